@@ -57,12 +57,29 @@ func resize(slice []byte, size int64, zeroinit bool) []byte {
 	return slice
 }
 
+// Files are sparse: a block that has never been written is a hole.
+const blocksize = 4096
+
+func resizeBmap(bmap []bool, size int64) []bool {
+	n := int((size + blocksize - 1) / blocksize)
+	if n <= len(bmap) {
+		return bmap[:n]
+	}
+	return append(bmap, make([]bool, n-len(bmap))...)
+}
+
+func markBmap(bmap []bool, ofst int64, endofst int64) {
+	for i := ofst / blocksize; (endofst+blocksize-1)/blocksize > i; i++ {
+		bmap[i] = true
+	}
+}
+
 type node_t struct {
-	stat    fuse.Stat_t
-	xatr    map[string][]byte
-	chld    map[string]*node_t
-	data    []byte
-	opencnt int
+	stat fuse.Stat_t
+	xatr map[string][]byte
+	chld map[string]*node_t
+	data []byte
+	bmap []bool
 }
 
 func newNode(dev uint64, ino uint64, mode uint32, uid uint32, gid uint32) *node_t {
@@ -84,7 +101,7 @@ func newNode(dev uint64, ino uint64, mode uint32, uid uint32, gid uint32) *node_
 		nil,
 		nil,
 		nil,
-		0}
+		nil}
 	if fuse.S_IFDIR == self.stat.Mode&fuse.S_IFMT {
 		self.chld = map[string]*node_t{}
 	}
@@ -96,7 +113,16 @@ type Memfs struct {
 	lock    sync.Mutex
 	ino     uint64
 	root    *node_t
-	openmap map[uint64]*node_t
+	openmap fuse.HandleTable[*node_t]
+	locks   fuse.LockManager
+	flocks  fuse.LockManager
+}
+
+func (self *Memfs) Destroy() {
+	defer trace()()
+	if leaked := self.openmap.Destroy(); 0 < len(leaked) {
+		fmt.Fprintf(os.Stderr, "memfs: %v handles were not released\n", len(leaked))
+	}
 }
 
 func (self *Memfs) Mknod(path string, mode uint32, dev uint64) (errc int) {
@@ -266,6 +292,7 @@ func (self *Memfs) Truncate(path string, size int64, fh uint64) (errc int) {
 		return -fuse.ENOENT
 	}
 	node.data = resize(node.data, size, true)
+	node.bmap = resizeBmap(node.bmap, size)
 	node.stat.Size = size
 	tmsp := fuse.Now()
 	node.stat.Ctim = tmsp
@@ -302,9 +329,11 @@ func (self *Memfs) Write(path string, buff []byte, ofst int64, fh uint64) (n int
 	endofst := ofst + int64(len(buff))
 	if endofst > node.stat.Size {
 		node.data = resize(node.data, endofst, true)
+		node.bmap = resizeBmap(node.bmap, endofst)
 		node.stat.Size = endofst
 	}
 	n = copy(node.data[ofst:endofst], buff)
+	markBmap(node.bmap, ofst, endofst)
 	tmsp := fuse.Now()
 	node.stat.Ctim = tmsp
 	node.stat.Mtim = tmsp
@@ -329,7 +358,7 @@ func (self *Memfs) Readdir(path string,
 	fh uint64) (errc int) {
 	defer trace(path, fill, ofst, fh)(&errc)
 	defer self.synchronize()()
-	node := self.openmap[fh]
+	node, _ := self.openmap.Get(fh)
 	fill(".", &node.stat, 0)
 	fill("..", nil, 0)
 	for name, chld := range node.chld {
@@ -458,6 +487,46 @@ func (self *Memfs) Setchgtime(path string, tmsp fuse.Timespec) (errc int) {
 	return 0
 }
 
+func (self *Memfs) Lock(path string, cmd int, lock *fuse.Lock_t, fh uint64) (errc int) {
+	defer trace(path, cmd, lock, fh)(&errc)
+	self.lock.Lock()
+	node := self.getNode(path, fh)
+	self.lock.Unlock()
+	if nil == node {
+		return -fuse.ENOENT
+	}
+	// F_SETLKW may block, so do not hold the file system lock while locking; it returns
+	// -EINTR if the kernel interrupts it
+	return self.locks.LockKeyContext(fuse.Context(), node.stat.Ino, cmd, lock)
+}
+
+func (self *Memfs) Flock(path string, op int, owner uint64, fh uint64) (errc int) {
+	defer trace(path, op, owner, fh)(&errc)
+	self.lock.Lock()
+	node := self.getNode(path, fh)
+	self.lock.Unlock()
+	if nil == node {
+		return -fuse.ENOENT
+	}
+	// BSD locks are whole-file locks that are independent of POSIX record locks
+	lock := fuse.Lock_t{Whence: fuse.SEEK_SET, Owner: owner}
+	switch op &^ fuse.LOCK_NB {
+	case fuse.LOCK_SH:
+		lock.Type = fuse.F_RDLCK
+	case fuse.LOCK_EX:
+		lock.Type = fuse.F_WRLCK
+	case fuse.LOCK_UN:
+		lock.Type = fuse.F_UNLCK
+	default:
+		return -fuse.EINVAL
+	}
+	cmd := fuse.F_SETLKW
+	if 0 != op&fuse.LOCK_NB {
+		cmd = fuse.F_SETLK
+	}
+	return self.flocks.LockKeyContext(fuse.Context(), node.stat.Ino, cmd, &lock)
+}
+
 func (self *Memfs) lookupNode(path string, ancestor *node_t) (prnt *node_t, name string, node *node_t) {
 	prnt = self.root
 	name = ""
@@ -529,36 +598,31 @@ func (self *Memfs) removeNode(path string, dir bool) int {
 func (self *Memfs) openNode(path string, dir bool) (int, uint64) {
 	_, _, node := self.lookupNode(path, nil)
 	if nil == node {
-		return -fuse.ENOENT, ^uint64(0)
+		return -fuse.ENOENT, fuse.InvalidHandle
 	}
 	if !dir && fuse.S_IFDIR == node.stat.Mode&fuse.S_IFMT {
-		return -fuse.EISDIR, ^uint64(0)
+		return -fuse.EISDIR, fuse.InvalidHandle
 	}
 	if dir && fuse.S_IFDIR != node.stat.Mode&fuse.S_IFMT {
-		return -fuse.ENOTDIR, ^uint64(0)
-	}
-	node.opencnt++
-	if 1 == node.opencnt {
-		self.openmap[node.stat.Ino] = node
+		return -fuse.ENOTDIR, fuse.InvalidHandle
 	}
-	return 0, node.stat.Ino
+	return 0, self.openmap.New(node)
 }
 
 func (self *Memfs) closeNode(fh uint64) int {
-	node := self.openmap[fh]
-	node.opencnt--
-	if 0 == node.opencnt {
-		delete(self.openmap, node.stat.Ino)
+	if _, _, ok := self.openmap.Release(fh); !ok {
+		return -fuse.EBADF
 	}
 	return 0
 }
 
 func (self *Memfs) getNode(path string, fh uint64) *node_t {
-	if ^uint64(0) == fh {
+	if fuse.InvalidHandle == fh {
 		_, _, node := self.lookupNode(path, nil)
 		return node
 	} else {
-		return self.openmap[fh]
+		node, _ := self.openmap.Get(fh)
+		return node
 	}
 }
 
@@ -574,13 +638,14 @@ func NewMemfs() *Memfs {
 	defer self.synchronize()()
 	self.ino++
 	self.root = newNode(0, self.ino, fuse.S_IFDIR|00777, 0, 0)
-	self.openmap = map[uint64]*node_t{}
 	return &self
 }
 
 var _ fuse.FileSystemChflags = (*Memfs)(nil)
 var _ fuse.FileSystemSetcrtime = (*Memfs)(nil)
 var _ fuse.FileSystemSetchgtime = (*Memfs)(nil)
+var _ fuse.FileSystemLock = (*Memfs)(nil)
+var _ fuse.FileSystemFlock = (*Memfs)(nil)
 
 func main() {
 	memfs := NewMemfs()
@@ -55,6 +55,70 @@ func (self *Memfs) Rename3(oldpath string, newpath string, flags uint32) (errc i
 	return 0
 }
 
+func (self *Memfs) CopyFileRange(
+	pathIn string, fhIn uint64, ofstIn int64,
+	pathOut string, fhOut uint64, ofstOut int64,
+	size int64, flags int) (n int) {
+	defer trace(pathIn, fhIn, ofstIn, pathOut, fhOut, ofstOut, size, flags)(&n)
+	defer self.synchronize()()
+	if 0 != flags {
+		return -fuse.EINVAL
+	}
+	nodeIn := self.getNode(pathIn, fhIn)
+	nodeOut := self.getNode(pathOut, fhOut)
+	if nil == nodeIn || nil == nodeOut {
+		return -fuse.ENOENT
+	}
+	endofstIn := ofstIn + size
+	if endofstIn > nodeIn.stat.Size {
+		endofstIn = nodeIn.stat.Size
+	}
+	if endofstIn <= ofstIn {
+		return 0
+	}
+	endofstOut := ofstOut + (endofstIn - ofstIn)
+	if endofstOut > nodeOut.stat.Size {
+		nodeOut.data = resize(nodeOut.data, endofstOut, true)
+		nodeOut.bmap = resizeBmap(nodeOut.bmap, endofstOut)
+		nodeOut.stat.Size = endofstOut
+	}
+	n = copy(nodeOut.data[ofstOut:endofstOut], nodeIn.data[ofstIn:endofstIn])
+	markBmap(nodeOut.bmap, ofstOut, endofstOut)
+	tmsp := fuse.Now()
+	nodeIn.stat.Atim = tmsp
+	nodeOut.stat.Ctim = tmsp
+	nodeOut.stat.Mtim = tmsp
+	return
+}
+
+func (self *Memfs) Lseek(path string, ofst int64, whence int, fh uint64) (errc int, rofst int64) {
+	defer trace(path, ofst, whence, fh)(&errc, &rofst)
+	defer self.synchronize()()
+	node := self.getNode(path, fh)
+	if nil == node {
+		return -fuse.ENOENT, 0
+	}
+	if fuse.SEEK_DATA != whence && fuse.SEEK_HOLE != whence {
+		return -fuse.EINVAL, 0
+	}
+	if 0 > ofst || ofst >= node.stat.Size {
+		return -fuse.ENXIO, 0
+	}
+	// SEEK_DATA looks for an allocated block, SEEK_HOLE for an unallocated one
+	for i := ofst / blocksize; int64(len(node.bmap)) > i; i++ {
+		if (fuse.SEEK_DATA == whence) == node.bmap[i] {
+			if ofst < i*blocksize {
+				ofst = i * blocksize
+			}
+			return 0, ofst
+		}
+	}
+	if fuse.SEEK_DATA == whence {
+		return -fuse.ENXIO, 0
+	}
+	return 0, node.stat.Size
+}
+
 func (self *Memfs) Chmod3(path string, mode uint32, fh uint64) (errc int) {
 	defer trace(path, mode, fh)(&errc)
 	defer self.synchronize()()
@@ -106,3 +170,5 @@ var _ fuse.FileSystemRename3 = (*Memfs)(nil)
 var _ fuse.FileSystemChmod3 = (*Memfs)(nil)
 var _ fuse.FileSystemChown3 = (*Memfs)(nil)
 var _ fuse.FileSystemRename3 = (*Memfs)(nil)
+var _ fuse.FileSystemCopyFileRange = (*Memfs)(nil)
+var _ fuse.FileSystemLseek = (*Memfs)(nil)
@@ -1,5 +1,5 @@
-//go:build windows
-// +build windows
+//go:build windows || (linux && fuse3) || (linux && !cgo) || (linux && nocgo) || (freebsd && fuse3)
+// +build windows linux,fuse3 linux,!cgo linux,nocgo freebsd,fuse3
 
 /*
  * notifyfs.go
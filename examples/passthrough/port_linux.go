@@ -66,6 +66,68 @@ func copyFusestatFromGostat(dst *fuse.Stat_t, src *syscall.Stat_t) {
 	dst.Blocks = int64(src.Blocks)
 }
 
+func (self *Ptfs) Fallocate(path string, mode uint32, ofst int64, length int64, fh uint64) (errc int) {
+	defer trace(path, mode, ofst, length, fh)(&errc)
+	return errno(syscall.Fallocate(int(fh), mode, ofst, length))
+}
+
+func (self *Ptfs) ReadBuf(path string, size int, ofst int64, fh uint64) (errc int, bufs []fuse.Buf_t) {
+	defer trace(path, size, ofst, fh)(&errc)
+	// let the FUSE layer splice the data directly out of our file
+	return 0, []fuse.Buf_t{{
+		Size:  size,
+		Flags: fuse.BUF_IS_FD | fuse.BUF_FD_SEEK,
+		Fd:    int(fh),
+		Pos:   ofst,
+	}}
+}
+
+func (self *Ptfs) WriteBuf(path string, bufs []fuse.Buf_t, ofst int64, fh uint64) (n int) {
+	defer trace(path, bufs, ofst, fh)(&n)
+	for _, buf := range bufs {
+		var m int
+		var e error
+		switch {
+		case 0 == buf.Flags&fuse.BUF_IS_FD:
+			m, e = syscall.Pwrite(int(fh), buf.Mem, ofst)
+		case 0 == buf.Flags&fuse.BUF_FD_SEEK:
+			// data is in a pipe; move it into our file without copying it
+			m, e = spliceAll(buf.Fd, int(fh), ofst, buf.Size)
+		default:
+			mem := make([]byte, buf.Size)
+			if m, e = syscall.Pread(buf.Fd, mem, buf.Pos); nil == e {
+				m, e = syscall.Pwrite(int(fh), mem[:m], ofst)
+			}
+		}
+		if nil != e {
+			if 0 == n {
+				return errno(e)
+			}
+			break
+		}
+		n += m
+		ofst += int64(m)
+		if m < buf.Size && 0 != buf.Flags&fuse.BUF_IS_FD {
+			break
+		}
+	}
+	return n
+}
+
+func spliceAll(rfd int, wfd int, ofst int64, size int) (n int, e error) {
+	for n < size {
+		m, e := syscall.Splice(rfd, nil, wfd, &ofst, size-n, 0)
+		if nil != e {
+			return n, e
+		}
+		if 0 == m {
+			break
+		}
+		n += int(m)
+	}
+	return n, nil
+}
+
 func syscall_Statfs(path string, stat *syscall.Statfs_t) error {
 	return syscall.Statfs(path, stat)
 }
@@ -0,0 +1,22 @@
+//go:build !cgo && !linux && !windows
+// +build !cgo,!linux,!windows
+
+/*
+ * cgo_required.go
+ *
+ * Copyright 2017-2022 Bill Zissimopoulos
+ */
+/*
+ * This file is part of Cgofuse.
+ *
+ * It is licensed under the MIT license. The full license text can be found
+ * in the License.txt file at the root of this project.
+ */
+
+package fuse
+
+// The !cgo variant exists only on Windows, where WinFsp is loaded dynamically, and on
+// Linux, where the FUSE kernel protocol is spoken directly. On macOS and the BSDs the FUSE
+// library can only be called through cgo, so make a CGO_ENABLED=0 build fail with an
+// error that says so rather than with a list of undefined names.
+type _ = CGO_ENABLED_0_is_supported_only_on_Linux_and_Windows
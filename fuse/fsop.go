@@ -14,17 +14,23 @@
 //
 // This packages supports both FUSE2 and FUSE3 on Linux and FUSE2 on Windows and macOS.
 // By default, cgofuse will link with FUSE2. To link with FUSE3, simply add '-tags=fuse3'
-// to your 'go build' flags.
+// to your 'go build' flags. On Linux, building with CGO_ENABLED=0 or '-tags=nocgo' selects
+// a variant that speaks the FUSE kernel protocol directly and does not need libfuse.
 //
 // A user mode file system is a user mode process that receives file system operations
 // from the OS FUSE layer and satisfies them in user mode. A user mode file system
 // implements the interface FileSystemInterface either directly or by embedding a
 // FileSystemBase struct which provides a default (empty) implementation of all methods
-// in FileSystemInterface.
+// in FileSystemInterface. A file system that needs information about the caller of each
+// operation (or that hands operations to other goroutines) can instead implement the
+// context-aware FileSystemInterfaceCtx or embed FileSystemBaseCtx. A file system that
+// prefers to return Go errors rather than FUSE error codes can implement
+// FileSystemInterfaceErr or embed FileSystemBaseErr.
 //
 // In order to expose the user mode file system to the OS, the file system must be hosted
 // (mounted) by a FileSystemHost. The FileSystemHost Mount() method is used for this
-// purpose.
+// purpose. Alternatively the FileSystemHost Start() method mounts the file system
+// without blocking and returns once the file system is ready.
 //
 // A note on thread-safety: In general FUSE file systems are expected to protect their
 // own data structures. Many FUSE implementations provide a -s command line option that
@@ -33,8 +39,11 @@
 package fuse
 
 import (
+	"io/fs"
+	"runtime"
 	"strconv"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -150,6 +159,45 @@ type Stat_t struct {
 	Flags uint32
 }
 
+// ConnInfo contains information about the connection between the FUSE layer and
+// the kernel. This structure is analogous to the FUSE struct fuse_conn_info.
+type ConnInfo struct {
+	// Major version of the FUSE protocol. [read-only]
+	ProtoMajor uint32
+
+	// Minor version of the FUSE protocol. [read-only]
+	ProtoMinor uint32
+
+	// Maximum size of a write request.
+	MaxWrite uint32
+
+	// Maximum size of a read request. [FUSE3 only]
+	MaxRead uint32
+
+	// Maximum readahead.
+	MaxReadahead uint32
+
+	// Capabilities supported by the kernel; a combination of CAP_* flags.
+	// [read-only; Linux and FreeBSD only]
+	Capable uint32
+
+	// Capabilities wanted by the file system; a combination of CAP_* flags.
+	// Capabilities that the kernel does not support are ignored.
+	// [Linux and FreeBSD only]
+	Want uint32
+
+	// Maximum number of pending background requests.
+	// [FUSE2 (2.9 or later) and FUSE3 on Linux and FreeBSD only]
+	MaxBackground uint32
+
+	// Number of pending background requests at which the kernel considers the
+	// file system congested. [FUSE2 (2.9 or later) and FUSE3 on Linux and FreeBSD only]
+	CongestionThreshold uint32
+
+	// Granularity of timestamps in nanoseconds. [FUSE3 only]
+	TimeGran uint32
+}
+
 // FileInfo_t contains open file information.
 // This structure is analogous to the FUSE struct fuse_file_info.
 type FileInfo_t struct {
@@ -169,14 +217,13 @@ type FileInfo_t struct {
 	Fh uint64
 }
 
-/*
 // Lock_t contains file locking information.
 // This structure is analogous to the POSIX struct flock.
 type Lock_t struct {
 	// Type of lock; F_RDLCK, F_WRLCK, F_UNLCK.
 	Type int16
 
-	// Flag for starting offset.
+	// Flag for starting offset; always SEEK_SET when received from the FUSE layer.
 	Whence int16
 
 	// Relative offset in bytes.
@@ -185,10 +232,88 @@ type Lock_t struct {
 	// Size; if 0 then until EOF.
 	Len int64
 
-	// Process ID of the process holding the lock
+	// Process ID of the process holding the lock.
 	Pid int
+
+	// Opaque identifier of the lock owner. [IGNORED when returned by F_GETLK]
+	Owner uint64
+}
+
+// Buf_t describes a data buffer that is either in memory or in a file.
+// This structure is analogous to the FUSE struct fuse_buf.
+type Buf_t struct {
+	// Size of data in bytes. [IGNORED for memory buffers returned by ReadBuf; len(Mem) is used]
+	Size int
+
+	// Buffer flags; a combination of BUF_IS_FD, BUF_FD_SEEK, BUF_FD_RETRY.
+	Flags uint32
+
+	// Memory buffer; used if BUF_IS_FD is not set.
+	Mem []byte
+
+	// File descriptor; used if BUF_IS_FD is set.
+	Fd int
+
+	// File position; used if BUF_FD_SEEK is set.
+	Pos int64
+}
+
+// IoctlCmd is an ioctl command number. The command number encodes the direction and
+// size of the data that accompany the command; use IO, IOR, IOW and IOWR to construct
+// command numbers in the same way as the C _IO, _IOR, _IOW and _IOWR macros.
+type IoctlCmd uint32
+
+func ioctlCmd(dir uint32, typ byte, nr byte, size int) IoctlCmd {
+	return IoctlCmd(dir | (uint32(size)&ioc_SIZEMASK)<<16 | uint32(typ)<<8 | uint32(nr))
+}
+
+// IO constructs an ioctl command number for a command without data.
+func IO(typ byte, nr byte) IoctlCmd {
+	return ioctlCmd(ioc_VOID, typ, nr, 0)
+}
+
+// IOR constructs an ioctl command number for a command that returns size bytes of data
+// to the caller.
+func IOR(typ byte, nr byte, size int) IoctlCmd {
+	return ioctlCmd(ioc_OUT, typ, nr, size)
+}
+
+// IOW constructs an ioctl command number for a command that passes size bytes of data
+// from the caller.
+func IOW(typ byte, nr byte, size int) IoctlCmd {
+	return ioctlCmd(ioc_IN, typ, nr, size)
+}
+
+// IOWR constructs an ioctl command number for a command that passes size bytes of data
+// from the caller and returns size bytes of data to the caller.
+func IOWR(typ byte, nr byte, size int) IoctlCmd {
+	return ioctlCmd(ioc_IN|ioc_OUT, typ, nr, size)
+}
+
+// Type returns the type (group) of the command.
+func (self IoctlCmd) Type() byte {
+	return byte(self >> 8)
+}
+
+// Nr returns the number of the command within its type.
+func (self IoctlCmd) Nr() byte {
+	return byte(self)
+}
+
+// Size returns the size of the data of the command.
+func (self IoctlCmd) Size() int {
+	return int(uint32(self) >> 16 & ioc_SIZEMASK)
+}
+
+// In reports whether the command passes data from the caller (IOW and IOWR).
+func (self IoctlCmd) In() bool {
+	return 0 != uint32(self)&ioc_IN
+}
+
+// Out reports whether the command returns data to the caller (IOR and IOWR).
+func (self IoctlCmd) Out() bool {
+	return 0 != uint32(self)&ioc_OUT
 }
-*/
 
 // FileSystemInterface is the interface that a user mode file system must implement.
 //
@@ -282,9 +407,6 @@ type FileSystemInterface interface {
 	// Fsync synchronizes file contents.
 	Fsync(path string, datasync bool, fh uint64) int
 
-	// Lock performs a file locking operation.
-	//Lock(path string, cmd int, lock *Lock_t, fh uint64) int
-
 	// Opendir opens a directory.
 	Opendir(path string) (int, uint64)
 
@@ -313,6 +435,18 @@ type FileSystemInterface interface {
 	Listxattr(path string, fill func(name string) bool) int
 }
 
+// FileSystemInitEx is the interface that wraps the InitEx method.
+//
+// InitEx is similar to Init except that it receives information about the connection
+// to the kernel. The file system may inspect the protocol version and the capabilities
+// that the kernel supports, choose the capabilities that it wants and tune connection
+// parameters such as MaxWrite. On entry conn.Want contains the capabilities that the host
+// has already chosen (for example CAP_POSIX_LOCKS when the file system implements Lock).
+// When a file system implements InitEx, Init is not called.
+type FileSystemInitEx interface {
+	InitEx(conn *ConnInfo)
+}
+
 // FileSystemOpenEx is the interface that wraps the OpenEx and CreateEx methods.
 //
 // OpenEx and CreateEx are similar to Open and Create except that they allow
@@ -375,6 +509,22 @@ type FileSystemUtimens3 interface {
 	Utimens3(path string, tmsp []Timespec, fh uint64) int
 }
 
+// FileSystemReaddir3 is the interface that wraps the FUSE3 Readdir method.
+//
+// Readdir3 is similar to Readdir except that it includes flags that are
+// available only under FUSE3. If the flags include READDIR_PLUS the kernel has
+// asked for full stat information, which the file system should pass to fill;
+// otherwise the file system may pass nil stat to fill. Note that libfuse forwards
+// stat information to the kernel only if the file system passes non-zero offsets
+// to fill (see SetCapReaddirPlus).
+type FileSystemReaddir3 interface {
+	Readdir3(path string,
+		fill func(name string, stat *Stat_t, ofst int64) bool,
+		ofst int64,
+		fh uint64,
+		flags uint32) int
+}
+
 // FileSystemRename3 is the interface that wraps the FUSE3 Rename method.
 //
 // Rename3 is similar to Rename except that it includes flags that are
@@ -383,6 +533,135 @@ type FileSystemRename3 interface {
 	Rename3(oldpath string, newpath string, flags uint32) int
 }
 
+// FileSystemLock is the interface that wraps the Lock method.
+//
+// Lock performs a POSIX record (byte-range) locking operation. The cmd is one of
+// F_GETLK, F_SETLK or F_SETLKW. For F_GETLK the file system must report a conflicting
+// lock in lock, or set lock.Type to F_UNLCK if there is none. For F_SETLK the file system
+// must return -EAGAIN if the lock cannot be acquired. For F_SETLKW the file system should
+// wait until the lock can be acquired.
+//
+// Locks are owned by lock.Owner rather than by a process or a file handle. The FUSE layer
+// releases the locks of an owner by sending an F_UNLCK request when the owner closes the
+// file. A LockManager may be used to implement Lock. [FUSE2 and FUSE3 only; not Windows]
+type FileSystemLock interface {
+	Lock(path string, cmd int, lock *Lock_t, fh uint64) int
+}
+
+// FileSystemFlock is the interface that wraps the Flock method.
+//
+// Flock performs a BSD flock(2) locking operation. The op is one of LOCK_SH, LOCK_EX or
+// LOCK_UN, optionally combined with LOCK_NB. If LOCK_NB is specified and the lock cannot
+// be acquired the file system must return -EAGAIN; otherwise it should wait until the lock
+// can be acquired. BSD locks apply to the whole file and are independent of POSIX record
+// locks.
+//
+// Locks are owned by owner, which identifies the open file (rather than a process). The
+// FUSE layer releases the lock of an owner by sending LOCK_UN when the file is released.
+// [FUSE2 (2.9 or later) and FUSE3 on Linux and FreeBSD only]
+type FileSystemFlock interface {
+	Flock(path string, op int, owner uint64, fh uint64) int
+}
+
+// FileSystemFallocate is the interface that wraps the Fallocate method.
+//
+// Fallocate manipulates the allocated disk space of a file. If mode is 0 the file system
+// must allocate space for the range [ofst, ofst+length) and extend the file size if
+// necessary. Otherwise mode is a combination of FALLOC_FL_* flags as in Linux
+// fallocate(2). For example, FALLOC_FL_PUNCH_HOLE|FALLOC_FL_KEEP_SIZE deallocates the
+// range, which subsequently reads as zeroes. The file system should return -EOPNOTSUPP
+// for modes that it does not support.
+// [FUSE2 (2.9 or later) and FUSE3 on Linux and FreeBSD only]
+type FileSystemFallocate interface {
+	Fallocate(path string, mode uint32, ofst int64, length int64, fh uint64) int
+}
+
+// FileSystemCopyFileRange is the interface that wraps the CopyFileRange method.
+//
+// CopyFileRange copies up to size bytes from the file pathIn (open as fhIn) at offset
+// ofstIn to the file pathOut (open as fhOut) at offset ofstOut, without passing the data
+// through the caller. The flags are those of copy_file_range(2) and are currently always
+// 0. CopyFileRange returns the number of bytes copied or a negative error code; if it
+// returns -ENOSYS or -EOPNOTSUPP the kernel falls back to copying the data using reads
+// and writes. [FUSE3 only]
+type FileSystemCopyFileRange interface {
+	CopyFileRange(
+		pathIn string, fhIn uint64, ofstIn int64,
+		pathOut string, fhOut uint64, ofstOut int64,
+		size int64, flags int) int
+}
+
+// FileSystemLseek is the interface that wraps the Lseek method.
+//
+// Lseek finds data or holes in a sparse file. The whence is SEEK_DATA or SEEK_HOLE
+// (other values are handled by the kernel). For SEEK_DATA the file system must return
+// the first offset greater or equal to ofst that contains data; for SEEK_HOLE the first
+// offset greater or equal to ofst that is in a hole, where the end of the file counts as
+// a hole. It must return -ENXIO if ofst is beyond the end of the file or if there is no
+// data after ofst. [FUSE3 (3.8 or later) only]
+type FileSystemLseek interface {
+	Lseek(path string, ofst int64, whence int, fh uint64) (int, int64)
+}
+
+// FileSystemIoctl is the interface that wraps the Ioctl method.
+//
+// Ioctl performs an ioctl command on an open file or directory. Only restricted ioctls
+// are supported: the FUSE layer transfers the data that the command number cmd
+// describes and nothing else. If cmd.In() is true, in contains the cmd.Size() bytes
+// passed by the caller. If cmd.Out() is true, out is a buffer of cmd.Size() bytes that
+// is returned to the caller; for IOWR commands in and out are the same buffer. The arg
+// is the argument value passed by the caller; for commands with data it is an address
+// in the caller's address space and cannot be dereferenced. The flags may include
+// IOCTL_COMPAT (caller is a 32-bit process) and IOCTL_DIR (fh is a directory handle).
+//
+// Ioctl returns a non-negative value that is returned to the caller or a negative error
+// code. It should return -ENOTTY for commands that it does not recognize.
+// [FUSE2 and FUSE3 on Linux and FreeBSD only]
+type FileSystemIoctl interface {
+	Ioctl(path string, cmd IoctlCmd, arg uint64, fh uint64, flags uint32,
+		in []byte, out []byte) int
+}
+
+// FileSystemPoll is the interface that wraps the Poll method.
+//
+// Poll reports the I/O readiness of an open file as a combination of the POLL* flags
+// (e.g. POLLIN|POLLOUT). If ph is not nil, the caller wishes to be notified when the
+// readiness of the file changes; the file system should keep ph and call ph.Notify
+// when this happens. A file system that receives a new PollHandle for a file may
+// Destroy the one it kept from a previous Poll call.
+// [FUSE2 and FUSE3 on Linux and FreeBSD only]
+type FileSystemPoll interface {
+	Poll(path string, ph *PollHandle, fh uint64) (int, uint32)
+}
+
+// FileSystemReadBuf is the interface that wraps the ReadBuf method.
+//
+// ReadBuf reads data from a file starting at offset ofst. Unlike Read, ReadBuf returns
+// the data as a list of buffers that may refer to file descriptors (BUF_IS_FD) rather
+// than memory. This allows the FUSE layer to move data from a file descriptor to the
+// kernel using splice(2), without copying it through the file system. The buffers must
+// hold no more than size bytes in total; data in a file descriptor that lies beyond its
+// end of file is not transferred. The FUSE layer does not close file descriptors.
+//
+// If ReadBuf returns -ENOSYS the data is read using Read instead.
+// [FUSE2 (2.9 or later) and FUSE3 on Linux and FreeBSD only]
+type FileSystemReadBuf interface {
+	ReadBuf(path string, size int, ofst int64, fh uint64) (int, []Buf_t)
+}
+
+// FileSystemWriteBuf is the interface that wraps the WriteBuf method.
+//
+// WriteBuf writes the data in bufs to a file starting at offset ofst and returns the
+// number of bytes written. The buffers may refer to file descriptors (e.g. a pipe that
+// the FUSE layer has spliced the data into) rather than memory. Memory buffers are valid
+// only for the duration of the call.
+//
+// If WriteBuf returns -ENOSYS the data is written using Write instead.
+// [FUSE2 (2.9 or later) and FUSE3 on Linux and FreeBSD only]
+type FileSystemWriteBuf interface {
+	WriteBuf(path string, bufs []Buf_t, ofst int64, fh uint64) int
+}
+
 // Error encapsulates a FUSE error code. In some rare circumstances it is useful
 // to signal an error to the FUSE layer by boxing the error code using Error and
 // calling panic(). The FUSE layer will recover and report the boxed error code
@@ -418,6 +697,40 @@ func (self Error) GoString() string {
 	return self.Error()
 }
 
+// Is reports whether the error code matches target. It recognizes the io/fs sentinel
+// errors; for example, errors.Is(fuse.Error(-fuse.ENOENT), fs.ErrNotExist) is true.
+func (self Error) Is(target error) bool {
+	errc := int(self)
+	if 0 < errc {
+		errc = -errc
+	}
+	switch target {
+	case fs.ErrNotExist:
+		return -ENOENT == errc
+	case fs.ErrExist:
+		return -EEXIST == errc || -ENOTEMPTY == errc
+	case fs.ErrPermission:
+		return -EPERM == errc || -EACCES == errc
+	case fs.ErrInvalid:
+		return -EINVAL == errc
+	}
+	return false
+}
+
+// As converts the error code to a syscall.Errno if target is a *syscall.Errno
+// [not on Windows].
+func (self Error) As(target interface{}) bool {
+	if p, ok := target.(*syscall.Errno); ok && "windows" != runtime.GOOS {
+		errc := int(self)
+		if 0 > errc {
+			errc = -errc
+		}
+		*p = syscall.Errno(errc)
+		return true
+	}
+	return false
+}
+
 var _ error = (*Error)(nil)
 
 // FileSystemBase provides default implementations of the methods in FileSystemInterface.
@@ -570,14 +883,6 @@ func (*FileSystemBase) Fsync(path string, datasync bool, fh uint64) int {
 	return -ENOSYS
 }
 
-/*
-// Lock performs a file locking operation.
-// The FileSystemBase implementation returns -ENOSYS.
-func (*FileSystemBase) Lock(path string, cmd int, lock *Lock_t, fh uint64) int {
-	return -ENOSYS
-}
-*/
-
 // Opendir opens a directory.
 // The FileSystemBase implementation returns -ENOSYS.
 func (*FileSystemBase) Opendir(path string) (int, uint64) {
@@ -1,5 +1,6 @@
-//go:build cgo
+//go:build cgo && !(linux && nocgo)
 // +build cgo
+// +build !linux !nocgo
 
 /*
  * fsop_cgo.go
@@ -24,6 +25,12 @@ package fuse
 
 #include <errno.h>
 #include <fcntl.h>
+#include <poll.h>
+#include <sys/file.h>
+#include <unistd.h>
+#if defined(__linux__)
+#include <linux/falloc.h>
+#endif
 
 #elif defined(_WIN32)
 
@@ -154,6 +161,59 @@ package fuse
 #define XATTR_CREATE    1
 #define XATTR_REPLACE   2
 #endif
+
+#include <stdio.h>
+
+#if defined(_WIN32)
+#define LOCK_SH         1
+#define LOCK_EX         2
+#define LOCK_NB         4
+#define LOCK_UN         8
+#define POLLIN          0x0001
+#define POLLPRI         0x0002
+#define POLLOUT         0x0004
+#define POLLERR         0x0008
+#define POLLHUP         0x0010
+#define POLLNVAL        0x0020
+#define F_GETLK         5
+#define F_SETLK         6
+#define F_SETLKW        7
+#define F_RDLCK         0
+#define F_WRLCK         1
+#define F_UNLCK         2
+#endif
+
+#if defined(__linux__)
+#include <sys/ioctl.h>
+#define CGOFUSE_IOC_VOID                (_IOC_NONE << _IOC_DIRSHIFT)
+#define CGOFUSE_IOC_OUT                 (_IOC_READ << _IOC_DIRSHIFT)
+#define CGOFUSE_IOC_IN                  (_IOC_WRITE << _IOC_DIRSHIFT)
+#define CGOFUSE_IOC_SIZEMASK            _IOC_SIZEMASK
+#elif defined(__APPLE__) || defined(__FreeBSD__) || defined(__NetBSD__) || defined(__OpenBSD__)
+#include <sys/ioccom.h>
+#define CGOFUSE_IOC_VOID                IOC_VOID
+#define CGOFUSE_IOC_OUT                 IOC_OUT
+#define CGOFUSE_IOC_IN                  IOC_IN
+#define CGOFUSE_IOC_SIZEMASK            IOCPARM_MASK
+#elif defined(_WIN32)
+#define CGOFUSE_IOC_VOID                0x00000000U
+#define CGOFUSE_IOC_OUT                 0x80000000U
+#define CGOFUSE_IOC_IN                  0x40000000U
+#define CGOFUSE_IOC_SIZEMASK            0x3fff
+#endif
+
+#if !defined(SEEK_DATA)
+#define SEEK_DATA       3
+#define SEEK_HOLE       4
+#endif
+
+#if !defined(FALLOC_FL_KEEP_SIZE)
+#define FALLOC_FL_KEEP_SIZE             0x01
+#define FALLOC_FL_PUNCH_HOLE            0x02
+#define FALLOC_FL_COLLAPSE_RANGE        0x08
+#define FALLOC_FL_ZERO_RANGE            0x10
+#define FALLOC_FL_INSERT_RANGE          0x20
+#endif
 */
 import "C"
 
@@ -303,6 +363,108 @@ const (
 	XATTR_REPLACE = int(C.XATTR_REPLACE)
 )
 
+// Commands used in FileSystemLock.Lock.
+const (
+	F_GETLK  = C.F_GETLK
+	F_SETLK  = C.F_SETLK
+	F_SETLKW = C.F_SETLKW
+)
+
+// Operations used in FileSystemFlock.Flock.
+const (
+	LOCK_SH = C.LOCK_SH
+	LOCK_EX = C.LOCK_EX
+	LOCK_NB = C.LOCK_NB
+	LOCK_UN = C.LOCK_UN
+)
+
+// Flags used in FileSystemFallocate.Fallocate.
+const (
+	FALLOC_FL_KEEP_SIZE      = C.FALLOC_FL_KEEP_SIZE
+	FALLOC_FL_PUNCH_HOLE     = C.FALLOC_FL_PUNCH_HOLE
+	FALLOC_FL_COLLAPSE_RANGE = C.FALLOC_FL_COLLAPSE_RANGE
+	FALLOC_FL_ZERO_RANGE     = C.FALLOC_FL_ZERO_RANGE
+	FALLOC_FL_INSERT_RANGE   = C.FALLOC_FL_INSERT_RANGE
+)
+
+// Capabilities used in ConnInfo.
+const (
+	CAP_ASYNC_READ          = 1 << 0
+	CAP_POSIX_LOCKS         = 1 << 1
+	CAP_ATOMIC_O_TRUNC      = 1 << 3
+	CAP_EXPORT_SUPPORT      = 1 << 4
+	CAP_BIG_WRITES          = 1 << 5 // FUSE2 only
+	CAP_DONT_MASK           = 1 << 6
+	CAP_SPLICE_WRITE        = 1 << 7
+	CAP_SPLICE_MOVE         = 1 << 8
+	CAP_SPLICE_READ         = 1 << 9
+	CAP_FLOCK_LOCKS         = 1 << 10
+	CAP_IOCTL_DIR           = 1 << 11
+	CAP_AUTO_INVAL_DATA     = 1 << 12 // FUSE3 only
+	CAP_READDIRPLUS         = 1 << 13 // FUSE3 only
+	CAP_READDIRPLUS_AUTO    = 1 << 14 // FUSE3 only
+	CAP_ASYNC_DIO           = 1 << 15 // FUSE3 only
+	CAP_WRITEBACK_CACHE     = 1 << 16 // FUSE3 only
+	CAP_NO_OPEN_SUPPORT     = 1 << 17 // FUSE3 only
+	CAP_PARALLEL_DIROPS     = 1 << 18 // FUSE3 only
+	CAP_POSIX_ACL           = 1 << 19 // FUSE3 only
+	CAP_HANDLE_KILLPRIV     = 1 << 20 // FUSE3 only
+	CAP_CACHE_SYMLINKS      = 1 << 23 // FUSE3 only
+	CAP_NO_OPENDIR_SUPPORT  = 1 << 24 // FUSE3 only
+	CAP_EXPLICIT_INVAL_DATA = 1 << 25 // FUSE3 only
+)
+
+// Flags used in Buf_t.
+const (
+	BUF_IS_FD    = 1 << 1
+	BUF_FD_SEEK  = 1 << 2
+	BUF_FD_RETRY = 1 << 3
+)
+
+// Events reported by FileSystemPoll.Poll.
+const (
+	POLLIN   = C.POLLIN
+	POLLPRI  = C.POLLPRI
+	POLLOUT  = C.POLLOUT
+	POLLERR  = C.POLLERR
+	POLLHUP  = C.POLLHUP
+	POLLNVAL = C.POLLNVAL
+)
+
+// Flags used in FileSystemIoctl.Ioctl.
+const (
+	IOCTL_COMPAT = 1 << 0
+	IOCTL_DIR    = 1 << 4
+)
+
+// Ioctl command encoding used by IoctlCmd.
+const (
+	ioc_VOID     = C.CGOFUSE_IOC_VOID
+	ioc_OUT      = C.CGOFUSE_IOC_OUT
+	ioc_IN       = C.CGOFUSE_IOC_IN
+	ioc_SIZEMASK = C.CGOFUSE_IOC_SIZEMASK
+)
+
+// Lock types used in Lock_t.
+const (
+	F_RDLCK = C.F_RDLCK
+	F_WRLCK = C.F_WRLCK
+	F_UNLCK = C.F_UNLCK
+)
+
+// Whence values used in Lock_t.
+const (
+	SEEK_SET = C.SEEK_SET
+	SEEK_CUR = C.SEEK_CUR
+	SEEK_END = C.SEEK_END
+)
+
+// Whence values used in FileSystemLseek.Lseek.
+const (
+	SEEK_DATA = C.SEEK_DATA
+	SEEK_HOLE = C.SEEK_HOLE
+)
+
 // Flags used in Utimens and Utimens3.
 const (
 	UTIME_NOW  = (1 << 30) - 1
@@ -316,6 +478,11 @@ const (
 	RENAME_WHITEOUT  = 1 << 2
 )
 
+// Flags used in FileSystemReaddir3.Readdir3.
+const (
+	READDIR_PLUS = 1 << 0
+)
+
 // Notify actions.
 const (
 	NOTIFY_MKDIR    = 0x0001
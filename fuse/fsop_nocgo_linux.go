@@ -0,0 +1,298 @@
+//go:build linux && (!cgo || nocgo)
+// +build linux
+// +build !cgo nocgo
+
+/*
+ * fsop_nocgo_linux.go
+ *
+ * Copyright 2017-2022 Bill Zissimopoulos
+ */
+/*
+ * This file is part of Cgofuse.
+ *
+ * It is licensed under the MIT license. The full license text can be found
+ * in the License.txt file at the root of this project.
+ */
+
+package fuse
+
+import "syscall"
+
+// Error codes reported by FUSE file systems.
+const (
+	E2BIG           = int(syscall.E2BIG)
+	EACCES          = int(syscall.EACCES)
+	EADDRINUSE      = int(syscall.EADDRINUSE)
+	EADDRNOTAVAIL   = int(syscall.EADDRNOTAVAIL)
+	EAFNOSUPPORT    = int(syscall.EAFNOSUPPORT)
+	EAGAIN          = int(syscall.EAGAIN)
+	EALREADY        = int(syscall.EALREADY)
+	EBADF           = int(syscall.EBADF)
+	EBADMSG         = int(syscall.EBADMSG)
+	EBUSY           = int(syscall.EBUSY)
+	ECANCELED       = int(syscall.ECANCELED)
+	ECHILD          = int(syscall.ECHILD)
+	ECONNABORTED    = int(syscall.ECONNABORTED)
+	ECONNREFUSED    = int(syscall.ECONNREFUSED)
+	ECONNRESET      = int(syscall.ECONNRESET)
+	EDEADLK         = int(syscall.EDEADLK)
+	EDESTADDRREQ    = int(syscall.EDESTADDRREQ)
+	EDOM            = int(syscall.EDOM)
+	EEXIST          = int(syscall.EEXIST)
+	EFAULT          = int(syscall.EFAULT)
+	EFBIG           = int(syscall.EFBIG)
+	EHOSTUNREACH    = int(syscall.EHOSTUNREACH)
+	EIDRM           = int(syscall.EIDRM)
+	EILSEQ          = int(syscall.EILSEQ)
+	EINPROGRESS     = int(syscall.EINPROGRESS)
+	EINTR           = int(syscall.EINTR)
+	EINVAL          = int(syscall.EINVAL)
+	EIO             = int(syscall.EIO)
+	EISCONN         = int(syscall.EISCONN)
+	EISDIR          = int(syscall.EISDIR)
+	ELOOP           = int(syscall.ELOOP)
+	EMFILE          = int(syscall.EMFILE)
+	EMLINK          = int(syscall.EMLINK)
+	EMSGSIZE        = int(syscall.EMSGSIZE)
+	ENAMETOOLONG    = int(syscall.ENAMETOOLONG)
+	ENETDOWN        = int(syscall.ENETDOWN)
+	ENETRESET       = int(syscall.ENETRESET)
+	ENETUNREACH     = int(syscall.ENETUNREACH)
+	ENFILE          = int(syscall.ENFILE)
+	ENOATTR         = ENODATA
+	ENOBUFS         = int(syscall.ENOBUFS)
+	ENODATA         = int(syscall.ENODATA)
+	ENODEV          = int(syscall.ENODEV)
+	ENOENT          = int(syscall.ENOENT)
+	ENOEXEC         = int(syscall.ENOEXEC)
+	ENOLCK          = int(syscall.ENOLCK)
+	ENOLINK         = int(syscall.ENOLINK)
+	ENOMEM          = int(syscall.ENOMEM)
+	ENOMSG          = int(syscall.ENOMSG)
+	ENOPROTOOPT     = int(syscall.ENOPROTOOPT)
+	ENOSPC          = int(syscall.ENOSPC)
+	ENOSR           = int(syscall.ENOSR)
+	ENOSTR          = int(syscall.ENOSTR)
+	ENOSYS          = int(syscall.ENOSYS)
+	ENOTCONN        = int(syscall.ENOTCONN)
+	ENOTDIR         = int(syscall.ENOTDIR)
+	ENOTEMPTY       = int(syscall.ENOTEMPTY)
+	ENOTRECOVERABLE = int(syscall.ENOTRECOVERABLE)
+	ENOTSOCK        = int(syscall.ENOTSOCK)
+	ENOTSUP         = int(syscall.ENOTSUP)
+	ENOTTY          = int(syscall.ENOTTY)
+	ENXIO           = int(syscall.ENXIO)
+	EOPNOTSUPP      = int(syscall.EOPNOTSUPP)
+	EOVERFLOW       = int(syscall.EOVERFLOW)
+	EOWNERDEAD      = int(syscall.EOWNERDEAD)
+	EPERM           = int(syscall.EPERM)
+	EPIPE           = int(syscall.EPIPE)
+	EPROTO          = int(syscall.EPROTO)
+	EPROTONOSUPPORT = int(syscall.EPROTONOSUPPORT)
+	EPROTOTYPE      = int(syscall.EPROTOTYPE)
+	ERANGE          = int(syscall.ERANGE)
+	EROFS           = int(syscall.EROFS)
+	ESPIPE          = int(syscall.ESPIPE)
+	ESRCH           = int(syscall.ESRCH)
+	ETIME           = int(syscall.ETIME)
+	ETIMEDOUT       = int(syscall.ETIMEDOUT)
+	ETXTBSY         = int(syscall.ETXTBSY)
+	EWOULDBLOCK     = int(syscall.EWOULDBLOCK)
+	EXDEV           = int(syscall.EXDEV)
+)
+
+// Flags used in FileSystemInterface.Create and FileSystemInterface.Open.
+const (
+	O_RDONLY  = syscall.O_RDONLY
+	O_WRONLY  = syscall.O_WRONLY
+	O_RDWR    = syscall.O_RDWR
+	O_APPEND  = syscall.O_APPEND
+	O_CREAT   = syscall.O_CREAT
+	O_EXCL    = syscall.O_EXCL
+	O_TRUNC   = syscall.O_TRUNC
+	O_ACCMODE = syscall.O_ACCMODE
+)
+
+// File type and permission bits.
+const (
+	S_IFMT   = 0170000
+	S_IFBLK  = 0060000
+	S_IFCHR  = 0020000
+	S_IFIFO  = 0010000
+	S_IFREG  = 0100000
+	S_IFDIR  = 0040000
+	S_IFLNK  = 0120000
+	S_IFSOCK = 0140000
+
+	S_IRWXU = 00700
+	S_IRUSR = 00400
+	S_IWUSR = 00200
+	S_IXUSR = 00100
+	S_IRWXG = 00070
+	S_IRGRP = 00040
+	S_IWGRP = 00020
+	S_IXGRP = 00010
+	S_IRWXO = 00007
+	S_IROTH = 00004
+	S_IWOTH = 00002
+	S_IXOTH = 00001
+	S_ISUID = 04000
+	S_ISGID = 02000
+	S_ISVTX = 01000
+)
+
+// BSD file flags (Windows file attributes).
+const (
+	UF_HIDDEN   = 0x00008000
+	UF_READONLY = 0x00001000
+	UF_SYSTEM   = 0x00000080
+	UF_ARCHIVE  = 0x00000800
+)
+
+// Access flags
+const (
+	F_OK      = 0
+	R_OK      = 4
+	W_OK      = 2
+	X_OK      = 1
+	DELETE_OK = 0x40000000 // Delete access check [Windows only]
+)
+
+// Options that control Setxattr operation.
+const (
+	XATTR_CREATE  = 1
+	XATTR_REPLACE = 2
+)
+
+// Commands used in FileSystemLock.Lock.
+const (
+	F_GETLK  = 5
+	F_SETLK  = 6
+	F_SETLKW = 7
+)
+
+// Operations used in FileSystemFlock.Flock.
+const (
+	LOCK_SH = syscall.LOCK_SH
+	LOCK_EX = syscall.LOCK_EX
+	LOCK_NB = syscall.LOCK_NB
+	LOCK_UN = syscall.LOCK_UN
+)
+
+// Flags used in FileSystemFallocate.Fallocate.
+const (
+	FALLOC_FL_KEEP_SIZE      = 0x01
+	FALLOC_FL_PUNCH_HOLE     = 0x02
+	FALLOC_FL_COLLAPSE_RANGE = 0x08
+	FALLOC_FL_ZERO_RANGE     = 0x10
+	FALLOC_FL_INSERT_RANGE   = 0x20
+)
+
+// Capabilities used in ConnInfo.
+const (
+	CAP_ASYNC_READ          = 1 << 0
+	CAP_POSIX_LOCKS         = 1 << 1
+	CAP_ATOMIC_O_TRUNC      = 1 << 3
+	CAP_EXPORT_SUPPORT      = 1 << 4
+	CAP_BIG_WRITES          = 1 << 5 // FUSE2 only
+	CAP_DONT_MASK           = 1 << 6
+	CAP_SPLICE_WRITE        = 1 << 7
+	CAP_SPLICE_MOVE         = 1 << 8
+	CAP_SPLICE_READ         = 1 << 9
+	CAP_FLOCK_LOCKS         = 1 << 10
+	CAP_IOCTL_DIR           = 1 << 11
+	CAP_AUTO_INVAL_DATA     = 1 << 12 // FUSE3 only
+	CAP_READDIRPLUS         = 1 << 13 // FUSE3 only
+	CAP_READDIRPLUS_AUTO    = 1 << 14 // FUSE3 only
+	CAP_ASYNC_DIO           = 1 << 15 // FUSE3 only
+	CAP_WRITEBACK_CACHE     = 1 << 16 // FUSE3 only
+	CAP_NO_OPEN_SUPPORT     = 1 << 17 // FUSE3 only
+	CAP_PARALLEL_DIROPS     = 1 << 18 // FUSE3 only
+	CAP_POSIX_ACL           = 1 << 19 // FUSE3 only
+	CAP_HANDLE_KILLPRIV     = 1 << 20 // FUSE3 only
+	CAP_CACHE_SYMLINKS      = 1 << 23 // FUSE3 only
+	CAP_NO_OPENDIR_SUPPORT  = 1 << 24 // FUSE3 only
+	CAP_EXPLICIT_INVAL_DATA = 1 << 25 // FUSE3 only
+)
+
+// Flags used in Buf_t.
+const (
+	BUF_IS_FD    = 1 << 1
+	BUF_FD_SEEK  = 1 << 2
+	BUF_FD_RETRY = 1 << 3
+)
+
+// Events reported by FileSystemPoll.Poll.
+const (
+	POLLIN   = 0x0001
+	POLLPRI  = 0x0002
+	POLLOUT  = 0x0004
+	POLLERR  = 0x0008
+	POLLHUP  = 0x0010
+	POLLNVAL = 0x0020
+)
+
+// Flags used in FileSystemIoctl.Ioctl.
+const (
+	IOCTL_COMPAT = 1 << 0
+	IOCTL_DIR    = 1 << 4
+)
+
+// Ioctl command encoding used by IoctlCmd.
+const (
+	ioc_VOID     = 0x00000000
+	ioc_OUT      = 0x80000000 // _IOC_READ
+	ioc_IN       = 0x40000000 // _IOC_WRITE
+	ioc_SIZEMASK = 0x3fff
+)
+
+// Lock types used in Lock_t.
+const (
+	F_RDLCK = syscall.F_RDLCK
+	F_WRLCK = syscall.F_WRLCK
+	F_UNLCK = syscall.F_UNLCK
+)
+
+// Whence values used in Lock_t.
+const (
+	SEEK_SET = 0
+	SEEK_CUR = 1
+	SEEK_END = 2
+)
+
+// Whence values used in FileSystemLseek.Lseek.
+const (
+	SEEK_DATA = 3
+	SEEK_HOLE = 4
+)
+
+// Flags used in Utimens and Utimens3.
+const (
+	UTIME_NOW  = (1 << 30) - 1
+	UTIME_OMIT = (1 << 30) - 2
+)
+
+// Flags used in FileSystemRename3.Rename3.
+const (
+	RENAME_NOREPLACE = 1 << 0
+	RENAME_EXCHANGE  = 1 << 1
+	RENAME_WHITEOUT  = 1 << 2
+)
+
+// Flags used in FileSystemReaddir3.Readdir3.
+const (
+	READDIR_PLUS = 1 << 0
+)
+
+// Notify actions.
+const (
+	NOTIFY_MKDIR    = 0x0001
+	NOTIFY_RMDIR    = 0x0002
+	NOTIFY_CREATE   = 0x0004
+	NOTIFY_UNLINK   = 0x0008
+	NOTIFY_CHMOD    = 0x0010
+	NOTIFY_CHOWN    = 0x0020
+	NOTIFY_UTIME    = 0x0040
+	NOTIFY_CHFLAGS  = 0x0080
+	NOTIFY_TRUNCATE = 0x0100
+)
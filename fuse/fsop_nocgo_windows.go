@@ -161,6 +161,108 @@ const (
 	XATTR_REPLACE = 2
 )
 
+// Commands used in FileSystemLock.Lock.
+const (
+	F_GETLK  = 5
+	F_SETLK  = 6
+	F_SETLKW = 7
+)
+
+// Operations used in FileSystemFlock.Flock.
+const (
+	LOCK_SH = 1
+	LOCK_EX = 2
+	LOCK_NB = 4
+	LOCK_UN = 8
+)
+
+// Flags used in FileSystemFallocate.Fallocate.
+const (
+	FALLOC_FL_KEEP_SIZE      = 0x01
+	FALLOC_FL_PUNCH_HOLE     = 0x02
+	FALLOC_FL_COLLAPSE_RANGE = 0x08
+	FALLOC_FL_ZERO_RANGE     = 0x10
+	FALLOC_FL_INSERT_RANGE   = 0x20
+)
+
+// Capabilities used in ConnInfo.
+const (
+	CAP_ASYNC_READ          = 1 << 0
+	CAP_POSIX_LOCKS         = 1 << 1
+	CAP_ATOMIC_O_TRUNC      = 1 << 3
+	CAP_EXPORT_SUPPORT      = 1 << 4
+	CAP_BIG_WRITES          = 1 << 5 // FUSE2 only
+	CAP_DONT_MASK           = 1 << 6
+	CAP_SPLICE_WRITE        = 1 << 7
+	CAP_SPLICE_MOVE         = 1 << 8
+	CAP_SPLICE_READ         = 1 << 9
+	CAP_FLOCK_LOCKS         = 1 << 10
+	CAP_IOCTL_DIR           = 1 << 11
+	CAP_AUTO_INVAL_DATA     = 1 << 12 // FUSE3 only
+	CAP_READDIRPLUS         = 1 << 13 // FUSE3 only
+	CAP_READDIRPLUS_AUTO    = 1 << 14 // FUSE3 only
+	CAP_ASYNC_DIO           = 1 << 15 // FUSE3 only
+	CAP_WRITEBACK_CACHE     = 1 << 16 // FUSE3 only
+	CAP_NO_OPEN_SUPPORT     = 1 << 17 // FUSE3 only
+	CAP_PARALLEL_DIROPS     = 1 << 18 // FUSE3 only
+	CAP_POSIX_ACL           = 1 << 19 // FUSE3 only
+	CAP_HANDLE_KILLPRIV     = 1 << 20 // FUSE3 only
+	CAP_CACHE_SYMLINKS      = 1 << 23 // FUSE3 only
+	CAP_NO_OPENDIR_SUPPORT  = 1 << 24 // FUSE3 only
+	CAP_EXPLICIT_INVAL_DATA = 1 << 25 // FUSE3 only
+)
+
+// Flags used in Buf_t.
+const (
+	BUF_IS_FD    = 1 << 1
+	BUF_FD_SEEK  = 1 << 2
+	BUF_FD_RETRY = 1 << 3
+)
+
+// Events reported by FileSystemPoll.Poll.
+const (
+	POLLIN   = 0x0001
+	POLLPRI  = 0x0002
+	POLLOUT  = 0x0004
+	POLLERR  = 0x0008
+	POLLHUP  = 0x0010
+	POLLNVAL = 0x0020
+)
+
+// Flags used in FileSystemIoctl.Ioctl.
+const (
+	IOCTL_COMPAT = 1 << 0
+	IOCTL_DIR    = 1 << 4
+)
+
+// Ioctl command encoding used by IoctlCmd.
+const (
+	ioc_VOID     = 0x00000000
+	ioc_OUT      = 0x80000000
+	ioc_IN       = 0x40000000
+	ioc_SIZEMASK = 0x3fff
+)
+
+// Lock types used in Lock_t.
+const (
+	F_RDLCK = 0
+	F_WRLCK = 1
+	F_UNLCK = 2
+)
+
+// Whence values used in Lock_t.
+const (
+	SEEK_SET = 0
+	SEEK_CUR = 1
+	SEEK_END = 2
+)
+
+// Whence values used in FileSystemLseek.Lseek.
+const (
+	SEEK_DATA = 3
+	SEEK_HOLE = 4
+)
+
 // Flags used in Utimens and Utimens3.
 const (
 	UTIME_NOW  = (1 << 30) - 1
@@ -174,6 +276,11 @@ const (
 	RENAME_WHITEOUT  = 1 << 2
 )
 
+// Flags used in FileSystemReaddir3.Readdir3.
+const (
+	READDIR_PLUS = 1 << 0
+)
+
 // Notify actions.
 const (
 	NOTIFY_MKDIR    = 0x0001
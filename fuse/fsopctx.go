@@ -0,0 +1,538 @@
+/*
+ * fsopctx.go
+ *
+ * Copyright 2017-2022 Bill Zissimopoulos
+ */
+/*
+ * This file is part of Cgofuse.
+ *
+ * It is licensed under the MIT license. The full license text can be found
+ * in the License.txt file at the root of this project.
+ */
+
+package fuse
+
+import (
+	"context"
+)
+
+// OpContext contains information about the process that issued a file system operation.
+// A file system that implements FileSystemInterfaceCtx can retrieve it from the context
+// that it receives with each operation using GetOpContext.
+type OpContext struct {
+	// User ID of the calling process.
+	Uid uint32
+
+	// Group ID of the calling process.
+	Gid uint32
+
+	// Process ID of the calling process.
+	Pid int
+
+	// Umask of the calling process. It is set only for operations that create files
+	// (Mknod, Mkdir, Create) and only when the FUSE layer supports it.
+	Umask uint32
+
+	groups func() []uint32
+}
+
+// Groups returns the supplementary groups of the calling process. Retrieving them is
+// expensive (the FUSE library reads them from /proc), so this is done only when Groups
+// is first called and only if it is called from the goroutine that runs the file system
+// operation while the operation is running; otherwise Groups returns the groups that
+// were retrieved earlier or nil. [High-level FUSE on Linux and FreeBSD only]
+func (self *OpContext) Groups() []uint32 {
+	if nil == self.groups {
+		return nil
+	}
+	return self.groups()
+}
+
+type opContextKey struct{}
+
+// GetOpContext gets the OpContext that is carried by ctx.
+func GetOpContext(ctx context.Context) (opctx *OpContext, ok bool) {
+	opctx, ok = ctx.Value(opContextKey{}).(*OpContext)
+	return
+}
+
+// FileSystemInterfaceCtx is a variant of FileSystemInterface where every method receives
+// a context.Context as its first argument. The context carries an OpContext that
+// describes the calling process (see GetOpContext) and it is cancelled when the kernel
+// interrupts the operation (as detected by polling; see Context) or when the operation
+// completes.
+//
+// Unlike Getcontext, which must be called from the goroutine that runs the operation,
+// the context can be passed to other goroutines; although it is only useful for as
+// long as the operation is running.
+//
+// A file system that implements FileSystemInterfaceCtx is hosted by a FileSystemHost
+// created with NewFileSystemHostCtx. It may still implement the optional interfaces
+// (FileSystemOpenEx, FileSystemChmod3, FileSystemLock, FileSystemIoctl, etc.).
+//
+// Limitation: there are no context-taking variants of the optional interfaces; their
+// methods do not receive a context. They must call Context on the goroutine that runs
+// the operation, before passing the context to other goroutines.
+type FileSystemInterfaceCtx interface {
+	// Init is called when the file system is created.
+	Init(ctx context.Context)
+
+	// Destroy is called when the file system is destroyed.
+	Destroy(ctx context.Context)
+
+	// Statfs gets file system statistics.
+	Statfs(ctx context.Context, path string, stat *Statfs_t) int
+
+	// Mknod creates a file node.
+	Mknod(ctx context.Context, path string, mode uint32, dev uint64) int
+
+	// Mkdir creates a directory.
+	Mkdir(ctx context.Context, path string, mode uint32) int
+
+	// Unlink removes a file.
+	Unlink(ctx context.Context, path string) int
+
+	// Rmdir removes a directory.
+	Rmdir(ctx context.Context, path string) int
+
+	// Link creates a hard link to a file.
+	Link(ctx context.Context, oldpath string, newpath string) int
+
+	// Symlink creates a symbolic link.
+	Symlink(ctx context.Context, target string, newpath string) int
+
+	// Readlink reads the target of a symbolic link.
+	Readlink(ctx context.Context, path string) (int, string)
+
+	// Rename renames a file.
+	Rename(ctx context.Context, oldpath string, newpath string) int
+
+	// Chmod changes the permission bits of a file.
+	Chmod(ctx context.Context, path string, mode uint32) int
+
+	// Chown changes the owner and group of a file.
+	Chown(ctx context.Context, path string, uid uint32, gid uint32) int
+
+	// Utimens changes the access and modification times of a file.
+	Utimens(ctx context.Context, path string, tmsp []Timespec) int
+
+	// Access checks file access permissions.
+	Access(ctx context.Context, path string, mask uint32) int
+
+	// Create creates and opens a file.
+	// The flags are a combination of the fuse.O_* constants.
+	Create(ctx context.Context, path string, flags int, mode uint32) (int, uint64)
+
+	// Open opens a file.
+	// The flags are a combination of the fuse.O_* constants.
+	Open(ctx context.Context, path string, flags int) (int, uint64)
+
+	// Getattr gets file attributes.
+	Getattr(ctx context.Context, path string, stat *Stat_t, fh uint64) int
+
+	// Truncate changes the size of a file.
+	Truncate(ctx context.Context, path string, size int64, fh uint64) int
+
+	// Read reads data from a file.
+	Read(ctx context.Context, path string, buff []byte, ofst int64, fh uint64) int
+
+	// Write writes data to a file.
+	Write(ctx context.Context, path string, buff []byte, ofst int64, fh uint64) int
+
+	// Flush flushes cached file data.
+	Flush(ctx context.Context, path string, fh uint64) int
+
+	// Release closes an open file.
+	Release(ctx context.Context, path string, fh uint64) int
+
+	// Fsync synchronizes file contents.
+	Fsync(ctx context.Context, path string, datasync bool, fh uint64) int
+
+	// Opendir opens a directory.
+	Opendir(ctx context.Context, path string) (int, uint64)
+
+	// Readdir reads a directory.
+	Readdir(ctx context.Context, path string,
+		fill func(name string, stat *Stat_t, ofst int64) bool,
+		ofst int64,
+		fh uint64) int
+
+	// Releasedir closes an open directory.
+	Releasedir(ctx context.Context, path string, fh uint64) int
+
+	// Fsyncdir synchronizes directory contents.
+	Fsyncdir(ctx context.Context, path string, datasync bool, fh uint64) int
+
+	// Setxattr sets extended attributes.
+	Setxattr(ctx context.Context, path string, name string, value []byte, flags int) int
+
+	// Getxattr gets extended attributes.
+	Getxattr(ctx context.Context, path string, name string) (int, []byte)
+
+	// Removexattr removes extended attributes.
+	Removexattr(ctx context.Context, path string, name string) int
+
+	// Listxattr lists extended attributes.
+	Listxattr(ctx context.Context, path string, fill func(name string) bool) int
+}
+
+// FileSystemBaseCtx provides default implementations of the methods in
+// FileSystemInterfaceCtx. The default implementations are either empty or return -ENOSYS
+// to signal that the file system does not implement a particular operation to the FUSE
+// layer.
+type FileSystemBaseCtx struct {
+}
+
+// Init is called when the file system is created.
+// The FileSystemBaseCtx implementation does nothing.
+func (*FileSystemBaseCtx) Init(ctx context.Context) {
+}
+
+// Destroy is called when the file system is destroyed.
+// The FileSystemBaseCtx implementation does nothing.
+func (*FileSystemBaseCtx) Destroy(ctx context.Context) {
+}
+
+// Statfs gets file system statistics.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Statfs(ctx context.Context, path string, stat *Statfs_t) int {
+	return -ENOSYS
+}
+
+// Mknod creates a file node.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Mknod(ctx context.Context, path string, mode uint32, dev uint64) int {
+	return -ENOSYS
+}
+
+// Mkdir creates a directory.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Mkdir(ctx context.Context, path string, mode uint32) int {
+	return -ENOSYS
+}
+
+// Unlink removes a file.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Unlink(ctx context.Context, path string) int {
+	return -ENOSYS
+}
+
+// Rmdir removes a directory.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Rmdir(ctx context.Context, path string) int {
+	return -ENOSYS
+}
+
+// Link creates a hard link to a file.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Link(ctx context.Context, oldpath string, newpath string) int {
+	return -ENOSYS
+}
+
+// Symlink creates a symbolic link.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Symlink(ctx context.Context, target string, newpath string) int {
+	return -ENOSYS
+}
+
+// Readlink reads the target of a symbolic link.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Readlink(ctx context.Context, path string) (int, string) {
+	return -ENOSYS, ""
+}
+
+// Rename renames a file.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Rename(ctx context.Context, oldpath string, newpath string) int {
+	return -ENOSYS
+}
+
+// Chmod changes the permission bits of a file.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Chmod(ctx context.Context, path string, mode uint32) int {
+	return -ENOSYS
+}
+
+// Chown changes the owner and group of a file.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Chown(ctx context.Context, path string, uid uint32, gid uint32) int {
+	return -ENOSYS
+}
+
+// Utimens changes the access and modification times of a file.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Utimens(ctx context.Context, path string, tmsp []Timespec) int {
+	return -ENOSYS
+}
+
+// Access checks file access permissions.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Access(ctx context.Context, path string, mask uint32) int {
+	return -ENOSYS
+}
+
+// Create creates and opens a file.
+// The flags are a combination of the fuse.O_* constants.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Create(ctx context.Context, path string, flags int, mode uint32) (int, uint64) {
+	return -ENOSYS, ^uint64(0)
+}
+
+// Open opens a file.
+// The flags are a combination of the fuse.O_* constants.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Open(ctx context.Context, path string, flags int) (int, uint64) {
+	return -ENOSYS, ^uint64(0)
+}
+
+// Getattr gets file attributes.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Getattr(ctx context.Context, path string, stat *Stat_t, fh uint64) int {
+	return -ENOSYS
+}
+
+// Truncate changes the size of a file.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Truncate(ctx context.Context, path string, size int64, fh uint64) int {
+	return -ENOSYS
+}
+
+// Read reads data from a file.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Read(ctx context.Context, path string, buff []byte, ofst int64, fh uint64) int {
+	return -ENOSYS
+}
+
+// Write writes data to a file.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Write(ctx context.Context, path string, buff []byte, ofst int64, fh uint64) int {
+	return -ENOSYS
+}
+
+// Flush flushes cached file data.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Flush(ctx context.Context, path string, fh uint64) int {
+	return -ENOSYS
+}
+
+// Release closes an open file.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Release(ctx context.Context, path string, fh uint64) int {
+	return -ENOSYS
+}
+
+// Fsync synchronizes file contents.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Fsync(ctx context.Context, path string, datasync bool, fh uint64) int {
+	return -ENOSYS
+}
+
+// Opendir opens a directory.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Opendir(ctx context.Context, path string) (int, uint64) {
+	return -ENOSYS, ^uint64(0)
+}
+
+// Readdir reads a directory.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Readdir(ctx context.Context, path string,
+	fill func(name string, stat *Stat_t, ofst int64) bool,
+	ofst int64,
+	fh uint64) int {
+	return -ENOSYS
+}
+
+// Releasedir closes an open directory.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Releasedir(ctx context.Context, path string, fh uint64) int {
+	return -ENOSYS
+}
+
+// Fsyncdir synchronizes directory contents.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Fsyncdir(ctx context.Context, path string, datasync bool, fh uint64) int {
+	return -ENOSYS
+}
+
+// Setxattr sets extended attributes.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Setxattr(ctx context.Context, path string, name string, value []byte, flags int) int {
+	return -ENOSYS
+}
+
+// Getxattr gets extended attributes.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Getxattr(ctx context.Context, path string, name string) (int, []byte) {
+	return -ENOSYS, nil
+}
+
+// Removexattr removes extended attributes.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Removexattr(ctx context.Context, path string, name string) int {
+	return -ENOSYS
+}
+
+// Listxattr lists extended attributes.
+// The FileSystemBaseCtx implementation returns -ENOSYS.
+func (*FileSystemBaseCtx) Listxattr(ctx context.Context, path string, fill func(name string) bool) int {
+	return -ENOSYS
+}
+
+var _ FileSystemInterfaceCtx = (*FileSystemBaseCtx)(nil)
+
+// NewFileSystemCtxAdapter returns a FileSystemInterface that calls the methods of fsop
+// with the context that ctx returns, or with the context of the current file system
+// operation (see Context) if ctx is nil. It is the adapter that NewFileSystemHostCtx
+// uses, and it can be used to pass a FileSystemInterfaceCtx to code that accepts a
+// FileSystemInterface (for example the fusetest package). The optional interfaces
+// (FileSystemOpenEx, etc.) are implemented by fsop rather than by the adapter.
+func NewFileSystemCtxAdapter(fsop FileSystemInterfaceCtx,
+	ctx func() context.Context) FileSystemInterface {
+	return &fileSystemCtx{fsop: fsop, ctx: ctx}
+}
+
+// fileSystemCtx adapts a FileSystemInterfaceCtx to a FileSystemInterface.
+type fileSystemCtx struct {
+	fsop FileSystemInterfaceCtx
+	ctx  func() context.Context
+}
+
+func (self *fileSystemCtx) context() context.Context {
+	if nil != self.ctx {
+		return self.ctx()
+	}
+	return Context()
+}
+
+func (self *fileSystemCtx) Init() {
+	self.fsop.Init(self.context())
+}
+
+func (self *fileSystemCtx) Destroy() {
+	self.fsop.Destroy(self.context())
+}
+
+func (self *fileSystemCtx) Statfs(path string, stat *Statfs_t) int {
+	return self.fsop.Statfs(self.context(), path, stat)
+}
+
+func (self *fileSystemCtx) Mknod(path string, mode uint32, dev uint64) int {
+	return self.fsop.Mknod(self.context(), path, mode, dev)
+}
+
+func (self *fileSystemCtx) Mkdir(path string, mode uint32) int {
+	return self.fsop.Mkdir(self.context(), path, mode)
+}
+
+func (self *fileSystemCtx) Unlink(path string) int {
+	return self.fsop.Unlink(self.context(), path)
+}
+
+func (self *fileSystemCtx) Rmdir(path string) int {
+	return self.fsop.Rmdir(self.context(), path)
+}
+
+func (self *fileSystemCtx) Link(oldpath string, newpath string) int {
+	return self.fsop.Link(self.context(), oldpath, newpath)
+}
+
+func (self *fileSystemCtx) Symlink(target string, newpath string) int {
+	return self.fsop.Symlink(self.context(), target, newpath)
+}
+
+func (self *fileSystemCtx) Readlink(path string) (int, string) {
+	return self.fsop.Readlink(self.context(), path)
+}
+
+func (self *fileSystemCtx) Rename(oldpath string, newpath string) int {
+	return self.fsop.Rename(self.context(), oldpath, newpath)
+}
+
+func (self *fileSystemCtx) Chmod(path string, mode uint32) int {
+	return self.fsop.Chmod(self.context(), path, mode)
+}
+
+func (self *fileSystemCtx) Chown(path string, uid uint32, gid uint32) int {
+	return self.fsop.Chown(self.context(), path, uid, gid)
+}
+
+func (self *fileSystemCtx) Utimens(path string, tmsp []Timespec) int {
+	return self.fsop.Utimens(self.context(), path, tmsp)
+}
+
+func (self *fileSystemCtx) Access(path string, mask uint32) int {
+	return self.fsop.Access(self.context(), path, mask)
+}
+
+func (self *fileSystemCtx) Create(path string, flags int, mode uint32) (int, uint64) {
+	return self.fsop.Create(self.context(), path, flags, mode)
+}
+
+func (self *fileSystemCtx) Open(path string, flags int) (int, uint64) {
+	return self.fsop.Open(self.context(), path, flags)
+}
+
+func (self *fileSystemCtx) Getattr(path string, stat *Stat_t, fh uint64) int {
+	return self.fsop.Getattr(self.context(), path, stat, fh)
+}
+
+func (self *fileSystemCtx) Truncate(path string, size int64, fh uint64) int {
+	return self.fsop.Truncate(self.context(), path, size, fh)
+}
+
+func (self *fileSystemCtx) Read(path string, buff []byte, ofst int64, fh uint64) int {
+	return self.fsop.Read(self.context(), path, buff, ofst, fh)
+}
+
+func (self *fileSystemCtx) Write(path string, buff []byte, ofst int64, fh uint64) int {
+	return self.fsop.Write(self.context(), path, buff, ofst, fh)
+}
+
+func (self *fileSystemCtx) Flush(path string, fh uint64) int {
+	return self.fsop.Flush(self.context(), path, fh)
+}
+
+func (self *fileSystemCtx) Release(path string, fh uint64) int {
+	return self.fsop.Release(self.context(), path, fh)
+}
+
+func (self *fileSystemCtx) Fsync(path string, datasync bool, fh uint64) int {
+	return self.fsop.Fsync(self.context(), path, datasync, fh)
+}
+
+func (self *fileSystemCtx) Opendir(path string) (int, uint64) {
+	return self.fsop.Opendir(self.context(), path)
+}
+
+func (self *fileSystemCtx) Readdir(path string,
+	fill func(name string, stat *Stat_t, ofst int64) bool,
+	ofst int64,
+	fh uint64) int {
+	return self.fsop.Readdir(self.context(), path, fill, ofst, fh)
+}
+
+func (self *fileSystemCtx) Releasedir(path string, fh uint64) int {
+	return self.fsop.Releasedir(self.context(), path, fh)
+}
+
+func (self *fileSystemCtx) Fsyncdir(path string, datasync bool, fh uint64) int {
+	return self.fsop.Fsyncdir(self.context(), path, datasync, fh)
+}
+
+func (self *fileSystemCtx) Setxattr(path string, name string, value []byte, flags int) int {
+	return self.fsop.Setxattr(self.context(), path, name, value, flags)
+}
+
+func (self *fileSystemCtx) Getxattr(path string, name string) (int, []byte) {
+	return self.fsop.Getxattr(self.context(), path, name)
+}
+
+func (self *fileSystemCtx) Removexattr(path string, name string) int {
+	return self.fsop.Removexattr(self.context(), path, name)
+}
+
+func (self *fileSystemCtx) Listxattr(path string, fill func(name string) bool) int {
+	return self.fsop.Listxattr(self.context(), path, fill)
+}
+
+var _ FileSystemInterface = (*fileSystemCtx)(nil)
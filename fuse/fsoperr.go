@@ -0,0 +1,593 @@
+/*
+ * fsoperr.go
+ *
+ * Copyright 2017-2022 Bill Zissimopoulos
+ */
+/*
+ * This file is part of Cgofuse.
+ *
+ * It is licensed under the MIT license. The full license text can be found
+ * in the License.txt file at the root of this project.
+ */
+
+package fuse
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"runtime"
+	"sync"
+	"syscall"
+)
+
+// ErrnoMapper maps an error to a FUSE error code. It returns the NEGATIVE value of the
+// error code (for example -fuse.ENOENT) and true if it recognizes the error, or false
+// otherwise.
+type ErrnoMapper func(err error) (errc int, ok bool)
+
+var errnoMappers []ErrnoMapper
+var errnoMappersGuard sync.RWMutex
+
+// RegisterErrnoMapper registers a function that ErrnoFromError consults before its
+// built-in mappings. A file system can use it to map the error types of its backend
+// (for example the errors returned by a storage or network client). Mappers are
+// consulted in the reverse order of their registration.
+func RegisterErrnoMapper(mapper ErrnoMapper) {
+	errnoMappersGuard.Lock()
+	defer errnoMappersGuard.Unlock()
+	errnoMappers = append(errnoMappers, mapper)
+}
+
+// ErrnoFromError converts an error to a FUSE error code suitable for returning from a
+// FileSystemInterface method. It returns 0 for a nil error and the NEGATIVE value of an
+// error code otherwise. Errors are examined (including any errors that they wrap) in
+// the following order:
+//
+//   - fuse.Error: the boxed error code.
+//   - Errors recognized by a registered ErrnoMapper.
+//   - syscall.Errno: the same error code [not on Windows].
+//   - The io/fs sentinel errors ErrNotExist, ErrExist, ErrPermission, ErrInvalid and
+//     ErrClosed, and the os.ErrDeadlineExceeded, context.Canceled and
+//     context.DeadlineExceeded errors: ENOENT, EEXIST, EACCES, EINVAL, EBADF,
+//     ETIMEDOUT, EINTR and ETIMEDOUT respectively.
+//
+// Any other error is converted to -EIO.
+func ErrnoFromError(err error) int {
+	if nil == err {
+		return 0
+	}
+
+	var e Error
+	if errors.As(err, &e) {
+		if 0 < e {
+			return -int(e)
+		}
+		return int(e)
+	}
+
+	errnoMappersGuard.RLock()
+	mappers := errnoMappers
+	errnoMappersGuard.RUnlock()
+	for i := len(mappers) - 1; 0 <= i; i-- {
+		if errc, ok := mappers[i](err); ok {
+			return errc
+		}
+	}
+
+	if "windows" != runtime.GOOS {
+		var errno syscall.Errno
+		if errors.As(err, &errno) && 0 != errno {
+			return -int(errno)
+		}
+	}
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return -ENOENT
+	case errors.Is(err, fs.ErrExist):
+		return -EEXIST
+	case errors.Is(err, fs.ErrPermission):
+		return -EACCES
+	case errors.Is(err, fs.ErrInvalid):
+		return -EINVAL
+	case errors.Is(err, fs.ErrClosed):
+		return -EBADF
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return -ETIMEDOUT
+	case errors.Is(err, context.Canceled):
+		return -EINTR
+	case errors.Is(err, context.DeadlineExceeded):
+		return -ETIMEDOUT
+	}
+
+	return -EIO
+}
+
+// FileSystemInterfaceErr is a variant of FileSystemInterface where methods return a Go
+// error rather than a FUSE error code. Errors are converted to error codes using
+// ErrnoFromError; thus a file system can return the errors of its backend (for example
+// the errors returned by the os package) unchanged, or return a fuse.Error such as
+// fuse.Error(-fuse.ENOENT) to report a specific error code. Read and Write return the
+// number of bytes transferred in addition to an error.
+//
+// A file system that implements FileSystemInterfaceErr is hosted by a FileSystemHost
+// created with NewFileSystemHostErr. It may still implement the optional interfaces
+// (FileSystemOpenEx, FileSystemChmod3, etc.), whose methods return FUSE error codes.
+type FileSystemInterfaceErr interface {
+	// Init is called when the file system is created.
+	Init()
+
+	// Destroy is called when the file system is destroyed.
+	Destroy()
+
+	// Statfs gets file system statistics.
+	Statfs(path string, stat *Statfs_t) error
+
+	// Mknod creates a file node.
+	Mknod(path string, mode uint32, dev uint64) error
+
+	// Mkdir creates a directory.
+	Mkdir(path string, mode uint32) error
+
+	// Unlink removes a file.
+	Unlink(path string) error
+
+	// Rmdir removes a directory.
+	Rmdir(path string) error
+
+	// Link creates a hard link to a file.
+	Link(oldpath string, newpath string) error
+
+	// Symlink creates a symbolic link.
+	Symlink(target string, newpath string) error
+
+	// Readlink reads the target of a symbolic link.
+	Readlink(path string) (string, error)
+
+	// Rename renames a file.
+	Rename(oldpath string, newpath string) error
+
+	// Chmod changes the permission bits of a file.
+	Chmod(path string, mode uint32) error
+
+	// Chown changes the owner and group of a file.
+	Chown(path string, uid uint32, gid uint32) error
+
+	// Utimens changes the access and modification times of a file.
+	Utimens(path string, tmsp []Timespec) error
+
+	// Access checks file access permissions.
+	Access(path string, mask uint32) error
+
+	// Create creates and opens a file.
+	// The flags are a combination of the fuse.O_* constants.
+	Create(path string, flags int, mode uint32) (uint64, error)
+
+	// Open opens a file.
+	// The flags are a combination of the fuse.O_* constants.
+	Open(path string, flags int) (uint64, error)
+
+	// Getattr gets file attributes.
+	Getattr(path string, stat *Stat_t, fh uint64) error
+
+	// Truncate changes the size of a file.
+	Truncate(path string, size int64, fh uint64) error
+
+	// Read reads data from a file.
+	Read(path string, buff []byte, ofst int64, fh uint64) (int, error)
+
+	// Write writes data to a file.
+	Write(path string, buff []byte, ofst int64, fh uint64) (int, error)
+
+	// Flush flushes cached file data.
+	Flush(path string, fh uint64) error
+
+	// Release closes an open file.
+	Release(path string, fh uint64) error
+
+	// Fsync synchronizes file contents.
+	Fsync(path string, datasync bool, fh uint64) error
+
+	// Opendir opens a directory.
+	Opendir(path string) (uint64, error)
+
+	// Readdir reads a directory.
+	Readdir(path string,
+		fill func(name string, stat *Stat_t, ofst int64) bool,
+		ofst int64,
+		fh uint64) error
+
+	// Releasedir closes an open directory.
+	Releasedir(path string, fh uint64) error
+
+	// Fsyncdir synchronizes directory contents.
+	Fsyncdir(path string, datasync bool, fh uint64) error
+
+	// Setxattr sets extended attributes.
+	Setxattr(path string, name string, value []byte, flags int) error
+
+	// Getxattr gets extended attributes.
+	Getxattr(path string, name string) ([]byte, error)
+
+	// Removexattr removes extended attributes.
+	Removexattr(path string, name string) error
+
+	// Listxattr lists extended attributes.
+	Listxattr(path string, fill func(name string) bool) error
+}
+
+// FileSystemBaseErr provides default implementations of the methods in
+// FileSystemInterfaceErr. The default implementations are either empty or return
+// Error(-ENOSYS) to signal that the file system does not implement a particular
+// operation to the FUSE layer.
+type FileSystemBaseErr struct {
+}
+
+// Init is called when the file system is created.
+// The FileSystemBaseErr implementation does nothing.
+func (*FileSystemBaseErr) Init() {
+}
+
+// Destroy is called when the file system is destroyed.
+// The FileSystemBaseErr implementation does nothing.
+func (*FileSystemBaseErr) Destroy() {
+}
+
+// Statfs gets file system statistics.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Statfs(path string, stat *Statfs_t) error {
+	return Error(-ENOSYS)
+}
+
+// Mknod creates a file node.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Mknod(path string, mode uint32, dev uint64) error {
+	return Error(-ENOSYS)
+}
+
+// Mkdir creates a directory.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Mkdir(path string, mode uint32) error {
+	return Error(-ENOSYS)
+}
+
+// Unlink removes a file.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Unlink(path string) error {
+	return Error(-ENOSYS)
+}
+
+// Rmdir removes a directory.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Rmdir(path string) error {
+	return Error(-ENOSYS)
+}
+
+// Link creates a hard link to a file.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Link(oldpath string, newpath string) error {
+	return Error(-ENOSYS)
+}
+
+// Symlink creates a symbolic link.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Symlink(target string, newpath string) error {
+	return Error(-ENOSYS)
+}
+
+// Readlink reads the target of a symbolic link.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Readlink(path string) (string, error) {
+	return "", Error(-ENOSYS)
+}
+
+// Rename renames a file.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Rename(oldpath string, newpath string) error {
+	return Error(-ENOSYS)
+}
+
+// Chmod changes the permission bits of a file.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Chmod(path string, mode uint32) error {
+	return Error(-ENOSYS)
+}
+
+// Chown changes the owner and group of a file.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Chown(path string, uid uint32, gid uint32) error {
+	return Error(-ENOSYS)
+}
+
+// Utimens changes the access and modification times of a file.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Utimens(path string, tmsp []Timespec) error {
+	return Error(-ENOSYS)
+}
+
+// Access checks file access permissions.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Access(path string, mask uint32) error {
+	return Error(-ENOSYS)
+}
+
+// Create creates and opens a file.
+// The flags are a combination of the fuse.O_* constants.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Create(path string, flags int, mode uint32) (uint64, error) {
+	return ^uint64(0), Error(-ENOSYS)
+}
+
+// Open opens a file.
+// The flags are a combination of the fuse.O_* constants.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Open(path string, flags int) (uint64, error) {
+	return ^uint64(0), Error(-ENOSYS)
+}
+
+// Getattr gets file attributes.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Getattr(path string, stat *Stat_t, fh uint64) error {
+	return Error(-ENOSYS)
+}
+
+// Truncate changes the size of a file.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Truncate(path string, size int64, fh uint64) error {
+	return Error(-ENOSYS)
+}
+
+// Read reads data from a file.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Read(path string, buff []byte, ofst int64, fh uint64) (int, error) {
+	return 0, Error(-ENOSYS)
+}
+
+// Write writes data to a file.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Write(path string, buff []byte, ofst int64, fh uint64) (int, error) {
+	return 0, Error(-ENOSYS)
+}
+
+// Flush flushes cached file data.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Flush(path string, fh uint64) error {
+	return Error(-ENOSYS)
+}
+
+// Release closes an open file.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Release(path string, fh uint64) error {
+	return Error(-ENOSYS)
+}
+
+// Fsync synchronizes file contents.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Fsync(path string, datasync bool, fh uint64) error {
+	return Error(-ENOSYS)
+}
+
+// Opendir opens a directory.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Opendir(path string) (uint64, error) {
+	return ^uint64(0), Error(-ENOSYS)
+}
+
+// Readdir reads a directory.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Readdir(path string,
+	fill func(name string, stat *Stat_t, ofst int64) bool,
+	ofst int64,
+	fh uint64) error {
+	return Error(-ENOSYS)
+}
+
+// Releasedir closes an open directory.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Releasedir(path string, fh uint64) error {
+	return Error(-ENOSYS)
+}
+
+// Fsyncdir synchronizes directory contents.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Fsyncdir(path string, datasync bool, fh uint64) error {
+	return Error(-ENOSYS)
+}
+
+// Setxattr sets extended attributes.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Setxattr(path string, name string, value []byte, flags int) error {
+	return Error(-ENOSYS)
+}
+
+// Getxattr gets extended attributes.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Getxattr(path string, name string) ([]byte, error) {
+	return nil, Error(-ENOSYS)
+}
+
+// Removexattr removes extended attributes.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Removexattr(path string, name string) error {
+	return Error(-ENOSYS)
+}
+
+// Listxattr lists extended attributes.
+// The FileSystemBaseErr implementation returns Error(-ENOSYS).
+func (*FileSystemBaseErr) Listxattr(path string, fill func(name string) bool) error {
+	return Error(-ENOSYS)
+}
+
+var _ FileSystemInterfaceErr = (*FileSystemBaseErr)(nil)
+
+// NewFileSystemErrAdapter returns a FileSystemInterface that calls the methods of fsop
+// and converts the errors that they return to error codes with ErrnoFromError. It is the
+// adapter that NewFileSystemHostErr uses, and it can be used to pass a
+// FileSystemInterfaceErr to code that accepts a FileSystemInterface (for example the
+// fusetest package). The optional interfaces (FileSystemOpenEx, etc.) are implemented by
+// fsop rather than by the adapter.
+func NewFileSystemErrAdapter(fsop FileSystemInterfaceErr) FileSystemInterface {
+	return &fileSystemErr{fsop}
+}
+
+// fileSystemErr adapts a FileSystemInterfaceErr to a FileSystemInterface.
+type fileSystemErr struct {
+	fsop FileSystemInterfaceErr
+}
+
+func (self *fileSystemErr) Init() {
+	self.fsop.Init()
+}
+
+func (self *fileSystemErr) Destroy() {
+	self.fsop.Destroy()
+}
+
+func (self *fileSystemErr) Statfs(path string, stat *Statfs_t) int {
+	return ErrnoFromError(self.fsop.Statfs(path, stat))
+}
+
+func (self *fileSystemErr) Mknod(path string, mode uint32, dev uint64) int {
+	return ErrnoFromError(self.fsop.Mknod(path, mode, dev))
+}
+
+func (self *fileSystemErr) Mkdir(path string, mode uint32) int {
+	return ErrnoFromError(self.fsop.Mkdir(path, mode))
+}
+
+func (self *fileSystemErr) Unlink(path string) int {
+	return ErrnoFromError(self.fsop.Unlink(path))
+}
+
+func (self *fileSystemErr) Rmdir(path string) int {
+	return ErrnoFromError(self.fsop.Rmdir(path))
+}
+
+func (self *fileSystemErr) Link(oldpath string, newpath string) int {
+	return ErrnoFromError(self.fsop.Link(oldpath, newpath))
+}
+
+func (self *fileSystemErr) Symlink(target string, newpath string) int {
+	return ErrnoFromError(self.fsop.Symlink(target, newpath))
+}
+
+func (self *fileSystemErr) Readlink(path string) (int, string) {
+	target, err := self.fsop.Readlink(path)
+	return ErrnoFromError(err), target
+}
+
+func (self *fileSystemErr) Rename(oldpath string, newpath string) int {
+	return ErrnoFromError(self.fsop.Rename(oldpath, newpath))
+}
+
+func (self *fileSystemErr) Chmod(path string, mode uint32) int {
+	return ErrnoFromError(self.fsop.Chmod(path, mode))
+}
+
+func (self *fileSystemErr) Chown(path string, uid uint32, gid uint32) int {
+	return ErrnoFromError(self.fsop.Chown(path, uid, gid))
+}
+
+func (self *fileSystemErr) Utimens(path string, tmsp []Timespec) int {
+	return ErrnoFromError(self.fsop.Utimens(path, tmsp))
+}
+
+func (self *fileSystemErr) Access(path string, mask uint32) int {
+	return ErrnoFromError(self.fsop.Access(path, mask))
+}
+
+func (self *fileSystemErr) Create(path string, flags int, mode uint32) (int, uint64) {
+	fh, err := self.fsop.Create(path, flags, mode)
+	if nil != err {
+		return ErrnoFromError(err), ^uint64(0)
+	}
+	return 0, fh
+}
+
+func (self *fileSystemErr) Open(path string, flags int) (int, uint64) {
+	fh, err := self.fsop.Open(path, flags)
+	if nil != err {
+		return ErrnoFromError(err), ^uint64(0)
+	}
+	return 0, fh
+}
+
+func (self *fileSystemErr) Getattr(path string, stat *Stat_t, fh uint64) int {
+	return ErrnoFromError(self.fsop.Getattr(path, stat, fh))
+}
+
+func (self *fileSystemErr) Truncate(path string, size int64, fh uint64) int {
+	return ErrnoFromError(self.fsop.Truncate(path, size, fh))
+}
+
+func (self *fileSystemErr) Read(path string, buff []byte, ofst int64, fh uint64) int {
+	n, err := self.fsop.Read(path, buff, ofst, fh)
+	if nil != err {
+		return ErrnoFromError(err)
+	}
+	return n
+}
+
+func (self *fileSystemErr) Write(path string, buff []byte, ofst int64, fh uint64) int {
+	n, err := self.fsop.Write(path, buff, ofst, fh)
+	if nil != err {
+		return ErrnoFromError(err)
+	}
+	return n
+}
+
+func (self *fileSystemErr) Flush(path string, fh uint64) int {
+	return ErrnoFromError(self.fsop.Flush(path, fh))
+}
+
+func (self *fileSystemErr) Release(path string, fh uint64) int {
+	return ErrnoFromError(self.fsop.Release(path, fh))
+}
+
+func (self *fileSystemErr) Fsync(path string, datasync bool, fh uint64) int {
+	return ErrnoFromError(self.fsop.Fsync(path, datasync, fh))
+}
+
+func (self *fileSystemErr) Opendir(path string) (int, uint64) {
+	fh, err := self.fsop.Opendir(path)
+	if nil != err {
+		return ErrnoFromError(err), ^uint64(0)
+	}
+	return 0, fh
+}
+
+func (self *fileSystemErr) Readdir(path string,
+	fill func(name string, stat *Stat_t, ofst int64) bool,
+	ofst int64,
+	fh uint64) int {
+	return ErrnoFromError(self.fsop.Readdir(path, fill, ofst, fh))
+}
+
+func (self *fileSystemErr) Releasedir(path string, fh uint64) int {
+	return ErrnoFromError(self.fsop.Releasedir(path, fh))
+}
+
+func (self *fileSystemErr) Fsyncdir(path string, datasync bool, fh uint64) int {
+	return ErrnoFromError(self.fsop.Fsyncdir(path, datasync, fh))
+}
+
+func (self *fileSystemErr) Setxattr(path string, name string, value []byte, flags int) int {
+	return ErrnoFromError(self.fsop.Setxattr(path, name, value, flags))
+}
+
+func (self *fileSystemErr) Getxattr(path string, name string) (int, []byte) {
+	value, err := self.fsop.Getxattr(path, name)
+	return ErrnoFromError(err), value
+}
+
+func (self *fileSystemErr) Removexattr(path string, name string) int {
+	return ErrnoFromError(self.fsop.Removexattr(path, name))
+}
+
+func (self *fileSystemErr) Listxattr(path string, fill func(name string) bool) int {
+	return ErrnoFromError(self.fsop.Listxattr(path, fill))
+}
+
+var _ FileSystemInterface = (*fileSystemErr)(nil)
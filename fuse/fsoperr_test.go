@@ -0,0 +1,139 @@
+/*
+ * fsoperr_test.go
+ *
+ * Copyright 2017-2022 Bill Zissimopoulos
+ */
+/*
+ * This file is part of Cgofuse.
+ *
+ * It is licensed under the MIT license. The full license text can be found
+ * in the License.txt file at the root of this project.
+ */
+
+package fuse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+type testBackendError struct {
+	code int
+}
+
+func (self *testBackendError) Error() string {
+	return fmt.Sprintf("backend error %d", self.code)
+}
+
+func TestErrnoFromError(t *testing.T) {
+	if errc := ErrnoFromError(nil); 0 != errc {
+		t.Error("ErrnoFromError(nil) expected 0", errc)
+	}
+	if errc := ErrnoFromError(Error(-ENOTEMPTY)); -ENOTEMPTY != errc {
+		t.Error("ErrnoFromError expected -ENOTEMPTY", errc)
+	}
+	if errc := ErrnoFromError(fmt.Errorf("wrapped: %w", Error(-EROFS))); -EROFS != errc {
+		t.Error("ErrnoFromError of wrapped Error expected -EROFS", errc)
+	}
+	if errc := ErrnoFromError(fs.ErrNotExist); -ENOENT != errc {
+		t.Error("ErrnoFromError(fs.ErrNotExist) expected -ENOENT", errc)
+	}
+	if errc := ErrnoFromError(fs.ErrPermission); -EACCES != errc {
+		t.Error("ErrnoFromError(fs.ErrPermission) expected -EACCES", errc)
+	}
+	if errc := ErrnoFromError(context.Canceled); -EINTR != errc {
+		t.Error("ErrnoFromError(context.Canceled) expected -EINTR", errc)
+	}
+	if errc := ErrnoFromError(errors.New("unknown")); -EIO != errc {
+		t.Error("ErrnoFromError of unknown error expected -EIO", errc)
+	}
+
+	_, err := os.Stat(filepath.Join(os.TempDir(), "cgofuse-nonexistent"))
+	if errc := ErrnoFromError(err); -ENOENT != errc {
+		t.Error("ErrnoFromError of *fs.PathError expected -ENOENT", errc, err)
+	}
+
+	if "windows" != runtime.GOOS {
+		err = &os.PathError{Op: "open", Path: "/file", Err: syscall.Errno(ENAMETOOLONG)}
+		if errc := ErrnoFromError(err); -ENAMETOOLONG != errc {
+			t.Error("ErrnoFromError of syscall.Errno expected -ENAMETOOLONG", errc)
+		}
+	}
+
+	RegisterErrnoMapper(func(err error) (int, bool) {
+		var e *testBackendError
+		if errors.As(err, &e) {
+			return -e.code, true
+		}
+		return 0, false
+	})
+	err = fmt.Errorf("wrapped: %w", &testBackendError{ENOSPC})
+	if errc := ErrnoFromError(err); -ENOSPC != errc {
+		t.Error("ErrnoFromError with ErrnoMapper expected -ENOSPC", errc)
+	}
+}
+
+func TestErrorIsAs(t *testing.T) {
+	if !errors.Is(Error(-ENOENT), fs.ErrNotExist) {
+		t.Error("Error(-ENOENT) expected to be fs.ErrNotExist")
+	}
+	if !errors.Is(fmt.Errorf("wrapped: %w", Error(-EACCES)), fs.ErrPermission) {
+		t.Error("wrapped Error(-EACCES) expected to be fs.ErrPermission")
+	}
+	if errors.Is(Error(-EIO), fs.ErrNotExist) {
+		t.Error("Error(-EIO) not expected to be fs.ErrNotExist")
+	}
+
+	if "windows" != runtime.GOOS {
+		var errno syscall.Errno
+		if !errors.As(Error(-EEXIST), &errno) || syscall.EEXIST != errno {
+			t.Error("Error(-EEXIST) expected to convert to syscall.EEXIST", errno)
+		}
+	}
+}
+
+type testerrfs struct {
+	FileSystemBaseErr
+}
+
+func (self *testerrfs) Open(path string, flags int) (uint64, error) {
+	if "/file" != path {
+		return 0, &os.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+	return 42, nil
+}
+
+func (self *testerrfs) Read(path string, buff []byte, ofst int64, fh uint64) (int, error) {
+	return copy(buff, "hello"), nil
+}
+
+func (self *testerrfs) Flock(path string, op int, owner uint64, fh uint64) int {
+	return 0
+}
+
+func TestFileSystemErr(t *testing.T) {
+	fsop := NewFileSystemHostErr(&testerrfs{}).fsop
+
+	if errc, fh := fsop.Open("/file", O_RDONLY); 0 != errc || 42 != fh {
+		t.Error("Open failed", errc, fh)
+	}
+	if errc, fh := fsop.Open("/nonexistent", O_RDONLY); -ENOENT != errc || ^uint64(0) != fh {
+		t.Error("Open expected -ENOENT", errc, fh)
+	}
+	if n := fsop.Read("/file", make([]byte, 10), 0, 42); 5 != n {
+		t.Error("Read expected 5 bytes", n)
+	}
+	if errc := fsop.Mkdir("/dir", 0755); -ENOSYS != errc {
+		t.Error("Mkdir expected -ENOSYS", errc)
+	}
+	if _, ok := hostOptional(fsop).(FileSystemFlock); !ok {
+		t.Error("FileSystemFlock not found")
+	}
+}
@@ -0,0 +1,773 @@
+/*
+ * driver.go
+ *
+ * Copyright 2017-2022 Bill Zissimopoulos
+ */
+/*
+ * This file is part of Cgofuse.
+ *
+ * It is licensed under the MIT license. The full license text can be found
+ * in the License.txt file at the root of this project.
+ */
+
+// Package fusetest provides an in-process driver for testing file systems that implement
+// fuse.FileSystemInterface without mounting them.
+//
+// A Driver calls a file system in the same way that the FUSE high-level library does
+// when the kernel forwards file system calls to it, and exposes an API that is similar
+// to that of the os package. For example:
+//
+//	drv := fusetest.NewDriver(NewMemfs())
+//	defer drv.Close()
+//	err := drv.WriteFile("/hello", []byte("hello, world\n"), 0644)
+//	data, err := drv.ReadFile("/hello")
+//
+// No kernel and no FUSE library are involved, so tests that use a Driver run wherever
+// Go runs. Paths are always slash separated and relative to the root of the file
+// system. Since there is no kernel namespace, the targets of absolute symbolic links
+// are also resolved relative to the root of the file system.
+//
+// As with the FUSE library, open files continue to be accessed through their new path
+// after they (or their parent directories) are renamed. Unlike the FUSE library, the
+// driver does not hide open files that are removed or replaced by a rename (see the
+// hard_remove option): the file system receives Unlink or Rename, and later operations
+// on the open file use its old path.
+package fusetest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/winfsp/cgofuse/fuse"
+)
+
+// Driver drives a file system from the same process. It is safe for concurrent use,
+// provided that the file system is.
+type Driver struct {
+	fsop         fuse.FileSystemInterface
+	opt          interface{} // implements the optional interfaces (FileSystemOpenEx, etc.)
+	capOpenTrunc bool
+	maxRead      int
+	maxWrite     int
+	initOnce     sync.Once
+	mutex        sync.Mutex
+	files        map[*File]struct{}
+	destroyed    bool
+}
+
+const (
+	// default request sizes of the Linux kernel (FUSE_DEFAULT_MAX_PAGES_PER_REQ pages)
+	defaultMaxRead  = 128 * 1024
+	defaultMaxWrite = 128 * 1024
+
+	// size of the kernel buffer for a single READDIR request
+	readdirBufSize = 4096
+
+	// maximum number of symbolic links followed during path resolution (as Linux)
+	maxSymlinks = 40
+)
+
+// NewDriver creates a driver for a file system. The file system is initialized (Init
+// or InitEx is called) when the driver is first used.
+func NewDriver(fsop fuse.FileSystemInterface) *Driver {
+	return newDriver(fsop, fsop)
+}
+
+// NewDriverCtx creates a driver for a file system that implements
+// fuse.FileSystemInterfaceCtx. The file system operations receive a context that is
+// never cancelled and that carries no fuse.OpContext.
+func NewDriverCtx(fsop fuse.FileSystemInterfaceCtx) *Driver {
+	return newDriver(fuse.NewFileSystemCtxAdapter(fsop, context.Background), fsop)
+}
+
+// NewDriverErr creates a driver for a file system that implements
+// fuse.FileSystemInterfaceErr.
+func NewDriverErr(fsop fuse.FileSystemInterfaceErr) *Driver {
+	return newDriver(fuse.NewFileSystemErrAdapter(fsop), fsop)
+}
+
+func newDriver(fsop fuse.FileSystemInterface, opt interface{}) *Driver {
+	return &Driver{
+		fsop:     fsop,
+		opt:      opt,
+		maxRead:  defaultMaxRead,
+		maxWrite: defaultMaxWrite,
+		files:    map[*File]struct{}{},
+	}
+}
+
+// SetCapOpenTrunc informs the driver that the file system can handle the O_TRUNC
+// open flag, as with FileSystemHost.SetCapOpenTrunc. When it is false (the default)
+// the driver truncates a file with Truncate before it opens it and removes O_TRUNC
+// from the open flags. It must be called before the driver is first used.
+func (self *Driver) SetCapOpenTrunc(value bool) {
+	self.capOpenTrunc = value
+}
+
+// Close destroys the file system (Destroy is called). It returns an error if any File
+// that was opened through the driver has not been closed.
+func (self *Driver) Close() error {
+	self.init()
+	self.mutex.Lock()
+	if self.destroyed {
+		self.mutex.Unlock()
+		return fs.ErrClosed
+	}
+	self.destroyed = true
+	n := len(self.files)
+	self.mutex.Unlock()
+
+	self.fsop.Destroy()
+	if 0 != n {
+		return errors.New("fusetest: " + strconv.Itoa(n) + " files were not closed")
+	}
+	return nil
+}
+
+func (self *Driver) init() {
+	self.initOnce.Do(func() {
+		if intf, ok := self.opt.(fuse.FileSystemInitEx); ok {
+			conn := fuse.ConnInfo{
+				ProtoMajor:   7,
+				ProtoMinor:   31,
+				MaxWrite:     uint32(self.maxWrite),
+				MaxRead:      uint32(self.maxRead),
+				MaxReadahead: uint32(self.maxRead),
+				Capable:      fuse.CAP_ATOMIC_O_TRUNC,
+			}
+			if self.capOpenTrunc {
+				conn.Want |= fuse.CAP_ATOMIC_O_TRUNC
+			}
+			intf.InitEx(&conn)
+			self.capOpenTrunc = 0 != conn.Want&fuse.CAP_ATOMIC_O_TRUNC
+			if 0 < conn.MaxWrite && uint32(self.maxWrite) > conn.MaxWrite {
+				self.maxWrite = int(conn.MaxWrite)
+			}
+			if 0 < conn.MaxRead && uint32(self.maxRead) > conn.MaxRead {
+				self.maxRead = int(conn.MaxRead)
+			}
+		} else {
+			self.fsop.Init()
+		}
+	})
+}
+
+// call calls a file system operation and converts a fuse.Error panic to an error code
+// in the same way as the FUSE host.
+func call(fn func() int) (errc int) {
+	defer func() {
+		if r := recover(); nil != r {
+			if e, ok := r.(fuse.Error); ok {
+				errc = int(e)
+			} else {
+				errc = -fuse.EIO
+			}
+		}
+	}()
+	return fn()
+}
+
+// errnoError converts an error code to an error. It is a syscall.Errno (like the
+// errors of the os package) except on Windows, where it is a fuse.Error. In either
+// case fuse.ErrnoFromError converts it back to the error code.
+func errnoError(errc int) error {
+	if "windows" != runtime.GOOS {
+		return syscall.Errno(-errc)
+	}
+	return fuse.Error(errc)
+}
+
+func pathError(op string, name string, errc int) error {
+	return &fs.PathError{Op: op, Path: name, Err: errnoError(errc)}
+}
+
+func (self *Driver) getattr(p string, stat *fuse.Stat_t, fh uint64) int {
+	return call(func() int {
+		*stat = fuse.Stat_t{}
+		return self.fsop.Getattr(p, stat, fh)
+	})
+}
+
+// resolve resolves a name to a path of the file system, looking up every path
+// component with Getattr as the FUSE library does. Symbolic links are followed in
+// all components except the last one, which is followed only if follow is true.
+func (self *Driver) resolve(name string, follow bool) (string, fuse.Stat_t, int) {
+	self.init()
+	comps := split(name)
+	p := "/"
+	stat := fuse.Stat_t{}
+	if errc := self.getattr(p, &stat, fuse.InvalidHandle); 0 != errc {
+		return "", stat, errc
+	}
+	for i, nlinks := 0, 0; len(comps) > i; i++ {
+		if fuse.S_IFDIR != stat.Mode&fuse.S_IFMT {
+			return "", stat, -fuse.ENOTDIR
+		}
+		next := path.Join(p, comps[i])
+		if errc := self.getattr(next, &stat, fuse.InvalidHandle); 0 != errc {
+			return "", stat, errc
+		}
+		if fuse.S_IFLNK == stat.Mode&fuse.S_IFMT && (len(comps)-1 > i || follow) {
+			nlinks++
+			if maxSymlinks < nlinks {
+				return "", stat, -fuse.ELOOP
+			}
+			var errc int
+			var target string
+			errc = call(func() int {
+				errc, target = self.fsop.Readlink(next)
+				return errc
+			})
+			if 0 != errc {
+				return "", stat, errc
+			}
+			if !strings.HasPrefix(target, "/") {
+				target = path.Join(p, target)
+			}
+			comps = append(split(target), comps[i+1:]...)
+			p = "/"
+			if errc := self.getattr(p, &stat, fuse.InvalidHandle); 0 != errc {
+				return "", stat, errc
+			}
+			i = -1
+			continue
+		}
+		p = next
+	}
+	return p, stat, 0
+}
+
+// resolveParent resolves the parent directory of a name and returns the path of the
+// name within it. The name itself is not looked up.
+func (self *Driver) resolveParent(name string) (string, int) {
+	comps := split(name)
+	if 0 == len(comps) {
+		return "/", 0
+	}
+	dir, _, errc := self.resolve(strings.Join(comps[:len(comps)-1], "/"), true)
+	if 0 != errc {
+		return "", errc
+	}
+	return path.Join(dir, comps[len(comps)-1]), 0
+}
+
+// Stat returns a FileInfo that describes the named file. Symbolic links are followed.
+func (self *Driver) Stat(name string) (fs.FileInfo, error) {
+	_, stat, errc := self.resolve(name, true)
+	if 0 != errc {
+		return nil, pathError("stat", name, errc)
+	}
+	return newFileInfo(path.Base("/"+name), &stat), nil
+}
+
+// Lstat returns a FileInfo that describes the named file. Symbolic links are not
+// followed.
+func (self *Driver) Lstat(name string) (fs.FileInfo, error) {
+	_, stat, errc := self.resolve(name, false)
+	if 0 != errc {
+		return nil, pathError("lstat", name, errc)
+	}
+	return newFileInfo(path.Base("/"+name), &stat), nil
+}
+
+// lookupNew resolves the parent directory of a name that is about to be created and
+// fails with -EEXIST if the name already exists.
+func (self *Driver) lookupNew(name string) (string, int) {
+	p, errc := self.resolveParent(name)
+	if 0 != errc {
+		return "", errc
+	}
+	stat := fuse.Stat_t{}
+	errc = self.getattr(p, &stat, fuse.InvalidHandle)
+	if 0 == errc {
+		return "", -fuse.EEXIST
+	} else if -fuse.ENOENT != errc {
+		return "", errc
+	}
+	return p, 0
+}
+
+// Mkdir creates a directory.
+func (self *Driver) Mkdir(name string, perm fs.FileMode) error {
+	p, errc := self.lookupNew(name)
+	if 0 == errc {
+		errc = call(func() int {
+			return self.fsop.Mkdir(p, modeFromFileMode(perm)&07777)
+		})
+	}
+	if 0 != errc {
+		return pathError("mkdir", name, errc)
+	}
+	return nil
+}
+
+// Remove removes a file or an empty directory.
+func (self *Driver) Remove(name string) error {
+	p, errc := self.resolveParent(name)
+	if 0 == errc {
+		stat := fuse.Stat_t{}
+		errc = self.getattr(p, &stat, fuse.InvalidHandle)
+		if 0 == errc {
+			errc = call(func() int {
+				if fuse.S_IFDIR == stat.Mode&fuse.S_IFMT {
+					return self.fsop.Rmdir(p)
+				}
+				return self.fsop.Unlink(p)
+			})
+		}
+	}
+	if 0 != errc {
+		return pathError("remove", name, errc)
+	}
+	return nil
+}
+
+// Rename renames (moves) a file.
+func (self *Driver) Rename(oldname string, newname string) error {
+	oldp, errc := self.resolveParent(oldname)
+	newp := ""
+	if 0 == errc {
+		stat := fuse.Stat_t{}
+		errc = self.getattr(oldp, &stat, fuse.InvalidHandle)
+	}
+	if 0 == errc {
+		newp, errc = self.resolveParent(newname)
+	}
+	if 0 == errc {
+		errc = call(func() int {
+			return self.fsop.Rename(oldp, newp)
+		})
+	}
+	if 0 != errc {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: errnoError(errc)}
+	}
+
+	// as with the FUSE library, open files that were renamed (or are within a renamed
+	// directory) are accessed through their new path from now on
+	self.mutex.Lock()
+	for file := range self.files {
+		if oldp == file.path {
+			file.path = newp
+		} else if strings.HasPrefix(file.path, oldp+"/") {
+			file.path = newp + file.path[len(oldp):]
+		}
+	}
+	self.mutex.Unlock()
+	return nil
+}
+
+// Symlink creates newname as a symbolic link to oldname.
+func (self *Driver) Symlink(oldname string, newname string) error {
+	p, errc := self.lookupNew(newname)
+	if 0 == errc {
+		errc = call(func() int {
+			return self.fsop.Symlink(oldname, p)
+		})
+	}
+	if 0 != errc {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: errnoError(errc)}
+	}
+	return nil
+}
+
+// Link creates newname as a hard link to oldname.
+func (self *Driver) Link(oldname string, newname string) error {
+	oldp, _, errc := self.resolve(oldname, false)
+	newp := ""
+	if 0 == errc {
+		newp, errc = self.lookupNew(newname)
+	}
+	if 0 == errc {
+		errc = call(func() int {
+			return self.fsop.Link(oldp, newp)
+		})
+	}
+	if 0 != errc {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: errnoError(errc)}
+	}
+	return nil
+}
+
+// Readlink returns the target of a symbolic link.
+func (self *Driver) Readlink(name string) (string, error) {
+	p, _, errc := self.resolve(name, false)
+	target := ""
+	if 0 == errc {
+		errc = call(func() int {
+			errc, target = self.fsop.Readlink(p)
+			return errc
+		})
+	}
+	if 0 != errc {
+		return "", pathError("readlink", name, errc)
+	}
+	return target, nil
+}
+
+// Chmod changes the mode of a file.
+func (self *Driver) Chmod(name string, mode fs.FileMode) error {
+	p, _, errc := self.resolve(name, true)
+	if 0 == errc {
+		errc = call(func() int {
+			return self.fsop.Chmod(p, modeFromFileMode(mode)&07777)
+		})
+	}
+	if 0 != errc {
+		return pathError("chmod", name, errc)
+	}
+	return nil
+}
+
+// Chown changes the owner and group of a file.
+func (self *Driver) Chown(name string, uid int, gid int) error {
+	p, _, errc := self.resolve(name, true)
+	if 0 == errc {
+		errc = call(func() int {
+			return self.fsop.Chown(p, uint32(uid), uint32(gid))
+		})
+	}
+	if 0 != errc {
+		return pathError("chown", name, errc)
+	}
+	return nil
+}
+
+// Chtimes changes the access and modification times of a file.
+func (self *Driver) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	p, _, errc := self.resolve(name, true)
+	if 0 == errc {
+		errc = call(func() int {
+			tmsp := []fuse.Timespec{fuse.NewTimespec(atime), fuse.NewTimespec(mtime)}
+			return self.fsop.Utimens(p, tmsp)
+		})
+	}
+	if 0 != errc {
+		return pathError("chtimes", name, errc)
+	}
+	return nil
+}
+
+// Truncate changes the size of a file.
+func (self *Driver) Truncate(name string, size int64) error {
+	p, _, errc := self.resolve(name, true)
+	if 0 == errc {
+		errc = call(func() int {
+			return self.fsop.Truncate(p, size, fuse.InvalidHandle)
+		})
+	}
+	if 0 != errc {
+		return pathError("truncate", name, errc)
+	}
+	return nil
+}
+
+// Open opens a file or directory for reading.
+func (self *Driver) Open(name string) (*File, error) {
+	return self.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// Create creates or truncates a file and opens it for reading and writing.
+func (self *Driver) Create(name string) (*File, error) {
+	return self.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// OpenFile opens a file with the specified flags (os.O_RDONLY etc.) and permissions.
+// As with the kernel, a file that does not exist is created with Create or (if Create
+// returns -ENOSYS) with Mknod and Open; a directory is opened with Opendir; O_TRUNC is
+// passed to Open or handled with Truncate depending on SetCapOpenTrunc.
+func (self *Driver) OpenFile(name string, flag int, perm fs.FileMode) (*File, error) {
+	file, errc := self.openFile(name, flag, perm)
+	if 0 != errc {
+		return nil, pathError("open", name, errc)
+	}
+
+	self.mutex.Lock()
+	self.files[file] = struct{}{}
+	self.mutex.Unlock()
+	return file, nil
+}
+
+func (self *Driver) openFile(name string, flag int, perm fs.FileMode) (*File, int) {
+	flags := flagsFromOsFlags(flag)
+
+	p, stat, errc := self.resolve(name, true)
+	if -fuse.ENOENT == errc && 0 != flag&os.O_CREATE {
+		p, errc = self.resolveParent(name)
+		if 0 != errc {
+			return nil, errc
+		}
+		if !self.capOpenTrunc {
+			flags &^= fuse.O_TRUNC
+		}
+		return self.create(name, p, flags, modeFromFileMode(perm)&07777)
+	}
+	if 0 != errc {
+		return nil, errc
+	}
+	if 0 != flag&os.O_CREATE && 0 != flag&os.O_EXCL {
+		return nil, -fuse.EEXIST
+	}
+
+	if fuse.S_IFDIR == stat.Mode&fuse.S_IFMT {
+		if fuse.O_RDONLY != flags&fuse.O_ACCMODE || 0 != flag&os.O_TRUNC {
+			return nil, -fuse.EISDIR
+		}
+		var fh uint64
+		errc = call(func() int {
+			errc, fh = self.fsop.Opendir(p)
+			if -fuse.ENOSYS == errc {
+				errc = 0
+			}
+			return errc
+		})
+		if 0 != errc {
+			return nil, errc
+		}
+		return &File{drv: self, name: name, path: p, fh: fh, dir: true}, 0
+	}
+
+	// the kernel does not pass O_CREAT and O_EXCL to open
+	flags &^= fuse.O_CREAT | fuse.O_EXCL
+	if 0 != flags&fuse.O_TRUNC && !self.capOpenTrunc {
+		flags &^= fuse.O_TRUNC
+		errc = call(func() int {
+			return self.fsop.Truncate(p, 0, fuse.InvalidHandle)
+		})
+		if 0 != errc {
+			return nil, errc
+		}
+	}
+	var fh uint64
+	errc = call(func() int {
+		if intf, ok := self.opt.(fuse.FileSystemOpenEx); ok {
+			fi := fuse.FileInfo_t{Flags: flags}
+			errc = intf.OpenEx(p, &fi)
+			fh = fi.Fh
+			return errc
+		}
+		errc, fh = self.fsop.Open(p, flags)
+		return errc
+	})
+	if 0 != errc {
+		return nil, errc
+	}
+	return &File{drv: self, name: name, path: p, fh: fh, flags: flags}, 0
+}
+
+func (self *Driver) create(name string, p string, flags int, mode uint32) (*File, int) {
+	var fh uint64
+	errc := call(func() int {
+		var errc int
+		intf, ok := self.opt.(fuse.FileSystemOpenEx)
+		fi := fuse.FileInfo_t{Flags: flags}
+		if ok {
+			errc = intf.CreateEx(p, mode, &fi)
+		} else {
+			errc, fi.Fh = self.fsop.Create(p, flags, mode)
+		}
+		if -fuse.ENOSYS == errc {
+			errc = self.fsop.Mknod(p, fuse.S_IFREG|mode, 0)
+			if 0 == errc {
+				if ok {
+					errc = intf.OpenEx(p, &fi)
+				} else {
+					errc, fi.Fh = self.fsop.Open(p, flags)
+				}
+			}
+		}
+		fh = fi.Fh
+		return errc
+	})
+	if 0 != errc {
+		return nil, errc
+	}
+
+	// the FUSE library looks up a newly created file before it replies to the kernel
+	stat := fuse.Stat_t{}
+	errc = self.getattr(p, &stat, fh)
+	if 0 != errc {
+		call(func() int {
+			return self.fsop.Release(p, fh)
+		})
+		return nil, errc
+	}
+	return &File{drv: self, name: name, path: p, fh: fh, flags: flags}, 0
+}
+
+// ReadFile reads the named file and returns its contents.
+func (self *Driver) ReadFile(name string) ([]byte, error) {
+	file, err := self.Open(name)
+	if nil != err {
+		return nil, err
+	}
+	defer file.Close()
+	data := []byte{}
+	buff := make([]byte, self.maxRead)
+	for {
+		n, err := file.Read(buff)
+		data = append(data, buff[:n]...)
+		if nil != err {
+			if io.EOF == err {
+				return data, nil
+			}
+			return data, err
+		}
+	}
+}
+
+// WriteFile writes data to the named file, creating it if necessary.
+func (self *Driver) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	file, err := self.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if nil != err {
+		return err
+	}
+	_, err = file.Write(data)
+	if err1 := file.Close(); nil == err {
+		err = err1
+	}
+	return err
+}
+
+// ReadDir reads the named directory and returns its entries sorted by name. The
+// entries "." and ".." are not included.
+func (self *Driver) ReadDir(name string) ([]fs.DirEntry, error) {
+	file, err := self.Open(name)
+	if nil != err {
+		return nil, err
+	}
+	defer file.Close()
+	entries, err := file.ReadDir(-1)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, err
+}
+
+// readdir reads a directory in the same way as the FUSE library reads it on behalf of
+// the kernel. If the file system passes zero offsets to fill, the whole directory is
+// read with a single call. Otherwise the directory is read in chunks that fit in the
+// kernel buffer, and every subsequent call receives the offset of the last entry of the
+// previous chunk.
+func (self *Driver) readdir(p string, fh uint64) ([]dirEntry, int) {
+	entries := []dirEntry{}
+	ofst := int64(0)
+	for {
+		size, full, nofst := 0, false, 0
+		next := ofst
+		errc := call(func() int {
+			return self.fsop.Readdir(p, func(name string, stat *fuse.Stat_t, ofst int64) bool {
+				if 0 == ofst {
+					nofst++
+				} else {
+					size += (24 + len(name) + 7) &^ 7
+					if readdirBufSize < size {
+						full = true
+						return false
+					}
+					next = ofst
+				}
+				entry := dirEntry{drv: self, dir: p, name: name}
+				if nil != stat {
+					entry.stat, entry.valid = *stat, true
+				}
+				entries = append(entries, entry)
+				return true
+			}, ofst, fh)
+		})
+		if 0 != errc {
+			return nil, errc
+		}
+		if 0 != nofst || !full || next == ofst {
+			return entries, 0
+		}
+		ofst = next
+	}
+}
+
+func split(name string) []string {
+	comps := []string{}
+	for _, c := range strings.Split(name, "/") {
+		if "" != c && "." != c {
+			comps = append(comps, c)
+		}
+	}
+	return comps
+}
+
+func flagsFromOsFlags(flag int) int {
+	flags := 0
+	switch flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR) {
+	case os.O_RDONLY:
+		flags = fuse.O_RDONLY
+	case os.O_WRONLY:
+		flags = fuse.O_WRONLY
+	case os.O_RDWR:
+		flags = fuse.O_RDWR
+	}
+	if 0 != flag&os.O_APPEND {
+		flags |= fuse.O_APPEND
+	}
+	if 0 != flag&os.O_CREATE {
+		flags |= fuse.O_CREAT
+	}
+	if 0 != flag&os.O_EXCL {
+		flags |= fuse.O_EXCL
+	}
+	if 0 != flag&os.O_TRUNC {
+		flags |= fuse.O_TRUNC
+	}
+	return flags
+}
+
+func modeFromFileMode(mode fs.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	if 0 != mode&fs.ModeSetuid {
+		m |= fuse.S_ISUID
+	}
+	if 0 != mode&fs.ModeSetgid {
+		m |= fuse.S_ISGID
+	}
+	if 0 != mode&fs.ModeSticky {
+		m |= fuse.S_ISVTX
+	}
+	return m
+}
+
+func fileModeFromMode(m uint32) fs.FileMode {
+	mode := fs.FileMode(m & 0777)
+	switch m & fuse.S_IFMT {
+	case fuse.S_IFDIR:
+		mode |= fs.ModeDir
+	case fuse.S_IFLNK:
+		mode |= fs.ModeSymlink
+	case fuse.S_IFIFO:
+		mode |= fs.ModeNamedPipe
+	case fuse.S_IFSOCK:
+		mode |= fs.ModeSocket
+	case fuse.S_IFCHR:
+		mode |= fs.ModeDevice | fs.ModeCharDevice
+	case fuse.S_IFBLK:
+		mode |= fs.ModeDevice
+	}
+	if 0 != m&fuse.S_ISUID {
+		mode |= fs.ModeSetuid
+	}
+	if 0 != m&fuse.S_ISGID {
+		mode |= fs.ModeSetgid
+	}
+	if 0 != m&fuse.S_ISVTX {
+		mode |= fs.ModeSticky
+	}
+	return mode
+}
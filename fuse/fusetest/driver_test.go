@@ -0,0 +1,477 @@
+/*
+ * driver_test.go
+ *
+ * Copyright 2017-2022 Bill Zissimopoulos
+ */
+/*
+ * This file is part of Cgofuse.
+ *
+ * It is licensed under the MIT license. The full license text can be found
+ * in the License.txt file at the root of this project.
+ */
+
+package fusetest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/winfsp/cgofuse/fuse"
+)
+
+// testfs is a flat path-based file system. It does not implement Create and it reads
+// directories using offsets, so that the driver has to fall back to Mknod+Open and
+// page through Readdir.
+type testfs struct {
+	fuse.FileSystemBase
+	mutex sync.Mutex
+	nodes map[string]*testnode
+	open  map[uint64]string
+	fh    uint64
+	calls []string
+	init  int
+	dstr  int
+}
+
+type testnode struct {
+	mode uint32
+	data []byte
+	link string
+}
+
+func newTestfs() *testfs {
+	return &testfs{
+		nodes: map[string]*testnode{"/": {mode: fuse.S_IFDIR | 0755}},
+		open:  map[uint64]string{},
+	}
+}
+
+func (self *testfs) log(op string, vals ...interface{}) {
+	s := op
+	for _, v := range vals {
+		switch v := v.(type) {
+		case string:
+			s += " " + v
+		case int:
+			s += " " + strconv.Itoa(v)
+		}
+	}
+	self.calls = append(self.calls, s)
+}
+
+func (self *testfs) Init() {
+	self.init++
+}
+
+func (self *testfs) Destroy() {
+	self.dstr++
+}
+
+func (self *testfs) Getattr(path string, stat *fuse.Stat_t, fh uint64) int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	node, ok := self.nodes[path]
+	if !ok {
+		return -fuse.ENOENT
+	}
+	stat.Mode = node.mode
+	stat.Size = int64(len(node.data))
+	if fuse.S_IFLNK == node.mode&fuse.S_IFMT {
+		stat.Size = int64(len(node.link))
+	}
+	return 0
+}
+
+func (self *testfs) make(p string, mode uint32) int {
+	if _, ok := self.nodes[path.Dir(p)]; !ok {
+		return -fuse.ENOENT
+	}
+	if _, ok := self.nodes[p]; ok {
+		return -fuse.EEXIST
+	}
+	self.nodes[p] = &testnode{mode: mode}
+	return 0
+}
+
+func (self *testfs) Mknod(path string, mode uint32, dev uint64) int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.log("mknod", path)
+	return self.make(path, mode)
+}
+
+func (self *testfs) Mkdir(path string, mode uint32) int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.make(path, fuse.S_IFDIR|mode)
+}
+
+func (self *testfs) Symlink(target string, newpath string) int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	errc := self.make(newpath, fuse.S_IFLNK|0777)
+	if 0 == errc {
+		self.nodes[newpath].link = target
+	}
+	return errc
+}
+
+func (self *testfs) Readlink(path string) (int, string) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	node, ok := self.nodes[path]
+	if !ok {
+		return -fuse.ENOENT, ""
+	}
+	return 0, node.link
+}
+
+func (self *testfs) Unlink(path string) int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if _, ok := self.nodes[path]; !ok {
+		return -fuse.ENOENT
+	}
+	delete(self.nodes, path)
+	return 0
+}
+
+func (self *testfs) Rename(oldpath string, newpath string) int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	node, ok := self.nodes[oldpath]
+	if !ok {
+		return -fuse.ENOENT
+	}
+	delete(self.nodes, oldpath)
+	self.nodes[newpath] = node
+	return 0
+}
+
+func (self *testfs) Truncate(path string, size int64, fh uint64) int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.log("truncate", path, int(size))
+	node, ok := self.nodes[path]
+	if !ok {
+		return -fuse.ENOENT
+	}
+	node.data = append(node.data, make([]byte, size)...)[:size]
+	return 0
+}
+
+func (self *testfs) Open(path string, flags int) (int, uint64) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.log("open", path, flags&(fuse.O_TRUNC|fuse.O_CREAT|fuse.O_EXCL))
+	if _, ok := self.nodes[path]; !ok {
+		return -fuse.ENOENT, fuse.InvalidHandle
+	}
+	if 0 != flags&fuse.O_TRUNC {
+		self.nodes[path].data = nil
+	}
+	self.fh++
+	self.open[self.fh] = path
+	return 0, self.fh
+}
+
+func (self *testfs) Read(path string, buff []byte, ofst int64, fh uint64) int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	node := self.nodes[self.open[fh]]
+	if nil == node {
+		return -fuse.EBADF
+	}
+	if int64(len(node.data)) <= ofst {
+		return 0
+	}
+	return copy(buff, node.data[ofst:])
+}
+
+func (self *testfs) Write(path string, buff []byte, ofst int64, fh uint64) int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	node := self.nodes[self.open[fh]]
+	if nil == node {
+		return -fuse.EBADF
+	}
+	if end := ofst + int64(len(buff)); int64(len(node.data)) < end {
+		node.data = append(node.data, make([]byte, end-int64(len(node.data)))...)
+	}
+	return copy(node.data[ofst:], buff)
+}
+
+func (self *testfs) Release(path string, fh uint64) int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.log("release", path)
+	delete(self.open, fh)
+	return 0
+}
+
+func (self *testfs) Readdir(dir string,
+	fill func(name string, stat *fuse.Stat_t, ofst int64) bool,
+	ofst int64,
+	fh uint64) int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.log("readdir", dir, int(ofst))
+	names := []string{".", ".."}
+	for p := range self.nodes {
+		if "/" != p && dir == path.Dir(p) {
+			names = append(names, path.Base(p))
+		}
+	}
+	sort.Strings(names)
+	for i := int(ofst); len(names) > i; i++ {
+		if !fill(names[i], nil, int64(i+1)) {
+			break
+		}
+	}
+	return 0
+}
+
+func TestDriver(t *testing.T) {
+	tstf := newTestfs()
+	drv := NewDriver(tstf)
+
+	if err := drv.Mkdir("/d", 0755); nil != err {
+		t.Error("Mkdir failed", err)
+	}
+	if err := drv.Mkdir("/d", 0755); !errors.Is(err, fs.ErrExist) {
+		t.Error("Mkdir expected ErrExist", err)
+	}
+
+	// Create is not implemented, so files are created with Mknod and Open
+	if err := drv.WriteFile("/d/f", []byte("hello, world\n"), 0644); nil != err {
+		t.Error("WriteFile failed", err)
+	}
+	if 2 > len(tstf.calls) ||
+		"mknod /d/f" != tstf.calls[0] || "open /d/f "+strconv.Itoa(fuse.O_CREAT) != tstf.calls[1] {
+		t.Error("WriteFile unexpected calls", tstf.calls)
+	}
+	if data, err := drv.ReadFile("/d/f"); nil != err || "hello, world\n" != string(data) {
+		t.Error("ReadFile failed", err, string(data))
+	}
+	if info, err := drv.Stat("/d/f"); nil != err || 13 != info.Size() || !info.Mode().IsRegular() {
+		t.Error("Stat failed", err, info)
+	}
+	if _, err := drv.Stat("/d/f/x"); -fuse.ENOTDIR != fuse.ErrnoFromError(err) {
+		t.Error("Stat expected ENOTDIR", err)
+	}
+	if _, err := drv.Stat("/missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("Stat expected not exist", err)
+	}
+
+	// without CapOpenTrunc O_TRUNC is handled with Truncate
+	tstf.calls = nil
+	if err := drv.WriteFile("/d/f", []byte("bye"), 0644); nil != err {
+		t.Error("WriteFile failed", err)
+	}
+	if 2 > len(tstf.calls) || "truncate /d/f 0" != tstf.calls[0] || "open /d/f 0" != tstf.calls[1] {
+		t.Error("WriteFile unexpected calls", tstf.calls)
+	}
+	if data, _ := drv.ReadFile("/d/f"); "bye" != string(data) {
+		t.Error("ReadFile after truncate failed", string(data))
+	}
+
+	// symbolic links are followed
+	if err := drv.Symlink("d/f", "/l"); nil != err {
+		t.Error("Symlink failed", err)
+	}
+	if data, err := drv.ReadFile("/l"); nil != err || "bye" != string(data) {
+		t.Error("ReadFile through link failed", err, string(data))
+	}
+	if info, err := drv.Lstat("/l"); nil != err || 0 == info.Mode()&fs.ModeSymlink {
+		t.Error("Lstat failed", err, info)
+	}
+
+	// a directory with many entries is read in multiple Readdir calls
+	for i := 0; 500 > i; i++ {
+		if err := drv.WriteFile("/d/"+strings.Repeat("x", 20)+strconv.Itoa(i), nil, 0644); nil != err {
+			t.Fatal("WriteFile failed", err)
+		}
+	}
+	tstf.calls = nil
+	entries, err := drv.ReadDir("/d")
+	if nil != err || 501 != len(entries) {
+		t.Error("ReadDir failed", err, len(entries))
+	}
+	ncalls := 0
+	for _, c := range tstf.calls {
+		if strings.HasPrefix(c, "readdir") {
+			ncalls++
+		}
+	}
+	if 2 > ncalls {
+		t.Error("ReadDir did not page", tstf.calls)
+	}
+	if "f" != entries[0].Name() || entries[0].IsDir() {
+		t.Error("ReadDir incorrect entry", entries[0].Name())
+	}
+
+	file, err := drv.Open("/d/f")
+	if nil != err {
+		t.Fatal("Open failed", err)
+	}
+	buff := make([]byte, 2)
+	if n, err := file.Read(buff); nil != err || "by" != string(buff[:n]) {
+		t.Error("Read failed", err, string(buff[:n]))
+	}
+	if n, err := file.Read(buff); nil != err || "e" != string(buff[:n]) {
+		t.Error("Read failed", err, string(buff[:n]))
+	}
+	if _, err := file.Read(buff); io.EOF != err {
+		t.Error("Read expected EOF", err)
+	}
+	if _, err := file.Write(buff); -fuse.EBADF != fuse.ErrnoFromError(err) {
+		t.Error("Write to read-only file expected EBADF", err)
+	}
+
+	if err := drv.Rename("/d/f", "/g"); nil != err {
+		t.Error("Rename failed", err)
+	}
+	if err := drv.Remove("/g"); nil != err {
+		t.Error("Remove failed", err)
+	}
+
+	if err := drv.Close(); nil == err {
+		t.Error("Close expected error for open file")
+	}
+	if err := file.Close(); nil != err {
+		t.Error("File.Close failed", err)
+	}
+	if 1 != tstf.init || 1 != tstf.dstr {
+		t.Error("Init/Destroy called incorrectly", tstf.init, tstf.dstr)
+	}
+}
+
+func TestDriverCapOpenTrunc(t *testing.T) {
+	tstf := newTestfs()
+	drv := NewDriver(tstf)
+	drv.SetCapOpenTrunc(true)
+	defer drv.Close()
+
+	if err := drv.WriteFile("/f", []byte("hello"), 0644); nil != err {
+		t.Error("WriteFile failed", err)
+	}
+	tstf.calls = nil
+	if err := drv.WriteFile("/f", []byte("bye"), 0644); nil != err {
+		t.Error("WriteFile failed", err)
+	}
+	if 1 > len(tstf.calls) || "open /f "+strconv.Itoa(fuse.O_TRUNC) != tstf.calls[0] {
+		t.Error("WriteFile unexpected calls", tstf.calls)
+	}
+	if data, _ := drv.ReadFile("/f"); "bye" != string(data) {
+		t.Error("ReadFile failed", string(data))
+	}
+}
+
+func TestDriverRename(t *testing.T) {
+	tstf := newTestfs()
+	drv := NewDriver(tstf)
+	defer drv.Close()
+
+	file, err := drv.Create("/f")
+	if nil != err {
+		t.Fatal("Create failed", err)
+	}
+	if err := drv.Rename("/f", "/g"); nil != err {
+		t.Error("Rename failed", err)
+	}
+	drv.Mkdir("/d", 0755)
+	dfile, err := drv.Create("/d/x")
+	if nil != err {
+		t.Fatal("Create failed", err)
+	}
+	if err := drv.Rename("/d", "/e"); nil != err {
+		t.Error("Rename failed", err)
+	}
+	tstf.calls = nil
+	file.Close()
+	dfile.Close()
+	if 2 != len(tstf.calls) || "release /g" != tstf.calls[0] || "release /e/x" != tstf.calls[1] {
+		t.Error("Close of renamed files unexpected calls", tstf.calls)
+	}
+}
+
+type ctxfs struct {
+	fuse.FileSystemBaseCtx
+	nilctx int
+}
+
+func (self *ctxfs) Getattr(ctx context.Context, path string, stat *fuse.Stat_t, fh uint64) int {
+	if nil == ctx {
+		self.nilctx++
+	}
+	if "/" != path {
+		return -fuse.ENOENT
+	}
+	stat.Mode = fuse.S_IFDIR | 0755
+	return 0
+}
+
+type errfs struct {
+	fuse.FileSystemBaseErr
+}
+
+func (self *errfs) Getattr(path string, stat *fuse.Stat_t, fh uint64) error {
+	if "/" != path {
+		return fs.ErrNotExist
+	}
+	stat.Mode = fuse.S_IFDIR | 0755
+	return nil
+}
+
+func (self *errfs) Mkdir(path string, mode uint32) error {
+	return fs.ErrPermission
+}
+
+func TestDriverCtxErr(t *testing.T) {
+	tstf := &ctxfs{}
+	drv := NewDriverCtx(tstf)
+	if info, err := drv.Stat("/"); nil != err || !info.IsDir() {
+		t.Error("Stat failed", err)
+	}
+	if _, err := drv.Stat("/x"); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("Stat expected ErrNotExist", err)
+	}
+	if 0 != tstf.nilctx {
+		t.Error("Getattr called without a context", tstf.nilctx)
+	}
+	drv.Close()
+
+	drv = NewDriverErr(&errfs{})
+	if info, err := drv.Stat("/"); nil != err || !info.IsDir() {
+		t.Error("Stat failed", err)
+	}
+	if err := drv.Mkdir("/d", 0755); !errors.Is(err, fs.ErrPermission) {
+		t.Error("Mkdir expected ErrPermission", err)
+	}
+	drv.Close()
+}
+
+func TestDriverPanic(t *testing.T) {
+	drv := NewDriver(&panicfs{})
+	defer drv.Close()
+
+	if _, err := drv.Stat("/"); -fuse.ENAMETOOLONG != fuse.ErrnoFromError(err) {
+		t.Error("Stat expected ENAMETOOLONG", err)
+	}
+}
+
+type panicfs struct {
+	fuse.FileSystemBase
+}
+
+func (self *panicfs) Getattr(path string, stat *fuse.Stat_t, fh uint64) int {
+	panic(fuse.Error(-fuse.ENAMETOOLONG))
+}
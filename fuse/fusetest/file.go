@@ -0,0 +1,385 @@
+/*
+ * file.go
+ *
+ * Copyright 2017-2022 Bill Zissimopoulos
+ */
+/*
+ * This file is part of Cgofuse.
+ *
+ * It is licensed under the MIT license. The full license text can be found
+ * in the License.txt file at the root of this project.
+ */
+
+package fusetest
+
+import (
+	"io"
+	"io/fs"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/winfsp/cgofuse/fuse"
+)
+
+// File is an open file or directory of a file system that is driven by a Driver.
+// Its methods are similar to those of os.File.
+type File struct {
+	drv   *Driver
+	name  string
+	path  string
+	fh    uint64
+	dir   bool
+	flags int
+	mutex sync.Mutex
+	ofst  int64
+	ents  []dirEntry
+	eread bool
+	done  bool
+}
+
+// Name returns the name of the file as presented to Open.
+func (self *File) Name() string {
+	return self.name
+}
+
+// Fh returns the file handle that the file system returned from Open, Create or
+// Opendir.
+func (self *File) Fh() uint64 {
+	return self.fh
+}
+
+// Read reads up to len(b) bytes from the file at the current offset.
+// It returns io.EOF at end of file.
+func (self *File) Read(b []byte) (int, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	n, err := self.readAt(b, self.ofst)
+	self.ofst += int64(n)
+	return n, err
+}
+
+// ReadAt reads up to len(b) bytes from the file at offset off.
+// It returns io.EOF if fewer than len(b) bytes were read.
+func (self *File) ReadAt(b []byte, off int64) (int, error) {
+	n, err := self.readAt(b, off)
+	if nil == err && len(b) > n {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// readAt reads in requests of at most MaxRead bytes, as the kernel does. A short read
+// ends the transfer.
+func (self *File) readAt(b []byte, off int64) (int, error) {
+	if errc := self.check(); 0 != errc {
+		return 0, pathError("read", self.name, errc)
+	}
+	if 0 == len(b) {
+		return 0, nil
+	}
+	tot := 0
+	for len(b) > tot {
+		size := len(b) - tot
+		if self.drv.maxRead < size {
+			size = self.drv.maxRead
+		}
+		n := call(func() int {
+			return self.drv.fsop.Read(self.getPath(), b[tot:tot+size], off+int64(tot), self.fh)
+		})
+		if 0 > n {
+			return tot, pathError("read", self.name, n)
+		}
+		tot += n
+		if size > n {
+			break
+		}
+	}
+	if 0 == tot {
+		return 0, io.EOF
+	}
+	return tot, nil
+}
+
+// Write writes len(b) bytes to the file at the current offset (or at the end of the
+// file if it was opened with O_APPEND).
+func (self *File) Write(b []byte) (int, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	off := self.ofst
+	if 0 != self.flags&fuse.O_APPEND {
+		stat := fuse.Stat_t{}
+		if errc := self.drv.getattr(self.getPath(), &stat, self.fh); 0 != errc {
+			return 0, pathError("write", self.name, errc)
+		}
+		off = stat.Size
+	}
+	n, err := self.writeAt(b, off)
+	self.ofst = off + int64(n)
+	return n, err
+}
+
+// WriteAt writes len(b) bytes to the file at offset off.
+func (self *File) WriteAt(b []byte, off int64) (int, error) {
+	return self.writeAt(b, off)
+}
+
+// writeAt writes in requests of at most MaxWrite bytes, as the kernel does.
+func (self *File) writeAt(b []byte, off int64) (int, error) {
+	if errc := self.check(); 0 != errc {
+		return 0, pathError("write", self.name, errc)
+	}
+	if fuse.O_RDONLY == self.flags&fuse.O_ACCMODE {
+		return 0, pathError("write", self.name, -fuse.EBADF)
+	}
+	tot := 0
+	for len(b) > tot {
+		size := len(b) - tot
+		if self.drv.maxWrite < size {
+			size = self.drv.maxWrite
+		}
+		n := call(func() int {
+			return self.drv.fsop.Write(self.getPath(), b[tot:tot+size], off+int64(tot), self.fh)
+		})
+		if 0 > n {
+			return tot, pathError("write", self.name, n)
+		}
+		tot += n
+		if size > n {
+			return tot, io.ErrShortWrite
+		}
+	}
+	return tot, nil
+}
+
+// Seek sets the offset for the next Read or Write.
+func (self *File) Seek(offset int64, whence int) (int64, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if errc := self.check(); 0 != errc {
+		return 0, pathError("seek", self.name, errc)
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += self.ofst
+	case io.SeekEnd:
+		stat := fuse.Stat_t{}
+		if errc := self.drv.getattr(self.getPath(), &stat, self.fh); 0 != errc {
+			return 0, pathError("seek", self.name, errc)
+		}
+		offset += stat.Size
+	default:
+		return 0, pathError("seek", self.name, -fuse.EINVAL)
+	}
+	if 0 > offset {
+		return 0, pathError("seek", self.name, -fuse.EINVAL)
+	}
+	self.ofst = offset
+	return offset, nil
+}
+
+// Stat returns a FileInfo that describes the file. The file handle is passed to
+// Getattr.
+func (self *File) Stat() (fs.FileInfo, error) {
+	if errc := self.check(); 0 != errc {
+		return nil, pathError("stat", self.name, errc)
+	}
+	stat := fuse.Stat_t{}
+	if errc := self.drv.getattr(self.getPath(), &stat, self.fh); 0 != errc {
+		return nil, pathError("stat", self.name, errc)
+	}
+	return newFileInfo(path.Base(self.getPath()), &stat), nil
+}
+
+// Truncate changes the size of the file. The file handle is passed to Truncate.
+func (self *File) Truncate(size int64) error {
+	if errc := self.check(); 0 != errc {
+		return pathError("truncate", self.name, errc)
+	}
+	errc := call(func() int {
+		return self.drv.fsop.Truncate(self.getPath(), size, self.fh)
+	})
+	if 0 != errc {
+		return pathError("truncate", self.name, errc)
+	}
+	return nil
+}
+
+// Sync synchronizes the contents of the file. As with the kernel, a file system that
+// returns -ENOSYS from Fsync or Fsyncdir is assumed to have nothing to synchronize.
+func (self *File) Sync() error {
+	if errc := self.check(); 0 != errc {
+		return pathError("sync", self.name, errc)
+	}
+	errc := call(func() int {
+		if self.dir {
+			return self.drv.fsop.Fsyncdir(self.getPath(), false, self.fh)
+		}
+		return self.drv.fsop.Fsync(self.getPath(), false, self.fh)
+	})
+	if 0 != errc && -fuse.ENOSYS != errc {
+		return pathError("sync", self.name, errc)
+	}
+	return nil
+}
+
+// ReadDir reads the contents of the directory and returns up to n entries in
+// directory order. If n <= 0, ReadDir returns all remaining entries. The entries "."
+// and ".." are not included.
+func (self *File) ReadDir(n int) ([]fs.DirEntry, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if errc := self.check(); 0 != errc {
+		return nil, pathError("readdirent", self.name, errc)
+	}
+	if !self.dir {
+		return nil, pathError("readdirent", self.name, -fuse.ENOTDIR)
+	}
+	if !self.eread {
+		ents, errc := self.drv.readdir(self.getPath(), self.fh)
+		if 0 != errc {
+			return nil, pathError("readdirent", self.name, errc)
+		}
+		for _, e := range ents {
+			if "." != e.name && ".." != e.name {
+				self.ents = append(self.ents, e)
+			}
+		}
+		self.eread = true
+	}
+	cnt := len(self.ents)
+	if 0 < n && n < cnt {
+		cnt = n
+	}
+	entries := make([]fs.DirEntry, cnt)
+	for i := range entries {
+		e := self.ents[i]
+		entries[i] = &e
+	}
+	self.ents = self.ents[cnt:]
+	if 0 < n && 0 == cnt {
+		return entries, io.EOF
+	}
+	return entries, nil
+}
+
+// Close closes the file. As with the kernel, a file is closed with Flush and Release
+// and a directory with Releasedir. The error returned from Flush (other than -ENOSYS)
+// is returned; errors returned from Release and Releasedir are ignored.
+func (self *File) Close() error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if errc := self.check(); 0 != errc {
+		return pathError("close", self.name, errc)
+	}
+	self.done = true
+
+	self.drv.mutex.Lock()
+	delete(self.drv.files, self)
+	self.drv.mutex.Unlock()
+
+	if self.dir {
+		call(func() int {
+			return self.drv.fsop.Releasedir(self.getPath(), self.fh)
+		})
+		return nil
+	}
+	errc := call(func() int {
+		return self.drv.fsop.Flush(self.getPath(), self.fh)
+	})
+	call(func() int {
+		return self.drv.fsop.Release(self.getPath(), self.fh)
+	})
+	if 0 != errc && -fuse.ENOSYS != errc {
+		return pathError("close", self.name, errc)
+	}
+	return nil
+}
+
+// getPath returns the path of the file in the file system, which Rename may change.
+func (self *File) getPath() string {
+	self.drv.mutex.Lock()
+	defer self.drv.mutex.Unlock()
+	return self.path
+}
+
+func (self *File) check() int {
+	if self.done {
+		return -fuse.EBADF
+	}
+	return 0
+}
+
+// fileInfo implements fs.FileInfo over a fuse.Stat_t.
+type fileInfo struct {
+	name string
+	stat fuse.Stat_t
+}
+
+func newFileInfo(name string, stat *fuse.Stat_t) *fileInfo {
+	return &fileInfo{name, *stat}
+}
+
+func (self *fileInfo) Name() string {
+	return self.name
+}
+
+func (self *fileInfo) Size() int64 {
+	return self.stat.Size
+}
+
+func (self *fileInfo) Mode() fs.FileMode {
+	return fileModeFromMode(self.stat.Mode)
+}
+
+func (self *fileInfo) ModTime() time.Time {
+	return self.stat.Mtim.Time()
+}
+
+func (self *fileInfo) IsDir() bool {
+	return fuse.S_IFDIR == self.stat.Mode&fuse.S_IFMT
+}
+
+// Sys returns the *fuse.Stat_t that the file system returned from Getattr.
+func (self *fileInfo) Sys() interface{} {
+	return &self.stat
+}
+
+// dirEntry implements fs.DirEntry. If the file system did not pass a stat to the
+// Readdir fill function, the entry is looked up with Getattr when it is needed.
+type dirEntry struct {
+	drv   *Driver
+	dir   string
+	name  string
+	stat  fuse.Stat_t
+	valid bool
+}
+
+func (self *dirEntry) Name() string {
+	return self.name
+}
+
+func (self *dirEntry) IsDir() bool {
+	return self.Type().IsDir()
+}
+
+func (self *dirEntry) Type() fs.FileMode {
+	if !self.valid || 0 == self.stat.Mode&fuse.S_IFMT {
+		if _, err := self.Info(); nil != err {
+			return 0
+		}
+	}
+	return fileModeFromMode(self.stat.Mode).Type()
+}
+
+func (self *dirEntry) Info() (fs.FileInfo, error) {
+	if !self.valid || 0 == self.stat.Mode&fuse.S_IFMT {
+		p := path.Join(self.dir, self.name)
+		if errc := self.drv.getattr(p, &self.stat, fuse.InvalidHandle); 0 != errc {
+			return nil, pathError("lstat", p, errc)
+		}
+		self.valid = true
+	}
+	return newFileInfo(self.name, &self.stat), nil
+}
@@ -0,0 +1,133 @@
+/*
+ * handletab.go
+ *
+ * Copyright 2017-2022 Bill Zissimopoulos
+ */
+/*
+ * This file is part of Cgofuse.
+ *
+ * It is licensed under the MIT license. The full license text can be found
+ * in the License.txt file at the root of this project.
+ */
+
+package fuse
+
+import (
+	"sync"
+)
+
+// InvalidHandle is the fh value that the FUSE layer passes to file system operations
+// when no file handle is available (for example Getattr on a path that is not open).
+// It is also the fh value that Open, Opendir and Create return on failure.
+const InvalidHandle = ^uint64(0)
+
+// HandleTable allocates file handles (fh) and maps them to values of type T. It may be
+// used by a file system to implement Open/Release, Opendir/Releasedir and Create.
+// A HandleTable is safe for concurrent use.
+//
+// Every handle has a reference count, which is 1 when the handle is allocated by New.
+// Acquire adds a reference and Release drops one; the handle is freed when its last
+// reference is dropped. A handle is never InvalidHandle and it is not reused while it is
+// in use.
+//
+// The zero value of HandleTable is ready for use.
+type HandleTable[T any] struct {
+	mutex   sync.Mutex
+	next    uint64
+	entries map[uint64]*handleEntry[T]
+}
+
+type handleEntry[T any] struct {
+	value T
+	refs  int
+}
+
+// New allocates a handle for value.
+func (self *HandleTable[T]) New(value T) uint64 {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if nil == self.entries {
+		self.entries = make(map[uint64]*handleEntry[T])
+	}
+
+	for {
+		self.next++
+		if InvalidHandle == self.next {
+			continue
+		}
+		if _, ok := self.entries[self.next]; !ok {
+			break
+		}
+	}
+	self.entries[self.next] = &handleEntry[T]{value, 1}
+	return self.next
+}
+
+// Get gets the value of the handle fh. It returns false if fh is not a valid handle.
+func (self *HandleTable[T]) Get(fh uint64) (T, bool) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if e, ok := self.entries[fh]; ok {
+		return e.value, true
+	}
+	var zero T
+	return zero, false
+}
+
+// Acquire adds a reference to the handle fh and gets its value. It returns false if fh
+// is not a valid handle.
+func (self *HandleTable[T]) Acquire(fh uint64) (T, bool) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if e, ok := self.entries[fh]; ok {
+		e.refs++
+		return e.value, true
+	}
+	var zero T
+	return zero, false
+}
+
+// Release drops a reference to the handle fh. It returns the value of the handle, the
+// number of references that remain and true; when no references remain the handle is
+// freed. It returns false if fh is not a valid handle.
+func (self *HandleTable[T]) Release(fh uint64) (T, int, bool) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	e, ok := self.entries[fh]
+	if !ok {
+		var zero T
+		return zero, 0, false
+	}
+	e.refs--
+	if 0 == e.refs {
+		delete(self.entries, fh)
+	}
+	return e.value, e.refs, true
+}
+
+// Len returns the number of handles in use.
+func (self *HandleTable[T]) Len() int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return len(self.entries)
+}
+
+// Destroy frees all handles and returns the values of those that were still in use.
+// A file system can call it from its Destroy method to report (or clean up) the handles
+// that were never released.
+func (self *HandleTable[T]) Destroy() map[uint64]T {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	leaked := make(map[uint64]T, len(self.entries))
+	for fh, e := range self.entries {
+		leaked[fh] = e.value
+	}
+	self.entries = nil
+	return leaked
+}
@@ -0,0 +1,81 @@
+/*
+ * handletab_test.go
+ *
+ * Copyright 2017-2022 Bill Zissimopoulos
+ */
+/*
+ * This file is part of Cgofuse.
+ *
+ * It is licensed under the MIT license. The full license text can be found
+ * in the License.txt file at the root of this project.
+ */
+
+package fuse
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestHandleTable(t *testing.T) {
+	var tab HandleTable[string]
+
+	fh1 := tab.New("one")
+	fh2 := tab.New("two")
+	if InvalidHandle == fh1 || fh1 == fh2 {
+		t.Error("New returned bad handles", fh1, fh2)
+	}
+	if v, ok := tab.Get(fh1); !ok || "one" != v {
+		t.Error("Get failed", v, ok)
+	}
+	if _, ok := tab.Get(InvalidHandle); ok {
+		t.Error("Get of InvalidHandle succeeded")
+	}
+
+	if v, ok := tab.Acquire(fh1); !ok || "one" != v {
+		t.Error("Acquire failed", v, ok)
+	}
+	if v, refs, ok := tab.Release(fh1); !ok || "one" != v || 1 != refs {
+		t.Error("Release failed", v, refs, ok)
+	}
+	if v, refs, ok := tab.Release(fh1); !ok || "one" != v || 0 != refs {
+		t.Error("Release of last reference failed", v, refs, ok)
+	}
+	if _, _, ok := tab.Release(fh1); ok {
+		t.Error("Release of freed handle succeeded")
+	}
+	if 1 != tab.Len() {
+		t.Error("Len incorrect", tab.Len())
+	}
+
+	leaked := tab.Destroy()
+	if 1 != len(leaked) || "two" != leaked[fh2] {
+		t.Error("Destroy incorrect", leaked)
+	}
+	if 0 != tab.Len() {
+		t.Error("Len after Destroy incorrect", tab.Len())
+	}
+}
+
+func TestHandleTableConcurrent(t *testing.T) {
+	var tab HandleTable[int]
+	var wg sync.WaitGroup
+	for i := 0; 8 > i; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; 1000 > j; j++ {
+				fh := tab.New(i)
+				if v, ok := tab.Get(fh); !ok || i != v {
+					t.Error("Get failed", fh, v, ok)
+					return
+				}
+				tab.Release(fh)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if 0 != tab.Len() {
+		t.Error("Len incorrect", tab.Len())
+	}
+}
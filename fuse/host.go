@@ -13,23 +13,29 @@
 package fuse
 
 import (
+	"context"
 	"errors"
+	"io/ioutil"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 	"unsafe"
 )
 
 // FileSystemHost is used to host a file system.
 type FileSystemHost struct {
 	fsop FileSystemInterface
-	fuse *c_struct_fuse
+	fuse unsafe.Pointer // *c_struct_fuse; accessed atomically
 	mntp string
 	sigc chan os.Signal
+	sigs []os.Signal
 
 	capCaseInsensitive bool
 	capReaddirPlus     bool
@@ -37,6 +43,219 @@ type FileSystemHost struct {
 	capOpenTrunc       bool
 	directIO           bool
 	useIno             bool
+	config             *HostConfig
+	signals            *SignalConfig
+	diag               *hostDiag
+	initc              chan struct{}
+	inflight           int32
+	draining           int32
+	drainGuard         sync.Mutex
+	drainc             chan struct{} // closed when no operations are in flight
+}
+
+// HostConfig controls how the FUSE layer and the kernel cache file system information
+// and how they present file ownership and permissions. It is analogous to the FUSE
+// struct fuse_config (FUSE3) and to the equivalent mount options (FUSE2).
+type HostConfig struct {
+	// Time that the kernel caches name lookups.
+	EntryTimeout time.Duration
+
+	// Time that the kernel caches file attributes.
+	AttrTimeout time.Duration
+
+	// Time that the kernel caches failed name lookups.
+	NegativeTimeout time.Duration
+
+	// Keep the kernel cache of file contents when a file is opened.
+	KernelCache bool
+
+	// Keep the kernel cache of file contents when a file is opened, unless the file's
+	// size or modification time have changed.
+	AutoCache bool
+
+	// Time that AutoCache caches file attributes. If zero AttrTimeout is used.
+	AcAttrTimeout time.Duration
+
+	// Remove files immediately instead of renaming them to .fuse_hiddenXXX while open.
+	HardRemove bool
+
+	// Allow operations on open files without a path; such operations receive an
+	// empty path.
+	NullpathOk bool
+
+	// Override the permissions reported by Getattr with 0777 &^ Umask.
+	SetUmask bool
+	Umask    uint32
+
+	// Override the owner reported by Getattr with Uid.
+	SetUid bool
+	Uid    uint32
+
+	// Override the group reported by Getattr with Gid.
+	SetGid bool
+	Gid    uint32
+}
+
+// DefaultHostConfig returns the configuration that the FUSE layer uses by default.
+func DefaultHostConfig() HostConfig {
+	return HostConfig{
+		EntryTimeout: time.Second,
+		AttrTimeout:  time.Second,
+	}
+}
+
+// SignalConfig controls how the host handles signals while a file system is mounted
+// [Linux, macOS and BSD only; on Windows signals are handled by WinFsp].
+type SignalConfig struct {
+	// Do not handle any signals. The application is then responsible for unmounting the
+	// file system, for example by calling Unmount from its own signal handler; otherwise
+	// the file system may remain mounted after the process exits.
+	Disable bool
+
+	// Signals that unmount the file system.
+	Unmount []os.Signal
+
+	// Signals that are passed to Handler; for example, syscall.SIGHUP to have the file
+	// system reload its configuration. A signal that is also listed in Unmount unmounts
+	// the file system after Handler returns.
+	Notify []os.Signal
+
+	// Function that is called when one of the Notify signals is received. It is called
+	// from a goroutine owned by the host, after the file system Init() method and before
+	// its Destroy() method.
+	Handler func(sig os.Signal)
+}
+
+// DefaultSignalConfig returns the signal configuration that the host uses by default:
+// SIGINT and SIGTERM unmount the file system.
+func DefaultSignalConfig() SignalConfig {
+	return SignalConfig{
+		Unmount: []os.Signal{syscall.SIGINT, syscall.SIGTERM},
+	}
+}
+
+func hostSignalIn(sig os.Signal, sigs []os.Signal) bool {
+	for _, s := range sigs {
+		if sig == s {
+			return true
+		}
+	}
+	return false
+}
+
+// hostSignalListen starts a goroutine that handles the signals of config (or of the
+// DefaultSignalConfig if config is nil): it passes the Notify signals to the Handler and
+// calls unmount for the Unmount signals. It returns the channel and the signals to pass
+// to signal.Notify, or a nil channel if signal handling is disabled, and a function that
+// stops signal delivery to the channel and waits for the goroutine to exit.
+func hostSignalListen(config *SignalConfig, unmount func() bool) (
+	chan os.Signal, []os.Signal, func()) {
+	signals := DefaultSignalConfig()
+	if nil != config {
+		signals = *config
+	}
+	if signals.Disable {
+		return nil, nil, func() {}
+	}
+	sigs := append([]os.Signal{}, signals.Unmount...)
+	if nil != signals.Handler {
+		sigs = append(sigs, signals.Notify...)
+	}
+	sigc := make(chan os.Signal, 1)
+	done := make(chan bool)
+	go func() {
+		for sig := range sigc {
+			if nil != signals.Handler && hostSignalIn(sig, signals.Notify) {
+				signals.Handler(sig)
+			}
+			if hostSignalIn(sig, signals.Unmount) {
+				unmount()
+			}
+		}
+		close(done)
+	}()
+	return sigc, sigs, func() {
+		signal.Stop(sigc)
+		close(sigc)
+		<-done
+	}
+}
+
+// hostFuseVersion returns the version of the loaded FUSE library as major*100+minor,
+// or 0 if there is no FUSE library.
+func hostFuseVersion() int {
+	version := int(c_hostFuseVersion())
+	if 100 > version {
+		// FUSE2 encodes its version as major*10+minor
+		version = version/10*100 + version%10
+	}
+	return version
+}
+
+func hostConfigOptions(config *HostConfig) (opts []string, ignored []string) {
+	fuse3 := 30 <= c_hostFuseUseVersion()
+	version := hostFuseVersion()
+	supported := func(name string) bool {
+		switch {
+		case 0 == version:
+			return false
+		case "windows" == runtime.GOOS:
+			// WinFsp-FUSE supports the FUSE API, but only these libfuse options
+			return "Umask" == name || "Uid" == name || "Gid" == name
+		case "netbsd" == runtime.GOOS || "openbsd" == runtime.GOOS:
+			// librefuse and the OpenBSD FUSE library do not support libfuse options
+			return false
+		case "NullpathOk" == name:
+			// nullpath_ok was added in FUSE 2.8; the FUSE2 host passes it on Linux and
+			// FreeBSD only (see c_hostMount)
+			return 208 <= version &&
+				(fuse3 || "linux" == runtime.GOOS || "freebsd" == runtime.GOOS)
+		}
+		// the remaining options are supported since FUSE 2.6
+		return 206 <= version
+	}
+	add := func(name string, set bool, opt string) {
+		if !supported(name) {
+			if set {
+				ignored = append(ignored, name)
+			}
+			return
+		}
+		if !fuse3 && "" != opt {
+			opts = append(opts, opt)
+		}
+	}
+	seconds := func(d time.Duration) string {
+		return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+	}
+	flag := func(value bool, opt string) string {
+		if value {
+			return opt
+		}
+		return ""
+	}
+	add("EntryTimeout", 0 != config.EntryTimeout,
+		"entry_timeout="+seconds(config.EntryTimeout))
+	add("AttrTimeout", 0 != config.AttrTimeout,
+		"attr_timeout="+seconds(config.AttrTimeout))
+	add("NegativeTimeout", 0 != config.NegativeTimeout,
+		"negative_timeout="+seconds(config.NegativeTimeout))
+	add("KernelCache", config.KernelCache,
+		flag(config.KernelCache, "kernel_cache"))
+	add("AutoCache", config.AutoCache,
+		flag(config.AutoCache, "auto_cache"))
+	add("AcAttrTimeout", 0 != config.AcAttrTimeout,
+		flag(0 != config.AcAttrTimeout, "ac_attr_timeout="+seconds(config.AcAttrTimeout)))
+	add("HardRemove", config.HardRemove,
+		flag(config.HardRemove, "hard_remove"))
+	add("NullpathOk", config.NullpathOk, "") // FUSE2: passed to c_hostMount
+	add("Umask", config.SetUmask,
+		flag(config.SetUmask, "umask="+strconv.FormatUint(uint64(config.Umask), 8)))
+	add("Uid", config.SetUid,
+		flag(config.SetUid, "uid="+strconv.FormatUint(uint64(config.Uid), 10)))
+	add("Gid", config.SetGid,
+		flag(config.SetGid, "gid="+strconv.FormatUint(uint64(config.Gid), 10)))
+	return
 }
 
 var (
@@ -105,7 +324,139 @@ func copyFusetimespecFromCtimespec(dst *Timespec, src *c_fuse_timespec_t) {
 	dst.Nsec = int64(src.tv_nsec)
 }
 
+func copyFuselockFromCflock(dst *Lock_t, src *c_fuse_flock_t) {
+	dst.Type = int16(src.l_type)
+	dst.Whence = int16(src.l_whence)
+	dst.Start = int64(src.l_start)
+	dst.Len = int64(src.l_len)
+	dst.Pid = int(src.l_pid)
+}
+
+func copyCflockFromFuselock(dst *c_fuse_flock_t, src *Lock_t) {
+	c_hostCflockFromFuselock(dst,
+		c_int(src.Type),
+		c_int(src.Whence),
+		c_int64_t(src.Start),
+		c_int64_t(src.Len),
+		c_int64_t(src.Pid))
+}
+
+func copyCbufvecFromFusebufs(bufv unsafe.Pointer, bufs []Buf_t) c_int {
+	for i, buf := range bufs {
+		if 0 != buf.Flags&BUF_IS_FD {
+			c_hostBufvecSet(bufv, c_size_t(i),
+				c_uint32_t(buf.Flags), nil, c_size_t(buf.Size), c_int(buf.Fd), c_int64_t(buf.Pos))
+			continue
+		}
+		var mem unsafe.Pointer
+		if 0 < len(buf.Mem) {
+			mem = c_malloc(c_size_t(len(buf.Mem)))
+			if nil == mem {
+				return -c_int(ENOMEM)
+			}
+			copy((*[1 << 30]byte)(mem)[:len(buf.Mem)], buf.Mem)
+		}
+		c_hostBufvecSet(bufv, c_size_t(i),
+			c_uint32_t(buf.Flags), mem, c_size_t(len(buf.Mem)), -1, 0)
+	}
+	return 0
+}
+
+func copyFusebufsFromCbufvec(bufs []Buf_t, bufv unsafe.Pointer) {
+	for i := range bufs {
+		var flags c_uint32_t
+		var mem unsafe.Pointer
+		var size c_size_t
+		var fd c_int
+		var pos c_int64_t
+		c_hostBufvecGet(bufv, c_size_t(i), &flags, &mem, &size, &fd, &pos)
+		bufs[i] = Buf_t{
+			Size:  int(size),
+			Flags: uint32(flags),
+			Fd:    int(fd),
+			Pos:   int64(pos),
+		}
+		if 0 == flags&BUF_IS_FD && nil != mem {
+			bufs[i].Mem = (*[1 << 30]byte)(mem)[:size:size]
+		}
+	}
+}
+
+func copyConnInfoFromCconninfo(dst *ConnInfo, src *c_struct_fuse_conn_info) {
+	*dst = ConnInfo{}
+	c_hostConninfoGet(src,
+		(*c_uint32_t)(&dst.ProtoMajor),
+		(*c_uint32_t)(&dst.ProtoMinor),
+		(*c_uint32_t)(&dst.MaxWrite),
+		(*c_uint32_t)(&dst.MaxRead),
+		(*c_uint32_t)(&dst.MaxReadahead),
+		(*c_uint32_t)(&dst.Capable),
+		(*c_uint32_t)(&dst.Want),
+		(*c_uint32_t)(&dst.MaxBackground),
+		(*c_uint32_t)(&dst.CongestionThreshold),
+		(*c_uint32_t)(&dst.TimeGran))
+}
+
+func copyCconninfoFromConnInfo(dst *c_struct_fuse_conn_info, src *ConnInfo) {
+	c_hostConninfoSet(dst,
+		c_uint32_t(src.MaxWrite),
+		c_uint32_t(src.MaxRead),
+		c_uint32_t(src.MaxReadahead),
+		c_uint32_t(src.Want),
+		c_uint32_t(src.MaxBackground),
+		c_uint32_t(src.CongestionThreshold),
+		c_uint32_t(src.TimeGran))
+}
+
+// hostOptional returns the object that implements the optional interfaces of fsop
+// (FileSystemOpenEx, FileSystemChmod3, etc.).
+func hostOptional(fsop FileSystemInterface) interface{} {
+	switch intf := fsop.(type) {
+	case *fileSystemCtx:
+		return intf.fsop
+	case *fileSystemErr:
+		return intf.fsop
+	}
+	return fsop
+}
+
+// hostOpBegin is called at the beginning of every file system operation and returns
+// the host, which the operation passes to a deferred hostOpEnd. Operations that begin
+// while the host is draining (see UnmountDrain) fail with -ENOTCONN.
+func hostOpBegin() *FileSystemHost {
+	host := hostOpBeginRelease()
+	if 0 != atomic.LoadInt32(&host.draining) {
+		hostOpEnd(host)
+		panic(Error(-ENOTCONN))
+	}
+	return host
+}
+
+// hostOpBeginRelease is similar to hostOpBegin, but it is called by operations that
+// release resources (Flush, Release, Releasedir), which are allowed while draining.
+func hostOpBeginRelease() *FileSystemHost {
+	host := hostHandleGet(c_fuse_get_context().private_data)
+	atomic.AddInt32(&host.inflight, 1)
+	return host
+}
+
+// hostOpEnd is called at the end of every file system operation. It wakes up a
+// draining UnmountE when the last operation in flight completes.
+func hostOpEnd(host *FileSystemHost) {
+	if 0 == atomic.AddInt32(&host.inflight, -1) && 0 != atomic.LoadInt32(&host.draining) {
+		host.drainGuard.Lock()
+		if nil != host.drainc {
+			close(host.drainc)
+			host.drainc = nil
+		}
+		host.drainGuard.Unlock()
+	}
+}
+
 func recoverAsErrno(errc0 *c_int) {
+	// recoverAsErrno is deferred by every file system operation, which makes it
+	// the place to release per-operation state
+	hostOpctxDel()
 	if r := recover(); nil != r {
 		switch e := r.(type) {
 		case Error:
@@ -118,7 +469,9 @@ func recoverAsErrno(errc0 *c_int) {
 
 func hostGetattr(path0 *c_char, stat0 *c_fuse_stat_t, fi0 *c_struct_fuse_file_info) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
 	stat := &Stat_t{}
 	fifh := ^uint64(0)
@@ -132,7 +485,9 @@ func hostGetattr(path0 *c_char, stat0 *c_fuse_stat_t, fi0 *c_struct_fuse_file_in
 
 func hostReadlink(path0 *c_char, buff0 *c_char, size0 c_size_t) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
 	errc, rslt := fsop.Readlink(path)
 	buff := (*[1 << 30]byte)(unsafe.Pointer(buff0))
@@ -146,7 +501,9 @@ func hostReadlink(path0 *c_char, buff0 *c_char, size0 c_size_t) (errc0 c_int) {
 
 func hostMknod(path0 *c_char, mode0 c_fuse_mode_t, dev0 c_fuse_dev_t) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
 	errc := fsop.Mknod(path, uint32(mode0), uint64(dev0))
 	return c_int(errc)
@@ -154,7 +511,9 @@ func hostMknod(path0 *c_char, mode0 c_fuse_mode_t, dev0 c_fuse_dev_t) (errc0 c_i
 
 func hostMkdir(path0 *c_char, mode0 c_fuse_mode_t) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
 	errc := fsop.Mkdir(path, uint32(mode0))
 	return c_int(errc)
@@ -162,7 +521,9 @@ func hostMkdir(path0 *c_char, mode0 c_fuse_mode_t) (errc0 c_int) {
 
 func hostUnlink(path0 *c_char) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
 	errc := fsop.Unlink(path)
 	return c_int(errc)
@@ -170,7 +531,9 @@ func hostUnlink(path0 *c_char) (errc0 c_int) {
 
 func hostRmdir(path0 *c_char) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
 	errc := fsop.Rmdir(path)
 	return c_int(errc)
@@ -178,7 +541,9 @@ func hostRmdir(path0 *c_char) (errc0 c_int) {
 
 func hostSymlink(target0 *c_char, newpath0 *c_char) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	target, newpath := c_GoString(target0), c_GoString(newpath0)
 	errc := fsop.Symlink(target, newpath)
 	return c_int(errc)
@@ -186,9 +551,11 @@ func hostSymlink(target0 *c_char, newpath0 *c_char) (errc0 c_int) {
 
 func hostRename(oldpath0 *c_char, newpath0 *c_char, flags c_uint32_t) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	oldpath, newpath := c_GoString(oldpath0), c_GoString(newpath0)
-	intf, ok := fsop.(FileSystemRename3)
+	intf, ok := hostOptional(fsop).(FileSystemRename3)
 	if ok {
 		errc := intf.Rename3(oldpath, newpath, uint32(flags))
 		return c_int(errc)
@@ -204,7 +571,9 @@ func hostRename(oldpath0 *c_char, newpath0 *c_char, flags c_uint32_t) (errc0 c_i
 
 func hostLink(oldpath0 *c_char, newpath0 *c_char) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	oldpath, newpath := c_GoString(oldpath0), c_GoString(newpath0)
 	errc := fsop.Link(oldpath, newpath)
 	return c_int(errc)
@@ -212,9 +581,11 @@ func hostLink(oldpath0 *c_char, newpath0 *c_char) (errc0 c_int) {
 
 func hostChmod(path0 *c_char, mode0 c_fuse_mode_t, fi0 *c_struct_fuse_file_info) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
-	intf, ok := fsop.(FileSystemChmod3)
+	intf, ok := hostOptional(fsop).(FileSystemChmod3)
 	if ok {
 		fifh := ^uint64(0)
 		if nil != fi0 {
@@ -230,9 +601,11 @@ func hostChmod(path0 *c_char, mode0 c_fuse_mode_t, fi0 *c_struct_fuse_file_info)
 
 func hostChown(path0 *c_char, uid0 c_fuse_uid_t, gid0 c_fuse_gid_t, fi0 *c_struct_fuse_file_info) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
-	intf, ok := fsop.(FileSystemChown3)
+	intf, ok := hostOptional(fsop).(FileSystemChown3)
 	if ok {
 		fifh := ^uint64(0)
 		if nil != fi0 {
@@ -248,7 +621,9 @@ func hostChown(path0 *c_char, uid0 c_fuse_uid_t, gid0 c_fuse_gid_t, fi0 *c_struc
 
 func hostTruncate(path0 *c_char, size0 c_fuse_off_t, fi0 *c_struct_fuse_file_info) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
 	fifh := ^uint64(0)
 	if nil != fi0 {
@@ -260,9 +635,11 @@ func hostTruncate(path0 *c_char, size0 c_fuse_off_t, fi0 *c_struct_fuse_file_inf
 
 func hostOpen(path0 *c_char, fi0 *c_struct_fuse_file_info) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
-	intf, ok := fsop.(FileSystemOpenEx)
+	intf, ok := hostOptional(fsop).(FileSystemOpenEx)
 	if ok {
 		fi := FileInfo_t{Flags: int(fi0.flags)}
 		errc := intf.OpenEx(path, &fi)
@@ -282,7 +659,9 @@ func hostOpen(path0 *c_char, fi0 *c_struct_fuse_file_info) (errc0 c_int) {
 func hostRead(path0 *c_char, buff0 *c_char, size0 c_size_t, ofst0 c_fuse_off_t,
 	fi0 *c_struct_fuse_file_info) (nbyt0 c_int) {
 	defer recoverAsErrno(&nbyt0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
 	buff := (*[1 << 30]byte)(unsafe.Pointer(buff0))
 	nbyt := fsop.Read(path, buff[:size0], int64(ofst0), uint64(fi0.fh))
@@ -292,7 +671,9 @@ func hostRead(path0 *c_char, buff0 *c_char, size0 c_size_t, ofst0 c_fuse_off_t,
 func hostWrite(path0 *c_char, buff0 *c_char, size0 c_size_t, ofst0 c_fuse_off_t,
 	fi0 *c_struct_fuse_file_info) (nbyt0 c_int) {
 	defer recoverAsErrno(&nbyt0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
 	buff := (*[1 << 30]byte)(unsafe.Pointer(buff0))
 	nbyt := fsop.Write(path, buff[:size0], int64(ofst0), uint64(fi0.fh))
@@ -301,7 +682,9 @@ func hostWrite(path0 *c_char, buff0 *c_char, size0 c_size_t, ofst0 c_fuse_off_t,
 
 func hostStatfs(path0 *c_char, stat0 *c_fuse_statvfs_t) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
 	stat := &Statfs_t{}
 	errc := fsop.Statfs(path, stat)
@@ -315,7 +698,9 @@ func hostStatfs(path0 *c_char, stat0 *c_fuse_statvfs_t) (errc0 c_int) {
 
 func hostFlush(path0 *c_char, fi0 *c_struct_fuse_file_info) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBeginRelease()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
 	errc := fsop.Flush(path, uint64(fi0.fh))
 	return c_int(errc)
@@ -323,15 +708,24 @@ func hostFlush(path0 *c_char, fi0 *c_struct_fuse_file_info) (errc0 c_int) {
 
 func hostRelease(path0 *c_char, fi0 *c_struct_fuse_file_info) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBeginRelease()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
+	if c_hostFlockRelease(fi0) {
+		if intf, ok := hostOptional(fsop).(FileSystemFlock); ok {
+			intf.Flock(path, LOCK_UN, uint64(fi0.lock_owner), uint64(fi0.fh))
+		}
+	}
 	errc := fsop.Release(path, uint64(fi0.fh))
 	return c_int(errc)
 }
 
 func hostFsync(path0 *c_char, datasync c_int, fi0 *c_struct_fuse_file_info) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
 	errc := fsop.Fsync(path, 0 != datasync, uint64(fi0.fh))
 	if -ENOSYS == errc {
@@ -343,7 +737,9 @@ func hostFsync(path0 *c_char, datasync c_int, fi0 *c_struct_fuse_file_info) (err
 func hostSetxattr(path0 *c_char, name0 *c_char, buff0 *c_char, size0 c_size_t,
 	flags c_int) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
 	name := c_GoString(name0)
 	buff := (*[1 << 30]byte)(unsafe.Pointer(buff0))
@@ -353,7 +749,9 @@ func hostSetxattr(path0 *c_char, name0 *c_char, buff0 *c_char, size0 c_size_t,
 
 func hostGetxattr(path0 *c_char, name0 *c_char, buff0 *c_char, size0 c_size_t) (nbyt0 c_int) {
 	defer recoverAsErrno(&nbyt0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
 	name := c_GoString(name0)
 	errc, rslt := fsop.Getxattr(path, name)
@@ -372,7 +770,9 @@ func hostGetxattr(path0 *c_char, name0 *c_char, buff0 *c_char, size0 c_size_t) (
 
 func hostListxattr(path0 *c_char, buff0 *c_char, size0 c_size_t) (nbyt0 c_int) {
 	defer recoverAsErrno(&nbyt0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
 	buff := (*[1 << 30]byte)(unsafe.Pointer(buff0))
 	size := int(size0)
@@ -398,7 +798,9 @@ func hostListxattr(path0 *c_char, buff0 *c_char, size0 c_size_t) (nbyt0 c_int) {
 
 func hostRemovexattr(path0 *c_char, name0 *c_char) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
 	name := c_GoString(name0)
 	errc := fsop.Removexattr(path, name)
@@ -407,7 +809,9 @@ func hostRemovexattr(path0 *c_char, name0 *c_char) (errc0 c_int) {
 
 func hostOpendir(path0 *c_char, fi0 *c_struct_fuse_file_info) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
 	errc, rslt := fsop.Opendir(path)
 	if -ENOSYS == errc {
@@ -418,10 +822,16 @@ func hostOpendir(path0 *c_char, fi0 *c_struct_fuse_file_info) (errc0 c_int) {
 }
 
 func hostReaddir(path0 *c_char, buff0 unsafe.Pointer, fill0 c_fuse_fill_dir_t, ofst0 c_fuse_off_t,
-	fi0 *c_struct_fuse_file_info) (errc0 c_int) {
+	fi0 *c_struct_fuse_file_info, flags uint32) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
+	if "windows" == runtime.GOOS && host.capReaddirPlus {
+		// WinFsp uses the stat information of every Readdir call
+		flags |= READDIR_PLUS
+	}
 	fill := func(name1 string, stat1 *Stat_t, off1 int64) bool {
 		name := c_CString(name1)
 		defer c_free(unsafe.Pointer(name))
@@ -434,13 +844,19 @@ func hostReaddir(path0 *c_char, buff0 unsafe.Pointer, fill0 c_fuse_fill_dir_t, o
 			return 0 == c_hostFilldir(fill0, buff0, name, stat, c_fuse_off_t(off1))
 		}
 	}
+	if intf, ok := hostOptional(fsop).(FileSystemReaddir3); ok {
+		errc := intf.Readdir3(path, fill, int64(ofst0), uint64(fi0.fh), flags)
+		return c_int(errc)
+	}
 	errc := fsop.Readdir(path, fill, int64(ofst0), uint64(fi0.fh))
 	return c_int(errc)
 }
 
 func hostReleasedir(path0 *c_char, fi0 *c_struct_fuse_file_info) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBeginRelease()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
 	errc := fsop.Releasedir(path, uint64(fi0.fh))
 	return c_int(errc)
@@ -448,7 +864,9 @@ func hostReleasedir(path0 *c_char, fi0 *c_struct_fuse_file_info) (errc0 c_int) {
 
 func hostFsyncdir(path0 *c_char, datasync c_int, fi0 *c_struct_fuse_file_info) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
 	errc := fsop.Fsyncdir(path, 0 != datasync, uint64(fi0.fh))
 	if -ENOSYS == errc {
@@ -464,17 +882,56 @@ func hostInit(conn0 *c_struct_fuse_conn_info, conf0 *c_struct_fuse_config) (user
 	fctx := c_fuse_get_context()
 	user_data = fctx.private_data
 	host := hostHandleGet(user_data)
-	host.fuse = fctx.fuse
+	atomic.StorePointer(&host.fuse, unsafe.Pointer(fctx.fuse))
+	_, capPosixLocks := hostOptional(host.fsop).(FileSystemLock)
+	_, capFlockLocks := hostOptional(host.fsop).(FileSystemFlock)
+	_, capSpliceWrite := hostOptional(host.fsop).(FileSystemReadBuf)
+	_, capSpliceRead := hostOptional(host.fsop).(FileSystemWriteBuf)
 	c_hostAsgnCconninfo(conn0,
 		c_bool(host.capCaseInsensitive),
 		c_bool(host.capReaddirPlus),
 		c_bool(host.capDeleteAccess),
-		c_bool(host.capOpenTrunc))
+		c_bool(host.capOpenTrunc),
+		c_bool(capPosixLocks),
+		c_bool(capFlockLocks),
+		c_bool(capSpliceWrite),
+		c_bool(capSpliceRead))
 	c_hostAsgnCconfig(conf0,
 		c_bool(host.directIO),
 		c_bool(host.useIno))
-	if nil != host.sigc {
-		signal.Notify(host.sigc, syscall.SIGINT, syscall.SIGTERM)
+	if nil != host.config {
+		c := host.config
+		c_hostAsgnCconfigEx(conf0,
+			c_double(c.EntryTimeout.Seconds()),
+			c_double(c.AttrTimeout.Seconds()),
+			c_double(c.NegativeTimeout.Seconds()),
+			c_bool(c.KernelCache),
+			c_bool(c.AutoCache),
+			c_bool(0 != c.AcAttrTimeout),
+			c_double(c.AcAttrTimeout.Seconds()),
+			c_bool(c.HardRemove),
+			c_bool(c.NullpathOk),
+			c_bool(c.SetUmask),
+			c_uint32_t(c.Umask),
+			c_bool(c.SetUid),
+			c_uint32_t(c.Uid),
+			c_bool(c.SetGid),
+			c_uint32_t(c.Gid))
+	}
+	if nil != host.sigc && 0 < len(host.sigs) {
+		signal.Notify(host.sigc, host.sigs...)
+	}
+	// the file system is mounted; the FUSE layer output is no longer diagnostic
+	host.diag.flush()
+	if nil != host.initc {
+		defer close(host.initc)
+	}
+	if intf, ok := hostOptional(host.fsop).(FileSystemInitEx); ok {
+		var conn ConnInfo
+		copyConnInfoFromCconninfo(&conn, conn0)
+		intf.InitEx(&conn)
+		copyCconninfoFromConnInfo(conn0, &conn)
+		return
 	}
 	host.fsop.Init()
 	return
@@ -492,12 +949,14 @@ func hostDestroy(user_data unsafe.Pointer) {
 	if nil != host.sigc {
 		signal.Stop(host.sigc)
 	}
-	host.fuse = nil
+	atomic.StorePointer(&host.fuse, nil)
 }
 
 func hostAccess(path0 *c_char, mask0 c_int) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
 	errc := fsop.Access(path, uint32(mask0))
 	return c_int(errc)
@@ -505,9 +964,11 @@ func hostAccess(path0 *c_char, mask0 c_int) (errc0 c_int) {
 
 func hostCreate(path0 *c_char, mode0 c_fuse_mode_t, fi0 *c_struct_fuse_file_info) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
-	intf, ok := fsop.(FileSystemOpenEx)
+	intf, ok := hostOptional(fsop).(FileSystemOpenEx)
 	if ok {
 		fi := FileInfo_t{Flags: int(fi0.flags)}
 		errc := intf.CreateEx(path, uint32(mode0), &fi)
@@ -538,7 +999,9 @@ func hostCreate(path0 *c_char, mode0 c_fuse_mode_t, fi0 *c_struct_fuse_file_info
 
 func hostFtruncate(path0 *c_char, size0 c_fuse_off_t, fi0 *c_struct_fuse_file_info) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
 	errc := fsop.Truncate(path, int64(size0), uint64(fi0.fh))
 	return c_int(errc)
@@ -547,7 +1010,9 @@ func hostFtruncate(path0 *c_char, size0 c_fuse_off_t, fi0 *c_struct_fuse_file_in
 func hostFgetattr(path0 *c_char, stat0 *c_fuse_stat_t,
 	fi0 *c_struct_fuse_file_info) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
 	stat := &Stat_t{}
 	errc := fsop.Getattr(path, stat, uint64(fi0.fh))
@@ -555,9 +1020,245 @@ func hostFgetattr(path0 *c_char, stat0 *c_fuse_stat_t,
 	return c_int(errc)
 }
 
+func hostLock(path0 *c_char, fi0 *c_struct_fuse_file_info, cmd0 c_int,
+	lock0 *c_fuse_flock_t) (errc0 c_int) {
+	defer recoverAsErrno(&errc0)
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
+	intf, ok := hostOptional(fsop).(FileSystemLock)
+	if !ok {
+		return -c_int(ENOSYS)
+	}
+	path := c_GoString(path0)
+	lock := Lock_t{}
+	copyFuselockFromCflock(&lock, lock0)
+	lock.Owner = uint64(fi0.lock_owner)
+	errc := intf.Lock(path, int(cmd0), &lock, uint64(fi0.fh))
+	if 0 == errc && F_GETLK == cmd0 {
+		copyCflockFromFuselock(lock0, &lock)
+	}
+	return c_int(errc)
+}
+
+func hostFlock(path0 *c_char, fi0 *c_struct_fuse_file_info, op0 c_int) (errc0 c_int) {
+	defer recoverAsErrno(&errc0)
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
+	intf, ok := hostOptional(fsop).(FileSystemFlock)
+	if !ok {
+		return -c_int(ENOSYS)
+	}
+	path := c_GoString(path0)
+	errc := intf.Flock(path, int(op0), uint64(fi0.lock_owner), uint64(fi0.fh))
+	return c_int(errc)
+}
+
+func hostFallocate(path0 *c_char, mode0 c_int, ofst0 c_fuse_off_t, len0 c_fuse_off_t,
+	fi0 *c_struct_fuse_file_info) (errc0 c_int) {
+	defer recoverAsErrno(&errc0)
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
+	intf, ok := hostOptional(fsop).(FileSystemFallocate)
+	if !ok {
+		return -c_int(ENOSYS)
+	}
+	path := c_GoString(path0)
+	fifh := ^uint64(0)
+	if nil != fi0 {
+		fifh = uint64(fi0.fh)
+	}
+	errc := intf.Fallocate(path, uint32(mode0), int64(ofst0), int64(len0), fifh)
+	return c_int(errc)
+}
+
+func hostCopyFileRange(pathIn0 *c_char, fiIn0 *c_struct_fuse_file_info, ofstIn0 c_fuse_off_t,
+	pathOut0 *c_char, fiOut0 *c_struct_fuse_file_info, ofstOut0 c_fuse_off_t,
+	size0 c_size_t, flags0 c_int) (nbyt0 c_int) {
+	defer recoverAsErrno(&nbyt0)
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
+	intf, ok := hostOptional(fsop).(FileSystemCopyFileRange)
+	if !ok {
+		return -c_int(ENOSYS)
+	}
+	pathIn := c_GoString(pathIn0)
+	pathOut := c_GoString(pathOut0)
+	fifhIn := ^uint64(0)
+	if nil != fiIn0 {
+		fifhIn = uint64(fiIn0.fh)
+	}
+	fifhOut := ^uint64(0)
+	if nil != fiOut0 {
+		fifhOut = uint64(fiOut0.fh)
+	}
+	nbyt := intf.CopyFileRange(
+		pathIn, fifhIn, int64(ofstIn0),
+		pathOut, fifhOut, int64(ofstOut0),
+		int64(size0), int(flags0))
+	return c_int(nbyt)
+}
+
+func hostLseek(path0 *c_char, ofst0 c_fuse_off_t, whence0 c_int, fi0 *c_struct_fuse_file_info,
+	rofst0 *c_fuse_off_t) (errc0 c_int) {
+	defer recoverAsErrno(&errc0)
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
+	intf, ok := hostOptional(fsop).(FileSystemLseek)
+	if !ok {
+		return -c_int(ENOSYS)
+	}
+	path := c_GoString(path0)
+	fifh := ^uint64(0)
+	if nil != fi0 {
+		fifh = uint64(fi0.fh)
+	}
+	errc, rofst := intf.Lseek(path, int64(ofst0), int(whence0), fifh)
+	*rofst0 = c_fuse_off_t(rofst)
+	return c_int(errc)
+}
+
+func hostIoctl(path0 *c_char, cmd0 c_unsigned, arg0 c_uintptr_t, fi0 *c_struct_fuse_file_info,
+	flags0 c_unsigned, data0 unsafe.Pointer) (errc0 c_int) {
+	defer recoverAsErrno(&errc0)
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
+	intf, ok := hostOptional(fsop).(FileSystemIoctl)
+	if !ok {
+		return -c_int(ENOTTY)
+	}
+	path := c_GoString(path0)
+	fifh := ^uint64(0)
+	if nil != fi0 {
+		fifh = uint64(fi0.fh)
+	}
+	cmd := IoctlCmd(cmd0)
+	var in, out []byte
+	if size := cmd.Size(); 0 < size && nil != data0 {
+		// restricted ioctl: the FUSE layer has transferred exactly cmd.Size() bytes
+		data := (*[1 << 30]byte)(data0)[:size:size]
+		if cmd.In() {
+			in = data
+		}
+		if cmd.Out() {
+			out = data
+		}
+	}
+	errc := intf.Ioctl(path, cmd, uint64(arg0), fifh, uint32(flags0), in, out)
+	return c_int(errc)
+}
+
+func hostPoll(path0 *c_char, fi0 *c_struct_fuse_file_info, ph0 unsafe.Pointer,
+	revents0 *c_unsigned) (errc0 c_int) {
+	defer recoverAsErrno(&errc0)
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	intf, ok := hostOptional(host.fsop).(FileSystemPoll)
+	if !ok {
+		if nil != ph0 {
+			c_hostPollhandleDestroy(ph0)
+		}
+		return -c_int(ENOSYS)
+	}
+	path := c_GoString(path0)
+	fifh := ^uint64(0)
+	if nil != fi0 {
+		fifh = uint64(fi0.fh)
+	}
+	var ph *PollHandle
+	if nil != ph0 {
+		ph = newPollHandle(host, ph0)
+	}
+	errc, revents := intf.Poll(path, ph, fifh)
+	*revents0 = c_unsigned(revents)
+	return c_int(errc)
+}
+
+func hostReadBuf(path0 *c_char, bufp0 *unsafe.Pointer, size0 c_size_t, ofst0 c_fuse_off_t,
+	fi0 *c_struct_fuse_file_info) (errc0 c_int) {
+	defer recoverAsErrno(&errc0)
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
+	path := c_GoString(path0)
+	// The FUSE layer frees *bufp0 and its memory buffers, even when we fail.
+	if intf, ok := hostOptional(fsop).(FileSystemReadBuf); ok {
+		errc, bufs := intf.ReadBuf(path, int(size0), int64(ofst0), uint64(fi0.fh))
+		if -ENOSYS != errc {
+			if 0 > errc {
+				return c_int(errc)
+			}
+			bufv := c_hostBufvecNew(c_size_t(len(bufs)))
+			if nil == bufv {
+				return -c_int(ENOMEM)
+			}
+			*bufp0 = bufv
+			return copyCbufvecFromFusebufs(bufv, bufs)
+		}
+	}
+	bufv := c_hostBufvecNew(1)
+	if nil == bufv {
+		return -c_int(ENOMEM)
+	}
+	*bufp0 = bufv
+	allocsize := size0
+	if 0 == allocsize {
+		allocsize = 1
+	}
+	mem := c_malloc(allocsize)
+	if nil == mem {
+		return -c_int(ENOMEM)
+	}
+	c_hostBufvecSet(bufv, 0, 0, mem, 0, -1, 0)
+	buff := (*[1 << 30]byte)(mem)
+	nbyt := fsop.Read(path, buff[:size0], int64(ofst0), uint64(fi0.fh))
+	if 0 > nbyt {
+		return c_int(nbyt)
+	}
+	c_hostBufvecSet(bufv, 0, 0, mem, c_size_t(nbyt), -1, 0)
+	return 0
+}
+
+func hostWriteBuf(path0 *c_char, bufv0 unsafe.Pointer, ofst0 c_fuse_off_t,
+	fi0 *c_struct_fuse_file_info) (nbyt0 c_int) {
+	defer recoverAsErrno(&nbyt0)
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
+	path := c_GoString(path0)
+	bufs := make([]Buf_t, c_hostBufvecCount(bufv0))
+	copyFusebufsFromCbufvec(bufs, bufv0)
+	if intf, ok := hostOptional(fsop).(FileSystemWriteBuf); ok {
+		nbyt := intf.WriteBuf(path, bufs, int64(ofst0), uint64(fi0.fh))
+		if -ENOSYS != nbyt {
+			return c_int(nbyt)
+		}
+	}
+	if 1 == len(bufs) && 0 == bufs[0].Flags&BUF_IS_FD {
+		nbyt := fsop.Write(path, bufs[0].Mem, int64(ofst0), uint64(fi0.fh))
+		return c_int(nbyt)
+	}
+	var mem unsafe.Pointer
+	var size c_size_t
+	if errc := c_hostBufvecFlatten(bufv0, &mem, &size); 0 != errc {
+		return errc
+	}
+	defer c_free(mem)
+	buff := (*[1 << 30]byte)(mem)
+	nbyt := fsop.Write(path, buff[:size], int64(ofst0), uint64(fi0.fh))
+	return c_int(nbyt)
+}
+
 func hostUtimens(path0 *c_char, tmsp0 *c_fuse_timespec_t, fi0 *c_struct_fuse_file_info) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
 	path := c_GoString(path0)
 	tmsp := [2]Timespec{}
 	if nil == tmsp0 {
@@ -571,7 +1272,7 @@ func hostUtimens(path0 *c_char, tmsp0 *c_fuse_timespec_t, fi0 *c_struct_fuse_fil
 		copyFusetimespecFromCtimespec(&tmsp[0], &tmsa[0])
 		copyFusetimespecFromCtimespec(&tmsp[1], &tmsa[1])
 	}
-	intf, ok := fsop.(FileSystemUtimens3)
+	intf, ok := hostOptional(fsop).(FileSystemUtimens3)
 	if ok {
 		fifh := ^uint64(0)
 		if nil != fi0 {
@@ -588,8 +1289,10 @@ func hostUtimens(path0 *c_char, tmsp0 *c_fuse_timespec_t, fi0 *c_struct_fuse_fil
 func hostGetpath(path0 *c_char, buff0 *c_char, size0 c_size_t,
 	fi0 *c_struct_fuse_file_info) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
-	intf, ok := fsop.(FileSystemGetpath)
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
+	intf, ok := hostOptional(fsop).(FileSystemGetpath)
 	if !ok {
 		return -c_int(ENOSYS)
 	}
@@ -610,8 +1313,10 @@ func hostGetpath(path0 *c_char, buff0 *c_char, size0 c_size_t,
 
 func hostSetchgtime(path0 *c_char, tmsp0 *c_fuse_timespec_t) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
-	intf, ok := fsop.(FileSystemSetchgtime)
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
+	intf, ok := hostOptional(fsop).(FileSystemSetchgtime)
 	if !ok {
 		// say we did it!
 		return 0
@@ -625,8 +1330,10 @@ func hostSetchgtime(path0 *c_char, tmsp0 *c_fuse_timespec_t) (errc0 c_int) {
 
 func hostSetcrtime(path0 *c_char, tmsp0 *c_fuse_timespec_t) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
-	intf, ok := fsop.(FileSystemSetcrtime)
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
+	intf, ok := hostOptional(fsop).(FileSystemSetcrtime)
 	if !ok {
 		// say we did it!
 		return 0
@@ -640,8 +1347,10 @@ func hostSetcrtime(path0 *c_char, tmsp0 *c_fuse_timespec_t) (errc0 c_int) {
 
 func hostChflags(path0 *c_char, flags c_uint32_t) (errc0 c_int) {
 	defer recoverAsErrno(&errc0)
-	fsop := hostHandleGet(c_fuse_get_context().private_data).fsop
-	intf, ok := fsop.(FileSystemChflags)
+	host := hostOpBegin()
+	defer hostOpEnd(host)
+	fsop := host.fsop
+	intf, ok := hostOptional(fsop).(FileSystemChflags)
 	if !ok {
 		// say we did it!
 		return 0
@@ -658,6 +1367,22 @@ func NewFileSystemHost(fsop FileSystemInterface) *FileSystemHost {
 	return host
 }
 
+// NewFileSystemHostCtx creates a file system host for a file system that implements
+// FileSystemInterfaceCtx.
+func NewFileSystemHostCtx(fsop FileSystemInterfaceCtx) *FileSystemHost {
+	host := &FileSystemHost{}
+	host.fsop = NewFileSystemCtxAdapter(fsop, nil)
+	return host
+}
+
+// NewFileSystemHostErr creates a file system host for a file system that implements
+// FileSystemInterfaceErr.
+func NewFileSystemHostErr(fsop FileSystemInterfaceErr) *FileSystemHost {
+	host := &FileSystemHost{}
+	host.fsop = NewFileSystemErrAdapter(fsop)
+	return host
+}
+
 // SetCapCaseInsensitive informs the host that the hosted file system is case insensitive
 // [OSX and Windows only].
 func (host *FileSystemHost) SetCapCaseInsensitive(value bool) {
@@ -665,8 +1390,9 @@ func (host *FileSystemHost) SetCapCaseInsensitive(value bool) {
 }
 
 // SetCapReaddirPlus informs the host that the hosted file system has the readdir-plus
-// capability [Linux and Windows only]. A file system that has the readdir-plus capability can send
-// full stat information during Readdir, thus avoiding extraneous Getattr calls.
+// capability [FUSE3 on Linux and FreeBSD, and Windows only]. A file system that has the
+// readdir-plus capability can send full stat information during Readdir, thus avoiding
+// extraneous Getattr calls. See also FileSystemReaddir3.
 func (host *FileSystemHost) SetCapReaddirPlus(value bool) {
 	host.capReaddirPlus = value
 }
@@ -696,6 +1422,30 @@ func (host *FileSystemHost) SetUseIno(value bool) {
 	host.useIno = value
 }
 
+// SetConfig sets the configuration of the FUSE layer. It returns the names of the
+// HostConfig fields that are set but are not supported by the FUSE layer and will be
+// ignored; this depends on the FUSE library that is loaded and its version. Must be set
+// before Mount is called.
+//
+// If SetConfig is not called the FUSE layer uses its own defaults and any mount options
+// in opts (see DefaultHostConfig). Note however that on FUSE3 the host clears all caching
+// and timeout options unless SetConfig is called.
+func (host *FileSystemHost) SetConfig(config HostConfig) (ignored []string) {
+	host.config = &config
+	_, ignored = hostConfigOptions(&config)
+	return
+}
+
+// SetSignalConfig sets how the host handles signals while the file system is mounted
+// [Linux, macOS and BSD only]. Must be set before Mount is called.
+//
+// If SetSignalConfig is not called SIGINT and SIGTERM unmount the file system (see
+// DefaultSignalConfig). In all cases the host stops handling signals once the file system
+// is unmounted.
+func (host *FileSystemHost) SetSignalConfig(config SignalConfig) {
+	host.signals = &config
+}
+
 // Mount mounts a file system on the given mountpoint with the mount options in opts.
 //
 // Many of the mount options in opts are specific to the underlying FUSE implementation.
@@ -720,19 +1470,193 @@ func (host *FileSystemHost) Mount(mountpoint string, opts []string) bool {
 		}
 	}
 
+	return host.mount(mountpoint, opts, nil, nil)
+}
+
+// MountE is similar to Mount except that it returns a *MountError that describes why
+// the file system could not be mounted, rather than false. It also reports a missing FUSE
+// library as a MountError rather than a panic.
+//
+// While the file system is being mounted MountE captures the diagnostic output that the
+// FUSE layer (including fusermount) writes to the standard error, so that it can be
+// included in the MountError. If the file system is mounted successfully the captured
+// output is written to the standard error. Note that the FUSE library writes to the
+// standard error of the process, so it is redirected during this time: output that other
+// goroutines write to the standard error meanwhile ends up in the MountError Message
+// rather than on the standard error (unless the mount succeeds), and concurrent calls
+// to MountE or Start wait for each other to finish mounting. [Capture is not supported
+// on Windows; on Linux without cgo only the output of the mount itself is captured and
+// the standard error of the process is not redirected]
+func (host *FileSystemHost) MountE(mountpoint string, opts []string) error {
+	if 0 == c_hostFuseInit() {
+		return &MountError{Kind: MountErrLibrary}
+	}
+
+	return host.mountE(mountpoint, opts, nil)
+}
+
+// mountE is MountE that closes initc after the Init() method has been called.
+func (host *FileSystemHost) mountE(mountpoint string, opts []string,
+	initc chan struct{}) error {
+	diag := hostDiagNew()
+	if host.mount(mountpoint, opts, diag, initc) {
+		// the output of a mount that did not call Init (e.g. -h) is not diagnostic
+		diag.flush()
+		return nil
+	}
+	return newMountError(diag.stop())
+}
+
+// Mount represents a file system that has been mounted by FileSystemHost.Start.
+type Mount struct {
+	host  *FileSystemHost
+	ready chan struct{}
+	done  chan struct{}
+	err   error
+}
+
+// Start mounts a file system on the given mountpoint with the mount options in opts,
+// similar to MountE. Unlike MountE, Start does not block until the file system is
+// unmounted. Instead it returns a Mount after the Init() method has been called and the
+// mountpoint is live and serving file system operations. If the file system cannot be
+// mounted Start returns a *MountError.
+func (host *FileSystemHost) Start(mountpoint string, opts []string) (*Mount, error) {
+	return host.StartContext(context.Background(), mountpoint, opts)
+}
+
+// StartContext is similar to Start except that the file system is unmounted when ctx is
+// done. If ctx is done before the mountpoint is live, StartContext returns ctx.Err()
+// right away together with the Mount: the file system is unmounted as soon as its Init()
+// method has been called (if it ever is), and the Mount can be used to Wait for this.
+func (host *FileSystemHost) StartContext(ctx context.Context,
+	mountpoint string, opts []string) (*Mount, error) {
+	if 0 == c_hostFuseInit() {
+		return nil, &MountError{Kind: MountErrLibrary}
+	}
+
+	mount := &Mount{
+		host:  host,
+		ready: make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	/*
+	 * Readiness detection
+	 *
+	 * Init() may be called before the mountpoint is visible. So after Init() we also wait
+	 * until stat() of the mountpoint reports a different device than before mounting
+	 * (or fails, in which case the failure came from the file system). On Windows we
+	 * wait until the mountpoint exists.
+	 */
+	mntp := hostMountpoint(mountpoint, opts)
+	var cmntp *c_char
+	var dev0 c_uint64_t
+	if "" != mntp && "windows" != runtime.GOOS {
+		cmntp = c_CString(mntp)
+		c_hostStatDev(cmntp, &dev0)
+	}
+	initc := make(chan struct{})
+	go func() {
+		mount.err = host.mountE(mountpoint, opts, initc)
+		close(mount.done)
+	}()
+	go func() {
+		if nil != cmntp {
+			defer c_free(unsafe.Pointer(cmntp))
+		}
+		select {
+		case <-initc:
+		case <-mount.done:
+			return
+		}
+		for {
+			if "" == mntp {
+				break
+			} else if nil != cmntp {
+				var dev c_uint64_t
+				if 0 != c_hostStatDev(cmntp, &dev) || dev0 != dev {
+					break
+				}
+			} else if _, err := os.Stat(mntp); nil == err {
+				break
+			}
+			select {
+			case <-time.After(10 * time.Millisecond):
+			case <-mount.done:
+				return
+			}
+		}
+		close(mount.ready)
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			// the file system can be unmounted once Init() has been called
+			select {
+			case <-initc:
+				host.Unmount()
+			case <-mount.done:
+			}
+		case <-mount.done:
+		}
+	}()
+
+	select {
+	case <-mount.ready:
+		return mount, nil
+	case <-mount.done:
+		return nil, mount.err
+	case <-ctx.Done():
+		return mount, ctx.Err()
+	}
+}
+
+// Ready returns a channel that is closed when the file system is mounted and serving
+// file system operations. The channel is already closed when Start returns successfully.
+func (mount *Mount) Ready() <-chan struct{} {
+	return mount.ready
+}
+
+// Done returns a channel that is closed when the file system has been unmounted.
+func (mount *Mount) Done() <-chan struct{} {
+	return mount.done
+}
+
+// Wait waits until the file system has been unmounted. It returns nil if the file system
+// was unmounted normally (including by Unmount, a signal or the Start context) or a
+// *MountError otherwise.
+func (mount *Mount) Wait() error {
+	<-mount.done
+	return mount.err
+}
+
+// Unmount unmounts the file system. It does not wait until the file system has been
+// unmounted; use Wait for this purpose.
+func (mount *Mount) Unmount() bool {
+	return mount.host.Unmount()
+}
+
+func (host *FileSystemHost) mount(mountpoint string, opts []string,
+	diag *hostDiag, initc chan struct{}) bool {
 	/*
 	 * Command line handling
 	 *
 	 * We must prepare a command line to send to FUSE. This command line will look like this:
 	 *
-	 *     execname [mountpoint] "-f" [opts...] NULL
+	 *     execname [mountpoint] "-f" [config opts...] [opts...] NULL
 	 *
 	 * We add the "-f" option because Go cannot handle daemonization (at least on OSX).
+	 * Options from the HostConfig come before opts, so that opts can override them.
 	 */
 	exec := "<UNKNOWN>"
 	if 0 < len(os.Args) {
 		exec = os.Args[0]
 	}
+	if nil != host.config {
+		if cfgopts, _ := hostConfigOptions(host.config); 0 < len(cfgopts) {
+			opts = append([]string{"-o", strings.Join(cfgopts, ",")}, opts...)
+		}
+	}
 	argc := len(opts) + 2
 	if "" != mountpoint {
 		argc++
@@ -760,22 +1684,7 @@ func (host *FileSystemHost) Mount(mountpoint string, opts []string) bool {
 	 * We need to determine the mountpoint that FUSE is going (to try) to use, so that we
 	 * can unmount later.
 	 */
-	if "" != mountpoint {
-		host.mntp = mountpoint
-	} else {
-		outargs, _ := OptParse(opts, "")
-		if 1 <= len(outargs) {
-			host.mntp = outargs[0]
-		}
-	}
-	if "" != host.mntp {
-		if "windows" != runtime.GOOS || 2 != len(host.mntp) || ':' != host.mntp[1] {
-			abs, err := filepath.Abs(host.mntp)
-			if nil == err {
-				host.mntp = abs
-			}
-		}
-	}
+	host.mntp = hostMountpoint(mountpoint, opts)
 	defer func() {
 		host.mntp = ""
 	}()
@@ -785,24 +1694,16 @@ func (host *FileSystemHost) Mount(mountpoint string, opts []string) bool {
 	 *
 	 * FUSE on UNIX does not automatically unmount the file system, leaving behind "zombie"
 	 * mounts. So set things up to always unmount the file system (unless forcibly terminated).
-	 * This has the added benefit that the file system Destroy() always gets called.
+	 * This has the added benefit that the file system Destroy() always gets called. The
+	 * signals that do this can be changed (or this can be disabled) with SetSignalConfig.
 	 *
 	 * On Windows (WinFsp) this is handled by the FUSE layer and we do not have to do anything.
 	 */
+	host.sigc, host.sigs = nil, nil
 	if "windows" != runtime.GOOS {
-		done := make(chan bool)
-		defer func() {
-			<-done
-		}()
-		host.sigc = make(chan os.Signal, 1)
-		defer close(host.sigc)
-		go func() {
-			_, ok := <-host.sigc
-			if ok {
-				host.Unmount()
-			}
-			close(done)
-		}()
+		sigc, sigs, stop := hostSignalListen(host.signals, host.Unmount)
+		defer stop()
+		host.sigc, host.sigs = sigc, sigs
 	}
 
 	/*
@@ -810,14 +1711,130 @@ func (host *FileSystemHost) Mount(mountpoint string, opts []string) bool {
 	 */
 	hndl := hostHandleNew(host)
 	defer hostHandleDel(hndl)
-	return 0 != c_hostMount(c_int(argc), &argv[0], hndl)
+	nullpathOk := nil != host.config && host.config.NullpathOk
+	_, readBuf := hostOptional(host.fsop).(FileSystemReadBuf)
+	_, writeBuf := hostOptional(host.fsop).(FileSystemWriteBuf)
+	host.diag = diag
+	host.initc = initc
+	defer func() {
+		host.diag = nil
+		host.initc = nil
+	}()
+	atomic.StoreInt32(&host.draining, 0)
+	return 0 != c_hostMount(c_int(argc), &argv[0], c_bool(nullpathOk),
+		c_bool(readBuf), c_bool(writeBuf), hndl)
+}
+
+// loadFuse returns the FUSE instance of the host while the file system is mounted (from
+// Init() until Destroy()) or nil.
+func (host *FileSystemHost) loadFuse() *c_struct_fuse {
+	return (*c_struct_fuse)(atomic.LoadPointer(&host.fuse))
+}
+
+func hostMountpoint(mountpoint string, opts []string) string {
+	if "" == mountpoint {
+		outargs, _ := OptParse(opts, "")
+		if 1 <= len(outargs) {
+			mountpoint = outargs[0]
+		}
+	}
+	if "" != mountpoint {
+		if "windows" != runtime.GOOS || 2 != len(mountpoint) || ':' != mountpoint[1] {
+			abs, err := filepath.Abs(mountpoint)
+			if nil == err {
+				mountpoint = abs
+			}
+		}
+	}
+	return mountpoint
+}
+
+// hostDiag captures the diagnostic output that the FUSE layer writes to the standard
+// error while a file system is being mounted.
+type hostDiag struct {
+	once      sync.Once
+	flushOnce sync.Once
+	saved     c_int
+	pipe      *os.File
+	done      chan bool
+	buf       []byte
+	text      string
+}
+
+const hostDiagMax = 64 * 1024
+
+// hostDiagGuard serializes the captures of concurrent mounts, so that each capture
+// restores the standard error that it redirected. It is held from hostDiagNew until stop.
+var hostDiagGuard sync.Mutex
+
+func hostDiagNew() *hostDiag {
+	if "windows" == runtime.GOOS {
+		return nil
+	}
+	r, w, err := os.Pipe()
+	if nil != err {
+		return nil
+	}
+	hostDiagGuard.Lock()
+	saved := c_hostStderrRedirect(c_int(w.Fd()))
+	w.Close()
+	if 0 > saved {
+		hostDiagGuard.Unlock()
+		r.Close()
+		return nil
+	}
+	diag := &hostDiag{saved: saved, pipe: r, done: make(chan bool)}
+	go func() {
+		defer close(diag.done)
+		b := make([]byte, 4096)
+		for {
+			n, err := r.Read(b)
+			if hostDiagMax > len(diag.buf) {
+				diag.buf = append(diag.buf, b[:n]...)
+			}
+			if nil != err {
+				return
+			}
+		}
+	}()
+	return diag
+}
+
+// stop restores the standard error and returns the captured output.
+func (diag *hostDiag) stop() string {
+	if nil == diag {
+		return ""
+	}
+	diag.once.Do(func() {
+		c_hostStderrRestore(diag.saved)
+		hostDiagGuard.Unlock()
+		// Processes started by the FUSE layer (e.g. fusermount -o auto_unmount) may
+		// keep the pipe open, so do not wait for EOF indefinitely.
+		diag.pipe.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		<-diag.done
+		diag.pipe.Close()
+		diag.text = string(diag.buf)
+	})
+	return diag.text
+}
+
+// flush stops the capture and writes the captured output to the standard error once;
+// it is used when the output turns out not to be diagnostic.
+func (diag *hostDiag) flush() {
+	if nil == diag {
+		return
+	}
+	diag.flushOnce.Do(func() {
+		os.Stderr.WriteString(diag.stop())
+	})
 }
 
 // Unmount unmounts a mounted file system.
 // Unmount may be called at any time after the Init() method has been called
 // and before the Destroy() method has been called.
 func (host *FileSystemHost) Unmount() bool {
-	if nil == host.fuse {
+	fuse := host.loadFuse()
+	if nil == fuse {
 		return false
 	}
 	var mntp *c_char
@@ -825,13 +1842,267 @@ func (host *FileSystemHost) Unmount() bool {
 		mntp = c_CString(host.mntp)
 		defer c_free(unsafe.Pointer(mntp))
 	}
-	return 0 != c_hostUnmount(host.fuse, mntp)
+	return 0 != c_hostUnmount(fuse, mntp, true)
+}
+
+// UnmountMode specifies how UnmountE unmounts a file system.
+type UnmountMode int
+
+const (
+	// Detach the file system from the file hierarchy, similar to "fusermount -z" and
+	// umount2(MNT_DETACH). Operations on files that are still open continue to be
+	// served until the files are closed. [On macOS and BSD this is a regular unmount,
+	// which fails if the file system is busy]
+	UnmountLazy UnmountMode = iota
+
+	// Abort the FUSE connection, failing all pending and future operations, and detach
+	// the file system. On Linux the connection is aborted through the abort file of the
+	// fusectl file system (/sys/fs/fuse/connections/N/abort), which must be mounted. On
+	// macOS and BSD the file system is unmounted with MNT_FORCE. Operations that are
+	// running in the file system are not cancelled; the file system is destroyed after
+	// they return.
+	UnmountForce
+
+	// Fail new operations with -ENOTCONN, wait until operations that are in flight
+	// complete (see UnmountOptions.Timeout) and then detach the file system as in
+	// UnmountLazy. Operations that release resources (Flush, Release, Releasedir) are
+	// not failed. With a zero Timeout the wait has no time limit. If the file system
+	// cannot be unmounted it serves new operations again.
+	UnmountDrain
+)
+
+func (self UnmountMode) String() string {
+	switch self {
+	case UnmountLazy:
+		return "lazy"
+	case UnmountForce:
+		return "forced"
+	case UnmountDrain:
+		return "drain"
+	default:
+		return "UnmountMode(" + strconv.Itoa(int(self)) + ")"
+	}
+}
+
+// UnmountOptions controls how UnmountE unmounts a file system.
+type UnmountOptions struct {
+	// Unmount mode.
+	Mode UnmountMode
+
+	// Time that UnmountDrain waits for operations in flight. If zero UnmountDrain waits
+	// until all operations complete, with no time limit; an operation that never
+	// completes (for example, one that is blocked on an unresponsive network server)
+	// makes UnmountE wait forever.
+	Timeout time.Duration
+}
+
+// UnmountE unmounts a mounted file system similar to Unmount, but it allows control over
+// how the file system is unmounted. It returns nil if the file system was unmounted as
+// requested, or an *UnmountError that describes the steps that were taken otherwise;
+// for example, when a drain times out the file system is still unmounted and an
+// UnmountError reports the operations that were in flight.
+//
+// UnmountE may be called at any time after the Init() method has been called and before
+// the Destroy() method has been called, but not from within a file system operation.
+func (host *FileSystemHost) UnmountE(options UnmountOptions) error {
+	fuse := host.loadFuse()
+	if nil == fuse {
+		return &UnmountError{Mode: options.Mode, Err: errors.New("file system is not mounted")}
+	}
+	var mntp *c_char
+	if "" != host.mntp {
+		mntp = c_CString(host.mntp)
+		defer c_free(unsafe.Pointer(mntp))
+	}
+
+	var steps []string
+	var err error
+	inflight := 0
+	force := false
+	unmounted := false
+	switch options.Mode {
+	case UnmountDrain:
+		drainc := make(chan struct{})
+		host.drainGuard.Lock()
+		host.drainc = drainc
+		host.drainGuard.Unlock()
+		atomic.StoreInt32(&host.draining, 1)
+		defer func() {
+			host.drainGuard.Lock()
+			host.drainc = nil
+			host.drainGuard.Unlock()
+			if !unmounted {
+				// the file system remains mounted, so it must serve operations again
+				atomic.StoreInt32(&host.draining, 0)
+			}
+		}()
+		if 0 < atomic.LoadInt32(&host.inflight) {
+			var timeout <-chan time.Time
+			if 0 != options.Timeout {
+				timer := time.NewTimer(options.Timeout)
+				defer timer.Stop()
+				timeout = timer.C
+			}
+			select {
+			case <-drainc:
+			case <-timeout:
+			}
+		}
+		steps = append(steps, "drain")
+		if n := int(atomic.LoadInt32(&host.inflight)); 0 < n {
+			inflight = n
+			err = errors.New("timed out with " + strconv.Itoa(n) + " operations in flight")
+		}
+	case UnmountForce:
+		force = true
+		if "linux" == runtime.GOOS {
+			abort, e := hostFusectlAbort(host.mntp)
+			if nil == e {
+				steps = append(steps, "abort "+abort)
+			} else {
+				steps = append(steps, "abort failed")
+				err = e
+			}
+		}
+	}
+
+	r := c_hostUnmount(fuse, mntp, c_bool(force))
+	unmounted = 0 != r
+	switch {
+	case 0 == r:
+		steps = append(steps, "unmount failed")
+		if nil == err {
+			err = errors.New("cannot unmount " + host.mntp)
+		}
+	case "windows" == runtime.GOOS:
+		steps = append(steps, "fuse_exit")
+	case "linux" == runtime.GOOS && 2 == r:
+		steps = append(steps, "fusermount -z -u")
+	case "linux" == runtime.GOOS:
+		steps = append(steps, "umount2(MNT_DETACH)")
+	case force:
+		steps = append(steps, "unmount(MNT_FORCE)")
+	default:
+		steps = append(steps, "unmount")
+	}
+
+	if nil == err {
+		return nil
+	}
+	return &UnmountError{
+		Mode:     options.Mode,
+		Steps:    steps,
+		InFlight: inflight,
+		Err:      err,
+	}
+}
+
+// hostFusectlAbort aborts the FUSE connection of the file system mounted at mntp by
+// writing to its abort file in the fusectl file system [Linux only].
+func hostFusectlAbort(mntp string) (string, error) {
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(mntp)); nil == err {
+		mntp = filepath.Join(dir, filepath.Base(mntp))
+	}
+	data, err := ioutil.ReadFile("/proc/self/mountinfo")
+	if nil != err {
+		return "", err
+	}
+	conn := ""
+	for _, line := range strings.Split(string(data), "\n") {
+		// 36 35 0:49 / /mnt rw,nosuid,nodev shared:1 - fuse /dev/fuse rw,user_id=0
+		fields := strings.Split(line, " ")
+		sep := 6
+		for len(fields) > sep && "-" != fields[sep] {
+			sep++
+		}
+		if len(fields) <= sep+1 || mntp != hostUnescapeMountinfo(fields[4]) {
+			continue
+		}
+		fstype := fields[sep+1]
+		if "fuse" != fstype && "fuseblk" != fstype && !strings.HasPrefix(fstype, "fuse.") {
+			continue
+		}
+		if i := strings.IndexByte(fields[2], ':'); -1 != i {
+			major, _ := strconv.ParseUint(fields[2][:i], 10, 32)
+			minor, _ := strconv.ParseUint(fields[2][i+1:], 10, 32)
+			// the connection is named after the kernel representation of the device
+			conn = strconv.FormatUint(major<<20|minor, 10)
+		}
+	}
+	if "" == conn {
+		return "", errors.New("cannot find FUSE connection of " + mntp)
+	}
+	abort := "/sys/fs/fuse/connections/" + conn + "/abort"
+	return abort, ioutil.WriteFile(abort, []byte("1"), 0)
+}
+
+func hostUnescapeMountinfo(s string) string {
+	if -1 == strings.IndexByte(s, '\\') {
+		return s
+	}
+	b := make([]byte, 0, len(s))
+	for i := 0; len(s) > i; i++ {
+		if '\\' == s[i] && len(s) >= i+4 {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); nil == err {
+				b = append(b, byte(c))
+				i += 3
+				continue
+			}
+		}
+		b = append(b, s[i])
+	}
+	return string(b)
 }
 
 // Notify notifies the operating system about a file change.
 // The action is a combination of the fuse.NOTIFY_* constants.
+//
+// On FUSE3 on Linux and FreeBSD there is no change notification and Notify invalidates
+// the kernel caches for path instead (see InvalidatePath). If the action adds or removes
+// a directory entry (NOTIFY_MKDIR, NOTIFY_RMDIR, NOTIFY_CREATE, NOTIFY_UNLINK), the
+// caches of the parent directory and the directory entry are also invalidated (see
+// InvalidateEntry).
+// [Windows and FUSE3 on Linux and FreeBSD only]
 func (host *FileSystemHost) Notify(path string, action uint32) bool {
-	if nil == host.fuse {
+	fuse := host.loadFuse()
+	if nil == fuse {
+		return false
+	}
+	if "" == path {
+		return false
+	}
+	var p *c_char
+	p = c_CString(path)
+	defer c_free(unsafe.Pointer(p))
+	if 0 == c_hostNotify(fuse, p, c_uint32_t(action)) {
+		return false
+	}
+	if "windows" != runtime.GOOS &&
+		0 != action&(NOTIFY_MKDIR|NOTIFY_RMDIR|NOTIFY_CREATE|NOTIFY_UNLINK) {
+		i := strings.LastIndexByte(path, '/')
+		if -1 == i {
+			return false
+		}
+		dir := path[:i]
+		if "" == dir {
+			dir = "/"
+		}
+		return host.InvalidateEntry(dir, path[i+1:])
+	}
+	return true
+}
+
+// InvalidatePath invalidates the attributes and data that the kernel has cached for
+// a file, because the file has changed behind the kernel's back. Subsequent operations
+// on the file will go to the file system. InvalidatePath returns true if the caches were
+// invalidated or if the kernel has not cached the file.
+//
+// InvalidatePath should not be called from within a file system operation on the same
+// file, as the kernel may wait for that operation to complete.
+// [FUSE3 on Linux and FreeBSD only]
+func (host *FileSystemHost) InvalidatePath(path string) bool {
+	fuse := host.loadFuse()
+	if nil == fuse {
 		return false
 	}
 	if "" == path {
@@ -840,7 +2111,301 @@ func (host *FileSystemHost) Notify(path string, action uint32) bool {
 	var p *c_char
 	p = c_CString(path)
 	defer c_free(unsafe.Pointer(p))
-	return 0 != c_hostNotify(host.fuse, p, c_uint32_t(action))
+	return 0 == c_hostInvalidatePath(fuse, p)
+}
+
+// InvalidateEntry invalidates the entry name of the directory dir that the kernel has
+// cached, because the entry has been added, removed or renamed behind the kernel's back.
+// A subsequent lookup of the entry will go to the file system. InvalidateEntry returns
+// true if the entry was invalidated or if the kernel has not cached it.
+//
+// On cgo the FUSE library does not reveal the inode number that identifies dir to the
+// kernel. The host gets it from the kernel with lstat on the mountpoint, which requires
+// that SetUseIno is not set. InvalidateEntry should not be called from within a file
+// system operation on dir.
+// [FUSE3 on Linux and FreeBSD only]
+func (host *FileSystemHost) InvalidateEntry(dir string, name string) bool {
+	fuse := host.loadFuse()
+	if nil == fuse {
+		return false
+	}
+	if "" == dir || "" == name {
+		return false
+	}
+	var mntp *c_char
+	if "" != host.mntp {
+		mntp = c_CString(host.mntp)
+		defer c_free(unsafe.Pointer(mntp))
+	}
+	d := c_CString(dir)
+	defer c_free(unsafe.Pointer(d))
+	n := c_CString(name)
+	defer c_free(unsafe.Pointer(n))
+	return 0 == c_hostInvalidateEntry(fuse, mntp, d, n, c_bool(host.useIno))
+}
+
+// InvalidateData invalidates the attributes of a file and the data that the kernel has
+// cached for the range [ofst, ofst+size) of the file. If ofst is negative only the
+// attributes are invalidated; if size is zero the data is invalidated up to the end of
+// the file. InvalidateData returns true if the caches were invalidated or if the kernel
+// has not cached the file.
+//
+// On cgo InvalidateData has the same requirements as InvalidateEntry.
+// [FUSE3 on Linux and FreeBSD only]
+func (host *FileSystemHost) InvalidateData(path string, ofst int64, size int64) bool {
+	fuse := host.loadFuse()
+	if nil == fuse {
+		return false
+	}
+	if "" == path {
+		return false
+	}
+	var mntp *c_char
+	if "" != host.mntp {
+		mntp = c_CString(host.mntp)
+		defer c_free(unsafe.Pointer(mntp))
+	}
+	p := c_CString(path)
+	defer c_free(unsafe.Pointer(p))
+	return 0 == c_hostInvalidateData(fuse, mntp, p, c_int64_t(ofst), c_int64_t(size),
+		c_bool(host.useIno))
+}
+
+// PollHandle is used to notify the FUSE layer that the I/O readiness of a file has
+// changed. See FileSystemPoll.
+type PollHandle struct {
+	host  *FileSystemHost
+	mutex sync.Mutex
+	ph    unsafe.Pointer
+}
+
+func newPollHandle(host *FileSystemHost, ph unsafe.Pointer) *PollHandle {
+	self := &PollHandle{host: host, ph: ph}
+	runtime.SetFinalizer(self, (*PollHandle).Destroy)
+	return self
+}
+
+// Notify notifies the poller that the I/O readiness of the file has changed and
+// releases the handle. Notify may be called from any goroutine. It returns false if
+// the handle has already been released or the notification could not be sent.
+func (self *PollHandle) Notify() bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if nil == self.ph {
+		return false
+	}
+	ok := nil != self.host.loadFuse() && 0 != c_hostNotifyPoll(self.ph)
+	c_hostPollhandleDestroy(self.ph)
+	self.ph = nil
+	return ok
+}
+
+// Destroy releases the handle without notifying the poller. Handles that are not
+// released explicitly are released when they are garbage collected.
+func (self *PollHandle) Destroy() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if nil == self.ph {
+		return
+	}
+	c_hostPollhandleDestroy(self.ph)
+	self.ph = nil
+}
+
+// hostOpctx is the context of a file system operation (see Context). It carries the
+// OpContext of the operation.
+//
+// The FUSE high-level API reports interruption only to the thread that runs the
+// operation (fuse_interrupted), so interruption is detected by polling from that
+// thread: whenever Interrupted or the Err method of the context is called there.
+type hostOpctx struct {
+	opctx  OpContext
+	tid    uintptr // thread that runs the operation
+	active bool    // operation has a request and is running on tid
+	mutex  sync.Mutex
+	done   chan struct{}
+	err    error
+	groups []uint32
+	gotgrp bool
+}
+
+var (
+	opctxGuard = sync.Mutex{}
+	opctxTable = map[uintptr]*hostOpctx{}
+	opctxCount int32
+	closedchan = make(chan struct{})
+)
+
+func init() {
+	close(closedchan)
+}
+
+func (self *hostOpctx) Deadline() (deadline time.Time, ok bool) {
+	return
+}
+
+func (self *hostOpctx) Done() <-chan struct{} {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if nil == self.done {
+		if nil != self.err {
+			self.done = closedchan
+		} else {
+			self.done = make(chan struct{})
+		}
+	}
+	return self.done
+}
+
+func (self *hostOpctx) Err() error {
+	self.mutex.Lock()
+	err := self.err
+	poll := nil == err && self.onThread()
+	self.mutex.Unlock()
+	if poll && 0 != c_hostInterrupted() {
+		self.cancel()
+		err = context.Canceled
+	}
+	return err
+}
+
+func (self *hostOpctx) Value(key interface{}) interface{} {
+	if _, ok := key.(opContextKey); ok {
+		return &self.opctx
+	}
+	return nil
+}
+
+// onThread reports whether the caller runs on the thread of the operation while the
+// operation is running. Only then may it use the libfuse context of the operation.
+// It must be called with mutex held.
+func (self *hostOpctx) onThread() bool {
+	return self.active && c_hostThreadId() == self.tid
+}
+
+func (self *hostOpctx) cancel() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if nil != self.err {
+		return
+	}
+	self.err = context.Canceled
+	if nil == self.done {
+		self.done = closedchan
+	} else {
+		close(self.done)
+	}
+}
+
+// getgroups retrieves the supplementary groups of the calling process the first time
+// that it is called on the thread of the operation.
+func (self *hostOpctx) getgroups() []uint32 {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.gotgrp || !self.onThread() {
+		return self.groups
+	}
+	self.gotgrp = true
+	groups := make([]uint32, 32)
+	for {
+		n := int(c_hostGetgroups(c_int(len(groups)), (*c_uint32_t)(&groups[0])))
+		if 0 > n {
+			break
+		} else if len(groups) >= n {
+			self.groups = groups[:n]
+			break
+		}
+		groups = make([]uint32, n)
+	}
+	return self.groups
+}
+
+// hostOpctxDel is called when a file system operation completes. It cancels the
+// context of the operation, if there is one.
+func hostOpctxDel() {
+	if 0 == atomic.LoadInt32(&opctxCount) {
+		return
+	}
+	tid := c_hostThreadId()
+	opctxGuard.Lock()
+	opctx, ok := opctxTable[tid]
+	if ok {
+		delete(opctxTable, tid)
+		atomic.AddInt32(&opctxCount, -1)
+	}
+	opctxGuard.Unlock()
+	if ok {
+		opctx.mutex.Lock()
+		opctx.active = false
+		opctx.mutex.Unlock()
+		opctx.cancel()
+	}
+}
+
+// Interrupted reports whether the kernel has interrupted the current file system
+// operation; for example, because the process that issued it received a signal. A file
+// system may then abandon the operation and return -EINTR. Interrupted must be called
+// from the goroutine that runs the file system operation. If it returns true, it also
+// cancels the context of the operation (see Context). [Linux and FreeBSD only]
+func Interrupted() bool {
+	if 0 == c_hostInterrupted() {
+		return false
+	}
+	if 0 != atomic.LoadInt32(&opctxCount) {
+		tid := c_hostThreadId()
+		opctxGuard.Lock()
+		opctx, ok := opctxTable[tid]
+		opctxGuard.Unlock()
+		if ok {
+			opctx.cancel()
+		}
+	}
+	return true
+}
+
+// Context returns a context for the current file system operation. The context carries
+// an OpContext that describes the calling process (see GetOpContext) and it is cancelled
+// when the operation completes or when the kernel interrupts it. Context must be called
+// from the goroutine that runs the file system operation; the context may then be passed
+// to other goroutines.
+//
+// The FUSE library reports interruption only to the thread that runs the operation, so
+// the context does not learn of an interruption by itself: it is cancelled when its Err
+// method or Interrupted is called from the goroutine that runs the operation and finds
+// that the operation has been interrupted. A file system that waits on Done (for example
+// in a select statement) must therefore also poll Err or Interrupted from that goroutine
+// (for example on a timer). [Linux and FreeBSD only; elsewhere the context is never
+// cancelled]
+func Context() context.Context {
+	fctx := c_fuse_get_context()
+	if nil == fctx || nil == fctx.fuse {
+		return context.Background()
+	}
+	if 0 == fctx.pid || !c_hostInterruptible() {
+		// no request (Init and Destroy) or no interruption support; no context to keep
+		opctx := &hostOpctx{}
+		hostOpContext(&opctx.opctx, fctx, opctx)
+		return opctx
+	}
+	tid := c_hostThreadId()
+	opctxGuard.Lock()
+	opctx, ok := opctxTable[tid]
+	if !ok {
+		opctx = &hostOpctx{tid: tid, active: true}
+		hostOpContext(&opctx.opctx, fctx, opctx)
+		opctxTable[tid] = opctx
+		atomic.AddInt32(&opctxCount, 1)
+	}
+	opctxGuard.Unlock()
+	return opctx
+}
+
+func hostOpContext(opctx *OpContext, fctx *c_struct_fuse_context, hctx *hostOpctx) {
+	opctx.Uid = uint32(fctx.uid)
+	opctx.Gid = uint32(fctx.gid)
+	opctx.Pid = int(fctx.pid)
+	opctx.Umask = uint32(fctx.umask)
+	opctx.groups = hctx.getgroups
 }
 
 // Getcontext gets information related to a file system operation.
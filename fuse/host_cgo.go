@@ -1,5 +1,6 @@
-//go:build cgo
+//go:build cgo && !(linux && nocgo)
 // +build cgo
+// +build !linux !nocgo
 
 /*
  * host_cgo.go
@@ -32,6 +33,8 @@ package fuse
 #error platform not supported
 #endif
 
+#include <errno.h>
+#include <limits.h>
 #include <stdbool.h>
 #include <stdint.h>
 #include <stdlib.h>
@@ -43,6 +46,7 @@ package fuse
 #include <pthread.h>
 #include <spawn.h>
 #include <sys/mount.h>
+#include <sys/stat.h>
 #include <sys/wait.h>
 #include <unistd.h>
 
@@ -130,6 +134,56 @@ static int (*pfn_fuse_opt_parse)(struct fuse_args *args, void *data,
     const struct fuse_opt opts[], fuse_opt_proc_t proc);
 static void (*pfn_fuse_opt_free_args)(struct fuse_args *args);
 
+// optional
+static int (*pfn_fuse_version)(void);
+#if defined(__FreeBSD__) || defined(__linux__)
+static int (*pfn_fuse_notify_poll)(struct fuse_pollhandle *ph);
+static void (*pfn_fuse_pollhandle_destroy)(struct fuse_pollhandle *ph);
+static int (*pfn_fuse_interrupted)(void);
+static int (*pfn_fuse_getgroups)(int size, gid_t list[]);
+#endif
+#if (defined(__FreeBSD__) || defined(__linux__)) && FUSE_VERSION >= FUSE_MAKE_VERSION(2, 9)
+static ssize_t (*pfn_fuse_buf_copy)(struct fuse_bufvec *dst, struct fuse_bufvec *src,
+	enum fuse_buf_copy_flags flags);
+#endif
+#if (defined(__FreeBSD__) || defined(__linux__)) && FUSE_VERSION >= 30
+static int (*pfn_fuse_invalidate_path)(struct fuse *f, const char *path);
+static struct fuse_session *(*pfn_fuse_get_session)(struct fuse *f);
+#endif
+#if (defined(__FreeBSD__) || defined(__linux__)) && FUSE_VERSION >= 30
+#define CGOFUSE_LOWLEVEL
+#include <fuse_lowlevel.h>
+static int cgofuse_lowlevel;
+static struct fuse_session *(*pfn_fuse_session_new)(struct fuse_args *args,
+	const struct fuse_lowlevel_ops *op, size_t op_size, void *userdata);
+static int (*pfn_fuse_session_mount)(struct fuse_session *se, const char *mountpoint);
+static void (*pfn_fuse_session_unmount)(struct fuse_session *se);
+static void (*pfn_fuse_session_destroy)(struct fuse_session *se);
+static int (*pfn_fuse_session_loop)(struct fuse_session *se);
+static int (*pfn_fuse_session_loop_mt_31)(struct fuse_session *se, int clone_fd);
+static void *(*pfn_fuse_req_userdata)(fuse_req_t req);
+static const struct fuse_ctx *(*pfn_fuse_req_ctx)(fuse_req_t req);
+static int (*pfn_fuse_reply_err)(fuse_req_t req, int err);
+static void (*pfn_fuse_reply_none)(fuse_req_t req);
+static int (*pfn_fuse_reply_entry)(fuse_req_t req, const struct fuse_entry_param *e);
+static int (*pfn_fuse_reply_create)(fuse_req_t req, const struct fuse_entry_param *e,
+	const struct fuse_file_info *fi);
+static int (*pfn_fuse_reply_attr)(fuse_req_t req, const struct stat *attr, double attr_timeout);
+static int (*pfn_fuse_reply_open)(fuse_req_t req, const struct fuse_file_info *fi);
+static int (*pfn_fuse_reply_write)(fuse_req_t req, size_t count);
+static int (*pfn_fuse_reply_buf)(fuse_req_t req, const char *buf, size_t size);
+static int (*pfn_fuse_reply_statfs)(fuse_req_t req, const struct statvfs *stbuf);
+static int (*pfn_fuse_reply_xattr)(fuse_req_t req, size_t count);
+static size_t (*pfn_fuse_add_direntry)(fuse_req_t req, char *buf, size_t bufsize,
+	const char *name, const struct stat *stbuf, off_t off);
+static size_t (*pfn_fuse_add_direntry_plus)(fuse_req_t req, char *buf, size_t bufsize,
+	const char *name, const struct fuse_entry_param *e, off_t off);
+static int (*pfn_fuse_lowlevel_notify_inval_inode)(struct fuse_session *se,
+	fuse_ino_t ino, off_t off, off_t len);
+static int (*pfn_fuse_lowlevel_notify_inval_entry)(struct fuse_session *se,
+	fuse_ino_t parent, const char *name, size_t namelen);
+#endif
+
 static inline int inl_fuse_main_real(int argc, char *argv[],
     const struct fuse_operations *ops, size_t opsize, void *data)
 {
@@ -210,6 +264,52 @@ static void *cgofuse_init_fuse(void)
 	CGOFUSE_GET_API(fuse_opt_parse);
 	CGOFUSE_GET_API(fuse_opt_free_args);
 
+	// optional
+	*(void **)&pfn_fuse_version = dlsym(h, "fuse_version");
+#if defined(__FreeBSD__) || defined(__linux__)
+	*(void **)&pfn_fuse_notify_poll = dlsym(h, "fuse_notify_poll");
+	*(void **)&pfn_fuse_pollhandle_destroy = dlsym(h, "fuse_pollhandle_destroy");
+	*(void **)&pfn_fuse_interrupted = dlsym(h, "fuse_interrupted");
+	*(void **)&pfn_fuse_getgroups = dlsym(h, "fuse_getgroups");
+#endif
+#if (defined(__FreeBSD__) || defined(__linux__)) && FUSE_VERSION >= FUSE_MAKE_VERSION(2, 9)
+	*(void **)&pfn_fuse_buf_copy = dlsym(h, "fuse_buf_copy");
+#endif
+#if (defined(__FreeBSD__) || defined(__linux__)) && FUSE_VERSION >= 30
+	*(void **)&pfn_fuse_invalidate_path = dlsym(h, "fuse_invalidate_path");
+	*(void **)&pfn_fuse_get_session = dlsym(h, "fuse_get_session");
+#endif
+#if defined(CGOFUSE_LOWLEVEL)
+#define CGOFUSE_GET_LOWLEVEL_API(n)	\
+	if (0 == (*(void **)&(pfn_ ## n) = dlsym(h, #n)))\
+		cgofuse_lowlevel = 0;
+	cgofuse_lowlevel = 1;
+	CGOFUSE_GET_LOWLEVEL_API(fuse_session_new);
+	CGOFUSE_GET_LOWLEVEL_API(fuse_session_mount);
+	CGOFUSE_GET_LOWLEVEL_API(fuse_session_unmount);
+	CGOFUSE_GET_LOWLEVEL_API(fuse_session_destroy);
+	CGOFUSE_GET_LOWLEVEL_API(fuse_session_loop);
+	CGOFUSE_GET_LOWLEVEL_API(fuse_req_userdata);
+	CGOFUSE_GET_LOWLEVEL_API(fuse_req_ctx);
+	CGOFUSE_GET_LOWLEVEL_API(fuse_reply_err);
+	CGOFUSE_GET_LOWLEVEL_API(fuse_reply_none);
+	CGOFUSE_GET_LOWLEVEL_API(fuse_reply_entry);
+	CGOFUSE_GET_LOWLEVEL_API(fuse_reply_create);
+	CGOFUSE_GET_LOWLEVEL_API(fuse_reply_attr);
+	CGOFUSE_GET_LOWLEVEL_API(fuse_reply_open);
+	CGOFUSE_GET_LOWLEVEL_API(fuse_reply_write);
+	CGOFUSE_GET_LOWLEVEL_API(fuse_reply_buf);
+	CGOFUSE_GET_LOWLEVEL_API(fuse_reply_statfs);
+	CGOFUSE_GET_LOWLEVEL_API(fuse_reply_xattr);
+	CGOFUSE_GET_LOWLEVEL_API(fuse_add_direntry);
+	CGOFUSE_GET_LOWLEVEL_API(fuse_add_direntry_plus);
+	CGOFUSE_GET_LOWLEVEL_API(fuse_lowlevel_notify_inval_inode);
+	CGOFUSE_GET_LOWLEVEL_API(fuse_lowlevel_notify_inval_entry);
+	// fuse_session_loop_mt is versioned; fuse_session_loop_mt_31 (FUSE >= 3.2) is not
+	*(void **)&pfn_fuse_session_loop_mt_31 = dlsym(h, "fuse_session_loop_mt_31");
+#undef CGOFUSE_GET_LOWLEVEL_API
+#endif
+
 	return h;
 
 #undef CGOFUSE_GET_API
@@ -327,12 +427,14 @@ typedef dev_t fuse_dev_t;
 typedef uid_t fuse_uid_t;
 typedef gid_t fuse_gid_t;
 typedef off_t fuse_off_t;
+typedef struct flock fuse_flock_t;
 typedef unsigned long fuse_opt_offset_t;
 #elif defined(_WIN32)
 typedef struct fuse_stat fuse_stat_t;
 typedef struct fuse_stat_ex fuse_stat_ex_t;
 typedef struct fuse_statvfs fuse_statvfs_t;
 typedef struct fuse_timespec fuse_timespec_t;
+typedef struct fuse_flock fuse_flock_t;
 typedef unsigned int fuse_opt_offset_t;
 #endif
 
@@ -405,7 +507,25 @@ extern int go_hostCreate(char *path, fuse_mode_t mode, struct fuse_file_info *fi
 extern int go_hostFtruncate(char *path, fuse_off_t off, struct fuse_file_info *fi);
 extern int go_hostFgetattr(char *path, fuse_stat_t *stbuf, struct fuse_file_info *fi);
 #endif
-//extern int go_hostLock(char *path, struct fuse_file_info *fi, int cmd, struct fuse_flock *lock);
+extern int go_hostLock(char *path, struct fuse_file_info *fi, int cmd, fuse_flock_t *lock);
+extern int go_hostFlock(char *path, struct fuse_file_info *fi, int op);
+extern int go_hostReadBuf(char *path, void **bufp, size_t size, fuse_off_t off,
+	struct fuse_file_info *fi);
+extern int go_hostWriteBuf(char *path, void *bufv, fuse_off_t off,
+	struct fuse_file_info *fi);
+extern int go_hostPoll(char *path, struct fuse_file_info *fi, void *ph, unsigned *reventsp);
+extern int go_hostIoctl(char *path, unsigned int cmd, void *arg, struct fuse_file_info *fi,
+	unsigned int flags, void *data);
+#if FUSE_USE_VERSION >= 30
+extern int go_hostCopyFileRange(char *path_in, struct fuse_file_info *fi_in, fuse_off_t off_in,
+	char *path_out, struct fuse_file_info *fi_out, fuse_off_t off_out, size_t size, int flags);
+#endif
+#if FUSE_USE_VERSION >= 30 && FUSE_VERSION >= FUSE_MAKE_VERSION(3, 8)
+extern int go_hostLseek(char *path, fuse_off_t off, int whence, struct fuse_file_info *fi,
+	fuse_off_t *poff);
+#endif
+extern int go_hostFallocate(char *path, int mode, fuse_off_t off, fuse_off_t len,
+	struct fuse_file_info *fi);
 #if FUSE_USE_VERSION < 30
 extern int go_hostUtimens(char *path, fuse_timespec_t tv[2]);
 #else
@@ -416,12 +536,61 @@ extern int go_hostGetpath(char *path, char *buf, size_t size,
 extern int go_hostSetchgtime(char *path, fuse_timespec_t *tv);
 extern int go_hostSetcrtime(char *path, fuse_timespec_t *tv);
 extern int go_hostChflags(char *path, uint32_t flags);
+#if defined(CGOFUSE_LOWLEVEL)
+extern void go_hostLlInit(void *userdata, struct fuse_conn_info *conn);
+extern void go_hostLlDestroy(void *userdata);
+extern void go_hostLlLookup(void *req, uint64_t parent, char *name);
+extern void go_hostLlForget(void *req, uint64_t ino, uint64_t nlookup);
+extern void go_hostLlGetattr(void *req, uint64_t ino, struct fuse_file_info *fi);
+extern void go_hostLlSetattr(void *req, uint64_t ino,
+	uint32_t mode, uint32_t uid, uint32_t gid, int64_t size,
+	int64_t atimsec, int64_t atimnsec, int64_t mtimsec, int64_t mtimnsec,
+	int64_t ctimsec, int64_t ctimnsec,
+	int valid, struct fuse_file_info *fi);
+extern void go_hostLlReadlink(void *req, uint64_t ino);
+extern void go_hostLlMknod(void *req, uint64_t parent, char *name, fuse_mode_t mode, fuse_dev_t dev);
+extern void go_hostLlMkdir(void *req, uint64_t parent, char *name, fuse_mode_t mode);
+extern void go_hostLlUnlink(void *req, uint64_t parent, char *name);
+extern void go_hostLlRmdir(void *req, uint64_t parent, char *name);
+extern void go_hostLlSymlink(void *req, char *target, uint64_t parent, char *name);
+extern void go_hostLlRename(void *req, uint64_t parent, char *name,
+	uint64_t newparent, char *newname, unsigned int flags);
+extern void go_hostLlLink(void *req, uint64_t ino, uint64_t newparent, char *newname);
+extern void go_hostLlOpen(void *req, uint64_t ino, struct fuse_file_info *fi);
+extern void go_hostLlRead(void *req, uint64_t ino, size_t size, fuse_off_t off,
+	struct fuse_file_info *fi);
+extern void go_hostLlWrite(void *req, uint64_t ino, char *buf, size_t size, fuse_off_t off,
+	struct fuse_file_info *fi);
+extern void go_hostLlFlush(void *req, uint64_t ino, struct fuse_file_info *fi);
+extern void go_hostLlRelease(void *req, uint64_t ino, struct fuse_file_info *fi);
+extern void go_hostLlFsync(void *req, uint64_t ino, int datasync, struct fuse_file_info *fi);
+extern void go_hostLlOpendir(void *req, uint64_t ino, struct fuse_file_info *fi);
+extern void go_hostLlReaddir(void *req, uint64_t ino, size_t size, fuse_off_t off,
+	struct fuse_file_info *fi);
+extern void go_hostLlReaddirplus(void *req, uint64_t ino, size_t size, fuse_off_t off,
+	struct fuse_file_info *fi);
+extern void go_hostLlReleasedir(void *req, uint64_t ino, struct fuse_file_info *fi);
+extern void go_hostLlFsyncdir(void *req, uint64_t ino, int datasync, struct fuse_file_info *fi);
+extern void go_hostLlStatfs(void *req, uint64_t ino);
+extern void go_hostLlSetxattr(void *req, uint64_t ino, char *name, char *value, size_t size,
+	int flags);
+extern void go_hostLlGetxattr(void *req, uint64_t ino, char *name, size_t size);
+extern void go_hostLlListxattr(void *req, uint64_t ino, size_t size);
+extern void go_hostLlRemovexattr(void *req, uint64_t ino, char *name);
+extern void go_hostLlAccess(void *req, uint64_t ino, int mask);
+extern void go_hostLlCreate(void *req, uint64_t parent, char *name, fuse_mode_t mode,
+	struct fuse_file_info *fi);
+#endif
 
 static inline void hostAsgnCconninfo(struct fuse_conn_info *conn,
 	bool capCaseInsensitive,
 	bool capReaddirPlus,
 	bool capDeleteAccess,
-	bool capOpenTrunc)
+	bool capOpenTrunc,
+	bool capPosixLocks,
+	bool capFlockLocks,
+	bool capSpliceWrite,
+	bool capSpliceRead)
 {
 #if defined(__APPLE__)
 	if (capCaseInsensitive)
@@ -440,6 +609,28 @@ static inline void hostAsgnCconninfo(struct fuse_conn_info *conn,
 		conn->want |= conn->capable & FUSE_CAP_ATOMIC_O_TRUNC;
 	else
 		conn->want &= ~FUSE_CAP_ATOMIC_O_TRUNC;
+	// The .lock operation is always registered, which makes libfuse enable
+	// FUSE_CAP_POSIX_LOCKS. Keep it only if the file system implements Lock;
+	// otherwise let the kernel handle POSIX locks locally as it used to.
+	if (capPosixLocks)
+		conn->want |= conn->capable & FUSE_CAP_POSIX_LOCKS;
+	else
+		conn->want &= ~FUSE_CAP_POSIX_LOCKS;
+#if FUSE_VERSION >= FUSE_MAKE_VERSION(2, 9)
+	// Same for .flock and FUSE_CAP_FLOCK_LOCKS.
+	if (capFlockLocks)
+		conn->want |= conn->capable & FUSE_CAP_FLOCK_LOCKS;
+	else
+		conn->want &= ~FUSE_CAP_FLOCK_LOCKS;
+	// Splice data from file descriptors returned by ReadBuf to the kernel.
+	if (capSpliceWrite)
+		conn->want |= conn->capable & FUSE_CAP_SPLICE_WRITE;
+	// Splice data from the kernel into the buffers passed to WriteBuf.
+	if (capSpliceRead)
+		conn->want |= conn->capable & FUSE_CAP_SPLICE_READ;
+	else
+		conn->want &= ~FUSE_CAP_SPLICE_READ;
+#endif
 #elif defined(_WIN32)
 #if defined(FSP_FUSE_CAP_STAT_EX)
 	conn->want |= conn->capable & FSP_FUSE_CAP_STAT_EX;
@@ -454,12 +645,103 @@ static inline void hostAsgnCconninfo(struct fuse_conn_info *conn,
 #endif
 }
 
+static inline void hostConninfoGet(struct fuse_conn_info *conn,
+	uint32_t *proto_major,
+	uint32_t *proto_minor,
+	uint32_t *max_write,
+	uint32_t *max_read,
+	uint32_t *max_readahead,
+	uint32_t *capable,
+	uint32_t *want,
+	uint32_t *max_background,
+	uint32_t *congestion_threshold,
+	uint32_t *time_gran)
+{
+	*proto_major = conn->proto_major;
+	*proto_minor = conn->proto_minor;
+	*max_write = conn->max_write;
+	*max_readahead = conn->max_readahead;
+#if defined(__FreeBSD__) || defined(__linux__)
+	*capable = conn->capable;
+	*want = conn->want;
+#if FUSE_VERSION >= FUSE_MAKE_VERSION(2, 9)
+	*max_background = conn->max_background;
+	*congestion_threshold = conn->congestion_threshold;
+#endif
+#if FUSE_USE_VERSION >= 30
+	*max_read = conn->max_read;
+	*time_gran = conn->time_gran;
+#endif
+#endif
+}
+
+static inline void hostConninfoSet(struct fuse_conn_info *conn,
+	uint32_t max_write,
+	uint32_t max_read,
+	uint32_t max_readahead,
+	uint32_t want,
+	uint32_t max_background,
+	uint32_t congestion_threshold,
+	uint32_t time_gran)
+{
+	conn->max_write = max_write;
+	conn->max_readahead = max_readahead;
+#if defined(__FreeBSD__) || defined(__linux__)
+	// libfuse refuses to mount if we want capabilities that the kernel lacks
+	conn->want = want & conn->capable;
+#if FUSE_VERSION >= FUSE_MAKE_VERSION(2, 9)
+	conn->max_background = max_background;
+	conn->congestion_threshold = congestion_threshold;
+#endif
+#if FUSE_USE_VERSION >= 30
+	conn->max_read = max_read;
+	conn->time_gran = time_gran;
+#endif
+#endif
+}
+
+static inline int hostFuseUseVersion(void)
+{
+	return FUSE_USE_VERSION;
+}
+
+static int hostFuseVersion(void)
+{
+	if (0 == cgofuse_init_fast(0))
+		return 0;
+#if !defined(_WIN32)
+	// the loaded library may be newer or older than the headers we were built with
+	if (0 != pfn_fuse_version)
+		return pfn_fuse_version();
+#endif
+	return FUSE_VERSION;
+}
+
 #if FUSE_USE_VERSION < 30
 static inline void hostAsgnCconfig(struct fuse_config *conf,
 	bool direct_io,
 	bool use_ino)
 {
 }
+
+static inline void hostAsgnCconfigEx(struct fuse_config *conf,
+	double entry_timeout,
+	double attr_timeout,
+	double negative_timeout,
+	bool kernel_cache,
+	bool auto_cache,
+	bool ac_attr_timeout_set,
+	double ac_attr_timeout,
+	bool hard_remove,
+	bool nullpath_ok,
+	bool set_mode,
+	uint32_t umask,
+	bool set_uid,
+	uint32_t uid,
+	bool set_gid,
+	uint32_t gid)
+{
+}
 #else
 static inline void hostAsgnCconfig(struct fuse_config *conf,
 	bool direct_io,
@@ -469,6 +751,40 @@ static inline void hostAsgnCconfig(struct fuse_config *conf,
 	conf->direct_io = direct_io;
 	conf->use_ino = use_ino;
 }
+
+static inline void hostAsgnCconfigEx(struct fuse_config *conf,
+	double entry_timeout,
+	double attr_timeout,
+	double negative_timeout,
+	bool kernel_cache,
+	bool auto_cache,
+	bool ac_attr_timeout_set,
+	double ac_attr_timeout,
+	bool hard_remove,
+	bool nullpath_ok,
+	bool set_mode,
+	uint32_t umask,
+	bool set_uid,
+	uint32_t uid,
+	bool set_gid,
+	uint32_t gid)
+{
+	conf->entry_timeout = entry_timeout;
+	conf->attr_timeout = attr_timeout;
+	conf->negative_timeout = negative_timeout;
+	conf->kernel_cache = kernel_cache;
+	conf->auto_cache = auto_cache;
+	conf->ac_attr_timeout_set = ac_attr_timeout_set;
+	conf->ac_attr_timeout = ac_attr_timeout;
+	conf->hard_remove = hard_remove;
+	conf->nullpath_ok = nullpath_ok;
+	conf->set_mode = set_mode;
+	conf->umask = umask;
+	conf->set_uid = set_uid;
+	conf->uid = uid;
+	conf->set_gid = set_gid;
+	conf->gid = gid;
+}
 #endif
 
 static inline void hostCstatvfsFromFusestatfs(fuse_statvfs_t *stbuf,
@@ -580,13 +896,119 @@ static inline void hostAsgnCfileinfo(struct fuse_file_info *fi,
 	fi->fh = fh;
 }
 
+static inline bool hostFlockRelease(struct fuse_file_info *fi)
+{
+	// The kernel asks for BSD locks to be released along with the file,
+	// but the libfuse high-level API does not act on this; so we must.
+#if (defined(__FreeBSD__) || defined(__linux__)) && FUSE_VERSION >= FUSE_MAKE_VERSION(2, 9)
+	return fi->flock_release;
+#else
+	return false;
+#endif
+}
+
+static inline void *hostBufvecNew(size_t count)
+{
+#if (defined(__FreeBSD__) || defined(__linux__)) && FUSE_VERSION >= FUSE_MAKE_VERSION(2, 9)
+	struct fuse_bufvec *bufv;
+	if (0 == count)
+		count = 1;
+	bufv = calloc(1, sizeof *bufv + (count - 1) * sizeof bufv->buf[0]);
+	if (0 == bufv)
+		return 0;
+	bufv->count = count;
+	return bufv;
+#else
+	return 0;
+#endif
+}
+
+static inline size_t hostBufvecCount(void *bufv0)
+{
+#if (defined(__FreeBSD__) || defined(__linux__)) && FUSE_VERSION >= FUSE_MAKE_VERSION(2, 9)
+	struct fuse_bufvec *bufv = bufv0;
+	return bufv->count;
+#else
+	return 0;
+#endif
+}
+
+static inline void hostBufvecGet(void *bufv0, size_t i,
+	uint32_t *flags, void **mem, size_t *size, int *fd, int64_t *pos)
+{
+#if (defined(__FreeBSD__) || defined(__linux__)) && FUSE_VERSION >= FUSE_MAKE_VERSION(2, 9)
+	struct fuse_bufvec *bufv = bufv0;
+	*flags = bufv->buf[i].flags;
+	*mem = bufv->buf[i].mem;
+	*size = bufv->buf[i].size;
+	*fd = bufv->buf[i].fd;
+	*pos = bufv->buf[i].pos;
+#endif
+}
+
+static inline void hostBufvecSet(void *bufv0, size_t i,
+	uint32_t flags, void *mem, size_t size, int fd, int64_t pos)
+{
+#if (defined(__FreeBSD__) || defined(__linux__)) && FUSE_VERSION >= FUSE_MAKE_VERSION(2, 9)
+	struct fuse_bufvec *bufv = bufv0;
+	bufv->buf[i].flags = flags;
+	bufv->buf[i].mem = mem;
+	bufv->buf[i].size = size;
+	bufv->buf[i].fd = fd;
+	bufv->buf[i].pos = pos;
+#endif
+}
+
+static inline int hostBufvecFlatten(void *bufv0, void **pmem, size_t *psize)
+{
+#if (defined(__FreeBSD__) || defined(__linux__)) && FUSE_VERSION >= FUSE_MAKE_VERSION(2, 9)
+	struct fuse_bufvec *bufv = bufv0;
+	size_t size = 0;
+	for (size_t i = 0; bufv->count > i; i++)
+		size += bufv->buf[i].size;
+	struct fuse_bufvec dst = FUSE_BUFVEC_INIT(size);
+	ssize_t res;
+	if (0 == pfn_fuse_buf_copy)
+		return -ENOSYS;
+	dst.buf[0].mem = malloc(0 < size ? size : 1);
+	if (0 == dst.buf[0].mem)
+		return -ENOMEM;
+	res = pfn_fuse_buf_copy(&dst, bufv, 0);
+	if (0 > res)
+	{
+		free(dst.buf[0].mem);
+		return res;
+	}
+	*pmem = dst.buf[0].mem;
+	*psize = res;
+	return 0;
+#else
+	return -ENOSYS;
+#endif
+}
+
+static inline void hostCflockFromFuselock(fuse_flock_t *lock,
+	int type,
+	int whence,
+	int64_t start,
+	int64_t len,
+	int64_t pid)
+{
+	lock->l_type = type;
+	lock->l_whence = whence;
+	lock->l_start = start;
+	lock->l_len = len;
+	lock->l_pid = pid;
+}
+
 static inline int hostFilldir(fuse_fill_dir_t filler, void *buf,
 	char *name, fuse_stat_t *stbuf, fuse_off_t off)
 {
 #if FUSE_USE_VERSION < 30
 	return filler(buf, name, stbuf, off);
 #else
-	return filler(buf, name, stbuf, off, FUSE_FILL_DIR_PLUS);
+	// libfuse uses stbuf as readdirplus information only with FUSE_FILL_DIR_PLUS
+	return filler(buf, name, stbuf, off, 0 != stbuf ? FUSE_FILL_DIR_PLUS : 0);
 #endif
 }
 
@@ -608,6 +1030,25 @@ static int _hostGetxattr(char *path, char *name, char *value, size_t size,
 #define _hostGetxattr go_hostGetxattr
 #endif
 
+#if FUSE_USE_VERSION >= 30
+static ssize_t _hostCopyFileRange(char *path_in, struct fuse_file_info *fi_in, fuse_off_t off_in,
+	char *path_out, struct fuse_file_info *fi_out, fuse_off_t off_out, size_t size, int flags)
+{
+	// Go returns the number of bytes copied as an int; partial copies are fine.
+	if (INT_MAX < size)
+		size = INT_MAX;
+	return go_hostCopyFileRange(path_in, fi_in, off_in, path_out, fi_out, off_out, size, flags);
+}
+#endif
+
+#if FUSE_USE_VERSION >= 30 && FUSE_VERSION >= FUSE_MAKE_VERSION(3, 8)
+static fuse_off_t _hostLseek(char *path, fuse_off_t off, int whence, struct fuse_file_info *fi)
+{
+	int errc = go_hostLseek(path, off, whence, fi, &off);
+	return 0 != errc ? errc : off;
+}
+#endif
+
 // hostStaticInit, hostFuseInit and hostInit serve different purposes.
 //
 // hostStaticInit and hostFuseInit are needed to provide static and dynamic initialization
@@ -625,7 +1066,8 @@ static int hostFuseInit(void)
 	return 0 != cgofuse_init_fast(0);
 }
 
-static int hostMount(int argc, char *argv[], void *data)
+static int hostMount(int argc, char *argv[], bool nullpath_ok, bool read_buf, bool write_buf,
+	void *data)
 {
 	static struct fuse_operations fsop =
 	{
@@ -697,8 +1139,32 @@ static int hostMount(int argc, char *argv[], void *data)
 		.ftruncate = (int (*)(const char *, fuse_off_t, struct fuse_file_info *))go_hostFtruncate,
 		.fgetattr = (int (*)(const char *, fuse_stat_t *, struct fuse_file_info *))go_hostFgetattr,
 #endif
-		//.lock = (int (*)(const char *, struct fuse_file_info *, int, struct fuse_flock *))
-		//	go_hostFlock,
+#if !defined(_WIN32)
+		.lock = (int (*)(const char *, struct fuse_file_info *, int, fuse_flock_t *))go_hostLock,
+#endif
+#if defined(__FreeBSD__) || defined(__linux__)
+		.poll = (int (*)(const char *, struct fuse_file_info *, struct fuse_pollhandle *, unsigned *))
+			go_hostPoll,
+#if FUSE_USE_VERSION < 35
+		.ioctl = (int (*)(const char *, int, void *, struct fuse_file_info *, unsigned int, void *))
+			go_hostIoctl,
+#else
+		.ioctl = (int (*)(const char *, unsigned int, void *, struct fuse_file_info *, unsigned int,
+			void *))go_hostIoctl,
+#endif
+#endif
+#if (defined(__FreeBSD__) || defined(__linux__)) && FUSE_VERSION >= FUSE_MAKE_VERSION(2, 9)
+		.flock = (int (*)(const char *, struct fuse_file_info *, int))go_hostFlock,
+		.fallocate = (int (*)(const char *, int, fuse_off_t, fuse_off_t, struct fuse_file_info *))
+			go_hostFallocate,
+#endif
+#if FUSE_USE_VERSION >= 30
+		.copy_file_range = (ssize_t (*)(const char *, struct fuse_file_info *, fuse_off_t,
+			const char *, struct fuse_file_info *, fuse_off_t, size_t, int))_hostCopyFileRange,
+#endif
+#if FUSE_USE_VERSION >= 30 && FUSE_VERSION >= FUSE_MAKE_VERSION(3, 8)
+		.lseek = (fuse_off_t (*)(const char *, fuse_off_t, int, struct fuse_file_info *))_hostLseek,
+#endif
 #if FUSE_USE_VERSION < 30
 		.utimens = (int (*)(const char *, const fuse_timespec_t [2]))go_hostUtimens,
 #else
@@ -732,17 +1198,76 @@ static int hostMount(int argc, char *argv[], void *data)
 	// values are atomic so that no half writes can be observed).
 	((void **)&fsop)[45] = go_hostGetpath;
 #endif
+#if defined(__FreeBSD__) || defined(__linux__)
+	// Use a copy of fsop for the per-mount settings so that concurrent mounts
+	// do not interfere.
+	struct fuse_operations fsop0 = fsop;
+#if FUSE_USE_VERSION < 30
+	// FUSE2 has no nullpath_ok option; it is a flag in struct fuse_operations.
+	fsop0.flag_nullpath_ok = nullpath_ok;
+#endif
+#if FUSE_VERSION >= FUSE_MAKE_VERSION(2, 9)
+	// Register .read_buf and .write_buf only if the file system implements them;
+	// otherwise libfuse uses .read and .write directly.
+	if (read_buf)
+		fsop0.read_buf = (int (*)(const char *, struct fuse_bufvec **, size_t, fuse_off_t,
+			struct fuse_file_info *))go_hostReadBuf;
+	if (write_buf)
+		fsop0.write_buf = (int (*)(const char *, struct fuse_bufvec *, fuse_off_t,
+			struct fuse_file_info *))go_hostWriteBuf;
+#endif
+	return 0 == fuse_main_real(argc, argv, &fsop0, sizeof fsop0, data);
+#else
 	return 0 == fuse_main_real(argc, argv, &fsop, sizeof fsop, data);
+#endif
+}
+
+static int hostStatDev(char *path, uint64_t *dev)
+{
+#if !defined(_WIN32)
+	struct stat stbuf;
+	if (-1 == stat(path, &stbuf))
+		return errno;
+	*dev = stbuf.st_dev;
+	return 0;
+#else
+	return ENOSYS;
+#endif
+}
+
+static int hostStderrRedirect(int fd)
+{
+#if !defined(_WIN32)
+	int saved = dup(2);
+	if (-1 == saved)
+		return -1;
+	if (-1 == dup2(fd, 2))
+	{
+		close(saved);
+		return -1;
+	}
+	return saved;
+#else
+	return -1;
+#endif
+}
+
+static void hostStderrRestore(int saved)
+{
+#if !defined(_WIN32)
+	dup2(saved, 2);
+	close(saved);
+#endif
 }
 
-static int hostUnmount(struct fuse *fuse, char *mountpoint)
+static int hostUnmount(struct fuse *fuse, char *mountpoint, bool force)
 {
 #if defined(__APPLE__) || defined(__FreeBSD__) || defined(__NetBSD__) || defined(__OpenBSD__)
 	if (0 == mountpoint)
 		return 0;
 	// darwin,freebsd,netbsd: unmount is available to non-root
 	// openbsd: kern.usermount has been removed and mount/unmount is available to root only
-	return 0 == unmount(mountpoint, MNT_FORCE);
+	return 0 == unmount(mountpoint, force ? MNT_FORCE : 0);
 #elif defined(__linux__)
 	if (0 == mountpoint)
 		return 0;
@@ -752,6 +1277,10 @@ static int hostUnmount(struct fuse *fuse, char *mountpoint)
 	// linux: umount2 failed; try fusermount
 	char *paths[] =
 	{
+#if FUSE_USE_VERSION >= 30
+		"/bin/fusermount3",
+		"/usr/bin/fusermount3",
+#endif
 		"/bin/fusermount",
 		"/usr/bin/fusermount",
 	};
@@ -775,7 +1304,7 @@ static int hostUnmount(struct fuse *fuse, char *mountpoint)
 	return
 		0 == posix_spawn(&pid, argv[0], 0, 0, argv, 0) &&
 		pid == waitpid(pid, &status, 0) &&
-		WIFEXITED(status) && 0 == WEXITSTATUS(status);
+		WIFEXITED(status) && 0 == WEXITSTATUS(status) ? 2 : 0;
 #elif defined(_WIN32)
 	// windows/winfsp: fuse_exit just works from anywhere
 	fuse_exit(fuse);
@@ -783,17 +1312,174 @@ static int hostUnmount(struct fuse *fuse, char *mountpoint)
 #endif
 }
 
+static int hostInvalidatePath(struct fuse *fuse, const char *path)
+{
+#if (defined(__FreeBSD__) || defined(__linux__)) && FUSE_VERSION >= 30
+	int res;
+	if (0 == pfn_fuse_invalidate_path)
+		return -ENOSYS;
+	res = pfn_fuse_invalidate_path(fuse, path);
+	// -ENOENT: the kernel does not know the path, so there is nothing to invalidate
+	return -ENOENT == res ? 0 : res;
+#else
+	return -ENOSYS;
+#endif
+}
+
 static int hostNotify(struct fuse *fuse, const char *path, uint32_t action)
 {
 #if defined(_WIN32)
 	if (0 == pfn_fsp_fuse_notify)
 		return 0;
 	return 0 == pfn_fsp_fuse_notify(fsp_fuse_env(), fuse, path, action);
+#elif (defined(__FreeBSD__) || defined(__linux__)) && FUSE_VERSION >= 30
+	// FUSE3 cannot report changes, but it can invalidate the kernel caches.
+	// When entries are added to or removed from a directory (NOTIFY_MKDIR,
+	// NOTIFY_RMDIR, NOTIFY_CREATE, NOTIFY_UNLINK) also invalidate the directory.
+	char *parent, *slash;
+	int res;
+	res = hostInvalidatePath(fuse, path);
+	if (0 != res || 0 == (action & 0x000f))
+		return 0 == res;
+	parent = strdup(path);
+	if (0 == parent)
+		return 0;
+	slash = strrchr(parent, '/');
+	if (0 != slash)
+	{
+		if (parent == slash)
+			slash[1] = '\0'; // root directory
+		else
+			slash[0] = '\0';
+		res = hostInvalidatePath(fuse, parent);
+	}
+	free(parent);
+	return 0 == res;
+#else
+	return 0;
+#endif
+}
+
+#if (defined(__FreeBSD__) || defined(__linux__)) && FUSE_VERSION >= 30
+static int hostNodeid(const char *mountpoint, const char *path, bool useIno, fuse_ino_t *pino)
+{
+	// The high-level API does not expose its node ids. Unless the file system uses its
+	// own inode numbers the FUSE library reports the node id of a file as its inode
+	// number, so we ask the kernel for the inode number of the file.
+	struct stat stbuf;
+	char *fullpath;
+	size_t mlen, plen;
+	int res;
+	if (useIno || 0 == mountpoint)
+		return -ENOSYS;
+	mlen = strlen(mountpoint);
+	plen = strlen(path);
+	fullpath = malloc(mlen + plen + 1);
+	if (0 == fullpath)
+		return -ENOMEM;
+	memcpy(fullpath, mountpoint, mlen);
+	memcpy(fullpath + mlen, path, plen + 1);
+	res = -1 == lstat(fullpath, &stbuf) ? -errno : 0;
+	free(fullpath);
+	if (0 == res)
+		*pino = stbuf.st_ino;
+	return res;
+}
+#endif
+
+static int hostInvalidateEntry(struct fuse *fuse, const char *mountpoint,
+	const char *dir, const char *name, bool useIno)
+{
+#if (defined(__FreeBSD__) || defined(__linux__)) && FUSE_VERSION >= 30
+	fuse_ino_t parent;
+	int res;
+	if (0 == pfn_fuse_get_session || 0 == pfn_fuse_lowlevel_notify_inval_entry)
+		return -ENOSYS;
+	res = hostNodeid(mountpoint, dir, useIno, &parent);
+	if (0 == res)
+		res = pfn_fuse_lowlevel_notify_inval_entry(pfn_fuse_get_session(fuse),
+			parent, name, strlen(name));
+	// -ENOENT: the kernel does not know the entry, so there is nothing to invalidate
+	return -ENOENT == res ? 0 : res;
+#else
+	return -ENOSYS;
+#endif
+}
+
+static int hostInvalidateData(struct fuse *fuse, const char *mountpoint,
+	const char *path, int64_t ofst, int64_t size, bool useIno)
+{
+#if (defined(__FreeBSD__) || defined(__linux__)) && FUSE_VERSION >= 30
+	fuse_ino_t ino;
+	int res;
+	if (0 == pfn_fuse_get_session || 0 == pfn_fuse_lowlevel_notify_inval_inode)
+		return -ENOSYS;
+	res = hostNodeid(mountpoint, path, useIno, &ino);
+	if (0 == res)
+		res = pfn_fuse_lowlevel_notify_inval_inode(pfn_fuse_get_session(fuse),
+			ino, ofst, size);
+	return -ENOENT == res ? 0 : res;
+#else
+	return -ENOSYS;
+#endif
+}
+
+static int hostNotifyPoll(void *ph)
+{
+#if defined(__FreeBSD__) || defined(__linux__)
+	if (0 == pfn_fuse_notify_poll)
+		return 0;
+	return 0 == pfn_fuse_notify_poll(ph);
 #else
 	return 0;
 #endif
 }
 
+static int hostInterrupted(void)
+{
+#if defined(__FreeBSD__) || defined(__linux__)
+	if (0 == pfn_fuse_interrupted)
+		return 0;
+	return pfn_fuse_interrupted();
+#else
+	return 0;
+#endif
+}
+
+static int hostInterruptible(void)
+{
+#if defined(__FreeBSD__) || defined(__linux__)
+	return 0 != pfn_fuse_interrupted;
+#else
+	return 0;
+#endif
+}
+
+static uintptr_t hostThreadId(void)
+{
+	return (uintptr_t)pthread_self();
+}
+
+static int hostGetgroups(int size, uint32_t *list)
+{
+#if defined(__FreeBSD__) || defined(__linux__)
+	if (0 == pfn_fuse_getgroups)
+		return -ENOSYS;
+	return pfn_fuse_getgroups(size, (gid_t *)list);
+#else
+	return -ENOSYS;
+#endif
+}
+
+static void hostPollhandleDestroy(void *ph)
+{
+#if defined(__FreeBSD__) || defined(__linux__)
+	if (0 == pfn_fuse_pollhandle_destroy)
+		return;
+	pfn_fuse_pollhandle_destroy(ph);
+#endif
+}
+
 static void hostOptSet(struct fuse_opt *opt,
 	const char *templ, fuse_opt_offset_t offset, int value)
 {
@@ -826,6 +1512,287 @@ static int hostOptParse(struct fuse_args *args, void *data, const struct fuse_op
 {
 	return fuse_opt_parse(args, data, opts, nonopts ? hostOptParseOptProc : 0);
 }
+
+#if defined(CGOFUSE_LOWLEVEL)
+static void hostLlSetattr(fuse_req_t req, fuse_ino_t ino, struct stat *attr, int valid,
+	struct fuse_file_info *fi)
+{
+	go_hostLlSetattr(req, ino,
+		attr->st_mode, attr->st_uid, attr->st_gid, attr->st_size,
+		attr->st_atim.tv_sec, attr->st_atim.tv_nsec,
+		attr->st_mtim.tv_sec, attr->st_mtim.tv_nsec,
+		attr->st_ctim.tv_sec, attr->st_ctim.tv_nsec,
+		valid, fi);
+}
+
+static inline void hostLlEntryParam(struct fuse_entry_param *e,
+	uint64_t ino, uint64_t generation, fuse_stat_t *attr,
+	double attr_timeout, double entry_timeout)
+{
+	memset(e, 0, sizeof *e);
+	e->ino = ino;
+	e->generation = generation;
+	e->attr = *attr;
+	e->attr_timeout = attr_timeout;
+	e->entry_timeout = entry_timeout;
+}
+#endif
+
+static int hostLlFuseInit(void)
+{
+#if defined(CGOFUSE_LOWLEVEL)
+	return 0 != cgofuse_init_fast(0) && cgofuse_lowlevel;
+#else
+	return 0;
+#endif
+}
+
+static void *hostLlSessionNew(int argc, char *argv[], void *data)
+{
+#if defined(CGOFUSE_LOWLEVEL)
+	static struct fuse_lowlevel_ops llop =
+	{
+		.init = (void (*)(void *, struct fuse_conn_info *))go_hostLlInit,
+		.destroy = (void (*)(void *))go_hostLlDestroy,
+		.lookup = (void (*)(fuse_req_t, fuse_ino_t, const char *))go_hostLlLookup,
+		.forget = (void (*)(fuse_req_t, fuse_ino_t, uint64_t))go_hostLlForget,
+		.getattr = (void (*)(fuse_req_t, fuse_ino_t, struct fuse_file_info *))go_hostLlGetattr,
+		.setattr = hostLlSetattr,
+		.readlink = (void (*)(fuse_req_t, fuse_ino_t))go_hostLlReadlink,
+		.mknod = (void (*)(fuse_req_t, fuse_ino_t, const char *, mode_t, dev_t))go_hostLlMknod,
+		.mkdir = (void (*)(fuse_req_t, fuse_ino_t, const char *, mode_t))go_hostLlMkdir,
+		.unlink = (void (*)(fuse_req_t, fuse_ino_t, const char *))go_hostLlUnlink,
+		.rmdir = (void (*)(fuse_req_t, fuse_ino_t, const char *))go_hostLlRmdir,
+		.symlink = (void (*)(fuse_req_t, const char *, fuse_ino_t, const char *))go_hostLlSymlink,
+		.rename = (void (*)(fuse_req_t, fuse_ino_t, const char *, fuse_ino_t, const char *,
+			unsigned int))go_hostLlRename,
+		.link = (void (*)(fuse_req_t, fuse_ino_t, fuse_ino_t, const char *))go_hostLlLink,
+		.open = (void (*)(fuse_req_t, fuse_ino_t, struct fuse_file_info *))go_hostLlOpen,
+		.read = (void (*)(fuse_req_t, fuse_ino_t, size_t, off_t,
+			struct fuse_file_info *))go_hostLlRead,
+		.write = (void (*)(fuse_req_t, fuse_ino_t, const char *, size_t, off_t,
+			struct fuse_file_info *))go_hostLlWrite,
+		.flush = (void (*)(fuse_req_t, fuse_ino_t, struct fuse_file_info *))go_hostLlFlush,
+		.release = (void (*)(fuse_req_t, fuse_ino_t, struct fuse_file_info *))go_hostLlRelease,
+		.fsync = (void (*)(fuse_req_t, fuse_ino_t, int, struct fuse_file_info *))go_hostLlFsync,
+		.opendir = (void (*)(fuse_req_t, fuse_ino_t, struct fuse_file_info *))go_hostLlOpendir,
+		.readdir = (void (*)(fuse_req_t, fuse_ino_t, size_t, off_t,
+			struct fuse_file_info *))go_hostLlReaddir,
+		.releasedir = (void (*)(fuse_req_t, fuse_ino_t,
+			struct fuse_file_info *))go_hostLlReleasedir,
+		.fsyncdir = (void (*)(fuse_req_t, fuse_ino_t, int,
+			struct fuse_file_info *))go_hostLlFsyncdir,
+		.statfs = (void (*)(fuse_req_t, fuse_ino_t))go_hostLlStatfs,
+		.setxattr = (void (*)(fuse_req_t, fuse_ino_t, const char *, const char *, size_t,
+			int))go_hostLlSetxattr,
+		.getxattr = (void (*)(fuse_req_t, fuse_ino_t, const char *, size_t))go_hostLlGetxattr,
+		.listxattr = (void (*)(fuse_req_t, fuse_ino_t, size_t))go_hostLlListxattr,
+		.removexattr = (void (*)(fuse_req_t, fuse_ino_t, const char *))go_hostLlRemovexattr,
+		.access = (void (*)(fuse_req_t, fuse_ino_t, int))go_hostLlAccess,
+		.create = (void (*)(fuse_req_t, fuse_ino_t, const char *, mode_t,
+			struct fuse_file_info *))go_hostLlCreate,
+		.readdirplus = (void (*)(fuse_req_t, fuse_ino_t, size_t, off_t,
+			struct fuse_file_info *))go_hostLlReaddirplus,
+	};
+	struct fuse_args args = FUSE_ARGS_INIT(argc, argv);
+	struct fuse_session *se = pfn_fuse_session_new(&args, &llop, sizeof llop, data);
+	fuse_opt_free_args(&args);
+	return se;
+#else
+	return 0;
+#endif
+}
+
+static int hostLlSessionMount(void *se, char *mountpoint)
+{
+#if defined(CGOFUSE_LOWLEVEL)
+	return pfn_fuse_session_mount(se, mountpoint);
+#else
+	return -ENOSYS;
+#endif
+}
+
+static int hostLlSessionLoop(void *se, bool single)
+{
+#if defined(CGOFUSE_LOWLEVEL)
+	if (!single && 0 != pfn_fuse_session_loop_mt_31)
+		return pfn_fuse_session_loop_mt_31(se, 0);
+	return pfn_fuse_session_loop(se);
+#else
+	return -ENOSYS;
+#endif
+}
+
+static void hostLlSessionUnmount(void *se)
+{
+#if defined(CGOFUSE_LOWLEVEL)
+	pfn_fuse_session_unmount(se);
+#endif
+}
+
+static void hostLlSessionDestroy(void *se)
+{
+#if defined(CGOFUSE_LOWLEVEL)
+	pfn_fuse_session_destroy(se);
+#endif
+}
+
+static void *hostLlReqUserdata(void *req)
+{
+#if defined(CGOFUSE_LOWLEVEL)
+	return pfn_fuse_req_userdata(req);
+#else
+	return 0;
+#endif
+}
+
+static void hostLlReqCtx(void *req, uint32_t *uid, uint32_t *gid, uint32_t *pid, uint32_t *umask)
+{
+#if defined(CGOFUSE_LOWLEVEL)
+	const struct fuse_ctx *ctx = pfn_fuse_req_ctx(req);
+	*uid = ctx->uid;
+	*gid = ctx->gid;
+	*pid = ctx->pid;
+	*umask = ctx->umask;
+#else
+	*uid = *gid = *pid = *umask = 0;
+#endif
+}
+
+static int hostLlReplyErr(void *req, int err)
+{
+#if defined(CGOFUSE_LOWLEVEL)
+	return pfn_fuse_reply_err(req, err);
+#else
+	return -ENOSYS;
+#endif
+}
+
+static void hostLlReplyNone(void *req)
+{
+#if defined(CGOFUSE_LOWLEVEL)
+	pfn_fuse_reply_none(req);
+#endif
+}
+
+static int hostLlReplyEntry(void *req, uint64_t ino, uint64_t generation, fuse_stat_t *attr,
+	double attr_timeout, double entry_timeout)
+{
+#if defined(CGOFUSE_LOWLEVEL)
+	struct fuse_entry_param e;
+	hostLlEntryParam(&e, ino, generation, attr, attr_timeout, entry_timeout);
+	return pfn_fuse_reply_entry(req, &e);
+#else
+	return -ENOSYS;
+#endif
+}
+
+static int hostLlReplyCreate(void *req, uint64_t ino, uint64_t generation, fuse_stat_t *attr,
+	double attr_timeout, double entry_timeout, struct fuse_file_info *fi)
+{
+#if defined(CGOFUSE_LOWLEVEL)
+	struct fuse_entry_param e;
+	hostLlEntryParam(&e, ino, generation, attr, attr_timeout, entry_timeout);
+	return pfn_fuse_reply_create(req, &e, fi);
+#else
+	return -ENOSYS;
+#endif
+}
+
+static int hostLlReplyAttr(void *req, fuse_stat_t *attr, double attr_timeout)
+{
+#if defined(CGOFUSE_LOWLEVEL)
+	return pfn_fuse_reply_attr(req, attr, attr_timeout);
+#else
+	return -ENOSYS;
+#endif
+}
+
+static int hostLlReplyOpen(void *req, struct fuse_file_info *fi)
+{
+#if defined(CGOFUSE_LOWLEVEL)
+	return pfn_fuse_reply_open(req, fi);
+#else
+	return -ENOSYS;
+#endif
+}
+
+static int hostLlReplyWrite(void *req, size_t count)
+{
+#if defined(CGOFUSE_LOWLEVEL)
+	return pfn_fuse_reply_write(req, count);
+#else
+	return -ENOSYS;
+#endif
+}
+
+static int hostLlReplyBuf(void *req, char *buf, size_t size)
+{
+#if defined(CGOFUSE_LOWLEVEL)
+	return pfn_fuse_reply_buf(req, buf, size);
+#else
+	return -ENOSYS;
+#endif
+}
+
+static int hostLlReplyStatfs(void *req, fuse_statvfs_t *stbuf)
+{
+#if defined(CGOFUSE_LOWLEVEL)
+	return pfn_fuse_reply_statfs(req, stbuf);
+#else
+	return -ENOSYS;
+#endif
+}
+
+static int hostLlReplyXattr(void *req, size_t count)
+{
+#if defined(CGOFUSE_LOWLEVEL)
+	return pfn_fuse_reply_xattr(req, count);
+#else
+	return -ENOSYS;
+#endif
+}
+
+static size_t hostLlAddDirentry(void *req, char *buf, size_t bufsize,
+	char *name, fuse_stat_t *stbuf, fuse_off_t off)
+{
+#if defined(CGOFUSE_LOWLEVEL)
+	return pfn_fuse_add_direntry(req, buf, bufsize, name, stbuf, off);
+#else
+	return 0;
+#endif
+}
+
+static size_t hostLlAddDirentryPlus(void *req, char *buf, size_t bufsize,
+	char *name, uint64_t ino, uint64_t generation, fuse_stat_t *attr,
+	double attr_timeout, double entry_timeout, fuse_off_t off)
+{
+#if defined(CGOFUSE_LOWLEVEL)
+	struct fuse_entry_param e;
+	hostLlEntryParam(&e, ino, generation, attr, attr_timeout, entry_timeout);
+	return pfn_fuse_add_direntry_plus(req, buf, bufsize, name, &e, off);
+#else
+	return 0;
+#endif
+}
+
+static int hostLlNotifyInvalInode(void *se, uint64_t ino, int64_t off, int64_t len)
+{
+#if defined(CGOFUSE_LOWLEVEL)
+	return pfn_fuse_lowlevel_notify_inval_inode(se, ino, off, len);
+#else
+	return -ENOSYS;
+#endif
+}
+
+static int hostLlNotifyInvalEntry(void *se, uint64_t parent, char *name, size_t namelen)
+{
+#if defined(CGOFUSE_LOWLEVEL)
+	return pfn_fuse_lowlevel_notify_inval_entry(se, parent, name, namelen);
+#else
+	return -ENOSYS;
+#endif
+}
 */
 import "C"
 import "unsafe"
@@ -833,8 +1800,10 @@ import "unsafe"
 type (
 	c_bool                    = C.bool
 	c_char                    = C.char
+	c_double                  = C.double
 	c_fuse_dev_t              = C.fuse_dev_t
 	c_fuse_fill_dir_t         = C.fuse_fill_dir_t
+	c_fuse_flock_t            = C.fuse_flock_t
 	c_fuse_gid_t              = C.fuse_gid_t
 	c_fuse_mode_t             = C.fuse_mode_t
 	c_fuse_off_t              = C.fuse_off_t
@@ -894,8 +1863,92 @@ func c_hostAsgnCconninfo(conn *c_struct_fuse_conn_info,
 	capCaseInsensitive c_bool,
 	capReaddirPlus c_bool,
 	capDeleteAccess c_bool,
-	capOpenTrunc c_bool) {
-	C.hostAsgnCconninfo(conn, capCaseInsensitive, capReaddirPlus, capDeleteAccess, capOpenTrunc)
+	capOpenTrunc c_bool,
+	capPosixLocks c_bool,
+	capFlockLocks c_bool,
+	capSpliceWrite c_bool,
+	capSpliceRead c_bool) {
+	C.hostAsgnCconninfo(conn, capCaseInsensitive, capReaddirPlus, capDeleteAccess, capOpenTrunc,
+		capPosixLocks, capFlockLocks, capSpliceWrite, capSpliceRead)
+}
+func c_hostConninfoGet(conn *c_struct_fuse_conn_info,
+	protoMajor *c_uint32_t,
+	protoMinor *c_uint32_t,
+	maxWrite *c_uint32_t,
+	maxRead *c_uint32_t,
+	maxReadahead *c_uint32_t,
+	capable *c_uint32_t,
+	want *c_uint32_t,
+	maxBackground *c_uint32_t,
+	congestionThreshold *c_uint32_t,
+	timeGran *c_uint32_t) {
+	C.hostConninfoGet(conn,
+		protoMajor,
+		protoMinor,
+		maxWrite,
+		maxRead,
+		maxReadahead,
+		capable,
+		want,
+		maxBackground,
+		congestionThreshold,
+		timeGran)
+}
+func c_hostConninfoSet(conn *c_struct_fuse_conn_info,
+	maxWrite c_uint32_t,
+	maxRead c_uint32_t,
+	maxReadahead c_uint32_t,
+	want c_uint32_t,
+	maxBackground c_uint32_t,
+	congestionThreshold c_uint32_t,
+	timeGran c_uint32_t) {
+	C.hostConninfoSet(conn,
+		maxWrite,
+		maxRead,
+		maxReadahead,
+		want,
+		maxBackground,
+		congestionThreshold,
+		timeGran)
+}
+func c_hostFuseUseVersion() c_int {
+	return C.hostFuseUseVersion()
+}
+func c_hostFuseVersion() c_int {
+	return C.hostFuseVersion()
+}
+func c_hostAsgnCconfigEx(conf *c_struct_fuse_config,
+	entryTimeout c_double,
+	attrTimeout c_double,
+	negativeTimeout c_double,
+	kernelCache c_bool,
+	autoCache c_bool,
+	acAttrTimeoutSet c_bool,
+	acAttrTimeout c_double,
+	hardRemove c_bool,
+	nullpathOk c_bool,
+	setMode c_bool,
+	umask c_uint32_t,
+	setUid c_bool,
+	uid c_uint32_t,
+	setGid c_bool,
+	gid c_uint32_t) {
+	C.hostAsgnCconfigEx(conf,
+		entryTimeout,
+		attrTimeout,
+		negativeTimeout,
+		kernelCache,
+		autoCache,
+		acAttrTimeoutSet,
+		acAttrTimeout,
+		hardRemove,
+		nullpathOk,
+		setMode,
+		umask,
+		setUid,
+		uid,
+		setGid,
+		gid)
 }
 func c_hostAsgnCconfig(conf *c_struct_fuse_config,
 	directIO c_bool,
@@ -975,6 +2028,34 @@ func c_hostAsgnCfileinfo(fi *c_struct_fuse_file_info,
 		nonseekable,
 		fh)
 }
+func c_hostFlockRelease(fi *c_struct_fuse_file_info) c_bool {
+	return C.hostFlockRelease(fi)
+}
+func c_hostBufvecNew(count c_size_t) unsafe.Pointer {
+	return C.hostBufvecNew(count)
+}
+func c_hostBufvecCount(bufv unsafe.Pointer) c_size_t {
+	return C.hostBufvecCount(bufv)
+}
+func c_hostBufvecGet(bufv unsafe.Pointer, i c_size_t,
+	flags *c_uint32_t, mem *unsafe.Pointer, size *c_size_t, fd *c_int, pos *c_int64_t) {
+	C.hostBufvecGet(bufv, i, flags, mem, size, fd, pos)
+}
+func c_hostBufvecSet(bufv unsafe.Pointer, i c_size_t,
+	flags c_uint32_t, mem unsafe.Pointer, size c_size_t, fd c_int, pos c_int64_t) {
+	C.hostBufvecSet(bufv, i, flags, mem, size, fd, pos)
+}
+func c_hostBufvecFlatten(bufv unsafe.Pointer, mem *unsafe.Pointer, size *c_size_t) c_int {
+	return C.hostBufvecFlatten(bufv, mem, size)
+}
+func c_hostCflockFromFuselock(lock *c_fuse_flock_t,
+	typ c_int,
+	whence c_int,
+	start c_int64_t,
+	len c_int64_t,
+	pid c_int64_t) {
+	C.hostCflockFromFuselock(lock, typ, whence, start, len, pid)
+}
 func c_hostFilldir(filler c_fuse_fill_dir_t,
 	buf unsafe.Pointer, name *c_char, stbuf *c_fuse_stat_t, off c_fuse_off_t) c_int {
 	return C.hostFilldir(filler, buf, name, stbuf, off)
@@ -985,15 +2066,54 @@ func c_hostStaticInit() {
 func c_hostFuseInit() c_int {
 	return C.hostFuseInit()
 }
-func c_hostMount(argc c_int, argv **c_char, data unsafe.Pointer) c_int {
-	return C.hostMount(argc, argv, data)
+func c_hostMount(argc c_int, argv **c_char, nullpathOk c_bool,
+	readBuf c_bool, writeBuf c_bool, data unsafe.Pointer) c_int {
+	return C.hostMount(argc, argv, nullpathOk, readBuf, writeBuf, data)
+}
+func c_hostStatDev(path *c_char, dev *c_uint64_t) c_int {
+	return C.hostStatDev(path, dev)
 }
-func c_hostUnmount(fuse *c_struct_fuse, mountpoint *c_char) c_int {
-	return C.hostUnmount(fuse, mountpoint)
+func c_hostStderrRedirect(fd c_int) c_int {
+	return C.hostStderrRedirect(fd)
+}
+func c_hostStderrRestore(saved c_int) {
+	C.hostStderrRestore(saved)
+}
+func c_hostUnmount(fuse *c_struct_fuse, mountpoint *c_char, force c_bool) c_int {
+	return C.hostUnmount(fuse, mountpoint, force)
 }
 func c_hostNotify(fuse *c_struct_fuse, path *c_char, action c_uint32_t) c_int {
 	return C.hostNotify(fuse, path, action)
 }
+func c_hostInvalidatePath(fuse *c_struct_fuse, path *c_char) c_int {
+	return C.hostInvalidatePath(fuse, path)
+}
+func c_hostInvalidateEntry(fuse *c_struct_fuse, mountpoint *c_char,
+	dir *c_char, name *c_char, useIno c_bool) c_int {
+	return C.hostInvalidateEntry(fuse, mountpoint, dir, name, useIno)
+}
+func c_hostInvalidateData(fuse *c_struct_fuse, mountpoint *c_char,
+	path *c_char, ofst c_int64_t, size c_int64_t, useIno c_bool) c_int {
+	return C.hostInvalidateData(fuse, mountpoint, path, ofst, size, useIno)
+}
+func c_hostNotifyPoll(ph unsafe.Pointer) c_int {
+	return C.hostNotifyPoll(ph)
+}
+func c_hostPollhandleDestroy(ph unsafe.Pointer) {
+	C.hostPollhandleDestroy(ph)
+}
+func c_hostInterrupted() c_int {
+	return C.hostInterrupted()
+}
+func c_hostInterruptible() bool {
+	return 0 != C.hostInterruptible()
+}
+func c_hostThreadId() uintptr {
+	return uintptr(C.hostThreadId())
+}
+func c_hostGetgroups(size c_int, list *c_uint32_t) c_int {
+	return C.hostGetgroups(size, list)
+}
 func c_hostOptSet(opt *c_struct_fuse_opt,
 	templ *c_char, offset c_fuse_opt_offset_t, value c_int) {
 	C.hostOptSet(opt, templ, offset, value)
@@ -1002,6 +2122,82 @@ func c_hostOptParse(args *c_struct_fuse_args, data unsafe.Pointer, opts *c_struc
 	nonopts c_bool) c_int {
 	return C.hostOptParse(args, data, opts, nonopts)
 }
+func c_hostLlFuseInit() c_int {
+	return C.hostLlFuseInit()
+}
+func c_hostLlSessionNew(argc c_int, argv **c_char, data unsafe.Pointer) unsafe.Pointer {
+	return C.hostLlSessionNew(argc, argv, data)
+}
+func c_hostLlSessionMount(se unsafe.Pointer, mountpoint *c_char) c_int {
+	return C.hostLlSessionMount(se, mountpoint)
+}
+func c_hostLlSessionLoop(se unsafe.Pointer, single c_bool) c_int {
+	return C.hostLlSessionLoop(se, single)
+}
+func c_hostLlSessionUnmount(se unsafe.Pointer) {
+	C.hostLlSessionUnmount(se)
+}
+func c_hostLlSessionDestroy(se unsafe.Pointer) {
+	C.hostLlSessionDestroy(se)
+}
+func c_hostLlReqUserdata(req unsafe.Pointer) unsafe.Pointer {
+	return C.hostLlReqUserdata(req)
+}
+func c_hostLlReqCtx(req unsafe.Pointer, uid *c_uint32_t, gid *c_uint32_t, pid *c_uint32_t,
+	umask *c_uint32_t) {
+	C.hostLlReqCtx(req, uid, gid, pid, umask)
+}
+func c_hostLlReplyErr(req unsafe.Pointer, err c_int) c_int {
+	return C.hostLlReplyErr(req, err)
+}
+func c_hostLlReplyNone(req unsafe.Pointer) {
+	C.hostLlReplyNone(req)
+}
+func c_hostLlReplyEntry(req unsafe.Pointer, ino c_uint64_t, generation c_uint64_t,
+	attr *c_fuse_stat_t, attrTimeout c_double, entryTimeout c_double) c_int {
+	return C.hostLlReplyEntry(req, ino, generation, attr, attrTimeout, entryTimeout)
+}
+func c_hostLlReplyCreate(req unsafe.Pointer, ino c_uint64_t, generation c_uint64_t,
+	attr *c_fuse_stat_t, attrTimeout c_double, entryTimeout c_double,
+	fi *c_struct_fuse_file_info) c_int {
+	return C.hostLlReplyCreate(req, ino, generation, attr, attrTimeout, entryTimeout, fi)
+}
+func c_hostLlReplyAttr(req unsafe.Pointer, attr *c_fuse_stat_t, attrTimeout c_double) c_int {
+	return C.hostLlReplyAttr(req, attr, attrTimeout)
+}
+func c_hostLlReplyOpen(req unsafe.Pointer, fi *c_struct_fuse_file_info) c_int {
+	return C.hostLlReplyOpen(req, fi)
+}
+func c_hostLlReplyWrite(req unsafe.Pointer, count c_size_t) c_int {
+	return C.hostLlReplyWrite(req, count)
+}
+func c_hostLlReplyBuf(req unsafe.Pointer, buf *c_char, size c_size_t) c_int {
+	return C.hostLlReplyBuf(req, buf, size)
+}
+func c_hostLlReplyStatfs(req unsafe.Pointer, stbuf *c_fuse_statvfs_t) c_int {
+	return C.hostLlReplyStatfs(req, stbuf)
+}
+func c_hostLlReplyXattr(req unsafe.Pointer, count c_size_t) c_int {
+	return C.hostLlReplyXattr(req, count)
+}
+func c_hostLlAddDirentry(req unsafe.Pointer, buf *c_char, bufsize c_size_t,
+	name *c_char, stbuf *c_fuse_stat_t, off c_fuse_off_t) c_size_t {
+	return C.hostLlAddDirentry(req, buf, bufsize, name, stbuf, off)
+}
+func c_hostLlAddDirentryPlus(req unsafe.Pointer, buf *c_char, bufsize c_size_t,
+	name *c_char, ino c_uint64_t, generation c_uint64_t, attr *c_fuse_stat_t,
+	attrTimeout c_double, entryTimeout c_double, off c_fuse_off_t) c_size_t {
+	return C.hostLlAddDirentryPlus(req, buf, bufsize, name, ino, generation, attr,
+		attrTimeout, entryTimeout, off)
+}
+func c_hostLlNotifyInvalInode(se unsafe.Pointer, ino c_uint64_t, off c_int64_t,
+	len c_int64_t) c_int {
+	return C.hostLlNotifyInvalInode(se, ino, off, len)
+}
+func c_hostLlNotifyInvalEntry(se unsafe.Pointer, parent c_uint64_t, name *c_char,
+	namelen c_size_t) c_int {
+	return C.hostLlNotifyInvalEntry(se, parent, name, namelen)
+}
 
 //export go_hostGetattr
 func go_hostGetattr(path0 *c_char, stat0 *c_fuse_stat_t) (errc0 c_int) {
@@ -1157,14 +2353,14 @@ func go_hostOpendir(path0 *c_char, fi0 *c_struct_fuse_file_info) (errc0 c_int) {
 func go_hostReaddir(path0 *c_char,
 	buff0 unsafe.Pointer, fill0 c_fuse_fill_dir_t, ofst0 c_fuse_off_t,
 	fi0 *c_struct_fuse_file_info) (errc0 c_int) {
-	return hostReaddir(path0, buff0, fill0, ofst0, fi0)
+	return hostReaddir(path0, buff0, fill0, ofst0, fi0, 0)
 }
 
 //export go_hostReaddir3
 func go_hostReaddir3(path0 *c_char,
 	buff0 unsafe.Pointer, fill0 c_fuse_fill_dir_t, ofst0 c_fuse_off_t,
 	fi0 *c_struct_fuse_file_info, flags c_enum_fuse_readdir_flags) (errc0 c_int) {
-	return hostReaddir(path0, buff0, fill0, ofst0, fi0)
+	return hostReaddir(path0, buff0, fill0, ofst0, fi0, uint32(flags))
 }
 
 //export go_hostReleasedir
@@ -1214,6 +2410,60 @@ func go_hostFgetattr(path0 *c_char, stat0 *c_fuse_stat_t,
 	return hostFgetattr(path0, stat0, fi0)
 }
 
+//export go_hostLock
+func go_hostLock(path0 *c_char, fi0 *c_struct_fuse_file_info, cmd0 c_int,
+	lock0 *c_fuse_flock_t) (errc0 c_int) {
+	return hostLock(path0, fi0, cmd0, lock0)
+}
+
+//export go_hostFlock
+func go_hostFlock(path0 *c_char, fi0 *c_struct_fuse_file_info, op0 c_int) (errc0 c_int) {
+	return hostFlock(path0, fi0, op0)
+}
+
+//export go_hostFallocate
+func go_hostFallocate(path0 *c_char, mode0 c_int, ofst0 c_fuse_off_t, len0 c_fuse_off_t,
+	fi0 *c_struct_fuse_file_info) (errc0 c_int) {
+	return hostFallocate(path0, mode0, ofst0, len0, fi0)
+}
+
+//export go_hostCopyFileRange
+func go_hostCopyFileRange(pathIn0 *c_char, fiIn0 *c_struct_fuse_file_info, ofstIn0 c_fuse_off_t,
+	pathOut0 *c_char, fiOut0 *c_struct_fuse_file_info, ofstOut0 c_fuse_off_t,
+	size0 c_size_t, flags0 c_int) (nbyt0 c_int) {
+	return hostCopyFileRange(pathIn0, fiIn0, ofstIn0, pathOut0, fiOut0, ofstOut0, size0, flags0)
+}
+
+//export go_hostLseek
+func go_hostLseek(path0 *c_char, ofst0 c_fuse_off_t, whence0 c_int, fi0 *c_struct_fuse_file_info,
+	rofst0 *c_fuse_off_t) (errc0 c_int) {
+	return hostLseek(path0, ofst0, whence0, fi0, rofst0)
+}
+
+//export go_hostIoctl
+func go_hostIoctl(path0 *c_char, cmd0 c_unsigned, arg0 unsafe.Pointer, fi0 *c_struct_fuse_file_info,
+	flags0 c_unsigned, data0 unsafe.Pointer) (errc0 c_int) {
+	return hostIoctl(path0, cmd0, c_uintptr_t(uintptr(arg0)), fi0, flags0, data0)
+}
+
+//export go_hostPoll
+func go_hostPoll(path0 *c_char, fi0 *c_struct_fuse_file_info, ph0 unsafe.Pointer,
+	revents0 *c_unsigned) (errc0 c_int) {
+	return hostPoll(path0, fi0, ph0, revents0)
+}
+
+//export go_hostReadBuf
+func go_hostReadBuf(path0 *c_char, bufp0 *unsafe.Pointer, size0 c_size_t, ofst0 c_fuse_off_t,
+	fi0 *c_struct_fuse_file_info) (errc0 c_int) {
+	return hostReadBuf(path0, bufp0, size0, ofst0, fi0)
+}
+
+//export go_hostWriteBuf
+func go_hostWriteBuf(path0 *c_char, bufv0 unsafe.Pointer, ofst0 c_fuse_off_t,
+	fi0 *c_struct_fuse_file_info) (nbyt0 c_int) {
+	return hostWriteBuf(path0, bufv0, ofst0, fi0)
+}
+
 //export go_hostUtimens
 func go_hostUtimens(path0 *c_char, tmsp0 *c_fuse_timespec_t) (errc0 c_int) {
 	return hostUtimens(path0, tmsp0, nil)
@@ -1244,3 +2494,189 @@ func go_hostSetcrtime(path0 *c_char, tmsp0 *c_fuse_timespec_t) (errc0 c_int) {
 func go_hostChflags(path0 *c_char, flags c_uint32_t) (errc0 c_int) {
 	return hostChflags(path0, flags)
 }
+
+//export go_hostLlInit
+func go_hostLlInit(hndl unsafe.Pointer, conn0 *c_struct_fuse_conn_info) {
+	hostLlInit(hndl, conn0)
+}
+
+//export go_hostLlDestroy
+func go_hostLlDestroy(hndl unsafe.Pointer) {
+	hostLlDestroy(hndl)
+}
+
+//export go_hostLlLookup
+func go_hostLlLookup(req0 unsafe.Pointer, parent c_uint64_t, name0 *c_char) {
+	hostLlLookup(req0, uint64(parent), c_GoString(name0))
+}
+
+//export go_hostLlForget
+func go_hostLlForget(req0 unsafe.Pointer, ino c_uint64_t, nlookup c_uint64_t) {
+	hostLlForget(req0, uint64(ino), uint64(nlookup))
+}
+
+//export go_hostLlGetattr
+func go_hostLlGetattr(req0 unsafe.Pointer, ino c_uint64_t, fi0 *c_struct_fuse_file_info) {
+	hostLlGetattr(req0, uint64(ino), fi0)
+}
+
+//export go_hostLlSetattr
+func go_hostLlSetattr(req0 unsafe.Pointer, ino c_uint64_t,
+	mode c_uint32_t, uid c_uint32_t, gid c_uint32_t, size c_int64_t,
+	atimsec c_int64_t, atimnsec c_int64_t, mtimsec c_int64_t, mtimnsec c_int64_t,
+	ctimsec c_int64_t, ctimnsec c_int64_t,
+	valid c_int, fi0 *c_struct_fuse_file_info) {
+	attr := Stat_t{
+		Mode: uint32(mode),
+		Uid:  uint32(uid),
+		Gid:  uint32(gid),
+		Size: int64(size),
+		Atim: Timespec{Sec: int64(atimsec), Nsec: int64(atimnsec)},
+		Mtim: Timespec{Sec: int64(mtimsec), Nsec: int64(mtimnsec)},
+		Ctim: Timespec{Sec: int64(ctimsec), Nsec: int64(ctimnsec)},
+	}
+	hostLlSetattr(req0, uint64(ino), &attr, int(valid), fi0)
+}
+
+//export go_hostLlReadlink
+func go_hostLlReadlink(req0 unsafe.Pointer, ino c_uint64_t) {
+	hostLlReadlink(req0, uint64(ino))
+}
+
+//export go_hostLlMknod
+func go_hostLlMknod(req0 unsafe.Pointer, parent c_uint64_t, name0 *c_char,
+	mode0 c_fuse_mode_t, dev0 c_fuse_dev_t) {
+	hostLlMknod(req0, uint64(parent), c_GoString(name0), uint32(mode0), uint64(dev0))
+}
+
+//export go_hostLlMkdir
+func go_hostLlMkdir(req0 unsafe.Pointer, parent c_uint64_t, name0 *c_char, mode0 c_fuse_mode_t) {
+	hostLlMkdir(req0, uint64(parent), c_GoString(name0), uint32(mode0))
+}
+
+//export go_hostLlUnlink
+func go_hostLlUnlink(req0 unsafe.Pointer, parent c_uint64_t, name0 *c_char) {
+	hostLlUnlink(req0, uint64(parent), c_GoString(name0))
+}
+
+//export go_hostLlRmdir
+func go_hostLlRmdir(req0 unsafe.Pointer, parent c_uint64_t, name0 *c_char) {
+	hostLlRmdir(req0, uint64(parent), c_GoString(name0))
+}
+
+//export go_hostLlSymlink
+func go_hostLlSymlink(req0 unsafe.Pointer, target0 *c_char, parent c_uint64_t, name0 *c_char) {
+	hostLlSymlink(req0, c_GoString(target0), uint64(parent), c_GoString(name0))
+}
+
+//export go_hostLlRename
+func go_hostLlRename(req0 unsafe.Pointer, parent c_uint64_t, name0 *c_char,
+	newparent c_uint64_t, newname0 *c_char, flags c_unsigned) {
+	hostLlRename(req0, uint64(parent), c_GoString(name0),
+		uint64(newparent), c_GoString(newname0), uint32(flags))
+}
+
+//export go_hostLlLink
+func go_hostLlLink(req0 unsafe.Pointer, ino c_uint64_t, newparent c_uint64_t, newname0 *c_char) {
+	hostLlLink(req0, uint64(ino), uint64(newparent), c_GoString(newname0))
+}
+
+//export go_hostLlOpen
+func go_hostLlOpen(req0 unsafe.Pointer, ino c_uint64_t, fi0 *c_struct_fuse_file_info) {
+	hostLlOpen(req0, uint64(ino), fi0)
+}
+
+//export go_hostLlRead
+func go_hostLlRead(req0 unsafe.Pointer, ino c_uint64_t, size0 c_size_t, ofst0 c_fuse_off_t,
+	fi0 *c_struct_fuse_file_info) {
+	hostLlRead(req0, uint64(ino), int(size0), int64(ofst0), fi0)
+}
+
+//export go_hostLlWrite
+func go_hostLlWrite(req0 unsafe.Pointer, ino c_uint64_t, buff0 *c_char, size0 c_size_t,
+	ofst0 c_fuse_off_t, fi0 *c_struct_fuse_file_info) {
+	buff := (*[1 << 30]byte)(unsafe.Pointer(buff0))
+	hostLlWrite(req0, uint64(ino), buff[:size0:size0], int64(ofst0), fi0)
+}
+
+//export go_hostLlFlush
+func go_hostLlFlush(req0 unsafe.Pointer, ino c_uint64_t, fi0 *c_struct_fuse_file_info) {
+	hostLlFlush(req0, uint64(ino), fi0)
+}
+
+//export go_hostLlRelease
+func go_hostLlRelease(req0 unsafe.Pointer, ino c_uint64_t, fi0 *c_struct_fuse_file_info) {
+	hostLlRelease(req0, uint64(ino), fi0)
+}
+
+//export go_hostLlFsync
+func go_hostLlFsync(req0 unsafe.Pointer, ino c_uint64_t, datasync c_int,
+	fi0 *c_struct_fuse_file_info) {
+	hostLlFsync(req0, uint64(ino), 0 != datasync, fi0)
+}
+
+//export go_hostLlOpendir
+func go_hostLlOpendir(req0 unsafe.Pointer, ino c_uint64_t, fi0 *c_struct_fuse_file_info) {
+	hostLlOpendir(req0, uint64(ino), fi0)
+}
+
+//export go_hostLlReaddir
+func go_hostLlReaddir(req0 unsafe.Pointer, ino c_uint64_t, size0 c_size_t, ofst0 c_fuse_off_t,
+	fi0 *c_struct_fuse_file_info) {
+	hostLlReaddir(req0, uint64(ino), int(size0), int64(ofst0), fi0, false)
+}
+
+//export go_hostLlReaddirplus
+func go_hostLlReaddirplus(req0 unsafe.Pointer, ino c_uint64_t, size0 c_size_t,
+	ofst0 c_fuse_off_t, fi0 *c_struct_fuse_file_info) {
+	hostLlReaddir(req0, uint64(ino), int(size0), int64(ofst0), fi0, true)
+}
+
+//export go_hostLlReleasedir
+func go_hostLlReleasedir(req0 unsafe.Pointer, ino c_uint64_t, fi0 *c_struct_fuse_file_info) {
+	hostLlReleasedir(req0, uint64(ino), fi0)
+}
+
+//export go_hostLlFsyncdir
+func go_hostLlFsyncdir(req0 unsafe.Pointer, ino c_uint64_t, datasync c_int,
+	fi0 *c_struct_fuse_file_info) {
+	hostLlFsyncdir(req0, uint64(ino), 0 != datasync, fi0)
+}
+
+//export go_hostLlStatfs
+func go_hostLlStatfs(req0 unsafe.Pointer, ino c_uint64_t) {
+	hostLlStatfs(req0, uint64(ino))
+}
+
+//export go_hostLlSetxattr
+func go_hostLlSetxattr(req0 unsafe.Pointer, ino c_uint64_t, name0 *c_char, buff0 *c_char,
+	size0 c_size_t, flags c_int) {
+	buff := (*[1 << 30]byte)(unsafe.Pointer(buff0))
+	hostLlSetxattr(req0, uint64(ino), c_GoString(name0), buff[:size0:size0], int(flags))
+}
+
+//export go_hostLlGetxattr
+func go_hostLlGetxattr(req0 unsafe.Pointer, ino c_uint64_t, name0 *c_char, size0 c_size_t) {
+	hostLlGetxattr(req0, uint64(ino), c_GoString(name0), int(size0))
+}
+
+//export go_hostLlListxattr
+func go_hostLlListxattr(req0 unsafe.Pointer, ino c_uint64_t, size0 c_size_t) {
+	hostLlListxattr(req0, uint64(ino), int(size0))
+}
+
+//export go_hostLlRemovexattr
+func go_hostLlRemovexattr(req0 unsafe.Pointer, ino c_uint64_t, name0 *c_char) {
+	hostLlRemovexattr(req0, uint64(ino), c_GoString(name0))
+}
+
+//export go_hostLlAccess
+func go_hostLlAccess(req0 unsafe.Pointer, ino c_uint64_t, mask0 c_int) {
+	hostLlAccess(req0, uint64(ino), uint32(mask0))
+}
+
+//export go_hostLlCreate
+func go_hostLlCreate(req0 unsafe.Pointer, parent c_uint64_t, name0 *c_char, mode0 c_fuse_mode_t,
+	fi0 *c_struct_fuse_file_info) {
+	hostLlCreate(req0, uint64(parent), c_GoString(name0), uint32(mode0), fi0)
+}
@@ -0,0 +1,1339 @@
+//go:build linux && (!cgo || nocgo)
+// +build linux
+// +build !cgo nocgo
+
+/*
+ * host_nocgo_linux.go
+ *
+ * Copyright 2017-2022 Bill Zissimopoulos
+ */
+/*
+ * This file is part of Cgofuse.
+ *
+ * It is licensed under the MIT license. The full license text can be found
+ * in the License.txt file at the root of this project.
+ */
+
+package fuse
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+/*
+ * The !cgo Linux host does not use libfuse. Instead it speaks the FUSE kernel protocol
+ * over /dev/fuse (kernel_nocgo_linux.go), translates node ids to paths for
+ * FileSystemHost (pathfs_nocgo_linux.go), parses options (opt_nocgo_linux.go) and
+ * mounts file systems using mount(2) or fusermount3 (mount_nocgo_linux.go). The types
+ * and c_* functions in this file provide the "C" environment that host.go and
+ * lowlevel.go expect, so that they are shared with the cgo host.
+ */
+
+type fuse_flock_t struct {
+	l_type   c_int16_t
+	l_whence c_int16_t
+	l_start  c_fuse_off_t
+	l_len    c_fuse_off_t
+	l_pid    c_fuse_pid_t
+}
+
+type fuse_stat_t struct {
+	st_dev     c_fuse_dev_t
+	st_ino     c_fuse_ino_t
+	st_mode    c_fuse_mode_t
+	st_nlink   c_fuse_nlink_t
+	st_uid     c_fuse_uid_t
+	st_gid     c_fuse_gid_t
+	st_rdev    c_fuse_dev_t
+	st_size    c_fuse_off_t
+	st_atim    c_fuse_timespec_t
+	st_mtim    c_fuse_timespec_t
+	st_ctim    c_fuse_timespec_t
+	st_blksize c_fuse_blksize_t
+	st_blocks  c_fuse_blkcnt_t
+}
+
+type fuse_statvfs_t struct {
+	f_bsize   uint64
+	f_frsize  uint64
+	f_blocks  c_fuse_fsblkcnt_t
+	f_bfree   c_fuse_fsblkcnt_t
+	f_bavail  c_fuse_fsblkcnt_t
+	f_files   c_fuse_fsfilcnt_t
+	f_ffree   c_fuse_fsfilcnt_t
+	f_favail  c_fuse_fsfilcnt_t
+	f_fsid    uint64
+	f_flag    uint64
+	f_namemax uint64
+}
+
+type fuse_timespec_t struct {
+	tv_sec  int64
+	tv_nsec int64
+}
+
+type struct_fuse_args struct {
+	argc      c_int
+	argv      **c_char
+	allocated c_int
+}
+
+type struct_fuse_config struct {
+	set_gid             c_int
+	gid                 c_unsigned
+	set_uid             c_int
+	uid                 c_unsigned
+	set_mode            c_int
+	umask               c_unsigned
+	entry_timeout       c_double
+	negative_timeout    c_double
+	attr_timeout        c_double
+	intr                c_int
+	intr_signal         c_int
+	remember            c_int
+	hard_remove         c_int
+	use_ino             c_int
+	readdir_ino         c_int
+	direct_io           c_int
+	kernel_cache        c_int
+	auto_cache          c_int
+	no_rofd_flush       c_int
+	ac_attr_timeout_set c_int
+	ac_attr_timeout     c_double
+	nullpath_ok         c_int
+	show_help           c_int
+	modules             *c_char
+	debug               c_int
+}
+
+type struct_fuse_conn_info struct {
+	proto_major          c_unsigned
+	proto_minor          c_unsigned
+	max_write            c_unsigned
+	max_read             c_unsigned
+	max_readahead        c_unsigned
+	capable              c_unsigned
+	want                 c_unsigned
+	max_background       c_unsigned
+	congestion_threshold c_unsigned
+	time_gran            c_unsigned
+}
+
+type struct_fuse_context struct {
+	fuse         *c_struct_fuse
+	uid          c_fuse_uid_t
+	gid          c_fuse_gid_t
+	pid          c_fuse_pid_t
+	private_data unsafe.Pointer
+	umask        c_fuse_mode_t
+}
+
+type struct_fuse_file_info struct {
+	flags         c_int
+	writepage     c_bool
+	direct_io     c_bool
+	keep_cache    c_bool
+	flush         c_bool
+	nonseekable   c_bool
+	flock_release c_bool
+	cache_readdir c_bool
+	noflush       c_bool
+	fh            c_uint64_t
+	lock_owner    c_uint64_t
+	poll_events   c_uint32_t
+}
+
+type struct_fuse_opt struct {
+	templ  *c_char
+	offset c_fuse_opt_offset_t
+	value  c_int
+}
+
+type fuse_buf struct {
+	size  c_size_t
+	flags c_uint32_t
+	mem   unsafe.Pointer
+	fd    c_int
+	pos   c_fuse_off_t
+}
+
+type fuse_bufvec struct {
+	count c_size_t
+	idx   c_size_t
+	off   c_size_t
+	buf   [1]fuse_buf
+}
+
+type (
+	c_bool                  = bool
+	c_char                  = byte
+	c_double                = float64
+	c_fuse_blkcnt_t         = int64
+	c_fuse_blksize_t        = int64
+	c_fuse_dev_t            = uint64
+	c_fuse_fill_dir_t       = func(buf unsafe.Pointer, name *c_char, stbuf *c_fuse_stat_t, off c_fuse_off_t, flags c_int) c_int
+	c_fuse_flock_t          = fuse_flock_t
+	c_fuse_fsblkcnt_t       = uint64
+	c_fuse_fsfilcnt_t       = uint64
+	c_fuse_gid_t            = uint32
+	c_fuse_ino_t            = uint64
+	c_fuse_mode_t           = uint32
+	c_fuse_nlink_t          = uint32
+	c_fuse_off_t            = int64
+	c_fuse_opt_offset_t     = uintptr
+	c_fuse_pid_t            = int32
+	c_fuse_stat_t           = fuse_stat_t
+	c_fuse_stat_ex_t        = fuse_stat_t
+	c_fuse_statvfs_t        = fuse_statvfs_t
+	c_fuse_timespec_t       = fuse_timespec_t
+	c_fuse_uid_t            = uint32
+	c_int                   = int32
+	c_int16_t               = int16
+	c_int32_t               = int32
+	c_int64_t               = int64
+	c_int8_t                = int8
+	c_size_t                = uintptr
+	c_struct_fuse           = pathfs
+	c_struct_fuse_args      = struct_fuse_args
+	c_struct_fuse_config    = struct_fuse_config
+	c_struct_fuse_conn_info = struct_fuse_conn_info
+	c_struct_fuse_context   = struct_fuse_context
+	c_struct_fuse_file_info = struct_fuse_file_info
+	c_struct_fuse_opt       = struct_fuse_opt
+	c_uint16_t              = uint16
+	c_uint32_t              = uint32
+	c_uint64_t              = uint64
+	c_uint8_t               = uint8
+	c_uintptr_t             = uintptr
+	c_unsigned              = uint32
+)
+
+const (
+	FUSE_OPT_KEY_OPT     = -1
+	FUSE_OPT_KEY_NONOPT  = -2
+	FUSE_OPT_KEY_KEEP    = -3
+	FUSE_OPT_KEY_DISCARD = -4
+
+	FUSE_FILL_DIR_PLUS = 1 << 1
+)
+
+/*
+ * Memory allocator
+ *
+ * Memory returned by c_malloc is passed around as C memory: host.go converts it to
+ * (*[1 << 30]byte) arrays and stores pointers to other c_malloc memory in it. So it
+ * cannot be Go memory, which the garbage collector would neither scan nor keep alive
+ * through such pointers. Instead we allocate it with mmap. Small blocks are carved
+ * from 1MB chunks in power of two size classes and kept in free lists when freed;
+ * large blocks are mapped and unmapped individually. Every block starts with a 16 byte
+ * header that records its size class.
+ */
+
+const (
+	memHeaderSize = 16
+	memChunkSize  = 1 << 20
+	memMinClass   = 5
+	memMaxClass   = 16
+)
+
+var (
+	memGuard sync.Mutex
+	memFree  [memMaxClass + 1]unsafe.Pointer
+	memChunk []byte
+	memHuge  = map[unsafe.Pointer][]byte{}
+)
+
+func memMap(size int) []byte {
+	b, err := syscall.Mmap(-1, 0, size,
+		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_ANON)
+	if nil != err {
+		return nil
+	}
+	return b
+}
+
+func c_GoString(s *c_char) string {
+	if nil == s {
+		return ""
+	}
+	q := (*[1 << 30]c_char)(unsafe.Pointer(s))
+	l := 0
+	for 0 != q[l] {
+		l++
+	}
+	return string(q[:l])
+}
+func c_CString(s string) *c_char {
+	p := c_malloc(c_size_t(len(s) + 1))
+	q := (*[1 << 30]c_char)(p)
+	copy(q[:], s)
+	q[len(s)] = 0
+	return (*c_char)(p)
+}
+
+func c_malloc(size c_size_t) unsafe.Pointer {
+	n := size + memHeaderSize
+	class := uintptr(memMinClass)
+	for n > 1<<class {
+		class++
+	}
+	var p unsafe.Pointer
+	if memMaxClass < class {
+		b := memMap(int(n))
+		if nil == b {
+			return nil
+		}
+		p = unsafe.Pointer(&b[0])
+		memGuard.Lock()
+		memHuge[p] = b
+		memGuard.Unlock()
+	} else {
+		memGuard.Lock()
+		p = memFree[class]
+		if nil != p {
+			memFree[class] = *(*unsafe.Pointer)(p)
+		} else {
+			if 1<<class > len(memChunk) {
+				memChunk = memMap(memChunkSize)
+				if nil == memChunk {
+					memGuard.Unlock()
+					return nil
+				}
+			}
+			p = unsafe.Pointer(&memChunk[0])
+			memChunk = memChunk[1<<class:]
+		}
+		memGuard.Unlock()
+	}
+	*(*uintptr)(p) = class
+	return unsafe.Add(p, memHeaderSize)
+}
+func c_calloc(count c_size_t, size c_size_t) unsafe.Pointer {
+	p := c_malloc(count * size)
+	if nil != p {
+		b := unsafe.Slice((*byte)(p), count*size)
+		for i := range b {
+			b[i] = 0
+		}
+	}
+	return p
+}
+func c_free(p unsafe.Pointer) {
+	if nil == p {
+		return
+	}
+	p = unsafe.Add(p, -memHeaderSize)
+	class := *(*uintptr)(p)
+	memGuard.Lock()
+	if memMaxClass < class {
+		b := memHuge[p]
+		delete(memHuge, p)
+		memGuard.Unlock()
+		syscall.Munmap(b)
+		return
+	}
+	*(*unsafe.Pointer)(p) = memFree[class]
+	memFree[class] = p
+	memGuard.Unlock()
+}
+
+func c_fuse_get_context() *c_struct_fuse_context {
+	w := kernelCurrent()
+	if nil == w {
+		return &c_struct_fuse_context{}
+	}
+	return &w.ctx
+}
+func c_fuse_opt_free_args(args *c_struct_fuse_args) {
+	if nil != args.argv && 0 != args.allocated {
+		argv := unsafe.Slice(args.argv, args.argc)
+		for i := range argv {
+			c_free(unsafe.Pointer(argv[i]))
+		}
+		c_free(unsafe.Pointer(args.argv))
+	}
+	args.argc = 0
+	args.argv = nil
+	args.allocated = 0
+}
+
+func c_hostAsgnCconninfo(conn *c_struct_fuse_conn_info,
+	capCaseInsensitive c_bool,
+	capReaddirPlus c_bool,
+	capDeleteAccess c_bool,
+	capOpenTrunc c_bool,
+	capPosixLocks c_bool,
+	capFlockLocks c_bool,
+	capSpliceWrite c_bool,
+	capSpliceRead c_bool) {
+	if capReaddirPlus {
+		conn.want |= conn.capable & CAP_READDIRPLUS
+	} else {
+		conn.want &^= CAP_READDIRPLUS
+	}
+	// Enable CAP_ATOMIC_O_TRUNC only if the file system asks for it; see host_cgo.go.
+	if capOpenTrunc {
+		conn.want |= conn.capable & CAP_ATOMIC_O_TRUNC
+	} else {
+		conn.want &^= CAP_ATOMIC_O_TRUNC
+	}
+	if capPosixLocks {
+		conn.want |= conn.capable & CAP_POSIX_LOCKS
+	} else {
+		conn.want &^= CAP_POSIX_LOCKS
+	}
+	if capFlockLocks {
+		conn.want |= conn.capable & CAP_FLOCK_LOCKS
+	} else {
+		conn.want &^= CAP_FLOCK_LOCKS
+	}
+	// We do not splice; the kernel never reports the splice capabilities.
+	if capSpliceWrite {
+		conn.want |= conn.capable & CAP_SPLICE_WRITE
+	}
+	if capSpliceRead {
+		conn.want |= conn.capable & CAP_SPLICE_READ
+	} else {
+		conn.want &^= CAP_SPLICE_READ
+	}
+}
+func c_hostConninfoGet(conn *c_struct_fuse_conn_info,
+	protoMajor *c_uint32_t,
+	protoMinor *c_uint32_t,
+	maxWrite *c_uint32_t,
+	maxRead *c_uint32_t,
+	maxReadahead *c_uint32_t,
+	capable *c_uint32_t,
+	want *c_uint32_t,
+	maxBackground *c_uint32_t,
+	congestionThreshold *c_uint32_t,
+	timeGran *c_uint32_t) {
+	*protoMajor = conn.proto_major
+	*protoMinor = conn.proto_minor
+	*maxWrite = conn.max_write
+	*maxRead = conn.max_read
+	*maxReadahead = conn.max_readahead
+	*capable = conn.capable
+	*want = conn.want
+	*maxBackground = conn.max_background
+	*congestionThreshold = conn.congestion_threshold
+	*timeGran = conn.time_gran
+}
+func c_hostConninfoSet(conn *c_struct_fuse_conn_info,
+	maxWrite c_uint32_t,
+	maxRead c_uint32_t,
+	maxReadahead c_uint32_t,
+	want c_uint32_t,
+	maxBackground c_uint32_t,
+	congestionThreshold c_uint32_t,
+	timeGran c_uint32_t) {
+	conn.max_write = maxWrite
+	conn.max_readahead = maxReadahead
+	conn.want = want & conn.capable
+	conn.max_background = maxBackground
+	conn.congestion_threshold = congestionThreshold
+	conn.max_read = maxRead
+	conn.time_gran = timeGran
+}
+func c_hostFuseUseVersion() c_int {
+	return 39
+}
+func c_hostFuseVersion() c_int {
+	return 314 // fuse_PACKAGE_VERSION
+}
+func c_hostAsgnCconfigEx(conf *c_struct_fuse_config,
+	entryTimeout c_double,
+	attrTimeout c_double,
+	negativeTimeout c_double,
+	kernelCache c_bool,
+	autoCache c_bool,
+	acAttrTimeoutSet c_bool,
+	acAttrTimeout c_double,
+	hardRemove c_bool,
+	nullpathOk c_bool,
+	setMode c_bool,
+	umask c_uint32_t,
+	setUid c_bool,
+	uid c_uint32_t,
+	setGid c_bool,
+	gid c_uint32_t) {
+	conf.entry_timeout = entryTimeout
+	conf.attr_timeout = attrTimeout
+	conf.negative_timeout = negativeTimeout
+	conf.kernel_cache = c_intFromBool(kernelCache)
+	conf.auto_cache = c_intFromBool(autoCache)
+	conf.ac_attr_timeout_set = c_intFromBool(acAttrTimeoutSet)
+	conf.ac_attr_timeout = acAttrTimeout
+	conf.hard_remove = c_intFromBool(hardRemove)
+	conf.nullpath_ok = c_intFromBool(nullpathOk)
+	conf.set_mode = c_intFromBool(setMode)
+	conf.umask = umask
+	conf.set_uid = c_intFromBool(setUid)
+	conf.uid = uid
+	conf.set_gid = c_intFromBool(setGid)
+	conf.gid = gid
+}
+func c_hostAsgnCconfig(conf *c_struct_fuse_config,
+	directIO c_bool,
+	useIno c_bool) {
+	*conf = c_struct_fuse_config{}
+	conf.direct_io = c_intFromBool(directIO)
+	conf.use_ino = c_intFromBool(useIno)
+}
+func c_hostCstatvfsFromFusestatfs(stbuf *c_fuse_statvfs_t,
+	bsize c_uint64_t,
+	frsize c_uint64_t,
+	blocks c_uint64_t,
+	bfree c_uint64_t,
+	bavail c_uint64_t,
+	files c_uint64_t,
+	ffree c_uint64_t,
+	favail c_uint64_t,
+	fsid c_uint64_t,
+	flag c_uint64_t,
+	namemax c_uint64_t) {
+	*stbuf = c_fuse_statvfs_t{
+		f_bsize:   bsize,
+		f_frsize:  frsize,
+		f_blocks:  blocks,
+		f_bfree:   bfree,
+		f_bavail:  bavail,
+		f_files:   files,
+		f_ffree:   ffree,
+		f_favail:  favail,
+		f_fsid:    fsid,
+		f_flag:    flag,
+		f_namemax: namemax,
+	}
+}
+func c_hostFlockRelease(fi *c_struct_fuse_file_info) c_bool {
+	return fi.flock_release
+}
+func c_hostBufvecNew(count c_size_t) unsafe.Pointer {
+	if 0 == count {
+		count = 1
+	}
+	bufv := (*fuse_bufvec)(c_calloc(1,
+		unsafe.Sizeof(fuse_bufvec{})+(count-1)*unsafe.Sizeof(fuse_buf{})))
+	if nil == bufv {
+		return nil
+	}
+	bufv.count = count
+	return unsafe.Pointer(bufv)
+}
+func c_hostBufvecCount(bufv unsafe.Pointer) c_size_t {
+	return (*fuse_bufvec)(bufv).count
+}
+func c_hostBufvecGet(bufv unsafe.Pointer, i c_size_t,
+	flags *c_uint32_t, mem *unsafe.Pointer, size *c_size_t, fd *c_int, pos *c_int64_t) {
+	buf := bufvecBuf(bufv, i)
+	*flags = buf.flags
+	*mem = buf.mem
+	*size = buf.size
+	*fd = buf.fd
+	*pos = buf.pos
+}
+func c_hostBufvecSet(bufv unsafe.Pointer, i c_size_t,
+	flags c_uint32_t, mem unsafe.Pointer, size c_size_t, fd c_int, pos c_int64_t) {
+	buf := bufvecBuf(bufv, i)
+	buf.flags = flags
+	buf.mem = mem
+	buf.size = size
+	buf.fd = fd
+	buf.pos = pos
+}
+func c_hostBufvecFlatten(bufv unsafe.Pointer, mem *unsafe.Pointer, size *c_size_t) c_int {
+	total := bufvecSize(bufv)
+	allocsize := total
+	if 0 == allocsize {
+		allocsize = 1
+	}
+	p := c_malloc(allocsize)
+	if nil == p {
+		return -c_int(ENOMEM)
+	}
+	n, errc := bufvecCopy(unsafe.Slice((*byte)(p), total), bufv)
+	if 0 != errc {
+		c_free(p)
+		return c_int(errc)
+	}
+	*mem = p
+	*size = c_size_t(n)
+	return 0
+}
+
+// bufvecBuf returns the buffer i of bufv.
+func bufvecBuf(bufv unsafe.Pointer, i c_size_t) *fuse_buf {
+	v := (*fuse_bufvec)(bufv)
+	return (*fuse_buf)(unsafe.Add(unsafe.Pointer(&v.buf[0]), i*unsafe.Sizeof(fuse_buf{})))
+}
+
+// bufvecSize returns the total size of the buffers of bufv.
+func bufvecSize(bufv unsafe.Pointer) c_size_t {
+	size := c_size_t(0)
+	for i := c_size_t(0); (*fuse_bufvec)(bufv).count > i; i++ {
+		size += bufvecBuf(bufv, i).size
+	}
+	return size
+}
+
+// bufvecCopy copies the data of the buffers of bufv into dst and returns its size. The
+// data of descriptor buffers is read from the descriptor (at the buffer position if the
+// buffer has BUF_FD_SEEK). It returns a negative error code if nothing could be read.
+func bufvecCopy(dst []byte, bufv unsafe.Pointer) (int, int) {
+	n := 0
+	for i := c_size_t(0); (*fuse_bufvec)(bufv).count > i && len(dst) > n; i++ {
+		buf := bufvecBuf(bufv, i)
+		d := dst[n:]
+		if c_size_t(len(d)) > buf.size {
+			d = d[:buf.size]
+		}
+		if 0 == buf.flags&BUF_IS_FD {
+			if 0 < len(d) {
+				n += copy(d, unsafe.Slice((*byte)(buf.mem), len(d)))
+			}
+			continue
+		}
+		for done := int64(0); 0 < len(d); {
+			var m int
+			var err error
+			if 0 != buf.flags&BUF_FD_SEEK {
+				m, err = syscall.Pread(int(buf.fd), d, buf.pos+done)
+			} else {
+				m, err = syscall.Read(int(buf.fd), d)
+			}
+			if nil != err {
+				if 0 == n {
+					return 0, -int(err.(syscall.Errno))
+				}
+				return n, 0
+			}
+			if 0 == m {
+				// end of file
+				return n, 0
+			}
+			n += m
+			d = d[m:]
+			done += int64(m)
+		}
+	}
+	return n, 0
+}
+
+// bufvecFree frees bufv and its memory buffers.
+func bufvecFree(bufv unsafe.Pointer) {
+	if nil == bufv {
+		return
+	}
+	for i := c_size_t(0); (*fuse_bufvec)(bufv).count > i; i++ {
+		if buf := bufvecBuf(bufv, i); 0 == buf.flags&BUF_IS_FD {
+			c_free(buf.mem)
+		}
+	}
+	c_free(bufv)
+}
+func c_hostCflockFromFuselock(lock *c_fuse_flock_t,
+	typ c_int,
+	whence c_int,
+	start c_int64_t,
+	len c_int64_t,
+	pid c_int64_t) {
+	*lock = c_fuse_flock_t{
+		l_type:   c_int16_t(typ),
+		l_whence: c_int16_t(whence),
+		l_start:  c_fuse_off_t(start),
+		l_len:    c_fuse_off_t(len),
+		l_pid:    c_fuse_pid_t(pid),
+	}
+}
+func c_hostCstatFromFusestat(stbuf *c_fuse_stat_t,
+	dev c_uint64_t,
+	ino c_uint64_t,
+	mode c_uint32_t,
+	nlink c_uint32_t,
+	uid c_uint32_t,
+	gid c_uint32_t,
+	rdev c_uint64_t,
+	size c_int64_t,
+	atimSec c_int64_t, atimNsec c_int64_t,
+	mtimSec c_int64_t, mtimNsec c_int64_t,
+	ctimSec c_int64_t, ctimNsec c_int64_t,
+	blksize c_int64_t,
+	blocks c_int64_t,
+	birthtimSec c_int64_t, birthtimNsec c_int64_t,
+	flags c_uint32_t) {
+	*stbuf = c_fuse_stat_t{
+		st_dev:     dev,
+		st_ino:     ino,
+		st_mode:    mode,
+		st_nlink:   nlink,
+		st_uid:     uid,
+		st_gid:     gid,
+		st_rdev:    rdev,
+		st_size:    size,
+		st_blksize: blksize,
+		st_blocks:  blocks,
+		st_atim: c_fuse_timespec_t{
+			tv_sec:  atimSec,
+			tv_nsec: atimNsec,
+		},
+		st_mtim: c_fuse_timespec_t{
+			tv_sec:  mtimSec,
+			tv_nsec: mtimNsec,
+		},
+		st_ctim: c_fuse_timespec_t{
+			tv_sec:  ctimSec,
+			tv_nsec: ctimNsec,
+		},
+	}
+}
+func c_hostAsgnCfileinfo(fi *c_struct_fuse_file_info,
+	direct_io c_bool,
+	keep_cache c_bool,
+	nonseekable c_bool,
+	fh c_uint64_t) {
+	fi.direct_io = direct_io
+	fi.keep_cache = keep_cache
+	fi.nonseekable = nonseekable
+	fi.fh = fh
+}
+func c_hostFilldir(filler c_fuse_fill_dir_t,
+	buf unsafe.Pointer, name *c_char, stbuf *c_fuse_stat_t, off c_fuse_off_t) c_int {
+	// the FUSE layer uses stbuf as readdirplus information only with FUSE_FILL_DIR_PLUS
+	var flags c_int
+	if nil != stbuf {
+		flags = FUSE_FILL_DIR_PLUS
+	}
+	return filler(buf, name, stbuf, off, flags)
+}
+func c_hostStaticInit() {
+}
+func c_hostFuseInit() c_int {
+	return 1
+}
+func c_hostMount(argc c_int, argv **c_char, nullpathOk c_bool,
+	readBuf c_bool, writeBuf c_bool, data unsafe.Pointer) c_int {
+	args := make([]string, argc)
+	for i, a := range unsafe.Slice(argv, argc) {
+		args[i] = c_GoString(a)
+	}
+	fs := newPathfs(data, readBuf, writeBuf)
+	if nullpathOk {
+		fs.conf.nullpath_ok = 1
+	}
+	mc := mountParse(args, fs.option)
+	if nil == mc {
+		return 0
+	}
+	if mc.version {
+		mountVersion()
+		return 1
+	}
+	if mc.help {
+		mountHelp(mc.prog)
+		pathfsHelp()
+		return 1
+	}
+	ms := mc.mount()
+	if nil == ms {
+		return 0
+	}
+	defer ms.unmount()
+	conn := newKernelConn(ms.fd, fs, mc.debug)
+	conn.fuse = fs
+	conn.private = data
+	conn.maxThreads = int32(mc.maxThreads)
+	conn.allowRoot = mc.allowRoot
+	fs.conn = conn
+	return c_intFromBool(0 == conn.serve(mc.single))
+}
+func c_hostStatDev(path *c_char, dev *c_uint64_t) c_int {
+	var stbuf syscall.Stat_t
+	if err := syscall.Stat(c_GoString(path), &stbuf); nil != err {
+		return c_int(err.(syscall.Errno))
+	}
+	*dev = c_uint64_t(stbuf.Dev)
+	return 0
+}
+func c_hostStderrRedirect(fd c_int) c_int {
+	// the mount functions report errors on mountStderr, so there is no need to
+	// redirect the standard error of the process
+	nfd, err := syscall.Dup(int(fd))
+	if nil != err {
+		return -1
+	}
+	syscall.CloseOnExec(nfd)
+	mountDiagGuard.Lock()
+	mountDiag = os.NewFile(uintptr(nfd), "mountdiag")
+	mountDiagGuard.Unlock()
+	return 0
+}
+func c_hostStderrRestore(saved c_int) {
+	mountDiagGuard.Lock()
+	f := mountDiag
+	mountDiag = nil
+	mountDiagGuard.Unlock()
+	if nil != f {
+		f.Close()
+	}
+}
+func c_hostUnmount(fuse *c_struct_fuse, mountpoint *c_char, force c_bool) c_int {
+	if nil == mountpoint {
+		return 0
+	}
+	return c_int(mountUnmount(c_GoString(mountpoint)))
+}
+func c_hostInvalidatePath(fuse *c_struct_fuse, path *c_char) c_int {
+	res := fuse.invalidatePath(c_GoString(path))
+	// -ENOENT: the kernel does not know the path, so there is nothing to invalidate
+	if -ENOENT == res {
+		return 0
+	}
+	return c_int(res)
+}
+func c_hostInvalidateEntry(fuse *c_struct_fuse, mountpoint *c_char,
+	dir *c_char, name *c_char, useIno c_bool) c_int {
+	res := fuse.invalidateEntry(c_GoString(dir), c_GoString(name))
+	if -ENOENT == res {
+		return 0
+	}
+	return c_int(res)
+}
+func c_hostInvalidateData(fuse *c_struct_fuse, mountpoint *c_char,
+	path *c_char, ofst c_int64_t, size c_int64_t, useIno c_bool) c_int {
+	res := fuse.invalidateData(c_GoString(path), ofst, size)
+	if -ENOENT == res {
+		return 0
+	}
+	return c_int(res)
+}
+func c_hostNotify(fuse *c_struct_fuse, path *c_char, action c_uint32_t) c_int {
+	// There is no change notification, but we can invalidate the kernel caches.
+	// When entries are added to or removed from a directory (NOTIFY_MKDIR,
+	// NOTIFY_RMDIR, NOTIFY_CREATE, NOTIFY_UNLINK) also invalidate the directory.
+	res := c_hostInvalidatePath(fuse, path)
+	if 0 != res || 0 == action&0x000f {
+		return c_intFromBool(0 == res)
+	}
+	parent := c_GoString(path)
+	if i := strings.LastIndexByte(parent, '/'); -1 != i {
+		if 0 == i {
+			parent = "/" // root directory
+		} else {
+			parent = parent[:i]
+		}
+		p := c_CString(parent)
+		res = c_hostInvalidatePath(fuse, p)
+		c_free(unsafe.Pointer(p))
+	}
+	return c_intFromBool(0 == res)
+}
+func c_hostNotifyPoll(ph unsafe.Pointer) c_int {
+	return c_intFromBool(0 == (*kernelPoll)(ph).wakeup())
+}
+func c_hostPollhandleDestroy(ph unsafe.Pointer) {
+}
+func c_hostInterrupted() c_int {
+	if w := kernelCurrent(); nil != w && nil != w.req {
+		return c_intFromBool(w.req.interrupted())
+	}
+	return 0
+}
+func c_hostInterruptible() bool {
+	return true
+}
+func c_hostThreadId() uintptr {
+	return uintptr(syscall.Gettid())
+}
+func c_hostGetgroups(size c_int, list *c_uint32_t) c_int {
+	w := kernelCurrent()
+	if nil == w || nil == w.req {
+		return -c_int(EINVAL)
+	}
+	// the kernel does not send the supplementary groups; read them from /proc
+	pid := strconv.FormatUint(uint64(w.req.hdr.pid), 10)
+	data, err := ioutil.ReadFile("/proc/" + pid + "/task/" + pid + "/status")
+	if nil != err {
+		if e, ok := err.(*os.PathError); ok {
+			if errno, ok := e.Err.(syscall.Errno); ok {
+				return -c_int(errno)
+			}
+		}
+		return -c_int(EIO)
+	}
+	i := strings.Index(string(data), "\nGroups:")
+	if -1 == i {
+		return -c_int(EIO)
+	}
+	line := string(data[i+len("\nGroups:"):])
+	if j := strings.IndexByte(line, '\n'); -1 != j {
+		line = line[:j]
+	}
+	groups := strings.Fields(line)
+	if 0 < size {
+		dst := unsafe.Slice(list, size)
+		for k, g := range groups {
+			if len(dst) <= k {
+				break
+			}
+			v, _ := strconv.ParseUint(g, 0, 32)
+			dst[k] = c_uint32_t(v)
+		}
+	}
+	return c_int(len(groups))
+}
+func c_hostOptSet(opt *c_struct_fuse_opt,
+	templ *c_char, offset c_fuse_opt_offset_t, value c_int) {
+	*opt = c_struct_fuse_opt{
+		templ:  templ,
+		offset: offset,
+		value:  value,
+	}
+}
+func c_hostOptParse(args *c_struct_fuse_args, data unsafe.Pointer, opts *c_struct_fuse_opt,
+	nonopts c_bool) c_int {
+	var templs []optTemplate
+	for p := opts; nil != p.templ; p = (*c_struct_fuse_opt)(unsafe.Add(
+		unsafe.Pointer(p), unsafe.Sizeof(*p))) {
+		templs = append(templs, optTemplate{c_GoString(p.templ), p.offset, p.value})
+	}
+	var argv []string
+	if nil != args.argv {
+		for _, a := range unsafe.Slice(args.argv, args.argc) {
+			argv = append(argv, c_GoString(a))
+		}
+	}
+	if 0 == len(argv) {
+		argv = append(argv, "")
+	}
+	outargs, ok := optParseArgs(argv[1:], data, templs, nonopts)
+	if !ok {
+		return -1
+	}
+	outargs = append([]string{argv[0]}, outargs...)
+	c_fuse_opt_free_args(args)
+	argp := (**c_char)(c_calloc(c_size_t(len(outargs)+1), unsafe.Sizeof((*c_char)(nil))))
+	newv := unsafe.Slice(argp, len(outargs)+1)
+	for i, a := range outargs {
+		newv[i] = c_CString(a)
+	}
+	args.argc = c_int(len(outargs))
+	args.argv = argp
+	args.allocated = 1
+	return 0
+}
+
+func c_intFromBool(b bool) c_int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func c_hostLlFuseInit() c_int {
+	return 1
+}
+func c_hostLlSessionNew(argc c_int, argv **c_char, data unsafe.Pointer) unsafe.Pointer {
+	args := make([]string, argc)
+	for i, a := range unsafe.Slice(argv, argc) {
+		args[i] = c_GoString(a)
+	}
+	mc := mountParse(args, nil)
+	if nil == mc {
+		return nil
+	}
+	if "" != mc.mountpoint {
+		fmt.Fprintf(mountStderr(), "fuse: invalid argument `%s'\n", mc.mountpoint)
+		return nil
+	}
+	if mc.version || mc.help {
+		if mc.version {
+			mountVersion()
+		} else {
+			mountHelp(mc.prog)
+		}
+		return nil
+	}
+	return unsafe.Pointer(&llSession{mc: mc, data: data})
+}
+func c_hostLlSessionMount(se unsafe.Pointer, mountpoint *c_char) c_int {
+	s := (*llSession)(se)
+	s.mc.mountpoint = c_GoString(mountpoint)
+	s.ms = s.mc.mount()
+	if nil == s.ms {
+		return -1
+	}
+	s.conn = newKernelConn(s.ms.fd, s, s.mc.debug)
+	s.conn.private = s.data
+	s.conn.maxThreads = int32(s.mc.maxThreads)
+	s.conn.allowRoot = s.mc.allowRoot
+	return 0
+}
+func c_hostLlSessionLoop(se unsafe.Pointer, single c_bool) c_int {
+	s := (*llSession)(se)
+	return c_int(s.conn.serve(single || s.mc.single))
+}
+func c_hostLlSessionUnmount(se unsafe.Pointer) {
+	s := (*llSession)(se)
+	if nil != s.ms {
+		s.ms.unmount()
+		s.ms = nil
+	}
+}
+func c_hostLlSessionDestroy(se unsafe.Pointer) {
+	c_hostLlSessionUnmount(se)
+}
+func c_hostLlReqUserdata(req unsafe.Pointer) unsafe.Pointer {
+	return (*kernelReq)(req).conn.private
+}
+func c_hostLlReqCtx(req unsafe.Pointer, uid *c_uint32_t, gid *c_uint32_t, pid *c_uint32_t,
+	umask *c_uint32_t) {
+	r := (*kernelReq)(req)
+	*uid, *gid, *pid, *umask = r.hdr.uid, r.hdr.gid, r.hdr.pid, r.umask
+}
+func c_hostLlReplyErr(req unsafe.Pointer, err c_int) c_int {
+	return c_int((*kernelReq)(req).replyErr(-int(err)))
+}
+func c_hostLlReplyNone(req unsafe.Pointer) {
+	(*kernelReq)(req).replied = true
+}
+func c_hostLlReplyEntry(req unsafe.Pointer, ino c_uint64_t, generation c_uint64_t,
+	attr *c_fuse_stat_t, attrTimeout c_double, entryTimeout c_double) c_int {
+	e := kernelEntry{ino, generation, *attr, attrTimeout, entryTimeout}
+	return c_int((*kernelReq)(req).replyEntry(&e))
+}
+func c_hostLlReplyCreate(req unsafe.Pointer, ino c_uint64_t, generation c_uint64_t,
+	attr *c_fuse_stat_t, attrTimeout c_double, entryTimeout c_double,
+	fi *c_struct_fuse_file_info) c_int {
+	e := kernelEntry{ino, generation, *attr, attrTimeout, entryTimeout}
+	return c_int((*kernelReq)(req).replyCreate(&e, fi))
+}
+func c_hostLlReplyAttr(req unsafe.Pointer, attr *c_fuse_stat_t, attrTimeout c_double) c_int {
+	return c_int((*kernelReq)(req).replyAttr(attr, attrTimeout))
+}
+func c_hostLlReplyOpen(req unsafe.Pointer, fi *c_struct_fuse_file_info) c_int {
+	return c_int((*kernelReq)(req).replyOpen(fi))
+}
+func c_hostLlReplyWrite(req unsafe.Pointer, count c_size_t) c_int {
+	return c_int((*kernelReq)(req).replyWrite(uint32(count)))
+}
+func c_hostLlReplyBuf(req unsafe.Pointer, buf *c_char, size c_size_t) c_int {
+	var b []byte
+	if nil != buf {
+		b = unsafe.Slice((*byte)(buf), size)
+	}
+	return c_int((*kernelReq)(req).reply(0, b))
+}
+func c_hostLlReplyStatfs(req unsafe.Pointer, stbuf *c_fuse_statvfs_t) c_int {
+	return c_int((*kernelReq)(req).replyStatfs(stbuf))
+}
+func c_hostLlReplyXattr(req unsafe.Pointer, count c_size_t) c_int {
+	return c_int((*kernelReq)(req).replyXattrSize(uint32(count)))
+}
+func c_hostLlAddDirentry(req unsafe.Pointer, buf *c_char, bufsize c_size_t,
+	name *c_char, stbuf *c_fuse_stat_t, off c_fuse_off_t) c_size_t {
+	var b []byte
+	if nil != buf {
+		b = unsafe.Slice((*byte)(buf), bufsize)
+	}
+	return c_size_t(kernelDirent(b, c_GoString(name), stbuf.st_ino, stbuf.st_mode, off))
+}
+func c_hostLlAddDirentryPlus(req unsafe.Pointer, buf *c_char, bufsize c_size_t,
+	name *c_char, ino c_uint64_t, generation c_uint64_t, attr *c_fuse_stat_t,
+	attrTimeout c_double, entryTimeout c_double, off c_fuse_off_t) c_size_t {
+	var b []byte
+	if nil != buf {
+		b = unsafe.Slice((*byte)(buf), bufsize)
+	}
+	e := kernelEntry{ino, generation, *attr, attrTimeout, entryTimeout}
+	return c_size_t(kernelDirentPlus(b, c_GoString(name), &e, off))
+}
+func c_hostLlNotifyInvalInode(se unsafe.Pointer, ino c_uint64_t, off c_int64_t,
+	len c_int64_t) c_int {
+	s := (*llSession)(se)
+	if nil == s.conn {
+		return -c_int(ENOTCONN)
+	}
+	return c_int(s.conn.notifyInvalInode(ino, off, len))
+}
+func c_hostLlNotifyInvalEntry(se unsafe.Pointer, parent c_uint64_t, name *c_char,
+	namelen c_size_t) c_int {
+	s := (*llSession)(se)
+	if nil == s.conn {
+		return -c_int(ENOTCONN)
+	}
+	n := unsafe.Slice((*byte)(unsafe.Pointer(name)), namelen)
+	return c_int(s.conn.notifyInvalEntry(parent, string(n)))
+}
+
+/*
+ * Low-level session
+ *
+ * An llSession passes the requests of the kernel to the hostLl* functions of
+ * lowlevel.go, which reply through the c_hostLlReply* functions. Requests are passed as
+ * *kernelReq.
+ */
+
+type llSession struct {
+	mc   *mountConfig
+	data unsafe.Pointer
+	ms   *mountSession
+	conn *kernelConn
+}
+
+func (s *llSession) init(conn *struct_fuse_conn_info) {
+	hostLlInit(s.data, conn)
+}
+
+func (s *llSession) destroy() {
+	hostLlDestroy(s.data)
+}
+
+// llSetattrValid are the SETATTR attributes that lowlevel.go understands.
+const llSetattrValid = fattr_MODE | fattr_UID | fattr_GID | fattr_SIZE |
+	fattr_ATIME | fattr_MTIME | fattr_ATIME_NOW | fattr_MTIME_NOW | fattr_CTIME
+
+func (s *llSession) serve(req *kernelReq) {
+	r := unsafe.Pointer(req)
+	ino := req.hdr.nodeid
+	switch req.hdr.opcode {
+	case fuse_LOOKUP:
+		name, _ := kernelString(req.in)
+		hostLlLookup(r, ino, name)
+	case fuse_FORGET:
+		if in, _ := kernelArg[fuse_forget_in](req.in); nil != in {
+			hostLlForget(r, ino, in.nlookup)
+		}
+	case fuse_BATCH_FORGET:
+		in, rest := kernelArg[fuse_batch_forget_in](req.in)
+		for i := uint32(0); nil != in && in.count > i; i++ {
+			var one *fuse_forget_one
+			if one, rest = kernelArg[fuse_forget_one](rest); nil == one {
+				break
+			}
+			hostLlForget(r, one.nodeid, one.nlookup)
+		}
+	case fuse_GETATTR:
+		var fi *struct_fuse_file_info
+		if in, _ := kernelArg[fuse_getattr_in](req.in); nil != in &&
+			0 != in.getattr_flags&fuse_GETATTR_FH {
+			fi = &struct_fuse_file_info{fh: in.fh}
+		}
+		hostLlGetattr(r, ino, fi)
+	case fuse_SETATTR:
+		in, _ := kernelArg[fuse_setattr_in](req.in)
+		if nil == in {
+			req.replyErr(-EINVAL)
+			return
+		}
+		attr, valid := kernelSetattr(in)
+		var fi *struct_fuse_file_info
+		if 0 != valid&fattr_FH {
+			fi = &struct_fuse_file_info{fh: in.fh}
+		}
+		stat := Stat_t{
+			Mode: attr.st_mode,
+			Uid:  attr.st_uid,
+			Gid:  attr.st_gid,
+			Size: attr.st_size,
+			Atim: Timespec{Sec: attr.st_atim.tv_sec, Nsec: attr.st_atim.tv_nsec},
+			Mtim: Timespec{Sec: attr.st_mtim.tv_sec, Nsec: attr.st_mtim.tv_nsec},
+			Ctim: Timespec{Sec: attr.st_ctim.tv_sec, Nsec: attr.st_ctim.tv_nsec},
+		}
+		hostLlSetattr(r, ino, &stat, int(valid&llSetattrValid), fi)
+	case fuse_READLINK:
+		hostLlReadlink(r, ino)
+	case fuse_MKNOD:
+		in, rest := kernelArg[fuse_mknod_in](req.in)
+		if nil == in {
+			req.replyErr(-EINVAL)
+			return
+		}
+		name, _ := kernelString(rest)
+		req.setUmask(in.umask)
+		hostLlMknod(r, ino, name, in.mode, uint64(in.rdev))
+	case fuse_MKDIR:
+		in, rest := kernelArg[fuse_mkdir_in](req.in)
+		if nil == in {
+			req.replyErr(-EINVAL)
+			return
+		}
+		name, _ := kernelString(rest)
+		req.setUmask(in.umask)
+		hostLlMkdir(r, ino, name, in.mode)
+	case fuse_UNLINK:
+		name, _ := kernelString(req.in)
+		hostLlUnlink(r, ino, name)
+	case fuse_RMDIR:
+		name, _ := kernelString(req.in)
+		hostLlRmdir(r, ino, name)
+	case fuse_SYMLINK:
+		name, rest := kernelString(req.in)
+		target, _ := kernelString(rest)
+		hostLlSymlink(r, target, ino, name)
+	case fuse_RENAME, fuse_RENAME2:
+		var newdir uint64
+		var flags uint32
+		var rest []byte
+		if fuse_RENAME2 == req.hdr.opcode {
+			var in *fuse_rename2_in
+			if in, rest = kernelArg[fuse_rename2_in](req.in); nil != in {
+				newdir, flags = in.newdir, in.flags
+			}
+		} else {
+			var in *fuse_rename_in
+			if in, rest = kernelArg[fuse_rename_in](req.in); nil != in {
+				newdir = in.newdir
+			}
+		}
+		if 0 == newdir {
+			req.replyErr(-EINVAL)
+			return
+		}
+		name, rest := kernelString(rest)
+		newname, _ := kernelString(rest)
+		hostLlRename(r, ino, name, newdir, newname, flags)
+	case fuse_LINK:
+		in, rest := kernelArg[fuse_link_in](req.in)
+		if nil == in {
+			req.replyErr(-EINVAL)
+			return
+		}
+		newname, _ := kernelString(rest)
+		hostLlLink(r, in.oldnodeid, ino, newname)
+	case fuse_OPEN, fuse_OPENDIR:
+		in, _ := kernelArg[fuse_open_in](req.in)
+		if nil == in {
+			req.replyErr(-EINVAL)
+			return
+		}
+		fi := struct_fuse_file_info{flags: c_int(in.flags)}
+		if fuse_OPEN == req.hdr.opcode {
+			hostLlOpen(r, ino, &fi)
+		} else {
+			hostLlOpendir(r, ino, &fi)
+		}
+	case fuse_READ, fuse_READDIR, fuse_READDIRPLUS:
+		in, _ := kernelArg[fuse_read_in](req.in)
+		if nil == in {
+			req.replyErr(-EINVAL)
+			return
+		}
+		fi := struct_fuse_file_info{fh: in.fh, flags: c_int(in.flags), lock_owner: in.lock_owner}
+		switch req.hdr.opcode {
+		case fuse_READ:
+			hostLlRead(r, ino, int(in.size), int64(in.offset), &fi)
+		case fuse_READDIR:
+			hostLlReaddir(r, ino, int(in.size), int64(in.offset), &fi, false)
+		default:
+			hostLlReaddir(r, ino, int(in.size), int64(in.offset), &fi, true)
+		}
+	case fuse_WRITE:
+		in, data := kernelArg[fuse_write_in](req.in)
+		if nil == in || len(data) < int(in.size) {
+			req.replyErr(-EINVAL)
+			return
+		}
+		fi := struct_fuse_file_info{
+			fh:         in.fh,
+			flags:      c_int(in.flags),
+			lock_owner: in.lock_owner,
+			writepage:  0 != in.write_flags&1, // FUSE_WRITE_CACHE
+		}
+		hostLlWrite(r, ino, data[:in.size], int64(in.offset), &fi)
+	case fuse_FLUSH:
+		in, _ := kernelArg[fuse_flush_in](req.in)
+		if nil == in {
+			req.replyErr(-EINVAL)
+			return
+		}
+		fi := struct_fuse_file_info{fh: in.fh, lock_owner: in.lock_owner, flush: true}
+		hostLlFlush(r, ino, &fi)
+	case fuse_RELEASE, fuse_RELEASEDIR:
+		in, _ := kernelArg[fuse_release_in](req.in)
+		if nil == in {
+			req.replyErr(-EINVAL)
+			return
+		}
+		fi := struct_fuse_file_info{
+			flags:         c_int(in.flags),
+			fh:            in.fh,
+			lock_owner:    in.lock_owner,
+			flush:         0 != in.release_flags&fuse_RELEASE_FLUSH,
+			flock_release: 0 != in.release_flags&fuse_RELEASE_FLOCK_UNLOCK,
+		}
+		if fuse_RELEASE == req.hdr.opcode {
+			hostLlRelease(r, ino, &fi)
+		} else {
+			hostLlReleasedir(r, ino, &fi)
+		}
+	case fuse_FSYNC, fuse_FSYNCDIR:
+		in, _ := kernelArg[fuse_fsync_in](req.in)
+		if nil == in {
+			req.replyErr(-EINVAL)
+			return
+		}
+		fi := struct_fuse_file_info{fh: in.fh}
+		datasync := 0 != in.fsync_flags&fuse_FSYNC_FDATASYNC
+		if fuse_FSYNC == req.hdr.opcode {
+			hostLlFsync(r, ino, datasync, &fi)
+		} else {
+			hostLlFsyncdir(r, ino, datasync, &fi)
+		}
+	case fuse_STATFS:
+		hostLlStatfs(r, ino)
+	case fuse_SETXATTR:
+		in, rest := kernelArg[fuse_setxattr_in](req.in)
+		if nil == in {
+			req.replyErr(-EINVAL)
+			return
+		}
+		name, value := kernelString(rest)
+		if len(value) < int(in.size) {
+			req.replyErr(-EINVAL)
+			return
+		}
+		hostLlSetxattr(r, ino, name, value[:in.size], int(in.flags))
+	case fuse_GETXATTR, fuse_LISTXATTR:
+		in, rest := kernelArg[fuse_getxattr_in](req.in)
+		if nil == in {
+			req.replyErr(-EINVAL)
+			return
+		}
+		if fuse_GETXATTR == req.hdr.opcode {
+			name, _ := kernelString(rest)
+			hostLlGetxattr(r, ino, name, int(in.size))
+		} else {
+			hostLlListxattr(r, ino, int(in.size))
+		}
+	case fuse_REMOVEXATTR:
+		name, _ := kernelString(req.in)
+		hostLlRemovexattr(r, ino, name)
+	case fuse_ACCESS:
+		in, _ := kernelArg[fuse_access_in](req.in)
+		if nil == in {
+			req.replyErr(-EINVAL)
+			return
+		}
+		hostLlAccess(r, ino, in.mask)
+	case fuse_CREATE:
+		in, rest := kernelArg[fuse_create_in](req.in)
+		if nil == in {
+			req.replyErr(-EINVAL)
+			return
+		}
+		name, _ := kernelString(rest)
+		req.setUmask(in.umask)
+		fi := struct_fuse_file_info{flags: c_int(in.flags)}
+		hostLlCreate(r, ino, name, in.mode, &fi)
+	default:
+		req.replyErr(-ENOSYS)
+	}
+}
@@ -86,6 +86,15 @@ type fuse_operations struct {
 	fsetattr_x  uintptr
 }
 
+type fuse_flock_t struct {
+	l_type   c_int16_t
+	l_whence c_int16_t
+	_        align64
+	l_start  c_fuse_off_t
+	l_len    c_fuse_off_t
+	l_pid    c_fuse_pid_t
+}
+
 type fuse_stat_t struct {
 	st_dev      c_fuse_dev_t
 	_           align64
@@ -183,10 +192,12 @@ type struct_fuse_opt struct {
 type (
 	c_bool                  = bool
 	c_char                  = byte
+	c_double                = float64
 	c_fuse_blkcnt_t         = int64
 	c_fuse_blksize_t        = int32
 	c_fuse_dev_t            = uint32
 	c_fuse_fill_dir_t       = uintptr
+	c_fuse_flock_t          = fuse_flock_t
 	c_fuse_fsblkcnt_t       = uintptr
 	c_fuse_fsfilcnt_t       = uintptr
 	c_fuse_gid_t            = uint32
@@ -223,11 +234,12 @@ type (
 )
 
 var (
-	kernel32       = syscall.MustLoadDLL("kernel32.dll")
-	getProcessHeap = kernel32.MustFindProc("GetProcessHeap")
-	heapAlloc      = kernel32.MustFindProc("HeapAlloc")
-	heapFree       = kernel32.MustFindProc("HeapFree")
-	processHeap    uintptr
+	kernel32           = syscall.MustLoadDLL("kernel32.dll")
+	getProcessHeap     = kernel32.MustFindProc("GetProcessHeap")
+	heapAlloc          = kernel32.MustFindProc("HeapAlloc")
+	heapFree           = kernel32.MustFindProc("HeapFree")
+	getCurrentThreadId = kernel32.MustFindProc("GetCurrentThreadId")
+	processHeap        uintptr
 
 	/*
 	 * It appears safe to call cdecl functions from Go. Is it really?
@@ -310,7 +322,11 @@ func c_hostAsgnCconninfo(conn *c_struct_fuse_conn_info,
 	capCaseInsensitive c_bool,
 	capReaddirPlus c_bool,
 	capDeleteAccess c_bool,
-	capOpenTrunc c_bool) {
+	capOpenTrunc c_bool,
+	capPosixLocks c_bool,
+	capFlockLocks c_bool,
+	capSpliceWrite c_bool,
+	capSpliceRead c_bool) {
 	conn.want |= conn.capable & FSP_FUSE_CAP_STAT_EX
 	cgofuse_stat_ex = 0 != conn.want&FSP_FUSE_CAP_STAT_EX // hack!
 	if capCaseInsensitive {
@@ -323,6 +339,59 @@ func c_hostAsgnCconninfo(conn *c_struct_fuse_conn_info,
 		conn.want |= conn.capable & FSP_FUSE_CAP_DELETE_ACCESS
 	}
 }
+func c_hostConninfoGet(conn *c_struct_fuse_conn_info,
+	protoMajor *c_uint32_t,
+	protoMinor *c_uint32_t,
+	maxWrite *c_uint32_t,
+	maxRead *c_uint32_t,
+	maxReadahead *c_uint32_t,
+	capable *c_uint32_t,
+	want *c_uint32_t,
+	maxBackground *c_uint32_t,
+	congestionThreshold *c_uint32_t,
+	timeGran *c_uint32_t) {
+	*protoMajor = conn.proto_major
+	*protoMinor = conn.proto_minor
+	*maxWrite = conn.max_write
+	*maxReadahead = conn.max_readahead
+}
+func c_hostConninfoSet(conn *c_struct_fuse_conn_info,
+	maxWrite c_uint32_t,
+	maxRead c_uint32_t,
+	maxReadahead c_uint32_t,
+	want c_uint32_t,
+	maxBackground c_uint32_t,
+	congestionThreshold c_uint32_t,
+	timeGran c_uint32_t) {
+	conn.max_write = maxWrite
+	conn.max_readahead = maxReadahead
+}
+func c_hostFuseUseVersion() c_int {
+	return 28
+}
+func c_hostFuseVersion() c_int {
+	if 0 == c_hostFuseInit() {
+		return 0
+	}
+	return 28
+}
+func c_hostAsgnCconfigEx(conf *c_struct_fuse_config,
+	entryTimeout c_double,
+	attrTimeout c_double,
+	negativeTimeout c_double,
+	kernelCache c_bool,
+	autoCache c_bool,
+	acAttrTimeoutSet c_bool,
+	acAttrTimeout c_double,
+	hardRemove c_bool,
+	nullpathOk c_bool,
+	setMode c_bool,
+	umask c_uint32_t,
+	setUid c_bool,
+	uid c_uint32_t,
+	setGid c_bool,
+	gid c_uint32_t) {
+}
 func c_hostAsgnCconfig(conf *c_struct_fuse_config,
 	directIO c_bool,
 	useIno c_bool) {
@@ -353,6 +422,38 @@ func c_hostCstatvfsFromFusestatfs(stbuf *c_fuse_statvfs_t,
 		f_namemax: uintptr(namemax),
 	}
 }
+func c_hostFlockRelease(fi *c_struct_fuse_file_info) c_bool {
+	return false
+}
+func c_hostBufvecNew(count c_size_t) unsafe.Pointer {
+	return nil
+}
+func c_hostBufvecCount(bufv unsafe.Pointer) c_size_t {
+	return 0
+}
+func c_hostBufvecGet(bufv unsafe.Pointer, i c_size_t,
+	flags *c_uint32_t, mem *unsafe.Pointer, size *c_size_t, fd *c_int, pos *c_int64_t) {
+}
+func c_hostBufvecSet(bufv unsafe.Pointer, i c_size_t,
+	flags c_uint32_t, mem unsafe.Pointer, size c_size_t, fd c_int, pos c_int64_t) {
+}
+func c_hostBufvecFlatten(bufv unsafe.Pointer, mem *unsafe.Pointer, size *c_size_t) c_int {
+	return -ENOSYS
+}
+func c_hostCflockFromFuselock(lock *c_fuse_flock_t,
+	typ c_int,
+	whence c_int,
+	start c_int64_t,
+	len c_int64_t,
+	pid c_int64_t) {
+	*lock = c_fuse_flock_t{
+		l_type:   c_int16_t(typ),
+		l_whence: c_int16_t(whence),
+		l_start:  c_fuse_off_t(start),
+		l_len:    c_fuse_off_t(len),
+		l_pid:    c_fuse_pid_t(pid),
+	}
+}
 func c_hostCstatFromFusestat(stbuf *c_fuse_stat_t,
 	dev c_uint64_t,
 	ino c_uint64_t,
@@ -489,7 +590,8 @@ func c_hostFuseInit() c_int {
 	}
 	return 1
 }
-func c_hostMount(argc c_int, argv **c_char, data unsafe.Pointer) c_int {
+func c_hostMount(argc c_int, argv **c_char, nullpathOk c_bool,
+	readBuf c_bool, writeBuf c_bool, data unsafe.Pointer) c_int {
 	r, _, _ := fuse_main_real.Call(
 		uintptr(argc),
 		uintptr(unsafe.Pointer(argv)),
@@ -501,10 +603,47 @@ func c_hostMount(argc c_int, argv **c_char, data unsafe.Pointer) c_int {
 	}
 	return 0
 }
-func c_hostUnmount(fuse *c_struct_fuse, mountpoint *c_char) c_int {
+func c_hostStatDev(path *c_char, dev *c_uint64_t) c_int {
+	return c_int(ENOSYS)
+}
+func c_hostStderrRedirect(fd c_int) c_int {
+	return -1
+}
+func c_hostStderrRestore(saved c_int) {
+}
+func c_hostUnmount(fuse *c_struct_fuse, mountpoint *c_char, force c_bool) c_int {
 	fuse_exit.Call(uintptr(unsafe.Pointer(fuse)))
 	return 1
 }
+func c_hostInvalidatePath(fuse *c_struct_fuse, path *c_char) c_int {
+	return -ENOSYS
+}
+func c_hostInvalidateEntry(fuse *c_struct_fuse, mountpoint *c_char,
+	dir *c_char, name *c_char, useIno c_bool) c_int {
+	return -ENOSYS
+}
+func c_hostInvalidateData(fuse *c_struct_fuse, mountpoint *c_char,
+	path *c_char, ofst c_int64_t, size c_int64_t, useIno c_bool) c_int {
+	return -ENOSYS
+}
+func c_hostNotifyPoll(ph unsafe.Pointer) c_int {
+	return 0
+}
+func c_hostPollhandleDestroy(ph unsafe.Pointer) {
+}
+func c_hostInterrupted() c_int {
+	return 0
+}
+func c_hostInterruptible() bool {
+	return false
+}
+func c_hostThreadId() uintptr {
+	id, _, _ := getCurrentThreadId.Call()
+	return id
+}
+func c_hostGetgroups(size c_int, list *c_uint32_t) c_int {
+	return -ENOSYS
+}
 func c_hostNotify(fuse *c_struct_fuse, path *c_char, action c_uint32_t) c_int {
 	if nil == fuse_notify {
 		return 0
@@ -548,6 +687,79 @@ func c_hostOptParse(args *c_struct_fuse_args, data unsafe.Pointer, opts *c_struc
 	return c_int(r)
 }
 
+// WinFsp does not provide the FUSE3 low-level API.
+func c_hostLlFuseInit() c_int {
+	return 0
+}
+func c_hostLlSessionNew(argc c_int, argv **c_char, data unsafe.Pointer) unsafe.Pointer {
+	return nil
+}
+func c_hostLlSessionMount(se unsafe.Pointer, mountpoint *c_char) c_int {
+	return -ENOSYS
+}
+func c_hostLlSessionLoop(se unsafe.Pointer, single c_bool) c_int {
+	return -ENOSYS
+}
+func c_hostLlSessionUnmount(se unsafe.Pointer) {
+}
+func c_hostLlSessionDestroy(se unsafe.Pointer) {
+}
+func c_hostLlReqUserdata(req unsafe.Pointer) unsafe.Pointer {
+	return nil
+}
+func c_hostLlReqCtx(req unsafe.Pointer, uid *c_uint32_t, gid *c_uint32_t, pid *c_uint32_t,
+	umask *c_uint32_t) {
+}
+func c_hostLlReplyErr(req unsafe.Pointer, err c_int) c_int {
+	return -ENOSYS
+}
+func c_hostLlReplyNone(req unsafe.Pointer) {
+}
+func c_hostLlReplyEntry(req unsafe.Pointer, ino c_uint64_t, generation c_uint64_t,
+	attr *c_fuse_stat_t, attrTimeout c_double, entryTimeout c_double) c_int {
+	return -ENOSYS
+}
+func c_hostLlReplyCreate(req unsafe.Pointer, ino c_uint64_t, generation c_uint64_t,
+	attr *c_fuse_stat_t, attrTimeout c_double, entryTimeout c_double,
+	fi *c_struct_fuse_file_info) c_int {
+	return -ENOSYS
+}
+func c_hostLlReplyAttr(req unsafe.Pointer, attr *c_fuse_stat_t, attrTimeout c_double) c_int {
+	return -ENOSYS
+}
+func c_hostLlReplyOpen(req unsafe.Pointer, fi *c_struct_fuse_file_info) c_int {
+	return -ENOSYS
+}
+func c_hostLlReplyWrite(req unsafe.Pointer, count c_size_t) c_int {
+	return -ENOSYS
+}
+func c_hostLlReplyBuf(req unsafe.Pointer, buf *c_char, size c_size_t) c_int {
+	return -ENOSYS
+}
+func c_hostLlReplyStatfs(req unsafe.Pointer, stbuf *c_fuse_statvfs_t) c_int {
+	return -ENOSYS
+}
+func c_hostLlReplyXattr(req unsafe.Pointer, count c_size_t) c_int {
+	return -ENOSYS
+}
+func c_hostLlAddDirentry(req unsafe.Pointer, buf *c_char, bufsize c_size_t,
+	name *c_char, stbuf *c_fuse_stat_t, off c_fuse_off_t) c_size_t {
+	return 0
+}
+func c_hostLlAddDirentryPlus(req unsafe.Pointer, buf *c_char, bufsize c_size_t,
+	name *c_char, ino c_uint64_t, generation c_uint64_t, attr *c_fuse_stat_t,
+	attrTimeout c_double, entryTimeout c_double, off c_fuse_off_t) c_size_t {
+	return 0
+}
+func c_hostLlNotifyInvalInode(se unsafe.Pointer, ino c_uint64_t, off c_int64_t,
+	len c_int64_t) c_int {
+	return -ENOSYS
+}
+func c_hostLlNotifyInvalEntry(se unsafe.Pointer, parent c_uint64_t, name *c_char,
+	namelen c_size_t) c_int {
+	return -ENOSYS
+}
+
 func fspload() (dll *syscall.DLL, err error) {
 	dllname := ""
 	switch runtime.GOARCH {
@@ -793,7 +1005,7 @@ func go_hostOpendir64(path0 *c_char, fi0 *c_struct_fuse_file_info) (errc0 uintpt
 func go_hostReaddir64(path0 *c_char,
 	buff0 unsafe.Pointer, fill0 c_fuse_fill_dir_t, ofst0 uintptr,
 	fi0 *c_struct_fuse_file_info) (errc0 uintptr) {
-	return uintptr(int(hostReaddir(path0, buff0, fill0, c_fuse_off_t(ofst0), fi0)))
+	return uintptr(int(hostReaddir(path0, buff0, fill0, c_fuse_off_t(ofst0), fi0, 0)))
 }
 
 func go_hostReleasedir64(path0 *c_char, fi0 *c_struct_fuse_file_info) (errc0 uintptr) {
@@ -960,7 +1172,7 @@ func go_hostReaddir32(path0 *c_char,
 	buff0 unsafe.Pointer, fill0 c_fuse_fill_dir_t, lofst0, hofst0 uintptr,
 	fi0 *c_struct_fuse_file_info) (errc0 uintptr) {
 	return uintptr(int(hostReaddir(path0,
-		buff0, fill0, (c_fuse_off_t(hofst0)<<32)|c_fuse_off_t(lofst0), fi0)))
+		buff0, fill0, (c_fuse_off_t(hofst0)<<32)|c_fuse_off_t(lofst0), fi0, 0)))
 }
 
 func go_hostReleasedir32(path0 *c_char, fi0 *c_struct_fuse_file_info) (errc0 uintptr) {
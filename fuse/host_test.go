@@ -13,10 +13,14 @@
 package fuse
 
 import (
+	"context"
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -34,6 +38,40 @@ func (self *testfs) Destroy() {
 	self.dstr++
 }
 
+// testinitfs is a testfs whose Init() waits until wait is closed.
+type testinitfs struct {
+	testfs
+	wait chan struct{}
+}
+
+func (self *testinitfs) Init() {
+	<-self.wait
+	self.testfs.Init()
+}
+
+// testblockfs is a testfs with a file /dir/block whose Getattr waits until release is
+// closed. It sends on entered when Getattr starts waiting. The file is not in the root
+// directory, because the kernel may serialize lookups in the same directory.
+type testblockfs struct {
+	testfs
+	entered chan bool
+	release chan struct{}
+}
+
+func (self *testblockfs) Getattr(path string, stat *Stat_t, fh uint64) (errc int) {
+	switch path {
+	case "/dir":
+		stat.Mode = S_IFDIR | 0555
+		return 0
+	case "/dir/block":
+		self.entered <- true
+		<-self.release
+		stat.Mode = S_IFREG | 0444
+		return 0
+	}
+	return self.testfs.Getattr(path, stat, fh)
+}
+
 func (self *testfs) Getattr(path string, stat *Stat_t, fh uint64) (errc int) {
 	switch path {
 	case "/":
@@ -53,6 +91,61 @@ func (self *testfs) Readdir(path string,
 	return 0
 }
 
+type testctxfs struct {
+	FileSystemBaseCtx
+	opctx  chan *OpContext
+	groups chan []uint32
+	intr   chan bool
+}
+
+func (self *testctxfs) Getattr(ctx context.Context, path string, stat *Stat_t, fh uint64) (errc int) {
+	switch path {
+	case "/":
+		stat.Mode = S_IFDIR | 0555
+		return 0
+	case "/opctx":
+		// the supplementary groups are retrieved on the goroutine that runs Getattr
+		if opctx, ok := GetOpContext(ctx); ok {
+			self.groups <- opctx.Groups()
+		}
+		// retrieve the OpContext from a goroutine other than the one that runs Getattr
+		done := make(chan bool)
+		go func() {
+			opctx, _ := GetOpContext(ctx)
+			select {
+			case self.opctx <- opctx:
+			default:
+			}
+			done <- true
+		}()
+		<-done
+		return -ENOENT
+	case "/intr":
+		// wait until the caller is interrupted; interruption is detected by polling
+		done := make(chan bool)
+		go func() {
+			select {
+			case <-ctx.Done():
+				done <- true
+			case <-time.After(5 * time.Second):
+				done <- false
+			}
+		}()
+		for nil == ctx.Err() {
+			select {
+			case <-done:
+				self.intr <- false
+				return -EINTR
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		self.intr <- <-done && Interrupted()
+		return -EINTR
+	default:
+		return -ENOENT
+	}
+}
+
 func testHost(t *testing.T, unmount bool) {
 	path, err := ioutil.TempDir("", "test")
 	if nil != err {
@@ -107,3 +200,318 @@ func TestSignal(t *testing.T) {
 		testHost(t, false)
 	}
 }
+
+func TestHostConfig(t *testing.T) {
+	if "linux" != runtime.GOOS && "freebsd" != runtime.GOOS {
+		return
+	}
+	path, err := ioutil.TempDir("", "test")
+	if nil != err {
+		panic(err)
+	}
+	defer os.Remove(path)
+	mntp := filepath.Join(path, "m")
+	err = os.Mkdir(mntp, os.FileMode(0755))
+	if nil != err {
+		panic(err)
+	}
+	defer os.Remove(mntp)
+	done := make(chan bool)
+	tmch := time.After(3 * time.Second)
+	tstf := &testfs{}
+	host := NewFileSystemHost(tstf)
+	if version := hostFuseVersion(); 206 > version {
+		t.Error("hostFuseVersion", version)
+	}
+	config := DefaultHostConfig()
+	config.AttrTimeout = 0
+	config.SetUmask = true
+	config.Umask = 022
+	if ignored := host.SetConfig(config); 0 != len(ignored) {
+		t.Error("SetConfig ignored", ignored)
+	}
+	mres := false
+	go func() {
+		mres = host.Mount(mntp, nil)
+		done <- true
+	}()
+	<-tmch
+	info, err := os.Stat(mntp)
+	if nil != err {
+		t.Error("Stat failed", err)
+	} else if 0755 != info.Mode().Perm() {
+		t.Errorf("Stat mode %v; expected %v", info.Mode().Perm(), os.FileMode(0755))
+	}
+	host.Unmount()
+	<-done
+	if !mres {
+		t.Error("Mount failed")
+	}
+}
+
+func TestHostCtx(t *testing.T) {
+	if "linux" != runtime.GOOS && "freebsd" != runtime.GOOS {
+		return
+	}
+	path, err := ioutil.TempDir("", "test")
+	if nil != err {
+		panic(err)
+	}
+	defer os.Remove(path)
+	mntp := filepath.Join(path, "m")
+	err = os.Mkdir(mntp, os.FileMode(0755))
+	if nil != err {
+		panic(err)
+	}
+	defer os.Remove(mntp)
+	done := make(chan bool)
+	tmch := time.After(3 * time.Second)
+	tstf := &testctxfs{opctx: make(chan *OpContext, 1), groups: make(chan []uint32, 1)}
+	host := NewFileSystemHostCtx(tstf)
+	mres := false
+	go func() {
+		mres = host.Mount(mntp, nil)
+		done <- true
+	}()
+	<-tmch
+	os.Stat(filepath.Join(mntp, "opctx"))
+	select {
+	case opctx := <-tstf.opctx:
+		if nil == opctx {
+			t.Error("GetOpContext failed")
+		} else {
+			if uint32(os.Getuid()) != opctx.Uid || uint32(os.Getgid()) != opctx.Gid {
+				t.Errorf("OpContext uid/gid %v/%v; expected %v/%v",
+					opctx.Uid, opctx.Gid, os.Getuid(), os.Getgid())
+			}
+			if 0 == opctx.Pid {
+				t.Error("OpContext pid is 0")
+			}
+			if nil == <-tstf.groups {
+				t.Error("OpContext groups not retrieved")
+			}
+		}
+	default:
+		t.Error("Getattr not called")
+	}
+	host.Unmount()
+	<-done
+	if !mres {
+		t.Error("Mount failed")
+	}
+}
+
+func TestStart(t *testing.T) {
+	if "linux" != runtime.GOOS && "freebsd" != runtime.GOOS {
+		return
+	}
+	path, err := ioutil.TempDir("", "test")
+	if nil != err {
+		panic(err)
+	}
+	defer os.Remove(path)
+	mntp := filepath.Join(path, "m")
+	err = os.Mkdir(mntp, os.FileMode(0755))
+	if nil != err {
+		panic(err)
+	}
+	defer os.Remove(mntp)
+	ctx, cancel := context.WithCancel(context.Background())
+	tstf := &testfs{}
+	host := NewFileSystemHost(tstf)
+	mount, err := host.StartContext(ctx, mntp, nil)
+	if nil != err {
+		t.Fatal("Start failed", err)
+	}
+	select {
+	case <-mount.Ready():
+	default:
+		t.Error("Ready not closed")
+	}
+	if 1 != tstf.init {
+		t.Error("Init not called", tstf.init)
+	}
+	info, err := os.Stat(mntp)
+	if nil != err {
+		t.Error("Stat failed", err)
+	} else if 0555 != info.Mode().Perm() {
+		t.Errorf("Stat mode %v; expected %v", info.Mode().Perm(), os.FileMode(0555))
+	}
+	cancel()
+	select {
+	case <-mount.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("Done not closed after cancel")
+	}
+	if err := mount.Wait(); nil != err {
+		t.Error("Wait failed", err)
+	}
+	if 1 != tstf.dstr {
+		t.Error("Destroy not called", tstf.dstr)
+	}
+
+	_, err = host.Start(filepath.Join(path, "nonexistent"), nil)
+	if nil == err {
+		t.Error("Start expected error")
+	}
+
+	// a context that is done while Init() runs does not block StartContext
+	initf := &testinitfs{wait: make(chan struct{})}
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	mount, err = NewFileSystemHost(initf).StartContext(ctx, mntp, nil)
+	if context.DeadlineExceeded != err || nil == mount {
+		t.Fatal("StartContext expected context.DeadlineExceeded", err)
+	}
+	close(initf.wait)
+	select {
+	case <-mount.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("Done not closed after Init")
+	}
+	if 1 != initf.init || 1 != initf.dstr {
+		t.Error("Init or Destroy not called", initf.init, initf.dstr)
+	}
+}
+
+func TestUnmountDrain(t *testing.T) {
+	if "linux" != runtime.GOOS && "freebsd" != runtime.GOOS {
+		return
+	}
+	path, err := ioutil.TempDir("", "test")
+	if nil != err {
+		panic(err)
+	}
+	defer os.Remove(path)
+	mntp := filepath.Join(path, "m")
+	err = os.Mkdir(mntp, os.FileMode(0755))
+	if nil != err {
+		panic(err)
+	}
+	defer os.Remove(mntp)
+	tstf := &testblockfs{entered: make(chan bool, 1), release: make(chan struct{})}
+	host := NewFileSystemHost(tstf)
+	mount, err := host.Start(mntp, nil)
+	if nil != err {
+		t.Fatal("Start failed", err)
+	}
+	defer func() {
+		mount.Unmount()
+		<-mount.Done()
+	}()
+	go os.Stat(filepath.Join(mntp, "dir", "block"))
+	<-tstf.entered
+
+	errc := make(chan error)
+	begin := time.Now()
+	go func() {
+		errc <- host.UnmountE(UnmountOptions{Mode: UnmountDrain, Timeout: time.Second})
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if _, err := os.Stat(filepath.Join(mntp, "file")); !errors.Is(err, syscall.ENOTCONN) {
+		t.Error("Stat while draining expected ENOTCONN", err)
+	}
+	err = <-errc
+	var uerr *UnmountError
+	if !errors.As(err, &uerr) || 1 != uerr.InFlight {
+		t.Error("UnmountE expected UnmountError with 1 operation in flight", err)
+	}
+	if time.Since(begin) < time.Second {
+		t.Error("UnmountE did not wait for the timeout")
+	}
+	close(tstf.release)
+	select {
+	case <-mount.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("Done not closed after the operation completed")
+	}
+}
+
+func TestUnmountForce(t *testing.T) {
+	if "linux" != runtime.GOOS {
+		return
+	}
+	if data, err := ioutil.ReadFile("/proc/self/mountinfo"); nil != err ||
+		!strings.Contains(string(data), " - fusectl ") {
+		t.Skip("fusectl is not mounted")
+	}
+	path, err := ioutil.TempDir("", "test")
+	if nil != err {
+		panic(err)
+	}
+	defer os.Remove(path)
+	mntp := filepath.Join(path, "m")
+	err = os.Mkdir(mntp, os.FileMode(0755))
+	if nil != err {
+		panic(err)
+	}
+	defer os.Remove(mntp)
+	tstf := &testblockfs{entered: make(chan bool, 1), release: make(chan struct{})}
+	host := NewFileSystemHost(tstf)
+	mount, err := host.Start(mntp, nil)
+	if nil != err {
+		t.Fatal("Start failed", err)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		_, err := os.Stat(filepath.Join(mntp, "dir", "block"))
+		errc <- err
+	}()
+	<-tstf.entered
+
+	if err := host.UnmountE(UnmountOptions{Mode: UnmountForce}); nil != err {
+		t.Error("UnmountE failed", err)
+	}
+	select {
+	case err := <-errc:
+		if nil == err {
+			t.Error("Stat of aborted file system expected error")
+		}
+	case <-time.After(3 * time.Second):
+		t.Error("operation not failed after UnmountE")
+	}
+	// the FUSE layer waits for the operation in the file system before it exits
+	close(tstf.release)
+	select {
+	case <-mount.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("Done not closed after UnmountE")
+	}
+}
+
+func TestUnmountE(t *testing.T) {
+	if "linux" != runtime.GOOS && "freebsd" != runtime.GOOS {
+		return
+	}
+	path, err := ioutil.TempDir("", "test")
+	if nil != err {
+		panic(err)
+	}
+	defer os.Remove(path)
+	mntp := filepath.Join(path, "m")
+	err = os.Mkdir(mntp, os.FileMode(0755))
+	if nil != err {
+		panic(err)
+	}
+	defer os.Remove(mntp)
+	for _, mode := range []UnmountMode{UnmountLazy, UnmountDrain} {
+		tstf := &testfs{}
+		host := NewFileSystemHost(tstf)
+		mount, err := host.Start(mntp, nil)
+		if nil != err {
+			t.Fatal("Start failed", err)
+		}
+		err = host.UnmountE(UnmountOptions{Mode: mode, Timeout: 3 * time.Second})
+		if nil != err {
+			t.Error("UnmountE failed", mode, err)
+		}
+		select {
+		case <-mount.Done():
+		case <-time.After(3 * time.Second):
+			t.Fatal("Done not closed after UnmountE", mode)
+		}
+		if 1 != tstf.dstr {
+			t.Error("Destroy not called", mode, tstf.dstr)
+		}
+	}
+}
@@ -16,9 +16,167 @@
 package fuse
 
 import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"syscall"
+	"testing"
+	"time"
 )
 
 func sendInterrupt() bool {
 	return nil == syscall.Kill(syscall.Getpid(), syscall.SIGINT)
 }
+
+func TestSignalConfig(t *testing.T) {
+	path, err := ioutil.TempDir("", "test")
+	if nil != err {
+		panic(err)
+	}
+	defer os.Remove(path)
+	mntp := filepath.Join(path, "m")
+	err = os.Mkdir(mntp, os.FileMode(0755))
+	if nil != err {
+		panic(err)
+	}
+	defer os.Remove(mntp)
+
+	var lock sync.Mutex
+	var sigs []os.Signal
+	host := NewFileSystemHost(&testfs{})
+	host.SetSignalConfig(SignalConfig{
+		Unmount: []os.Signal{syscall.SIGUSR1},
+		Notify:  []os.Signal{syscall.SIGHUP, syscall.SIGUSR1},
+		Handler: func(sig os.Signal) {
+			lock.Lock()
+			sigs = append(sigs, sig)
+			lock.Unlock()
+		},
+	})
+	mount, err := host.Start(mntp, nil)
+	if nil != err {
+		t.Fatal("Start failed", err)
+	}
+	syscall.Kill(syscall.Getpid(), syscall.SIGHUP)
+	select {
+	case <-mount.Done():
+		t.Fatal("SIGHUP unmounted the file system")
+	case <-time.After(500 * time.Millisecond):
+	}
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	select {
+	case <-mount.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("SIGUSR1 did not unmount the file system")
+	}
+	lock.Lock()
+	if 2 != len(sigs) || syscall.SIGHUP != sigs[0] || syscall.SIGUSR1 != sigs[1] {
+		t.Error("Handler received", sigs)
+	}
+	lock.Unlock()
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT)
+	defer signal.Stop(sigc)
+	host.SetSignalConfig(SignalConfig{Disable: true})
+	mount, err = host.Start(mntp, nil)
+	if nil != err {
+		t.Fatal("Start failed", err)
+	}
+	syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+	<-sigc
+	select {
+	case <-mount.Done():
+		t.Fatal("SIGINT unmounted the file system")
+	case <-time.After(500 * time.Millisecond):
+	}
+	mount.Unmount()
+	<-mount.Done()
+}
+
+func TestHostInterrupt(t *testing.T) {
+	if "linux" != runtime.GOOS && "freebsd" != runtime.GOOS {
+		return
+	}
+	path, err := ioutil.TempDir("", "test")
+	if nil != err {
+		panic(err)
+	}
+	defer os.Remove(path)
+	mntp := filepath.Join(path, "m")
+	err = os.Mkdir(mntp, os.FileMode(0755))
+	if nil != err {
+		panic(err)
+	}
+	defer os.Remove(mntp)
+	tstf := &testctxfs{intr: make(chan bool, 1)}
+	host := NewFileSystemHostCtx(tstf)
+	mount, err := host.Start(mntp, nil)
+	if nil != err {
+		t.Fatal("Start failed", err)
+	}
+	defer func() {
+		mount.Unmount()
+		<-mount.Done()
+	}()
+	// stat in another process, so that it can be killed while the request is pending
+	cmd := exec.Command("stat", filepath.Join(mntp, "intr"))
+	if err := cmd.Start(); nil != err {
+		t.Fatal("exec failed", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	cmd.Process.Kill()
+	cmd.Wait()
+	select {
+	case intr := <-tstf.intr:
+		if !intr {
+			t.Error("context was not cancelled on interrupt")
+		}
+	case <-time.After(10 * time.Second):
+		t.Error("Getattr not called")
+	}
+}
+
+func TestMountEConcurrent(t *testing.T) {
+	if "linux" != runtime.GOOS && "freebsd" != runtime.GOOS {
+		return
+	}
+	path, err := ioutil.TempDir("", "test")
+	if nil != err {
+		panic(err)
+	}
+	defer os.Remove(path)
+	var stat0, stat1 syscall.Stat_t
+	syscall.Fstat(2, &stat0)
+	errs := make(chan error)
+	for i := 0; 8 > i; i++ {
+		mntp := filepath.Join(path, fmt.Sprintf("nonexistent%d", i))
+		go func() {
+			err := NewFileSystemHost(&testfs{}).MountE(mntp, nil)
+			var merr *MountError
+			if !errors.As(err, &merr) || MountErrMountpoint != merr.Kind ||
+				1 != strings.Count(merr.Message, "nonexistent") ||
+				!strings.Contains(merr.Message, mntp) {
+				errs <- fmt.Errorf("MountE(%s): %v", mntp, err)
+				return
+			}
+			errs <- nil
+		}()
+	}
+	for i := 0; 8 > i; i++ {
+		if err := <-errs; nil != err {
+			t.Error(err)
+		}
+	}
+	syscall.Fstat(2, &stat1)
+	if stat0.Dev != stat1.Dev || stat0.Ino != stat1.Ino {
+		t.Error("standard error was not restored")
+	}
+}
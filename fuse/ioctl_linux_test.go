@@ -0,0 +1,52 @@
+//go:build 386 || amd64 || arm || arm64
+
+/*
+ * ioctl_linux_test.go
+ *
+ * Copyright 2017-2022 Bill Zissimopoulos
+ */
+/*
+ * This file is part of Cgofuse.
+ *
+ * It is licensed under the MIT license. The full license text can be found
+ * in the License.txt file at the root of this project.
+ */
+
+package fuse
+
+import (
+	"testing"
+)
+
+func TestIoctlCmd(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  IoctlCmd
+		want uint32
+		typ  byte
+		nr   byte
+		size int
+		in   bool
+		out  bool
+	}{
+		// values from the Linux uapi headers
+		{"FIBMAP", IO(0x00, 1), 0x00000001, 0x00, 1, 0, false, false},
+		{"BLKFLSBUF", IO(0x12, 97), 0x00001261, 0x12, 97, 0, false, false},
+		{"FS_IOC_GETFLAGS", IOR('f', 1, 8), 0x80086601, 'f', 1, 8, false, true},
+		{"FS_IOC32_GETFLAGS", IOR('f', 1, 4), 0x80046601, 'f', 1, 4, false, true},
+		{"FS_IOC_SETFLAGS", IOW('f', 2, 8), 0x40086602, 'f', 2, 8, true, false},
+		{"FICLONE", IOW(0x94, 9, 4), 0x40049409, 0x94, 9, 4, true, false},
+		{"FIFREEZE", IOWR('X', 119, 4), 0xc0045877, 'X', 119, 4, true, true},
+		{"FS_IOC_FIEMAP", IOWR('f', 11, 32), 0xc020660b, 'f', 11, 32, true, true},
+	}
+	for _, tt := range tests {
+		if tt.want != uint32(tt.cmd) {
+			t.Errorf("%s: got %#08x, want %#08x", tt.name, uint32(tt.cmd), tt.want)
+		}
+		if tt.typ != tt.cmd.Type() || tt.nr != tt.cmd.Nr() || tt.size != tt.cmd.Size() ||
+			tt.in != tt.cmd.In() || tt.out != tt.cmd.Out() {
+			t.Errorf("%s: decoded as type=%#x nr=%d size=%d in=%v out=%v",
+				tt.name, tt.cmd.Type(), tt.cmd.Nr(), tt.cmd.Size(), tt.cmd.In(), tt.cmd.Out())
+		}
+	}
+}
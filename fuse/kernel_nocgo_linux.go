@@ -0,0 +1,1315 @@
+//go:build linux && (!cgo || nocgo)
+// +build linux
+// +build !cgo nocgo
+
+/*
+ * kernel_nocgo_linux.go
+ *
+ * Copyright 2017-2022 Bill Zissimopoulos
+ */
+/*
+ * This file is part of Cgofuse.
+ *
+ * It is licensed under the MIT license. The full license text can be found
+ * in the License.txt file at the root of this project.
+ */
+
+package fuse
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+/*
+ * FUSE kernel protocol
+ *
+ * The kernel sends file system requests to the FUSE device (/dev/fuse). Every request
+ * is a fuse_in_header followed by an argument that depends on the opcode; every reply
+ * is a fuse_out_header followed by a result that depends on the opcode. The constants
+ * and structures below are those of the kernel interface header <linux/fuse.h>.
+ *
+ * A kernelConn reads requests from the device with a pool of worker threads and passes
+ * them to a kernelHandler, which decodes them, calls the file system and replies. The
+ * path based handler of FileSystemHost is in pathfs_nocgo_linux.go; the inode based
+ * handler of LowLevelHost is in host_nocgo_linux.go.
+ */
+
+const (
+	kernelMajor    = 7
+	kernelMinor    = 31 // Linux 5.4
+	kernelMinMinor = 12 // Linux 2.6.31
+	kernelMaxWrite = 1 << 20
+	kernelHeadroom = 4096 // room for the request header and argument of a WRITE
+	kernelThreads  = 10
+
+	fuse_ROOT_ID     = 1
+	fuse_UNKNOWN_INO = 0xffffffff
+)
+
+// opcodes
+const (
+	fuse_LOOKUP          = 1
+	fuse_FORGET          = 2
+	fuse_GETATTR         = 3
+	fuse_SETATTR         = 4
+	fuse_READLINK        = 5
+	fuse_SYMLINK         = 6
+	fuse_MKNOD           = 8
+	fuse_MKDIR           = 9
+	fuse_UNLINK          = 10
+	fuse_RMDIR           = 11
+	fuse_RENAME          = 12
+	fuse_LINK            = 13
+	fuse_OPEN            = 14
+	fuse_READ            = 15
+	fuse_WRITE           = 16
+	fuse_STATFS          = 17
+	fuse_RELEASE         = 18
+	fuse_FSYNC           = 20
+	fuse_SETXATTR        = 21
+	fuse_GETXATTR        = 22
+	fuse_LISTXATTR       = 23
+	fuse_REMOVEXATTR     = 24
+	fuse_FLUSH           = 25
+	fuse_INIT            = 26
+	fuse_OPENDIR         = 27
+	fuse_READDIR         = 28
+	fuse_RELEASEDIR      = 29
+	fuse_FSYNCDIR        = 30
+	fuse_GETLK           = 31
+	fuse_SETLK           = 32
+	fuse_SETLKW          = 33
+	fuse_ACCESS          = 34
+	fuse_CREATE          = 35
+	fuse_INTERRUPT       = 36
+	fuse_BMAP            = 37
+	fuse_DESTROY         = 38
+	fuse_IOCTL           = 39
+	fuse_POLL            = 40
+	fuse_NOTIFY_REPLY    = 41
+	fuse_BATCH_FORGET    = 42
+	fuse_FALLOCATE       = 43
+	fuse_READDIRPLUS     = 44
+	fuse_RENAME2         = 45
+	fuse_LSEEK           = 46
+	fuse_COPY_FILE_RANGE = 47
+)
+
+// notification codes
+const (
+	fuse_NOTIFY_POLL        = 1
+	fuse_NOTIFY_INVAL_INODE = 2
+	fuse_NOTIFY_INVAL_ENTRY = 3
+)
+
+// INIT flags
+const (
+	fuse_ASYNC_READ          = 1 << 0
+	fuse_POSIX_LOCKS         = 1 << 1
+	fuse_ATOMIC_O_TRUNC      = 1 << 3
+	fuse_EXPORT_SUPPORT      = 1 << 4
+	fuse_BIG_WRITES          = 1 << 5
+	fuse_DONT_MASK           = 1 << 6
+	fuse_FLOCK_LOCKS         = 1 << 10
+	fuse_HAS_IOCTL_DIR       = 1 << 11
+	fuse_AUTO_INVAL_DATA     = 1 << 12
+	fuse_DO_READDIRPLUS      = 1 << 13
+	fuse_READDIRPLUS_AUTO    = 1 << 14
+	fuse_ASYNC_DIO           = 1 << 15
+	fuse_WRITEBACK_CACHE     = 1 << 16
+	fuse_NO_OPEN_SUPPORT     = 1 << 17
+	fuse_PARALLEL_DIROPS     = 1 << 18
+	fuse_HANDLE_KILLPRIV     = 1 << 19
+	fuse_POSIX_ACL           = 1 << 20
+	fuse_MAX_PAGES           = 1 << 22
+	fuse_CACHE_SYMLINKS      = 1 << 23
+	fuse_NO_OPENDIR_SUPPORT  = 1 << 24
+	fuse_EXPLICIT_INVAL_DATA = 1 << 25
+)
+
+// kernelCaps maps INIT flags to ConnInfo capabilities. Most capabilities have the value
+// of their flag, but not all of them.
+var kernelCaps = [...]struct {
+	flag uint32
+	cap  uint32
+}{
+	{fuse_ASYNC_READ, CAP_ASYNC_READ},
+	{fuse_POSIX_LOCKS, CAP_POSIX_LOCKS},
+	{fuse_ATOMIC_O_TRUNC, CAP_ATOMIC_O_TRUNC},
+	{fuse_EXPORT_SUPPORT, CAP_EXPORT_SUPPORT},
+	{fuse_DONT_MASK, CAP_DONT_MASK},
+	{fuse_FLOCK_LOCKS, CAP_FLOCK_LOCKS},
+	{fuse_HAS_IOCTL_DIR, CAP_IOCTL_DIR},
+	{fuse_AUTO_INVAL_DATA, CAP_AUTO_INVAL_DATA},
+	{fuse_DO_READDIRPLUS, CAP_READDIRPLUS},
+	{fuse_READDIRPLUS_AUTO, CAP_READDIRPLUS_AUTO},
+	{fuse_ASYNC_DIO, CAP_ASYNC_DIO},
+	{fuse_WRITEBACK_CACHE, CAP_WRITEBACK_CACHE},
+	{fuse_NO_OPEN_SUPPORT, CAP_NO_OPEN_SUPPORT},
+	{fuse_PARALLEL_DIROPS, CAP_PARALLEL_DIROPS},
+	{fuse_HANDLE_KILLPRIV, CAP_HANDLE_KILLPRIV},
+	{fuse_POSIX_ACL, CAP_POSIX_ACL},
+	{fuse_CACHE_SYMLINKS, CAP_CACHE_SYMLINKS},
+	{fuse_NO_OPENDIR_SUPPORT, CAP_NO_OPENDIR_SUPPORT},
+	{fuse_EXPLICIT_INVAL_DATA, CAP_EXPLICIT_INVAL_DATA},
+}
+
+// capabilities that are enabled unless the file system disables them in Init
+const kernelDefaultCaps = CAP_ASYNC_READ | CAP_AUTO_INVAL_DATA | CAP_ASYNC_DIO |
+	CAP_PARALLEL_DIROPS | CAP_IOCTL_DIR | CAP_READDIRPLUS_AUTO | CAP_HANDLE_KILLPRIV
+
+// SETATTR valid bits
+const (
+	fattr_MODE      = 1 << 0
+	fattr_UID       = 1 << 1
+	fattr_GID       = 1 << 2
+	fattr_SIZE      = 1 << 3
+	fattr_ATIME     = 1 << 4
+	fattr_MTIME     = 1 << 5
+	fattr_FH        = 1 << 6
+	fattr_ATIME_NOW = 1 << 7
+	fattr_MTIME_NOW = 1 << 8
+	fattr_LOCKOWNER = 1 << 9
+	fattr_CTIME     = 1 << 10
+)
+
+// miscellaneous flags
+const (
+	fopen_DIRECT_IO   = 1 << 0
+	fopen_KEEP_CACHE  = 1 << 1
+	fopen_NONSEEKABLE = 1 << 2
+	fopen_CACHE_DIR   = 1 << 3
+
+	fuse_GETATTR_FH           = 1 << 0
+	fuse_RELEASE_FLUSH        = 1 << 0
+	fuse_RELEASE_FLOCK_UNLOCK = 1 << 1
+	fuse_LK_FLOCK             = 1 << 0
+	fuse_POLL_SCHEDULE_NOTIFY = 1 << 0
+	fuse_FSYNC_FDATASYNC      = 1 << 0
+	fuse_IOCTL_UNRESTRICTED   = 1 << 1
+	fuse_IOCTL_DIR            = 1 << 4
+)
+
+type fuse_attr struct {
+	ino       uint64
+	size      uint64
+	blocks    uint64
+	atime     uint64
+	mtime     uint64
+	ctime     uint64
+	atimensec uint32
+	mtimensec uint32
+	ctimensec uint32
+	mode      uint32
+	nlink     uint32
+	uid       uint32
+	gid       uint32
+	rdev      uint32
+	blksize   uint32
+	padding   uint32
+}
+
+type fuse_kstatfs struct {
+	blocks  uint64
+	bfree   uint64
+	bavail  uint64
+	files   uint64
+	ffree   uint64
+	bsize   uint32
+	namelen uint32
+	frsize  uint32
+	padding uint32
+	spare   [6]uint32
+}
+
+type fuse_file_lock struct {
+	start uint64
+	end   uint64
+	typ   uint32
+	pid   uint32
+}
+
+type fuse_in_header struct {
+	len     uint32
+	opcode  uint32
+	unique  uint64
+	nodeid  uint64
+	uid     uint32
+	gid     uint32
+	pid     uint32
+	padding uint32
+}
+
+type fuse_out_header struct {
+	len    uint32
+	error  int32
+	unique uint64
+}
+
+type fuse_entry_out struct {
+	nodeid           uint64
+	generation       uint64
+	entry_valid      uint64
+	attr_valid       uint64
+	entry_valid_nsec uint32
+	attr_valid_nsec  uint32
+	attr             fuse_attr
+}
+
+type fuse_forget_in struct {
+	nlookup uint64
+}
+
+type fuse_forget_one struct {
+	nodeid  uint64
+	nlookup uint64
+}
+
+type fuse_batch_forget_in struct {
+	count uint32
+	dummy uint32
+}
+
+type fuse_getattr_in struct {
+	getattr_flags uint32
+	dummy         uint32
+	fh            uint64
+}
+
+type fuse_attr_out struct {
+	attr_valid      uint64
+	attr_valid_nsec uint32
+	dummy           uint32
+	attr            fuse_attr
+}
+
+type fuse_mknod_in struct {
+	mode    uint32
+	rdev    uint32
+	umask   uint32
+	padding uint32
+}
+
+type fuse_mkdir_in struct {
+	mode  uint32
+	umask uint32
+}
+
+type fuse_rename_in struct {
+	newdir uint64
+}
+
+type fuse_rename2_in struct {
+	newdir  uint64
+	flags   uint32
+	padding uint32
+}
+
+type fuse_link_in struct {
+	oldnodeid uint64
+}
+
+type fuse_setattr_in struct {
+	valid     uint32
+	padding   uint32
+	fh        uint64
+	size      uint64
+	lock_own  uint64
+	atime     uint64
+	mtime     uint64
+	ctime     uint64
+	atimensec uint32
+	mtimensec uint32
+	ctimensec uint32
+	mode      uint32
+	unused4   uint32
+	uid       uint32
+	gid       uint32
+	unused5   uint32
+}
+
+type fuse_open_in struct {
+	flags  uint32
+	unused uint32
+}
+
+type fuse_create_in struct {
+	flags   uint32
+	mode    uint32
+	umask   uint32
+	padding uint32
+}
+
+type fuse_open_out struct {
+	fh         uint64
+	open_flags uint32
+	padding    uint32
+}
+
+type fuse_release_in struct {
+	fh            uint64
+	flags         uint32
+	release_flags uint32
+	lock_owner    uint64
+}
+
+type fuse_flush_in struct {
+	fh         uint64
+	unused     uint32
+	padding    uint32
+	lock_owner uint64
+}
+
+type fuse_read_in struct {
+	fh         uint64
+	offset     uint64
+	size       uint32
+	read_flags uint32
+	lock_owner uint64
+	flags      uint32
+	padding    uint32
+}
+
+type fuse_write_in struct {
+	fh          uint64
+	offset      uint64
+	size        uint32
+	write_flags uint32
+	lock_owner  uint64
+	flags       uint32
+	padding     uint32
+}
+
+type fuse_write_out struct {
+	size    uint32
+	padding uint32
+}
+
+type fuse_fsync_in struct {
+	fh          uint64
+	fsync_flags uint32
+	padding     uint32
+}
+
+type fuse_setxattr_in struct {
+	size  uint32
+	flags uint32
+}
+
+type fuse_getxattr_in struct {
+	size    uint32
+	padding uint32
+}
+
+type fuse_getxattr_out struct {
+	size    uint32
+	padding uint32
+}
+
+type fuse_lk_in struct {
+	fh       uint64
+	owner    uint64
+	lk       fuse_file_lock
+	lk_flags uint32
+	padding  uint32
+}
+
+type fuse_lk_out struct {
+	lk fuse_file_lock
+}
+
+type fuse_access_in struct {
+	mask    uint32
+	padding uint32
+}
+
+type fuse_init_in struct {
+	major         uint32
+	minor         uint32
+	max_readahead uint32
+	flags         uint32
+}
+
+type fuse_init_out struct {
+	major                uint32
+	minor                uint32
+	max_readahead        uint32
+	flags                uint32
+	max_background       uint16
+	congestion_threshold uint16
+	max_write            uint32
+	time_gran            uint32
+	max_pages            uint16
+	map_alignment        uint16
+	unused               [8]uint32
+}
+
+type fuse_interrupt_in struct {
+	unique uint64
+}
+
+type fuse_ioctl_in struct {
+	fh       uint64
+	flags    uint32
+	cmd      uint32
+	arg      uint64
+	in_size  uint32
+	out_size uint32
+}
+
+type fuse_ioctl_out struct {
+	result   int32
+	flags    uint32
+	in_iovs  uint32
+	out_iovs uint32
+}
+
+type fuse_poll_in struct {
+	fh     uint64
+	kh     uint64
+	flags  uint32
+	events uint32
+}
+
+type fuse_poll_out struct {
+	revents uint32
+	padding uint32
+}
+
+type fuse_notify_poll_wakeup_out struct {
+	kh uint64
+}
+
+type fuse_fallocate_in struct {
+	fh      uint64
+	offset  uint64
+	length  uint64
+	mode    uint32
+	padding uint32
+}
+
+type fuse_dirent struct {
+	ino     uint64
+	off     uint64
+	namelen uint32
+	typ     uint32
+}
+
+type fuse_direntplus struct {
+	entry_out fuse_entry_out
+	dirent    fuse_dirent
+}
+
+type fuse_notify_inval_inode_out struct {
+	ino uint64
+	off int64
+	len int64
+}
+
+type fuse_notify_inval_entry_out struct {
+	parent  uint64
+	namelen uint32
+	padding uint32
+}
+
+type fuse_lseek_in struct {
+	fh      uint64
+	offset  uint64
+	whence  uint32
+	padding uint32
+}
+
+type fuse_lseek_out struct {
+	offset uint64
+}
+
+type fuse_copy_file_range_in struct {
+	fh_in      uint64
+	off_in     uint64
+	nodeid_out uint64
+	fh_out     uint64
+	off_out    uint64
+	len        uint64
+	flags      uint64
+}
+
+// kernelArg returns the argument of type T at the start of in and the bytes that follow
+// it, or nil if in is too short.
+func kernelArg[T any](in []byte) (*T, []byte) {
+	var arg T
+	size := int(unsafe.Sizeof(arg))
+	if len(in) < size {
+		return nil, nil
+	}
+	if 0 == size {
+		return &arg, in
+	}
+	// the argument may not be aligned, so copy it
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(&arg)), size), in)
+	return &arg, in[size:]
+}
+
+// kernelBytes returns the memory of *p as a byte slice.
+func kernelBytes[T any](p *T) []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(p)), unsafe.Sizeof(*p))
+}
+
+// kernelString returns the NUL terminated string at the start of in and the bytes that
+// follow it.
+func kernelString(in []byte) (string, []byte) {
+	for i, c := range in {
+		if 0 == c {
+			return string(in[:i]), in[i+1:]
+		}
+	}
+	return string(in), nil
+}
+
+/*
+ * Connection
+ */
+
+// kernelHandler handles the requests of a kernelConn.
+type kernelHandler interface {
+	// init is called with the capabilities of the kernel before any other request; the
+	// handler may change the wanted capabilities and limits.
+	init(conn *struct_fuse_conn_info)
+
+	// destroy is called when the file system is unmounted.
+	destroy()
+
+	// serve handles a request and replies to it (unless it is a FORGET). It is called
+	// concurrently by the worker threads.
+	serve(req *kernelReq)
+}
+
+// kernelConn is a connection to the kernel through an open FUSE device.
+type kernelConn struct {
+	fd      int
+	handler kernelHandler
+	debug   bool
+
+	// context of the requests of this connection (see c_fuse_get_context)
+	fuse    *c_struct_fuse
+	private unsafe.Pointer
+
+	// with allow_root only root and the owner of the file system may access it
+	allowRoot bool
+	owner     uint32
+
+	minor    uint32 // negotiated protocol minor version
+	maxWrite uint32
+	bufsize  int
+	inited   int32
+	ended    int32
+
+	guard     sync.Mutex
+	pending   map[uint64]*kernelReq // requests that may be interrupted
+	destroyed bool
+
+	threads    int32
+	idle       int32
+	maxThreads int32
+	wgroup     sync.WaitGroup
+	errc       int32
+}
+
+// kernelReq is a request received from the kernel.
+type kernelReq struct {
+	conn    *kernelConn
+	worker  *kernelWorker
+	hdr     fuse_in_header
+	in      []byte // argument that follows the header
+	umask   uint32
+	intr    int32
+	replied bool
+}
+
+// kernelWorker is a worker thread. While a worker serves a request it provides the
+// context that c_fuse_get_context returns on its thread.
+type kernelWorker struct {
+	ctx struct_fuse_context
+	req *kernelReq
+}
+
+// kernelWorkers maps thread ids to the kernelWorkers that run on them.
+var kernelWorkers sync.Map
+
+// kernelCurrent returns the worker of the calling thread or nil.
+func kernelCurrent() *kernelWorker {
+	if w, ok := kernelWorkers.Load(syscall.Gettid()); ok {
+		return w.(*kernelWorker)
+	}
+	return nil
+}
+
+func newKernelConn(fd int, handler kernelHandler, debug bool) *kernelConn {
+	return &kernelConn{
+		fd:         fd,
+		handler:    handler,
+		debug:      debug,
+		minor:      kernelMinor,
+		maxWrite:   kernelMaxWrite,
+		bufsize:    kernelMaxWrite + kernelHeadroom,
+		pending:    map[uint64]*kernelReq{},
+		maxThreads: kernelThreads,
+		owner:      uint32(os.Getuid()),
+	}
+}
+
+// kernelBufs is a pool of buffers for replies of up to kernelMaxWrite bytes.
+var kernelBufs = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, kernelMaxWrite)
+		return &b
+	},
+}
+
+// kernelGetBuf returns a buffer of at least size bytes; kernelPutBuf returns it to the
+// pool.
+func kernelGetBuf(size int) *[]byte {
+	if kernelMaxWrite < size {
+		b := make([]byte, size)
+		return &b
+	}
+	return kernelBufs.Get().(*[]byte)
+}
+func kernelPutBuf(b *[]byte) {
+	if kernelMaxWrite == len(*b) {
+		kernelBufs.Put(b)
+	}
+}
+
+// serve processes requests until the file system is unmounted. It returns 0 on success
+// or a negative error code. If single is true requests are processed one at a time.
+func (conn *kernelConn) serve(single bool) int {
+	if single {
+		conn.maxThreads = 1
+	}
+	conn.threads = 1
+	conn.idle = 1
+	conn.wgroup.Add(1)
+	go conn.worker()
+	conn.wgroup.Wait()
+
+	conn.guard.Lock()
+	destroy := 0 != conn.inited && !conn.destroyed
+	conn.destroyed = true
+	conn.guard.Unlock()
+	if destroy {
+		// only fuseblk file systems get a DESTROY request when they are unmounted
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		tid := syscall.Gettid()
+		w := &kernelWorker{}
+		w.ctx.fuse = conn.fuse
+		w.ctx.private_data = conn.private
+		kernelWorkers.Store(tid, w)
+		defer kernelWorkers.Delete(tid)
+		conn.handler.destroy()
+	}
+	return int(atomic.LoadInt32(&conn.errc))
+}
+
+// close closes the FUSE device.
+func (conn *kernelConn) close() {
+	if -1 != conn.fd {
+		syscall.Close(conn.fd)
+		conn.fd = -1
+	}
+}
+
+func (conn *kernelConn) worker() {
+	defer conn.wgroup.Done()
+
+	// The FUSE context of an operation belongs to the thread that serves it.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	tid := syscall.Gettid()
+	w := &kernelWorker{}
+	w.ctx.fuse = conn.fuse
+	w.ctx.private_data = conn.private
+	kernelWorkers.Store(tid, w)
+	defer kernelWorkers.Delete(tid)
+
+	// Requests are read into memory that is not managed by Go, because WRITE data is
+	// passed to the file system in bufvecs, which are not scanned by the collector.
+	buf := memMap(conn.bufsize)
+	if nil == buf {
+		conn.end(-ENOMEM)
+		return
+	}
+	defer syscall.Munmap(buf)
+	for {
+		n := conn.read(buf)
+		if 0 > n {
+			return
+		}
+		if 0 == atomic.AddInt32(&conn.idle, -1) &&
+			atomic.LoadInt32(&conn.threads) < conn.maxThreads {
+			// every thread is busy; start another one
+			atomic.AddInt32(&conn.threads, 1)
+			atomic.AddInt32(&conn.idle, 1)
+			conn.wgroup.Add(1)
+			go conn.worker()
+		}
+		conn.process(w, buf[:n])
+		atomic.AddInt32(&conn.idle, 1)
+	}
+}
+
+// read reads the next request into buf. It returns the size of the request or -1 when
+// the connection has ended.
+func (conn *kernelConn) read(buf []byte) int {
+	for {
+		if 0 != atomic.LoadInt32(&conn.ended) {
+			return -1
+		}
+		n, err := syscall.Read(conn.fd, buf)
+		switch err {
+		case nil:
+			if int(unsafe.Sizeof(fuse_in_header{})) > n {
+				fmt.Fprintf(os.Stderr, "fuse: short read on fuse device\n")
+				conn.end(-EIO)
+				return -1
+			}
+			return n
+		case syscall.EINTR, syscall.EAGAIN, syscall.ENOENT:
+			// ENOENT: the request was interrupted before we could read it
+			continue
+		case syscall.ENODEV:
+			// the file system has been unmounted
+			conn.end(0)
+			return -1
+		default:
+			fmt.Fprintf(os.Stderr, "fuse: reading device: %s\n", err.Error())
+			conn.end(-int(err.(syscall.Errno)))
+			return -1
+		}
+	}
+}
+
+// end ends the connection with the error code errc.
+func (conn *kernelConn) end(errc int) {
+	if atomic.CompareAndSwapInt32(&conn.ended, 0, 1) {
+		atomic.StoreInt32(&conn.errc, int32(errc))
+	}
+}
+
+func (conn *kernelConn) process(w *kernelWorker, msg []byte) {
+	req := &kernelReq{conn: conn, worker: w}
+	req.hdr = *(*fuse_in_header)(unsafe.Pointer(&msg[0]))
+	req.in = msg[unsafe.Sizeof(req.hdr):]
+	if int(req.hdr.len) != len(msg) {
+		fmt.Fprintf(os.Stderr, "fuse: bad request length %d (read %d)\n", req.hdr.len, len(msg))
+		req.replyErr(-EIO)
+		return
+	}
+	if conn.debug {
+		fmt.Fprintf(os.Stderr, "fuse: request %d: opcode=%d nodeid=%d len=%d pid=%d\n",
+			req.hdr.unique, req.hdr.opcode, req.hdr.nodeid, req.hdr.len, req.hdr.pid)
+	}
+
+	switch req.hdr.opcode {
+	case fuse_INIT:
+		conn.init(w, req)
+		return
+	case fuse_INTERRUPT:
+		conn.interrupt(req)
+		return
+	}
+
+	if 0 == atomic.LoadInt32(&conn.inited) {
+		req.replyErr(-EIO)
+		return
+	}
+	if conn.allowRoot && 0 != req.hdr.uid && conn.owner != req.hdr.uid &&
+		!kernelHandleOp(req.hdr.opcode) {
+		req.replyErr(-EACCES)
+		return
+	}
+
+	switch req.hdr.opcode {
+	case fuse_DESTROY:
+		conn.guard.Lock()
+		destroy := !conn.destroyed
+		conn.destroyed = true
+		conn.guard.Unlock()
+		if destroy {
+			conn.handler.destroy()
+		}
+		req.replyErr(0)
+	case fuse_FORGET, fuse_BATCH_FORGET:
+		conn.handler.serve(req)
+	case fuse_NOTIFY_REPLY:
+		// we do not retrieve data from the kernel cache
+	default:
+		conn.guard.Lock()
+		conn.pending[req.hdr.unique] = req
+		conn.guard.Unlock()
+		w.ctx.uid = req.hdr.uid
+		w.ctx.gid = req.hdr.gid
+		w.ctx.pid = int32(req.hdr.pid)
+		w.ctx.umask = 0
+		w.req = req
+		defer func() {
+			w.req = nil
+			conn.guard.Lock()
+			delete(conn.pending, req.hdr.unique)
+			conn.guard.Unlock()
+			if !req.replied {
+				req.replyErr(-EIO)
+			}
+		}()
+		conn.handler.serve(req)
+	}
+}
+
+// kernelHandleOp reports whether opcode is an operation on an open file or on the
+// connection, which is allowed to everyone that could open the file.
+func kernelHandleOp(opcode uint32) bool {
+	switch opcode {
+	case fuse_READ, fuse_WRITE, fuse_FSYNC, fuse_RELEASE, fuse_READDIR, fuse_READDIRPLUS,
+		fuse_FSYNCDIR, fuse_RELEASEDIR, fuse_FLUSH, fuse_GETLK, fuse_SETLK, fuse_SETLKW,
+		fuse_LSEEK, fuse_POLL, fuse_FORGET, fuse_BATCH_FORGET, fuse_DESTROY:
+		return true
+	}
+	return false
+}
+
+func (conn *kernelConn) init(w *kernelWorker, req *kernelReq) {
+	in, _ := kernelArg[fuse_init_in](req.in)
+	if nil == in {
+		req.replyErr(-EINVAL)
+		return
+	}
+	if kernelMajor < in.major {
+		// we only speak major version 7; the kernel will repeat INIT with it
+		out := fuse_init_out{major: kernelMajor, minor: kernelMinor}
+		req.reply(0, kernelBytes(&out)[:8])
+		return
+	}
+	if kernelMajor > in.major || kernelMinMinor > in.minor {
+		fmt.Fprintf(os.Stderr, "fuse: unsupported protocol version: %d.%d\n", in.major, in.minor)
+		req.replyErr(-EPROTO)
+		conn.end(-EPROTO)
+		return
+	}
+	if kernelMinor > in.minor {
+		conn.minor = in.minor
+	}
+
+	ci := struct_fuse_conn_info{
+		proto_major:   in.major,
+		proto_minor:   in.minor,
+		max_write:     conn.maxWrite,
+		max_readahead: in.max_readahead,
+		time_gran:     1,
+	}
+	for _, c := range kernelCaps {
+		if 0 != in.flags&c.flag {
+			ci.capable |= c.cap
+		}
+	}
+	ci.want = ci.capable & kernelDefaultCaps
+
+	w.ctx.pid = 0
+	w.ctx.uid = req.hdr.uid
+	w.ctx.gid = req.hdr.gid
+	conn.handler.init(&ci)
+
+	out := fuse_init_out{
+		major:         kernelMajor,
+		minor:         kernelMinor,
+		max_readahead: ci.max_readahead,
+		max_write:     ci.max_write,
+		time_gran:     ci.time_gran,
+	}
+	for _, c := range kernelCaps {
+		if 0 != ci.want&ci.capable&c.cap {
+			out.flags |= c.flag
+		}
+	}
+	out.flags |= in.flags & fuse_BIG_WRITES
+	if in.max_readahead < out.max_readahead {
+		out.max_readahead = in.max_readahead
+	}
+	if conn.maxWrite < out.max_write || 0 == out.max_write {
+		out.max_write = conn.maxWrite
+	}
+	if 4096 > out.max_write {
+		out.max_write = 4096
+	}
+	conn.maxWrite = out.max_write
+	if 0 != in.flags&fuse_MAX_PAGES {
+		pagesize := uint32(os.Getpagesize())
+		out.flags |= fuse_MAX_PAGES
+		out.max_pages = uint16((out.max_write + pagesize - 1) / pagesize)
+	}
+	if 0xffff >= ci.max_background {
+		out.max_background = uint16(ci.max_background)
+	}
+	if 0xffff >= ci.congestion_threshold {
+		out.congestion_threshold = uint16(ci.congestion_threshold)
+	}
+
+	atomic.StoreInt32(&conn.inited, 1)
+	b := kernelBytes(&out)
+	if 23 > in.minor {
+		b = b[:24] // size of fuse_init_out before 7.23
+	}
+	req.reply(0, b)
+}
+
+func (conn *kernelConn) interrupt(req *kernelReq) {
+	in, _ := kernelArg[fuse_interrupt_in](req.in)
+	if nil == in {
+		return
+	}
+	conn.guard.Lock()
+	target := conn.pending[in.unique]
+	conn.guard.Unlock()
+	if nil != target {
+		atomic.StoreInt32(&target.intr, 1)
+		return
+	}
+	// We may not have seen the request yet; EAGAIN tells the kernel to send the
+	// interrupt again if the request is still pending.
+	req.replyErr(-EAGAIN)
+}
+
+// write writes a message to the FUSE device.
+func (conn *kernelConn) write(parts [][]byte) int {
+	var iov [8]syscall.Iovec
+	n := 0
+	for _, p := range parts {
+		if 0 < len(p) {
+			iov[n].Base = &p[0]
+			iov[n].SetLen(len(p))
+			n++
+		}
+	}
+	_, _, e := syscall.Syscall(syscall.SYS_WRITEV,
+		uintptr(conn.fd), uintptr(unsafe.Pointer(&iov[0])), uintptr(n))
+	runtime.KeepAlive(parts)
+	if 0 != e {
+		return -int(e)
+	}
+	return 0
+}
+
+/*
+ * Replies
+ */
+
+// setUmask sets the umask of the request, which the kernel sends with MKNOD, MKDIR and
+// CREATE.
+func (req *kernelReq) setUmask(umask uint32) {
+	req.umask = umask
+	if nil != req.worker {
+		req.worker.ctx.umask = umask
+	}
+}
+
+// interrupted reports whether the kernel has interrupted the request.
+func (req *kernelReq) interrupted() bool {
+	return 0 != atomic.LoadInt32(&req.intr)
+}
+
+// reply replies to the request with the error code errc (0 or negative) and the
+// concatenation of parts. It returns 0 or a negative error code.
+func (req *kernelReq) reply(errc int, parts ...[]byte) int {
+	if req.replied {
+		return -EINVAL
+	}
+	req.replied = true
+	if 0 < errc || -4096 >= errc {
+		errc = -ERANGE
+	}
+	var msg [8][]byte
+	out := fuse_out_header{error: int32(errc), unique: req.hdr.unique}
+	msg[0] = kernelBytes(&out)
+	n := 1
+	if 0 == errc {
+		n += copy(msg[1:], parts)
+	}
+	for _, p := range msg[:n] {
+		out.len += uint32(len(p))
+	}
+	if req.conn.debug {
+		fmt.Fprintf(os.Stderr, "fuse: reply %d: error=%d len=%d\n", out.unique, errc, out.len)
+	}
+	res := req.conn.write(msg[:n])
+	if 0 != res && -ENOENT != res && 0 == atomic.LoadInt32(&req.conn.ended) {
+		// ENOENT: the request was interrupted and the kernel no longer waits for it
+		fmt.Fprintf(os.Stderr, "fuse: writing device: %s\n", syscall.Errno(-res).Error())
+	}
+	return res
+}
+
+func (req *kernelReq) replyErr(errc int) int {
+	return req.reply(errc)
+}
+
+// kernelTimeout converts a timeout in seconds to the seconds and nanoseconds used by the
+// kernel.
+func kernelTimeout(t float64) (uint64, uint32) {
+	if 0 >= t {
+		return 0, 0
+	}
+	if float64(1<<63) <= t {
+		return 1 << 63, 0
+	}
+	sec := uint64(t)
+	nsec := uint64((t - float64(sec)) * 1e9)
+	if 999999999 < nsec {
+		nsec = 999999999
+	}
+	return sec, uint32(nsec)
+}
+
+// kernelAttr converts a stat buffer to a fuse_attr.
+func kernelAttr(attr *fuse_attr, stat *fuse_stat_t) {
+	*attr = fuse_attr{
+		ino:       stat.st_ino,
+		size:      uint64(stat.st_size),
+		blocks:    uint64(stat.st_blocks),
+		atime:     uint64(stat.st_atim.tv_sec),
+		mtime:     uint64(stat.st_mtim.tv_sec),
+		ctime:     uint64(stat.st_ctim.tv_sec),
+		atimensec: uint32(stat.st_atim.tv_nsec),
+		mtimensec: uint32(stat.st_mtim.tv_nsec),
+		ctimensec: uint32(stat.st_ctim.tv_nsec),
+		mode:      stat.st_mode,
+		nlink:     stat.st_nlink,
+		uid:       stat.st_uid,
+		gid:       stat.st_gid,
+		rdev:      uint32(stat.st_rdev),
+		blksize:   uint32(stat.st_blksize),
+	}
+}
+
+// kernelEntry describes a directory entry that is returned by LOOKUP, MKNOD, MKDIR,
+// SYMLINK, LINK, CREATE and READDIRPLUS.
+type kernelEntry struct {
+	ino          uint64
+	generation   uint64
+	attr         fuse_stat_t
+	attrTimeout  float64
+	entryTimeout float64
+}
+
+func (e *kernelEntry) encode(out *fuse_entry_out) {
+	out.nodeid = e.ino
+	out.generation = e.generation
+	out.entry_valid, out.entry_valid_nsec = kernelTimeout(e.entryTimeout)
+	out.attr_valid, out.attr_valid_nsec = kernelTimeout(e.attrTimeout)
+	kernelAttr(&out.attr, &e.attr)
+}
+
+// kernelOpenFlags returns the FOPEN flags that correspond to the fields of fi.
+func kernelOpenFlags(fi *struct_fuse_file_info) uint32 {
+	var flags uint32
+	if fi.direct_io {
+		flags |= fopen_DIRECT_IO
+	}
+	if fi.keep_cache {
+		flags |= fopen_KEEP_CACHE
+	}
+	if fi.nonseekable {
+		flags |= fopen_NONSEEKABLE
+	}
+	if fi.cache_readdir {
+		flags |= fopen_CACHE_DIR
+	}
+	return flags
+}
+
+func (req *kernelReq) replyEntry(e *kernelEntry) int {
+	var out fuse_entry_out
+	e.encode(&out)
+	return req.reply(0, kernelBytes(&out))
+}
+
+func (req *kernelReq) replyCreate(e *kernelEntry, fi *struct_fuse_file_info) int {
+	var out struct {
+		entry fuse_entry_out
+		open  fuse_open_out
+	}
+	e.encode(&out.entry)
+	out.open.fh = fi.fh
+	out.open.open_flags = kernelOpenFlags(fi)
+	return req.reply(0, kernelBytes(&out))
+}
+
+func (req *kernelReq) replyAttr(stat *fuse_stat_t, timeout float64) int {
+	var out fuse_attr_out
+	out.attr_valid, out.attr_valid_nsec = kernelTimeout(timeout)
+	kernelAttr(&out.attr, stat)
+	return req.reply(0, kernelBytes(&out))
+}
+
+func (req *kernelReq) replyOpen(fi *struct_fuse_file_info) int {
+	out := fuse_open_out{fh: fi.fh, open_flags: kernelOpenFlags(fi)}
+	return req.reply(0, kernelBytes(&out))
+}
+
+func (req *kernelReq) replyWrite(size uint32) int {
+	out := fuse_write_out{size: size}
+	return req.reply(0, kernelBytes(&out))
+}
+
+func (req *kernelReq) replyStatfs(stat *fuse_statvfs_t) int {
+	out := fuse_kstatfs{
+		blocks:  stat.f_blocks,
+		bfree:   stat.f_bfree,
+		bavail:  stat.f_bavail,
+		files:   stat.f_files,
+		ffree:   stat.f_ffree,
+		bsize:   uint32(stat.f_bsize),
+		namelen: uint32(stat.f_namemax),
+		frsize:  uint32(stat.f_frsize),
+	}
+	return req.reply(0, kernelBytes(&out))
+}
+
+func (req *kernelReq) replyXattrSize(size uint32) int {
+	out := fuse_getxattr_out{size: size}
+	return req.reply(0, kernelBytes(&out))
+}
+
+func (req *kernelReq) replyLock(lock *fuse_flock_t) int {
+	out := fuse_lk_out{lk: fuse_file_lock{
+		typ: uint32(lock.l_type),
+		pid: uint32(lock.l_pid),
+	}}
+	if F_UNLCK != lock.l_type {
+		out.lk.start = uint64(lock.l_start)
+		out.lk.end = uint64(lock.l_start + lock.l_len - 1)
+		if 0 == lock.l_len {
+			out.lk.end = 1<<63 - 1
+		}
+	}
+	return req.reply(0, kernelBytes(&out))
+}
+
+func (req *kernelReq) replyIoctl(result int32, data []byte) int {
+	out := fuse_ioctl_out{result: result}
+	return req.reply(0, kernelBytes(&out), data)
+}
+
+func (req *kernelReq) replyPoll(revents uint32) int {
+	out := fuse_poll_out{revents: revents}
+	return req.reply(0, kernelBytes(&out))
+}
+
+func (req *kernelReq) replyLseek(ofst int64) int {
+	out := fuse_lseek_out{offset: uint64(ofst)}
+	return req.reply(0, kernelBytes(&out))
+}
+
+// kernelDirent encodes a READDIR entry at the start of buf. It returns the size of the
+// entry, which is encoded only if it fits into buf.
+func kernelDirent(buf []byte, name string, ino uint64, mode uint32, ofst int64) int {
+	head := int(unsafe.Sizeof(fuse_dirent{}))
+	size := (head + len(name) + 7) &^ 7
+	if len(buf) < size {
+		return size
+	}
+	*(*fuse_dirent)(unsafe.Pointer(&buf[0])) = fuse_dirent{
+		ino:     ino,
+		off:     uint64(ofst),
+		namelen: uint32(len(name)),
+		typ:     (mode & syscall.S_IFMT) >> 12,
+	}
+	n := head + copy(buf[head:], name)
+	for ; size > n; n++ {
+		buf[n] = 0
+	}
+	return size
+}
+
+// kernelDirentPlus is similar to kernelDirent, but it encodes a READDIRPLUS entry.
+func kernelDirentPlus(buf []byte, name string, e *kernelEntry, ofst int64) int {
+	head := int(unsafe.Sizeof(fuse_direntplus{}))
+	size := (head + len(name) + 7) &^ 7
+	if len(buf) < size {
+		return size
+	}
+	ent := (*fuse_direntplus)(unsafe.Pointer(&buf[0]))
+	*ent = fuse_direntplus{}
+	e.encode(&ent.entry_out)
+	ent.dirent = fuse_dirent{
+		ino:     e.attr.st_ino,
+		off:     uint64(ofst),
+		namelen: uint32(len(name)),
+		typ:     (e.attr.st_mode & syscall.S_IFMT) >> 12,
+	}
+	n := head + copy(buf[head:], name)
+	for ; size > n; n++ {
+		buf[n] = 0
+	}
+	return size
+}
+
+// kernelSetattr decodes the SETATTR argument.
+func kernelSetattr(in *fuse_setattr_in) (stat fuse_stat_t, valid uint32) {
+	stat.st_mode = in.mode
+	stat.st_uid = in.uid
+	stat.st_gid = in.gid
+	stat.st_size = int64(in.size)
+	stat.st_atim = fuse_timespec_t{int64(in.atime), int64(in.atimensec)}
+	stat.st_mtim = fuse_timespec_t{int64(in.mtime), int64(in.mtimensec)}
+	stat.st_ctim = fuse_timespec_t{int64(in.ctime), int64(in.ctimensec)}
+	valid = in.valid
+	return
+}
+
+/*
+ * Notifications
+ */
+
+// notify sends a notification to the kernel. It returns 0 or a negative error code.
+func (conn *kernelConn) notify(code int32, parts ...[]byte) int {
+	if 0 == atomic.LoadInt32(&conn.inited) || 0 != atomic.LoadInt32(&conn.ended) {
+		return -ENOTCONN
+	}
+	var msg [4][]byte
+	out := fuse_out_header{error: code}
+	msg[0] = kernelBytes(&out)
+	n := 1 + copy(msg[1:], parts)
+	for _, p := range msg[:n] {
+		out.len += uint32(len(p))
+	}
+	return conn.write(msg[:n])
+}
+
+// notifyInvalInode invalidates the attributes of the inode ino and the data that the
+// kernel has cached for the range [ofst, ofst+size).
+func (conn *kernelConn) notifyInvalInode(ino uint64, ofst int64, size int64) int {
+	out := fuse_notify_inval_inode_out{ino: ino, off: ofst, len: size}
+	return conn.notify(fuse_NOTIFY_INVAL_INODE, kernelBytes(&out))
+}
+
+// notifyInvalEntry invalidates the directory entry name of the inode parent.
+func (conn *kernelConn) notifyInvalEntry(parent uint64, name string) int {
+	out := fuse_notify_inval_entry_out{parent: parent, namelen: uint32(len(name))}
+	return conn.notify(fuse_NOTIFY_INVAL_ENTRY, kernelBytes(&out), append([]byte(name), 0))
+}
+
+// kernelPoll identifies a poll request that the file system may wake up later.
+type kernelPoll struct {
+	conn *kernelConn
+	kh   uint64
+}
+
+func (ph *kernelPoll) wakeup() int {
+	out := fuse_notify_poll_wakeup_out{kh: ph.kh}
+	return ph.conn.notify(fuse_NOTIFY_POLL, kernelBytes(&out))
+}
@@ -0,0 +1,258 @@
+/*
+ * lockmgr.go
+ *
+ * Copyright 2017-2022 Bill Zissimopoulos
+ */
+/*
+ * This file is part of Cgofuse.
+ *
+ * It is licensed under the MIT license. The full license text can be found
+ * in the License.txt file at the root of this project.
+ */
+
+package fuse
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// LockManager maintains POSIX record locks in memory. It may be embedded in a file
+// system to implement FileSystemLock, in which case locks are tracked per path.
+// File systems that support hard links or renames of open files should instead call
+// LockKeyContext with a key that identifies the file (e.g. its inode number).
+//
+// The zero value of LockManager is ready for use.
+type LockManager struct {
+	mutex   sync.Mutex
+	wake    chan struct{}
+	locks   map[interface{}][]lockRange
+	waiters map[uint64]lockWaiter
+}
+
+// lockWaiter is the lock that an owner waits for in F_SETLKW.
+type lockWaiter struct {
+	key   interface{}
+	start int64
+	end   int64
+	typ   int16
+}
+
+// lockPollInterval is how often a waiting F_SETLKW checks its context for cancellation.
+// A fuse.Context learns of an interruption only when it is polled (see Context).
+const lockPollInterval = 100 * time.Millisecond
+
+type lockRange struct {
+	start int64 // inclusive
+	end   int64 // exclusive; math.MaxInt64 means until EOF
+	typ   int16
+	owner uint64
+	pid   int
+}
+
+// Lock performs a POSIX record locking operation on the file identified by path.
+// It is the same as LockKey with path as the key; in particular F_SETLKW cannot be
+// interrupted.
+func (self *LockManager) Lock(path string, cmd int, lock *Lock_t, fh uint64) int {
+	return self.LockKey(path, cmd, lock)
+}
+
+// LockKey performs a POSIX record locking operation on the file identified by key.
+// It is the same as LockKeyContext with a context that is never cancelled, so that
+// F_SETLKW waits until the lock is granted or a deadlock is detected, even if the kernel
+// interrupts the operation.
+func (self *LockManager) LockKey(key interface{}, cmd int, lock *Lock_t) int {
+	return self.LockKeyContext(context.Background(), key, cmd, lock)
+}
+
+// LockKeyContext performs a POSIX record locking operation on the file identified by
+// key. The key must be comparable. The semantics are those of FileSystemLock.Lock;
+// in particular F_SETLKW waits until no conflicting lock is held by another owner.
+// F_SETLKW returns -EDEADLK if waiting would deadlock with another waiting owner and
+// -EINTR if ctx is cancelled while waiting. A file system should pass the context
+// returned by fuse.Context, so that F_SETLKW returns when the kernel interrupts it.
+func (self *LockManager) LockKeyContext(ctx context.Context,
+	key interface{}, cmd int, lock *Lock_t) int {
+	if SEEK_SET != lock.Whence || 0 > lock.Start {
+		return -EINVAL
+	}
+	switch lock.Type {
+	case F_RDLCK, F_WRLCK, F_UNLCK:
+	default:
+		return -EINVAL
+	}
+
+	start, end := lock.Start, int64(math.MaxInt64)
+	if 0 < lock.Len {
+		if lock.Len < math.MaxInt64-start {
+			end = start + lock.Len
+		}
+	} else if 0 > lock.Len {
+		end = start
+		start += lock.Len
+		if 0 > start {
+			return -EINVAL
+		}
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if nil == self.locks {
+		self.wake = make(chan struct{})
+		self.locks = make(map[interface{}][]lockRange)
+		self.waiters = make(map[uint64]lockWaiter)
+	}
+
+	switch cmd {
+	case F_GETLK:
+		r := self.conflict(key, start, end, lock.Type, lock.Owner)
+		if nil == r {
+			lock.Type = F_UNLCK
+			return 0
+		}
+		lock.Type = r.typ
+		lock.Whence = SEEK_SET
+		lock.Start = r.start
+		lock.Len = 0
+		if math.MaxInt64 != r.end {
+			lock.Len = r.end - r.start
+		}
+		lock.Pid = r.pid
+		return 0
+	case F_SETLK, F_SETLKW:
+		for nil != self.conflict(key, start, end, lock.Type, lock.Owner) {
+			if F_SETLK == cmd {
+				return -EAGAIN
+			}
+			waiter := lockWaiter{key, start, end, lock.Type}
+			if self.deadlock(lock.Owner, waiter) {
+				return -EDEADLK
+			}
+			if errc := self.wait(ctx, lock.Owner, waiter); 0 != errc {
+				return errc
+			}
+		}
+		self.set(key, start, end, lock.Type, lock.Owner, lock.Pid)
+		close(self.wake)
+		self.wake = make(chan struct{})
+		return 0
+	default:
+		return -EINVAL
+	}
+}
+
+// wait waits until the locks change or ctx is cancelled. It must be called with mutex
+// held, which it releases while waiting.
+func (self *LockManager) wait(ctx context.Context, owner uint64, waiter lockWaiter) int {
+	self.waiters[owner] = waiter
+	defer delete(self.waiters, owner)
+	wake := self.wake
+	self.mutex.Unlock()
+	if done := ctx.Done(); nil == done {
+		<-wake
+	} else {
+		timer := time.NewTimer(lockPollInterval)
+		select {
+		case <-wake:
+		case <-done:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+	err := ctx.Err()
+	self.mutex.Lock()
+	if nil != err {
+		return -EINTR
+	}
+	return 0
+}
+
+// deadlock reports whether owner waiting for waiter would complete a cycle of owners
+// that wait for each other's locks.
+func (self *LockManager) deadlock(owner uint64, waiter lockWaiter) bool {
+	seen := map[uint64]bool{}
+	var visit func(w lockWaiter, o uint64) bool
+	visit = func(w lockWaiter, o uint64) bool {
+		for _, r := range self.locks[w.key] {
+			if o == r.owner || r.end <= w.start || w.end <= r.start ||
+				(F_WRLCK != w.typ && F_WRLCK != r.typ) {
+				continue
+			}
+			if owner == r.owner {
+				return true
+			}
+			if seen[r.owner] {
+				continue
+			}
+			seen[r.owner] = true
+			if next, ok := self.waiters[r.owner]; ok && visit(next, r.owner) {
+				return true
+			}
+		}
+		return false
+	}
+	return visit(waiter, owner)
+}
+
+func (self *LockManager) conflict(key interface{},
+	start int64, end int64, typ int16, owner uint64) *lockRange {
+	if F_UNLCK == typ {
+		return nil
+	}
+	ranges := self.locks[key]
+	for i := range ranges {
+		r := &ranges[i]
+		if owner != r.owner && r.start < end && start < r.end &&
+			(F_WRLCK == typ || F_WRLCK == r.typ) {
+			return r
+		}
+	}
+	return nil
+}
+
+func (self *LockManager) set(key interface{},
+	start int64, end int64, typ int16, owner uint64, pid int) {
+	ranges := self.locks[key]
+	newranges := make([]lockRange, 0, len(ranges)+2)
+	for _, r := range ranges {
+		if owner != r.owner || end <= r.start || r.end <= start {
+			newranges = append(newranges, r)
+			continue
+		}
+		// keep the parts of the owner's range that lie outside the new range
+		if r.start < start {
+			newranges = append(newranges, lockRange{r.start, start, r.typ, owner, r.pid})
+		}
+		if end < r.end {
+			newranges = append(newranges, lockRange{end, r.end, r.typ, owner, r.pid})
+		}
+	}
+
+	if F_UNLCK != typ {
+		// coalesce with adjacent ranges of the same owner and type
+		for i := 0; len(newranges) > i; {
+			r := newranges[i]
+			if owner == r.owner && typ == r.typ && (r.end == start || end == r.start) {
+				if r.start < start {
+					start = r.start
+				}
+				if r.end > end {
+					end = r.end
+				}
+				newranges = append(newranges[:i], newranges[i+1:]...)
+				continue
+			}
+			i++
+		}
+		newranges = append(newranges, lockRange{start, end, typ, owner, pid})
+	}
+
+	if 0 == len(newranges) {
+		delete(self.locks, key)
+	} else {
+		self.locks[key] = newranges
+	}
+}
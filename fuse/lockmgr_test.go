@@ -0,0 +1,151 @@
+/*
+ * lockmgr_test.go
+ *
+ * Copyright 2017-2022 Bill Zissimopoulos
+ */
+/*
+ * This file is part of Cgofuse.
+ *
+ * It is licensed under the MIT license. The full license text can be found
+ * in the License.txt file at the root of this project.
+ */
+
+package fuse
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLockManager(t *testing.T) {
+	var lm LockManager
+
+	lock := func(cmd int, typ int16, start int64, len int64, owner uint64) (int, Lock_t) {
+		l := Lock_t{Type: typ, Whence: SEEK_SET, Start: start, Len: len, Pid: int(owner), Owner: owner}
+		errc := lm.Lock("/file", cmd, &l, ^uint64(0))
+		return errc, l
+	}
+
+	if errc, _ := lock(F_SETLK, F_WRLCK, 0, 100, 1); 0 != errc {
+		t.Error("F_SETLK failed", errc)
+	}
+	if errc, _ := lock(F_SETLK, F_RDLCK, 50, 10, 2); -EAGAIN != errc {
+		t.Error("F_SETLK expected -EAGAIN", errc)
+	}
+	if errc, l := lock(F_GETLK, F_RDLCK, 50, 10, 2); 0 != errc ||
+		F_WRLCK != l.Type || 0 != l.Start || 100 != l.Len || 1 != l.Pid {
+		t.Error("F_GETLK incorrect conflict", errc, l)
+	}
+	if errc, l := lock(F_GETLK, F_WRLCK, 0, 0, 1); 0 != errc || F_UNLCK != l.Type {
+		t.Error("F_GETLK expected no conflict with own lock", errc, l)
+	}
+
+	// punch a hole into owner 1's lock
+	if errc, _ := lock(F_SETLK, F_UNLCK, 40, 20, 1); 0 != errc {
+		t.Error("F_UNLCK failed", errc)
+	}
+	if errc, _ := lock(F_SETLK, F_RDLCK, 45, 10, 2); 0 != errc {
+		t.Error("F_SETLK in unlocked hole failed", errc)
+	}
+	if errc, _ := lock(F_SETLK, F_RDLCK, 60, 10, 3); -EAGAIN != errc {
+		t.Error("F_SETLK expected -EAGAIN", errc)
+	}
+	if errc, _ := lock(F_SETLK, F_RDLCK, 50, 5, 3); 0 != errc {
+		t.Error("F_SETLK of shared lock failed", errc)
+	}
+	if errc, l := lock(F_GETLK, F_WRLCK, 100, 0, 3); 0 != errc || F_UNLCK != l.Type {
+		t.Error("F_GETLK expected no conflict past end of lock", errc, l)
+	}
+
+	done := make(chan int)
+	go func() {
+		errc, _ := lock(F_SETLKW, F_WRLCK, 0, 0, 4)
+		done <- errc
+	}()
+	select {
+	case <-done:
+		t.Error("F_SETLKW did not wait")
+	case <-time.After(100 * time.Millisecond):
+	}
+	lock(F_SETLK, F_UNLCK, 0, 0, 1)
+	lock(F_SETLK, F_UNLCK, 0, 0, 2)
+	lock(F_SETLK, F_UNLCK, 0, 0, 3)
+	select {
+	case errc := <-done:
+		if 0 != errc {
+			t.Error("F_SETLKW failed", errc)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("F_SETLKW did not complete")
+	}
+
+	if errc, l := lock(F_GETLK, F_RDLCK, 1000, 1, 1); 0 != errc ||
+		F_WRLCK != l.Type || 0 != l.Start || 0 != l.Len || 4 != l.Pid {
+		t.Error("F_GETLK incorrect conflict", errc, l)
+	}
+	if errc, _ := lock(F_SETLK, F_RDLCK, 0, 0, 1); -EAGAIN != errc {
+		t.Error("F_SETLK expected -EAGAIN", errc)
+	}
+	if errc, _ := lock(F_SETLK, F_RDLCK, 0, 0, 4); 0 != errc {
+		t.Error("F_SETLK lock conversion failed", errc)
+	}
+	if errc, _ := lock(F_SETLK, F_RDLCK, 0, 0, 1); 0 != errc {
+		t.Error("F_SETLK of shared lock failed", errc)
+	}
+}
+
+func TestLockManagerWait(t *testing.T) {
+	var lm LockManager
+
+	lock := func(ctx context.Context, cmd int, typ int16, start int64, owner uint64) int {
+		l := Lock_t{Type: typ, Whence: SEEK_SET, Start: start, Len: 1, Pid: int(owner), Owner: owner}
+		return lm.LockKeyContext(ctx, "/file", cmd, &l)
+	}
+	bg := context.Background()
+
+	if errc := lock(bg, F_SETLK, F_WRLCK, 0, 1); 0 != errc {
+		t.Error("F_SETLK failed", errc)
+	}
+	if errc := lock(bg, F_SETLK, F_WRLCK, 1, 2); 0 != errc {
+		t.Error("F_SETLK failed", errc)
+	}
+
+	// owner 1 waits for owner 2; owner 2 waiting for owner 1 would deadlock
+	done := make(chan int)
+	go func() {
+		done <- lock(bg, F_SETLKW, F_WRLCK, 1, 1)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if errc := lock(bg, F_SETLKW, F_WRLCK, 0, 2); -EDEADLK != errc {
+		t.Error("F_SETLKW expected -EDEADLK", errc)
+	}
+	lock(bg, F_SETLK, F_UNLCK, 1, 2)
+	select {
+	case errc := <-done:
+		if 0 != errc {
+			t.Error("F_SETLKW failed", errc)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("F_SETLKW did not complete")
+	}
+
+	// a cancelled context interrupts F_SETLKW
+	ctx, cancel := context.WithCancel(bg)
+	go func() {
+		done <- lock(ctx, F_SETLKW, F_WRLCK, 0, 3)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case errc := <-done:
+		if -EINTR != errc {
+			t.Error("F_SETLKW expected -EINTR", errc)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("F_SETLKW was not interrupted")
+	}
+	if errc := lock(bg, F_SETLK, F_WRLCK, 0, 4); -EAGAIN != errc {
+		t.Error("F_SETLK expected -EAGAIN", errc)
+	}
+}
@@ -0,0 +1,1196 @@
+/*
+ * lowlevel.go
+ *
+ * Copyright 2017-2022 Bill Zissimopoulos
+ */
+/*
+ * This file is part of Cgofuse.
+ *
+ * It is licensed under the MIT license. The full license text can be found
+ * in the License.txt file at the root of this project.
+ */
+
+package fuse
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// Attributes to set in LowLevelFileSystem.Setattr.
+const (
+	SET_ATTR_MODE      = 1 << 0
+	SET_ATTR_UID       = 1 << 1
+	SET_ATTR_GID       = 1 << 2
+	SET_ATTR_SIZE      = 1 << 3
+	SET_ATTR_ATIME     = 1 << 4
+	SET_ATTR_MTIME     = 1 << 5
+	SET_ATTR_ATIME_NOW = 1 << 7
+	SET_ATTR_MTIME_NOW = 1 << 8
+	SET_ATTR_CTIME     = 1 << 10
+)
+
+// EntryParam describes a directory entry that is returned to the kernel.
+// This structure is analogous to the FUSE struct fuse_entry_param.
+type EntryParam struct {
+	// Inode number of the entry. It must be unique among the inodes that the kernel
+	// knows about (i.e. that have not been forgotten). An entry with a zero Ino is a
+	// negative entry: the kernel caches that the name does not exist for EntryTimeout.
+	Ino uint64
+
+	// Generation number of the inode. The pair (Ino, Generation) must be unique for
+	// the lifetime of the file system, so when an inode number is reused the generation
+	// number must change.
+	Generation uint64
+
+	// Attributes of the inode. If Attr.Ino is zero, Ino is used.
+	Attr Stat_t
+
+	// Time that the kernel caches the attributes.
+	AttrTimeout time.Duration
+
+	// Time that the kernel caches the name lookup.
+	EntryTimeout time.Duration
+}
+
+// LowLevelFileSystem is the interface that a user mode file system must implement in
+// order to be hosted by a LowLevelHost. It is analogous to the FUSE struct
+// fuse_lowlevel_ops.
+//
+// Unlike FileSystemInterface, whose operations receive paths, the operations of a
+// LowLevelFileSystem receive inode numbers. The FUSE layer does not keep a path table;
+// instead the file system is responsible for assigning inode numbers and for keeping
+// track of how many times the kernel has looked up each inode. Every successful Lookup,
+// Mknod, Mkdir, Symlink, Link and Create (and every entry other than "." and ".." for
+// which the Readdirplus fill returns true) increments the lookup count of the inode; Forget decrements
+// it. The root directory has the inode number 1 and it is never forgotten.
+//
+// Except for Init, Destroy and Forget all operations receive a context.Context that
+// carries an OpContext that describes the calling process (see GetOpContext). Unlike
+// the context of FileSystemInterfaceCtx operations, this context is never cancelled,
+// neither when the kernel interrupts the operation nor when the operation completes,
+// and OpContext.Groups returns nil. All operations (except Init, Destroy and Forget)
+// must return 0 on success or the NEGATIVE value of a FUSE error on failure.
+type LowLevelFileSystem interface {
+	// Init is called when the file system is created. The file system may inspect and
+	// change conn, as with FileSystemInitEx.
+	Init(conn *ConnInfo)
+
+	// Destroy is called when the file system is destroyed.
+	Destroy()
+
+	// Lookup looks up a directory entry by name and gets its attributes.
+	Lookup(ctx context.Context, parent uint64, name string, entry *EntryParam) int
+
+	// Forget forgets nlookup lookups of an inode.
+	Forget(ino uint64, nlookup uint64)
+
+	// Getattr gets file attributes. It also returns the time that the kernel caches
+	// the attributes. The fh is ^uint64(0) if the file is not open.
+	Getattr(ctx context.Context, ino uint64, stat *Stat_t, fh uint64) (int, time.Duration)
+
+	// Setattr sets the file attributes in attr that are specified by valid, which is a
+	// combination of the fuse.SET_ATTR_* constants. On success attr must be filled with
+	// the new attributes of the file. It also returns the time that the kernel caches
+	// the attributes. The fh is ^uint64(0) if the file is not open.
+	Setattr(ctx context.Context, ino uint64, attr *Stat_t, valid int, fh uint64) (int, time.Duration)
+
+	// Readlink reads the target of a symbolic link.
+	Readlink(ctx context.Context, ino uint64) (int, string)
+
+	// Mknod creates a file node.
+	Mknod(ctx context.Context, parent uint64, name string, mode uint32, dev uint64,
+		entry *EntryParam) int
+
+	// Mkdir creates a directory.
+	Mkdir(ctx context.Context, parent uint64, name string, mode uint32, entry *EntryParam) int
+
+	// Unlink removes a file.
+	Unlink(ctx context.Context, parent uint64, name string) int
+
+	// Rmdir removes a directory.
+	Rmdir(ctx context.Context, parent uint64, name string) int
+
+	// Symlink creates a symbolic link.
+	Symlink(ctx context.Context, target string, parent uint64, name string,
+		entry *EntryParam) int
+
+	// Rename renames a file. The flags are a combination of the fuse.RENAME_* constants.
+	Rename(ctx context.Context, parent uint64, name string, newparent uint64, newname string,
+		flags uint32) int
+
+	// Link creates a hard link to a file.
+	Link(ctx context.Context, ino uint64, newparent uint64, newname string,
+		entry *EntryParam) int
+
+	// Open opens a file. On entry fi.Flags contains the open flags (a combination of
+	// the fuse.O_* constants); the file system sets fi.Fh and optionally fi.DirectIo,
+	// fi.KeepCache and fi.NonSeekable.
+	Open(ctx context.Context, ino uint64, fi *FileInfo_t) int
+
+	// Read reads data from a file.
+	Read(ctx context.Context, ino uint64, buff []byte, ofst int64, fh uint64) int
+
+	// Write writes data to a file.
+	Write(ctx context.Context, ino uint64, buff []byte, ofst int64, fh uint64) int
+
+	// Flush flushes cached file data.
+	Flush(ctx context.Context, ino uint64, fh uint64) int
+
+	// Release closes an open file.
+	Release(ctx context.Context, ino uint64, fh uint64) int
+
+	// Fsync synchronizes file contents.
+	Fsync(ctx context.Context, ino uint64, datasync bool, fh uint64) int
+
+	// Opendir opens a directory. The fi is used as in Open.
+	Opendir(ctx context.Context, ino uint64, fi *FileInfo_t) int
+
+	// Readdir reads a directory. Only the Ino and the file type bits of the Mode of
+	// stat are used; stat may be nil. Every entry must have a non-zero ofst, which is
+	// passed back to Readdir to continue after the entry. The fill function returns
+	// false when the buffer of the FUSE layer is full.
+	Readdir(ctx context.Context, ino uint64,
+		fill func(name string, stat *Stat_t, ofst int64) bool,
+		ofst int64,
+		fh uint64) int
+
+	// Releasedir closes an open directory.
+	Releasedir(ctx context.Context, ino uint64, fh uint64) int
+
+	// Fsyncdir synchronizes directory contents.
+	Fsyncdir(ctx context.Context, ino uint64, datasync bool, fh uint64) int
+
+	// Statfs gets file system statistics.
+	Statfs(ctx context.Context, ino uint64, stat *Statfs_t) int
+
+	// Setxattr sets extended attributes.
+	Setxattr(ctx context.Context, ino uint64, name string, value []byte, flags int) int
+
+	// Getxattr gets extended attributes.
+	Getxattr(ctx context.Context, ino uint64, name string) (int, []byte)
+
+	// Removexattr removes extended attributes.
+	Removexattr(ctx context.Context, ino uint64, name string) int
+
+	// Listxattr lists extended attributes.
+	Listxattr(ctx context.Context, ino uint64, fill func(name string) bool) int
+
+	// Access checks file access permissions.
+	Access(ctx context.Context, ino uint64, mask uint32) int
+
+	// Create creates and opens a file. The fi is used as in Open.
+	Create(ctx context.Context, parent uint64, name string, mode uint32,
+		entry *EntryParam, fi *FileInfo_t) int
+}
+
+// LowLevelFileSystemReaddirplus is the interface that wraps the Readdirplus method.
+//
+// Readdirplus is similar to Readdir except that it also returns the attributes of the
+// directory entries, so that the kernel does not have to look them up. Every entry for
+// which fill returns true, other than "." and "..", increments the lookup count of its
+// inode. When a file system implements Readdirplus the kernel may use it instead of Readdir.
+type LowLevelFileSystemReaddirplus interface {
+	Readdirplus(ctx context.Context, ino uint64,
+		fill func(name string, entry *EntryParam, ofst int64) bool,
+		ofst int64,
+		fh uint64) int
+}
+
+// LowLevelFileSystemBase provides default implementations of the methods in
+// LowLevelFileSystem. The default implementations are either empty or return -ENOSYS
+// to signal that the file system does not implement a particular operation to the FUSE
+// layer.
+type LowLevelFileSystemBase struct {
+}
+
+// Init is called when the file system is created.
+// The LowLevelFileSystemBase implementation does nothing.
+func (*LowLevelFileSystemBase) Init(conn *ConnInfo) {
+}
+
+// Destroy is called when the file system is destroyed.
+// The LowLevelFileSystemBase implementation does nothing.
+func (*LowLevelFileSystemBase) Destroy() {
+}
+
+// Lookup looks up a directory entry by name and gets its attributes.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Lookup(ctx context.Context, parent uint64, name string,
+	entry *EntryParam) int {
+	return -ENOSYS
+}
+
+// Forget forgets nlookup lookups of an inode.
+// The LowLevelFileSystemBase implementation does nothing.
+func (*LowLevelFileSystemBase) Forget(ino uint64, nlookup uint64) {
+}
+
+// Getattr gets file attributes.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Getattr(ctx context.Context, ino uint64, stat *Stat_t,
+	fh uint64) (int, time.Duration) {
+	return -ENOSYS, 0
+}
+
+// Setattr sets file attributes.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Setattr(ctx context.Context, ino uint64, attr *Stat_t,
+	valid int, fh uint64) (int, time.Duration) {
+	return -ENOSYS, 0
+}
+
+// Readlink reads the target of a symbolic link.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Readlink(ctx context.Context, ino uint64) (int, string) {
+	return -ENOSYS, ""
+}
+
+// Mknod creates a file node.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Mknod(ctx context.Context, parent uint64, name string,
+	mode uint32, dev uint64, entry *EntryParam) int {
+	return -ENOSYS
+}
+
+// Mkdir creates a directory.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Mkdir(ctx context.Context, parent uint64, name string,
+	mode uint32, entry *EntryParam) int {
+	return -ENOSYS
+}
+
+// Unlink removes a file.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Unlink(ctx context.Context, parent uint64, name string) int {
+	return -ENOSYS
+}
+
+// Rmdir removes a directory.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Rmdir(ctx context.Context, parent uint64, name string) int {
+	return -ENOSYS
+}
+
+// Symlink creates a symbolic link.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Symlink(ctx context.Context, target string, parent uint64,
+	name string, entry *EntryParam) int {
+	return -ENOSYS
+}
+
+// Rename renames a file.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Rename(ctx context.Context, parent uint64, name string,
+	newparent uint64, newname string, flags uint32) int {
+	return -ENOSYS
+}
+
+// Link creates a hard link to a file.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Link(ctx context.Context, ino uint64, newparent uint64,
+	newname string, entry *EntryParam) int {
+	return -ENOSYS
+}
+
+// Open opens a file.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Open(ctx context.Context, ino uint64, fi *FileInfo_t) int {
+	return -ENOSYS
+}
+
+// Read reads data from a file.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Read(ctx context.Context, ino uint64, buff []byte,
+	ofst int64, fh uint64) int {
+	return -ENOSYS
+}
+
+// Write writes data to a file.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Write(ctx context.Context, ino uint64, buff []byte,
+	ofst int64, fh uint64) int {
+	return -ENOSYS
+}
+
+// Flush flushes cached file data.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Flush(ctx context.Context, ino uint64, fh uint64) int {
+	return -ENOSYS
+}
+
+// Release closes an open file.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Release(ctx context.Context, ino uint64, fh uint64) int {
+	return -ENOSYS
+}
+
+// Fsync synchronizes file contents.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Fsync(ctx context.Context, ino uint64, datasync bool,
+	fh uint64) int {
+	return -ENOSYS
+}
+
+// Opendir opens a directory.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Opendir(ctx context.Context, ino uint64, fi *FileInfo_t) int {
+	return -ENOSYS
+}
+
+// Readdir reads a directory.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Readdir(ctx context.Context, ino uint64,
+	fill func(name string, stat *Stat_t, ofst int64) bool,
+	ofst int64,
+	fh uint64) int {
+	return -ENOSYS
+}
+
+// Releasedir closes an open directory.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Releasedir(ctx context.Context, ino uint64, fh uint64) int {
+	return -ENOSYS
+}
+
+// Fsyncdir synchronizes directory contents.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Fsyncdir(ctx context.Context, ino uint64, datasync bool,
+	fh uint64) int {
+	return -ENOSYS
+}
+
+// Statfs gets file system statistics.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Statfs(ctx context.Context, ino uint64, stat *Statfs_t) int {
+	return -ENOSYS
+}
+
+// Setxattr sets extended attributes.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Setxattr(ctx context.Context, ino uint64, name string,
+	value []byte, flags int) int {
+	return -ENOSYS
+}
+
+// Getxattr gets extended attributes.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Getxattr(ctx context.Context, ino uint64,
+	name string) (int, []byte) {
+	return -ENOSYS, nil
+}
+
+// Removexattr removes extended attributes.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Removexattr(ctx context.Context, ino uint64, name string) int {
+	return -ENOSYS
+}
+
+// Listxattr lists extended attributes.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Listxattr(ctx context.Context, ino uint64,
+	fill func(name string) bool) int {
+	return -ENOSYS
+}
+
+// Access checks file access permissions.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Access(ctx context.Context, ino uint64, mask uint32) int {
+	return -ENOSYS
+}
+
+// Create creates and opens a file.
+// The LowLevelFileSystemBase implementation returns -ENOSYS.
+func (*LowLevelFileSystemBase) Create(ctx context.Context, parent uint64, name string,
+	mode uint32, entry *EntryParam, fi *FileInfo_t) int {
+	return -ENOSYS
+}
+
+var _ LowLevelFileSystem = (*LowLevelFileSystemBase)(nil)
+
+// LowLevelHost is used to host a LowLevelFileSystem. It uses the FUSE3 low-level
+// (fuse_session) API and it is available on Linux and FreeBSD when building with
+// '-tags=fuse3' and on Linux when building without cgo (see the package documentation).
+type LowLevelHost struct {
+	fsop    LowLevelFileSystem
+	se      unsafe.Pointer // accessed atomically
+	mntp    string
+	signals *SignalConfig
+	diag    *hostDiag
+}
+
+// hostLlTable maps session handles to hosts. It is a copy-on-write map, so that
+// operations can look up their host without taking hostGuard.
+var hostLlTable atomic.Value // map[unsafe.Pointer]*LowLevelHost
+
+func hostLlHandleNew(host *LowLevelHost) unsafe.Pointer {
+	p := c_malloc(1)
+	hostGuard.Lock()
+	table, _ := hostLlTable.Load().(map[unsafe.Pointer]*LowLevelHost)
+	newtable := make(map[unsafe.Pointer]*LowLevelHost, len(table)+1)
+	for k, v := range table {
+		newtable[k] = v
+	}
+	newtable[p] = host
+	hostLlTable.Store(newtable)
+	hostGuard.Unlock()
+	return p
+}
+
+func hostLlHandleDel(p unsafe.Pointer) {
+	hostGuard.Lock()
+	table, _ := hostLlTable.Load().(map[unsafe.Pointer]*LowLevelHost)
+	newtable := make(map[unsafe.Pointer]*LowLevelHost, len(table))
+	for k, v := range table {
+		if p != k {
+			newtable[k] = v
+		}
+	}
+	hostLlTable.Store(newtable)
+	hostGuard.Unlock()
+	c_free(p)
+}
+
+func hostLlHandleGet(p unsafe.Pointer) *LowLevelHost {
+	table, _ := hostLlTable.Load().(map[unsafe.Pointer]*LowLevelHost)
+	return table[p]
+}
+
+// hostLlBufs is a pool of the buffers that Read and Readdir fill. The buffers have a
+// capacity of at least hostLlBufCap, so that they fit the usual kernel request sizes.
+var hostLlBufs sync.Pool
+
+const hostLlBufCap = 256 * 1024
+
+// hostLlGetBuf returns a buffer of size bytes; hostLlPutBuf returns it to the pool.
+func hostLlGetBuf(size int) *[]byte {
+	if b, _ := hostLlBufs.Get().(*[]byte); nil != b && size <= cap(*b) {
+		*b = (*b)[:size]
+		return b
+	}
+	c := hostLlBufCap
+	if c < size {
+		c = size
+	}
+	b := make([]byte, size, c)
+	return &b
+}
+
+func hostLlPutBuf(b *[]byte) {
+	hostLlBufs.Put(b)
+}
+
+// NewLowLevelHost creates a host for a file system that implements LowLevelFileSystem.
+func NewLowLevelHost(fsop LowLevelFileSystem) *LowLevelHost {
+	host := &LowLevelHost{}
+	host.fsop = fsop
+	return host
+}
+
+// SetSignalConfig sets how the host handles signals while the file system is mounted
+// (see FileSystemHost.SetSignalConfig).
+func (host *LowLevelHost) SetSignalConfig(config SignalConfig) {
+	host.signals = &config
+}
+
+// Mount mounts a file system on the given mountpoint with the mount options in opts.
+// It blocks until the file system is unmounted. The options are as for
+// FileSystemHost.Mount, except that the options of the FUSE high-level layer (such as
+// entry_timeout or use_ino) are not accepted.
+//
+// Mount panics if the low-level API is not available.
+func (host *LowLevelHost) Mount(mountpoint string, opts []string) bool {
+	if 0 == c_hostLlFuseInit() {
+		panic("cgofuse: cannot find FUSE3 low-level API")
+	}
+
+	return host.mount(mountpoint, opts, nil)
+}
+
+// MountE is similar to Mount except that it returns a *MountError that describes why
+// the file system could not be mounted, rather than false (see FileSystemHost.MountE).
+// If the low-level API is not available it returns a MountError of kind MountErrLibrary.
+func (host *LowLevelHost) MountE(mountpoint string, opts []string) error {
+	if 0 == c_hostLlFuseInit() {
+		return &MountError{Kind: MountErrLibrary, Errno: ENOSYS,
+			Message: "the low-level API requires FUSE3 on Linux or FreeBSD"}
+	}
+
+	diag := hostDiagNew()
+	if host.mount(mountpoint, opts, diag) {
+		diag.flush()
+		return nil
+	}
+	return newMountError(diag.stop())
+}
+
+func (host *LowLevelHost) mount(mountpoint string, opts []string, diag *hostDiag) bool {
+	/*
+	 * Command line handling
+	 *
+	 * The FUSE3 fuse_session_new accepts only the low-level and mount options; so we
+	 * handle -s ourselves, ignore -f (we never daemonize) and remove the mountpoint.
+	 */
+	var single, foreground bool
+	outargs, err := OptParse(opts, "-s -f", &single, &foreground)
+	if nil != err {
+		return false
+	}
+	if "" == mountpoint {
+		for i := 0; len(outargs) > i; i++ {
+			if "-o" == outargs[i] {
+				i++
+			} else if !strings.HasPrefix(outargs[i], "-") {
+				mountpoint = outargs[i]
+				outargs = append(outargs[:i:i], outargs[i+1:]...)
+				break
+			}
+		}
+	}
+	host.mntp = hostMountpoint(mountpoint, nil)
+	defer func() {
+		host.mntp = ""
+	}()
+	if "" == host.mntp {
+		os.Stderr.WriteString("error: no mountpoint specified\n")
+		return false
+	}
+	exec := "<UNKNOWN>"
+	if 0 < len(os.Args) {
+		exec = os.Args[0]
+	}
+	argv := make([]*c_char, len(outargs)+2)
+	argv[0] = c_CString(exec)
+	defer c_free(unsafe.Pointer(argv[0]))
+	for i := 0; len(outargs) > i; i++ {
+		argv[1+i] = c_CString(outargs[i])
+		defer c_free(unsafe.Pointer(argv[1+i]))
+	}
+	mntp := c_CString(host.mntp)
+	defer c_free(unsafe.Pointer(mntp))
+
+	/*
+	 * Create and mount the session.
+	 */
+	hndl := hostLlHandleNew(host)
+	defer hostLlHandleDel(hndl)
+	se := c_hostLlSessionNew(c_int(len(outargs)+1), &argv[0], hndl)
+	if nil == se {
+		return false
+	}
+	defer c_hostLlSessionDestroy(se)
+	if 0 != c_hostLlSessionMount(se, mntp) {
+		return false
+	}
+	atomic.StorePointer(&host.se, se)
+	defer func() {
+		atomic.StorePointer(&host.se, nil)
+		c_hostLlSessionUnmount(se)
+	}()
+	// the file system is mounted; the FUSE layer output is no longer diagnostic
+	diag.flush()
+
+	/*
+	 * Handle zombie mounts (see FileSystemHost.mount).
+	 */
+	sigc, sigs, stop := hostSignalListen(host.signals, host.Unmount)
+	defer stop()
+	if nil != sigc && 0 < len(sigs) {
+		signal.Notify(sigc, sigs...)
+	}
+
+	/*
+	 * Tell FUSE to do its job!
+	 */
+	return 0 == c_hostLlSessionLoop(se, c_bool(single))
+}
+
+// Unmount unmounts a mounted file system.
+// Unmount may be called at any time after the file system has been mounted.
+func (host *LowLevelHost) Unmount() bool {
+	if nil == atomic.LoadPointer(&host.se) {
+		return false
+	}
+	var mntp *c_char
+	if "" != host.mntp {
+		mntp = c_CString(host.mntp)
+		defer c_free(unsafe.Pointer(mntp))
+	}
+	return 0 != c_hostUnmount(nil, mntp, true)
+}
+
+// NotifyInvalInode invalidates the attributes of an inode and the data that the kernel
+// has cached for the range [ofst, ofst+size) of the inode. If ofst is negative only the
+// attributes are invalidated; if size is zero the data is invalidated up to the end of
+// the file.
+//
+// NotifyInvalInode should not be called from the operation that the kernel is waiting
+// for on the same inode, as this may deadlock.
+func (host *LowLevelHost) NotifyInvalInode(ino uint64, ofst int64, size int64) bool {
+	se := atomic.LoadPointer(&host.se)
+	if nil == se {
+		return false
+	}
+	res := int(c_hostLlNotifyInvalInode(se, c_uint64_t(ino), c_int64_t(ofst), c_int64_t(size)))
+	// -ENOENT: the kernel does not know the inode, so there is nothing to invalidate
+	return 0 == res || -ENOENT == res
+}
+
+// NotifyInvalEntry invalidates the name lookup of a directory entry that the kernel
+// has cached, as well as the attributes of the parent directory.
+//
+// NotifyInvalEntry should not be called from an operation on the parent directory,
+// as this may deadlock.
+func (host *LowLevelHost) NotifyInvalEntry(parent uint64, name string) bool {
+	se := atomic.LoadPointer(&host.se)
+	if nil == se {
+		return false
+	}
+	nameb := append([]byte(name), 0)
+	res := int(c_hostLlNotifyInvalEntry(se, c_uint64_t(parent),
+		(*c_char)(unsafe.Pointer(&nameb[0])), c_size_t(len(name))))
+	return 0 == res || -ENOENT == res
+}
+
+/*
+ * Operations
+ *
+ * The backend (host_cgo.go, host_nocgo_linux.go) calls the hostLl* functions with the
+ * request, which they must reply to exactly once by calling one of the
+ * c_hostLlReply* functions with hostLlReq.reply. If an operation panics before it
+ * replies, hostLlRecover replies with an error instead.
+ */
+
+func hostLlOpBegin(req0 unsafe.Pointer) (LowLevelFileSystem, context.Context) {
+	host := hostLlHandleGet(c_hostLlReqUserdata(req0))
+	var uid, gid, pid, umask c_uint32_t
+	c_hostLlReqCtx(req0, &uid, &gid, &pid, &umask)
+	opctx := &OpContext{
+		Uid:   uint32(uid),
+		Gid:   uint32(gid),
+		Pid:   int(int32(pid)),
+		Umask: uint32(umask),
+	}
+	return host.fsop, context.WithValue(context.Background(), opContextKey{}, opctx)
+}
+
+// hostLlReq is the request of an operation. The operation replies to it through reply,
+// which records that the request has been replied to and must not be used again.
+type hostLlReq struct {
+	req0    unsafe.Pointer
+	replied bool
+}
+
+func (req *hostLlReq) reply() unsafe.Pointer {
+	req.replied = true
+	return req.req0
+}
+
+func hostLlRecover(req *hostLlReq) {
+	if r := recover(); nil != r && !req.replied {
+		switch e := r.(type) {
+		case Error:
+			c_hostLlReplyErr(req.reply(), -c_int(e))
+		default:
+			c_hostLlReplyErr(req.reply(), c_int(EIO))
+		}
+	}
+}
+
+func hostLlReplyErrc(req *hostLlReq, errc int) {
+	if 0 < errc {
+		errc = 0
+	}
+	c_hostLlReplyErr(req.reply(), -c_int(errc))
+}
+
+func hostLlReplyEntry(req *hostLlReq, errc int, entry *EntryParam) {
+	if 0 != errc {
+		hostLlReplyErrc(req, errc)
+		return
+	}
+	var attr c_fuse_stat_t
+	hostLlCopyCstat(&attr, &entry.Attr, entry.Ino)
+	c_hostLlReplyEntry(req.reply(),
+		c_uint64_t(entry.Ino),
+		c_uint64_t(entry.Generation),
+		&attr,
+		c_double(entry.AttrTimeout.Seconds()),
+		c_double(entry.EntryTimeout.Seconds()))
+}
+
+func hostLlReplyAttr(req *hostLlReq, errc int, ino uint64, stat *Stat_t,
+	timeout time.Duration) {
+	if 0 != errc {
+		hostLlReplyErrc(req, errc)
+		return
+	}
+	var attr c_fuse_stat_t
+	hostLlCopyCstat(&attr, stat, ino)
+	c_hostLlReplyAttr(req.reply(), &attr, c_double(timeout.Seconds()))
+}
+
+func hostLlCopyCstat(dst *c_fuse_stat_t, src *Stat_t, ino uint64) {
+	if 0 == src.Ino {
+		stat := *src
+		stat.Ino = ino
+		src = &stat
+	}
+	copyCstatFromFusestat(dst, src)
+}
+
+func hostLlFh(fi0 *c_struct_fuse_file_info) uint64 {
+	if nil == fi0 {
+		return ^uint64(0)
+	}
+	return uint64(fi0.fh)
+}
+
+func hostLlInit(hndl unsafe.Pointer, conn0 *c_struct_fuse_conn_info) {
+	defer func() {
+		recover()
+	}()
+	host := hostLlHandleGet(hndl)
+	var conn ConnInfo
+	copyConnInfoFromCconninfo(&conn, conn0)
+	if _, ok := host.fsop.(LowLevelFileSystemReaddirplus); !ok {
+		conn.Want &^= CAP_READDIRPLUS | CAP_READDIRPLUS_AUTO
+	}
+	host.fsop.Init(&conn)
+	copyCconninfoFromConnInfo(conn0, &conn)
+}
+
+func hostLlDestroy(hndl unsafe.Pointer) {
+	defer func() {
+		recover()
+	}()
+	host := hostLlHandleGet(hndl)
+	host.fsop.Destroy()
+}
+
+func hostLlLookup(req0 unsafe.Pointer, parent uint64, name string) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	entry := EntryParam{}
+	errc := fsop.Lookup(ctx, parent, name, &entry)
+	hostLlReplyEntry(req, errc, &entry)
+}
+
+func hostLlForget(req0 unsafe.Pointer, ino uint64, nlookup uint64) {
+	defer func() {
+		recover()
+		c_hostLlReplyNone(req0)
+	}()
+	host := hostLlHandleGet(c_hostLlReqUserdata(req0))
+	host.fsop.Forget(ino, nlookup)
+}
+
+func hostLlGetattr(req0 unsafe.Pointer, ino uint64, fi0 *c_struct_fuse_file_info) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	stat := Stat_t{}
+	errc, timeout := fsop.Getattr(ctx, ino, &stat, hostLlFh(fi0))
+	hostLlReplyAttr(req, errc, ino, &stat, timeout)
+}
+
+func hostLlSetattr(req0 unsafe.Pointer, ino uint64, attr *Stat_t, valid int,
+	fi0 *c_struct_fuse_file_info) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	errc, timeout := fsop.Setattr(ctx, ino, attr, valid, hostLlFh(fi0))
+	hostLlReplyAttr(req, errc, ino, attr, timeout)
+}
+
+func hostLlReadlink(req0 unsafe.Pointer, ino uint64) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	errc, target := fsop.Readlink(ctx, ino)
+	if 0 != errc {
+		hostLlReplyErrc(req, errc)
+		return
+	}
+	// a readlink reply is the target without a terminating NUL
+	buff := []byte(target)
+	var p *c_char
+	if 0 < len(buff) {
+		p = (*c_char)(unsafe.Pointer(&buff[0]))
+	}
+	c_hostLlReplyBuf(req.reply(), p, c_size_t(len(buff)))
+}
+
+func hostLlMknod(req0 unsafe.Pointer, parent uint64, name string, mode uint32, dev uint64) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	entry := EntryParam{}
+	errc := fsop.Mknod(ctx, parent, name, mode, dev, &entry)
+	hostLlReplyEntry(req, errc, &entry)
+}
+
+func hostLlMkdir(req0 unsafe.Pointer, parent uint64, name string, mode uint32) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	entry := EntryParam{}
+	errc := fsop.Mkdir(ctx, parent, name, mode, &entry)
+	hostLlReplyEntry(req, errc, &entry)
+}
+
+func hostLlUnlink(req0 unsafe.Pointer, parent uint64, name string) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	errc := fsop.Unlink(ctx, parent, name)
+	hostLlReplyErrc(req, errc)
+}
+
+func hostLlRmdir(req0 unsafe.Pointer, parent uint64, name string) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	errc := fsop.Rmdir(ctx, parent, name)
+	hostLlReplyErrc(req, errc)
+}
+
+func hostLlSymlink(req0 unsafe.Pointer, target string, parent uint64, name string) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	entry := EntryParam{}
+	errc := fsop.Symlink(ctx, target, parent, name, &entry)
+	hostLlReplyEntry(req, errc, &entry)
+}
+
+func hostLlRename(req0 unsafe.Pointer, parent uint64, name string,
+	newparent uint64, newname string, flags uint32) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	errc := fsop.Rename(ctx, parent, name, newparent, newname, flags)
+	hostLlReplyErrc(req, errc)
+}
+
+func hostLlLink(req0 unsafe.Pointer, ino uint64, newparent uint64, newname string) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	entry := EntryParam{}
+	errc := fsop.Link(ctx, ino, newparent, newname, &entry)
+	hostLlReplyEntry(req, errc, &entry)
+}
+
+func hostLlOpen(req0 unsafe.Pointer, ino uint64, fi0 *c_struct_fuse_file_info) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	fi := FileInfo_t{Flags: int(fi0.flags)}
+	errc := fsop.Open(ctx, ino, &fi)
+	if 0 != errc {
+		hostLlReplyErrc(req, errc)
+		return
+	}
+	c_hostAsgnCfileinfo(fi0,
+		c_bool(fi.DirectIo),
+		c_bool(fi.KeepCache),
+		c_bool(fi.NonSeekable),
+		c_uint64_t(fi.Fh))
+	c_hostLlReplyOpen(req.reply(), fi0)
+}
+
+func hostLlRead(req0 unsafe.Pointer, ino uint64, size int, ofst int64,
+	fi0 *c_struct_fuse_file_info) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	buffp := hostLlGetBuf(size + 1)
+	defer hostLlPutBuf(buffp)
+	buff := *buffp
+	nbyt := fsop.Read(ctx, ino, buff[:size], ofst, hostLlFh(fi0))
+	if 0 > nbyt {
+		hostLlReplyErrc(req, nbyt)
+		return
+	}
+	if size < nbyt {
+		nbyt = size
+	}
+	c_hostLlReplyBuf(req.reply(), (*c_char)(unsafe.Pointer(&buff[0])), c_size_t(nbyt))
+}
+
+func hostLlWrite(req0 unsafe.Pointer, ino uint64, buff []byte, ofst int64,
+	fi0 *c_struct_fuse_file_info) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	nbyt := fsop.Write(ctx, ino, buff, ofst, hostLlFh(fi0))
+	if 0 > nbyt {
+		hostLlReplyErrc(req, nbyt)
+		return
+	}
+	c_hostLlReplyWrite(req.reply(), c_size_t(nbyt))
+}
+
+func hostLlFlush(req0 unsafe.Pointer, ino uint64, fi0 *c_struct_fuse_file_info) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	errc := fsop.Flush(ctx, ino, hostLlFh(fi0))
+	hostLlReplyErrc(req, errc)
+}
+
+func hostLlRelease(req0 unsafe.Pointer, ino uint64, fi0 *c_struct_fuse_file_info) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	errc := fsop.Release(ctx, ino, hostLlFh(fi0))
+	hostLlReplyErrc(req, errc)
+}
+
+func hostLlFsync(req0 unsafe.Pointer, ino uint64, datasync bool,
+	fi0 *c_struct_fuse_file_info) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	errc := fsop.Fsync(ctx, ino, datasync, hostLlFh(fi0))
+	hostLlReplyErrc(req, errc)
+}
+
+func hostLlOpendir(req0 unsafe.Pointer, ino uint64, fi0 *c_struct_fuse_file_info) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	fi := FileInfo_t{Flags: int(fi0.flags)}
+	errc := fsop.Opendir(ctx, ino, &fi)
+	if -ENOSYS == errc {
+		fi = FileInfo_t{}
+		errc = 0
+	}
+	if 0 != errc {
+		hostLlReplyErrc(req, errc)
+		return
+	}
+	c_hostAsgnCfileinfo(fi0,
+		c_bool(fi.DirectIo),
+		c_bool(fi.KeepCache),
+		c_bool(fi.NonSeekable),
+		c_uint64_t(fi.Fh))
+	c_hostLlReplyOpen(req.reply(), fi0)
+}
+
+func hostLlReaddir(req0 unsafe.Pointer, ino uint64, size int, ofst int64,
+	fi0 *c_struct_fuse_file_info, plus bool) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	buffp := hostLlGetBuf(size)
+	defer hostLlPutBuf(buffp)
+	buff := *buffp
+	nbyt := 0
+	var nameb []byte
+	add := func(name string, fn func(buff *c_char, size c_size_t, name *c_char) c_size_t) bool {
+		if len(buff) == nbyt {
+			return false
+		}
+		nameb = append(append(nameb[:0], name...), 0)
+		n := int(fn(
+			(*c_char)(unsafe.Pointer(&buff[nbyt])),
+			c_size_t(len(buff)-nbyt),
+			(*c_char)(unsafe.Pointer(&nameb[0]))))
+		if len(buff)-nbyt < n {
+			return false
+		}
+		nbyt += n
+		return true
+	}
+	var errc int
+	if intf, ok := fsop.(LowLevelFileSystemReaddirplus); plus && !ok {
+		errc = -ENOSYS
+	} else if plus {
+		fill := func(name1 string, entry1 *EntryParam, ofst1 int64) bool {
+			var attr c_fuse_stat_t
+			hostLlCopyCstat(&attr, &entry1.Attr, entry1.Ino)
+			return add(name1, func(buff *c_char, size c_size_t, name *c_char) c_size_t {
+				return c_hostLlAddDirentryPlus(req0, buff, size, name,
+					c_uint64_t(entry1.Ino),
+					c_uint64_t(entry1.Generation),
+					&attr,
+					c_double(entry1.AttrTimeout.Seconds()),
+					c_double(entry1.EntryTimeout.Seconds()),
+					c_fuse_off_t(ofst1))
+			})
+		}
+		errc = intf.Readdirplus(ctx, ino, fill, ofst, hostLlFh(fi0))
+	} else {
+		fill := func(name1 string, stat1 *Stat_t, ofst1 int64) bool {
+			stat := Stat_t{}
+			if nil != stat1 {
+				stat = *stat1
+			}
+			if 0 == stat.Ino {
+				stat.Ino = 0xffffffff // FUSE_UNKNOWN_INO
+			}
+			var attr c_fuse_stat_t
+			copyCstatFromFusestat(&attr, &stat)
+			return add(name1, func(buff *c_char, size c_size_t, name *c_char) c_size_t {
+				return c_hostLlAddDirentry(req0, buff, size, name, &attr, c_fuse_off_t(ofst1))
+			})
+		}
+		errc = fsop.Readdir(ctx, ino, fill, ofst, hostLlFh(fi0))
+	}
+	if 0 != errc && 0 == nbyt {
+		hostLlReplyErrc(req, errc)
+		return
+	}
+	var p *c_char
+	if 0 < nbyt {
+		p = (*c_char)(unsafe.Pointer(&buff[0]))
+	}
+	c_hostLlReplyBuf(req.reply(), p, c_size_t(nbyt))
+}
+
+func hostLlReleasedir(req0 unsafe.Pointer, ino uint64, fi0 *c_struct_fuse_file_info) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	errc := fsop.Releasedir(ctx, ino, hostLlFh(fi0))
+	hostLlReplyErrc(req, errc)
+}
+
+func hostLlFsyncdir(req0 unsafe.Pointer, ino uint64, datasync bool,
+	fi0 *c_struct_fuse_file_info) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	errc := fsop.Fsyncdir(ctx, ino, datasync, hostLlFh(fi0))
+	if -ENOSYS == errc {
+		errc = 0
+	}
+	hostLlReplyErrc(req, errc)
+}
+
+func hostLlStatfs(req0 unsafe.Pointer, ino uint64) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	stat := &Statfs_t{}
+	errc := fsop.Statfs(ctx, ino, stat)
+	if -ENOSYS == errc {
+		// same defaults as the FUSE high-level layer
+		stat = &Statfs_t{Bsize: 512, Namemax: 255}
+		errc = 0
+	}
+	if 0 != errc {
+		hostLlReplyErrc(req, errc)
+		return
+	}
+	var stbuf c_fuse_statvfs_t
+	copyCstatvfsFromFusestatfs(&stbuf, stat)
+	c_hostLlReplyStatfs(req.reply(), &stbuf)
+}
+
+func hostLlSetxattr(req0 unsafe.Pointer, ino uint64, name string, value []byte, flags int) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	errc := fsop.Setxattr(ctx, ino, name, value, flags)
+	hostLlReplyErrc(req, errc)
+}
+
+// hostLlReplyXattr replies to Getxattr and Listxattr: with the size of the value when
+// the kernel asks for it (size == 0) and otherwise with the value itself.
+func hostLlReplyXattr(req *hostLlReq, size int, value []byte) {
+	if 0 == size {
+		c_hostLlReplyXattr(req.reply(), c_size_t(len(value)))
+	} else if size < len(value) {
+		c_hostLlReplyErr(req.reply(), c_int(ERANGE))
+	} else {
+		var p *c_char
+		if 0 < len(value) {
+			p = (*c_char)(unsafe.Pointer(&value[0]))
+		}
+		c_hostLlReplyBuf(req.reply(), p, c_size_t(len(value)))
+	}
+}
+
+func hostLlGetxattr(req0 unsafe.Pointer, ino uint64, name string, size int) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	errc, value := fsop.Getxattr(ctx, ino, name)
+	if 0 != errc {
+		hostLlReplyErrc(req, errc)
+		return
+	}
+	hostLlReplyXattr(req, size, value)
+}
+
+func hostLlListxattr(req0 unsafe.Pointer, ino uint64, size int) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	var value []byte
+	fill := func(name1 string) bool {
+		value = append(value, name1...)
+		value = append(value, 0)
+		return true
+	}
+	errc := fsop.Listxattr(ctx, ino, fill)
+	if 0 != errc {
+		hostLlReplyErrc(req, errc)
+		return
+	}
+	hostLlReplyXattr(req, size, value)
+}
+
+func hostLlRemovexattr(req0 unsafe.Pointer, ino uint64, name string) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	errc := fsop.Removexattr(ctx, ino, name)
+	hostLlReplyErrc(req, errc)
+}
+
+func hostLlAccess(req0 unsafe.Pointer, ino uint64, mask uint32) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	errc := fsop.Access(ctx, ino, mask)
+	hostLlReplyErrc(req, errc)
+}
+
+func hostLlCreate(req0 unsafe.Pointer, parent uint64, name string, mode uint32,
+	fi0 *c_struct_fuse_file_info) {
+	req := &hostLlReq{req0: req0}
+	defer hostLlRecover(req)
+	fsop, ctx := hostLlOpBegin(req0)
+	entry := EntryParam{}
+	fi := FileInfo_t{Flags: int(fi0.flags)}
+	errc := fsop.Create(ctx, parent, name, mode, &entry, &fi)
+	if 0 != errc {
+		hostLlReplyErrc(req, errc)
+		return
+	}
+	c_hostAsgnCfileinfo(fi0,
+		c_bool(fi.DirectIo),
+		c_bool(fi.KeepCache),
+		c_bool(fi.NonSeekable),
+		c_uint64_t(fi.Fh))
+	var attr c_fuse_stat_t
+	hostLlCopyCstat(&attr, &entry.Attr, entry.Ino)
+	c_hostLlReplyCreate(req.reply(),
+		c_uint64_t(entry.Ino),
+		c_uint64_t(entry.Generation),
+		&attr,
+		c_double(entry.AttrTimeout.Seconds()),
+		c_double(entry.EntryTimeout.Seconds()),
+		fi0)
+}
@@ -0,0 +1,231 @@
+//go:build freebsd || linux
+// +build freebsd linux
+
+/*
+ * lowlevel_test.go
+ *
+ * Copyright 2017-2022 Bill Zissimopoulos
+ */
+/*
+ * This file is part of Cgofuse.
+ *
+ * It is licensed under the MIT license. The full license text can be found
+ * in the License.txt file at the root of this project.
+ */
+
+package fuse
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type testllfs struct {
+	LowLevelFileSystemBase
+	init, dstr int
+}
+
+var testllData = []byte("hello, world\n")
+
+func (self *testllfs) Init(conn *ConnInfo) {
+	self.init++
+}
+
+func (self *testllfs) Destroy() {
+	self.dstr++
+}
+
+func (self *testllfs) stat(ino uint64, stat *Stat_t) int {
+	switch ino {
+	case 1:
+		stat.Mode = S_IFDIR | 0555
+		stat.Nlink = 2
+	case 2:
+		stat.Mode = S_IFREG | 0444
+		stat.Nlink = 1
+		stat.Size = int64(len(testllData))
+	default:
+		return -ENOENT
+	}
+	stat.Ino = ino
+	return 0
+}
+
+func (self *testllfs) Lookup(ctx context.Context, parent uint64, name string,
+	entry *EntryParam) int {
+	if 1 != parent || "hello" != name {
+		return -ENOENT
+	}
+	entry.Ino = 2
+	entry.Generation = 1
+	entry.AttrTimeout = time.Second
+	entry.EntryTimeout = time.Second
+	return self.stat(2, &entry.Attr)
+}
+
+func (self *testllfs) Getattr(ctx context.Context, ino uint64, stat *Stat_t,
+	fh uint64) (int, time.Duration) {
+	return self.stat(ino, stat), time.Second
+}
+
+func (self *testllfs) Open(ctx context.Context, ino uint64, fi *FileInfo_t) int {
+	if 2 != ino {
+		return -EISDIR
+	}
+	fi.Fh = 42
+	return 0
+}
+
+func (self *testllfs) Read(ctx context.Context, ino uint64, buff []byte, ofst int64,
+	fh uint64) int {
+	if 42 != fh {
+		return -EBADF
+	}
+	if int64(len(testllData)) <= ofst {
+		return 0
+	}
+	return copy(buff, testllData[ofst:])
+}
+
+func (self *testllfs) Release(ctx context.Context, ino uint64, fh uint64) int {
+	return 0
+}
+
+func (self *testllfs) Readdir(ctx context.Context, ino uint64,
+	fill func(name string, stat *Stat_t, ofst int64) bool,
+	ofst int64,
+	fh uint64) int {
+	names := []string{".", "..", "hello"}
+	for i := int(ofst); len(names) > i; i++ {
+		stat := Stat_t{}
+		if 2 == i {
+			self.stat(2, &stat)
+		}
+		if !fill(names[i], &stat, int64(i+1)) {
+			break
+		}
+	}
+	return 0
+}
+
+func testllReadFile(path string) ([]byte, error) {
+	fd, err := syscall.Open(path, syscall.O_RDONLY, 0)
+	if nil != err {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+	data := []byte{}
+	buff := make([]byte, 4096)
+	for {
+		n, err := syscall.Read(fd, buff)
+		if nil != err {
+			return nil, err
+		}
+		if 0 == n {
+			return data, nil
+		}
+		data = append(data, buff[:n]...)
+	}
+}
+
+func TestLowLevelHost(t *testing.T) {
+	path, err := ioutil.TempDir("", "test")
+	if nil != err {
+		panic(err)
+	}
+	defer os.Remove(path)
+	mntp := filepath.Join(path, "m")
+	err = os.Mkdir(mntp, os.FileMode(0755))
+	if nil != err {
+		panic(err)
+	}
+	defer os.Remove(mntp)
+
+	var st0 syscall.Stat_t
+	syscall.Stat(mntp, &st0)
+
+	tstf := &testllfs{}
+	host := NewLowLevelHost(tstf)
+	done := make(chan error)
+	go func() {
+		done <- host.MountE(mntp, nil)
+	}()
+	for {
+		var st syscall.Stat_t
+		syscall.Stat(mntp, &st)
+		if st0.Dev != st.Dev {
+			break
+		}
+		select {
+		case err = <-done:
+			var merr *MountError
+			if errors.As(err, &merr) && MountErrLibrary == merr.Kind {
+				t.Skip(err)
+			}
+			t.Fatal("MountE failed", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// read with raw syscalls: os.File registers FUSE files with the Go poller,
+	// which deadlocks against an in-process server that uses the same poller
+	data, err := testllReadFile(filepath.Join(mntp, "hello"))
+	if nil != err || string(testllData) != string(data) {
+		t.Error("ReadFile", err, string(data))
+	}
+	infos, err := ioutil.ReadDir(mntp)
+	names := []string{}
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	if nil != err || 1 != len(names) || "hello" != names[0] {
+		t.Error("ReadDir", err, names)
+	}
+	_, err = os.Stat(filepath.Join(mntp, "missing"))
+	if !os.IsNotExist(err) {
+		t.Error("Stat", err)
+	}
+
+	if !host.NotifyInvalEntry(1, "hello") {
+		t.Error("NotifyInvalEntry failed")
+	}
+	if !host.NotifyInvalInode(2, 0, 0) {
+		t.Error("NotifyInvalInode failed")
+	}
+
+	if !host.Unmount() {
+		t.Error("Unmount failed")
+	}
+	err = <-done
+	if nil != err {
+		t.Error("MountE failed", err)
+	}
+	if 1 != tstf.init {
+		t.Errorf("Init() called %v times; expected 1", tstf.init)
+	}
+	if 1 != tstf.dstr {
+		t.Errorf("Destroy() called %v times; expected 1", tstf.dstr)
+	}
+}
+
+func TestLowLevelRecover(t *testing.T) {
+	// a panic after the reply must not reply again; the request is not valid here,
+	// so any reply would crash
+	req := &hostLlReq{}
+	func() {
+		defer hostLlRecover(req)
+		req.reply()
+		panic(Error(-EIO))
+	}()
+	if !req.replied {
+		t.Error("request not marked as replied")
+	}
+}
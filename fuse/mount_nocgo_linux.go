@@ -0,0 +1,542 @@
+//go:build linux && (!cgo || nocgo)
+// +build linux
+// +build !cgo nocgo
+
+/*
+ * mount_nocgo_linux.go
+ *
+ * Copyright 2017-2022 Bill Zissimopoulos
+ */
+/*
+ * This file is part of Cgofuse.
+ *
+ * It is licensed under the MIT license. The full license text can be found
+ * in the License.txt file at the root of this project.
+ */
+
+package fuse
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+/*
+ * Mounting
+ *
+ * A file system is mounted by opening /dev/fuse and passing the open descriptor to
+ * mount(2) in the "fd=N" option. This requires CAP_SYS_ADMIN. Other processes use the
+ * setuid fusermount3 (or fusermount) program instead: it mounts the file system and
+ * passes the descriptor back over a Unix socket whose number is in the _FUSE_COMMFD
+ * environment variable. With the auto_unmount option fusermount keeps running and
+ * unmounts the file system when the socket is closed, even if the process dies.
+ *
+ * Errors are reported on mountStderr in the wording that newMountError (mounterr.go)
+ * classifies.
+ */
+
+// mountDiag is the diagnostic pipe of MountE (see hostDiag); while it is set the mount
+// functions report errors to it rather than to the standard error of the process.
+var (
+	mountDiagGuard sync.Mutex
+	mountDiag      *os.File
+)
+
+func mountStderr() *os.File {
+	mountDiagGuard.Lock()
+	defer mountDiagGuard.Unlock()
+	if nil != mountDiag {
+		return mountDiag
+	}
+	return os.Stderr
+}
+
+// mountConfig is the parsed command line of a file system.
+type mountConfig struct {
+	prog        string
+	mountpoint  string
+	debug       bool
+	single      bool
+	help        bool
+	version     bool
+	maxThreads  int
+	allowRoot   bool
+	autoUnmount bool
+	blkdev      bool
+	fsname      string
+	subtype     string
+	flags       uintptr  // mount(2) flags
+	kernelOpts  []string // options that are passed to the kernel
+	helperOpts  []string // options that only fusermount understands
+}
+
+// mountFlags are the options that correspond to mount(2) flags.
+var mountFlags = map[string]struct {
+	flag uintptr
+	set  bool
+}{
+	"rw":         {syscall.MS_RDONLY, false},
+	"ro":         {syscall.MS_RDONLY, true},
+	"suid":       {syscall.MS_NOSUID, false},
+	"nosuid":     {syscall.MS_NOSUID, true},
+	"dev":        {syscall.MS_NODEV, false},
+	"nodev":      {syscall.MS_NODEV, true},
+	"exec":       {syscall.MS_NOEXEC, false},
+	"noexec":     {syscall.MS_NOEXEC, true},
+	"async":      {syscall.MS_SYNCHRONOUS, false},
+	"sync":       {syscall.MS_SYNCHRONOUS, true},
+	"atime":      {syscall.MS_NOATIME, false},
+	"noatime":    {syscall.MS_NOATIME, true},
+	"diratime":   {syscall.MS_NODIRATIME, false},
+	"nodiratime": {syscall.MS_NODIRATIME, true},
+	"dirsync":    {syscall.MS_DIRSYNC, true},
+}
+
+// mountKernelOpts are the options (or option prefixes) that the kernel understands.
+var mountKernelOpts = []string{
+	"allow_other",
+	"default_permissions",
+	"blksize=",
+	"max_read=",
+	"context=",
+	"fscontext=",
+	"defcontext=",
+	"rootcontext=",
+}
+
+// mountParse parses the command line of a file system; args[0] is the program name.
+// Options that are not mount options are passed to other, which reports whether it
+// understands them; other may be nil. mountParse reports errors on stderr and returns
+// nil.
+func mountParse(args []string, other func(opt string) bool) *mountConfig {
+	mc := &mountConfig{
+		flags:      syscall.MS_NOSUID | syscall.MS_NODEV,
+		maxThreads: kernelThreads,
+	}
+	if 0 < len(args) {
+		mc.prog = args[0]
+		args = args[1:]
+	}
+	endopts := false
+	for i := 0; len(args) > i; i++ {
+		arg := args[i]
+		switch {
+		case endopts || !strings.HasPrefix(arg, "-"):
+			if "" != mc.mountpoint {
+				fmt.Fprintf(mountStderr(), "fuse: invalid argument `%s'\n", arg)
+				return nil
+			}
+			mc.mountpoint = arg
+		case "--" == arg:
+			endopts = true
+		case "-h" == arg || "--help" == arg:
+			mc.help = true
+		case "-V" == arg || "--version" == arg:
+			mc.version = true
+		case "-d" == arg:
+			mc.debug = true
+		case "-s" == arg:
+			mc.single = true
+		case "-f" == arg:
+			// we always run in the foreground
+		case "-o" == arg:
+			if len(args) <= i+1 {
+				fmt.Fprintf(mountStderr(), "fuse: missing argument after `-o'\n")
+				return nil
+			}
+			i++
+			if !mc.parseGroup(args[i], other) {
+				return nil
+			}
+		case strings.HasPrefix(arg, "-o"):
+			if !mc.parseGroup(arg[2:], other) {
+				return nil
+			}
+		default:
+			fmt.Fprintf(mountStderr(), "fuse: unknown option `%s'\n", arg)
+			return nil
+		}
+	}
+	if "" == mc.subtype && "" != mc.prog {
+		mc.subtype = filepath.Base(mc.prog)
+	}
+	return mc
+}
+
+func (mc *mountConfig) parseGroup(group string, other func(opt string) bool) bool {
+	for _, opt := range optSplit(group) {
+		if !mc.parseOpt(opt, other) {
+			fmt.Fprintf(mountStderr(), "fuse: unknown option `%s'\n", opt)
+			return false
+		}
+	}
+	return true
+}
+
+func (mc *mountConfig) parseOpt(opt string, other func(opt string) bool) bool {
+	name, value, hasValue := opt, "", false
+	if i := strings.IndexByte(opt, '='); -1 != i {
+		name, value, hasValue = opt[:i], opt[i+1:], true
+	}
+	if f, ok := mountFlags[opt]; ok {
+		if f.set {
+			mc.flags |= f.flag
+		} else {
+			mc.flags &^= f.flag
+		}
+		return true
+	}
+	for _, k := range mountKernelOpts {
+		if k == opt || (strings.HasSuffix(k, "=") && strings.HasPrefix(opt, k)) {
+			mc.kernelOpts = append(mc.kernelOpts, opt)
+			return true
+		}
+	}
+	switch {
+	case "" == opt || strings.HasPrefix(opt, "x-"):
+		// empty options and userspace mount options (x-*) are ignored
+		return true
+	case "debug" == opt:
+		mc.debug = true
+		return true
+	case "allow_root" == opt:
+		// the kernel must allow other users; we reject those that are not root
+		mc.allowRoot = true
+		mc.kernelOpts = append(mc.kernelOpts, "allow_other")
+		return true
+	case "auto_unmount" == opt:
+		mc.autoUnmount = true
+		mc.helperOpts = append(mc.helperOpts, opt)
+		return true
+	case "blkdev" == opt:
+		mc.blkdev = true
+		mc.helperOpts = append(mc.helperOpts, opt)
+		return true
+	case "nonempty" == opt:
+		// mounting over a non-empty directory is always allowed
+		return true
+	case "fsname" == name && hasValue:
+		mc.fsname = value
+		return true
+	case "subtype" == name && hasValue:
+		mc.subtype = value
+		return true
+	case "max_threads" == name && hasValue:
+		n, err := strconv.Atoi(value)
+		if nil != err || 1 > n {
+			return false
+		}
+		mc.maxThreads = n
+		return true
+	case "max_idle_threads" == name && hasValue, "clone_fd" == opt:
+		// we do not keep idle threads or clone descriptors
+		return true
+	}
+	return nil != other && other(opt)
+}
+
+// mountHelp writes the help of the mount options to stdout.
+func mountHelp(prog string) {
+	fmt.Printf("usage: %s [options] <mountpoint>\n\n", prog)
+	fmt.Print("FUSE options:\n" +
+		"    -h   --help            print help\n" +
+		"    -V   --version         print version\n" +
+		"    -d   -o debug          enable debug output\n" +
+		"    -f                     foreground operation (always)\n" +
+		"    -s                     disable multi-threaded operation\n" +
+		"    -o max_threads=N       maximum number of threads\n" +
+		"    -o allow_other         allow access by all users\n" +
+		"    -o allow_root          allow access by root\n" +
+		"    -o auto_unmount        auto unmount on process termination\n" +
+		"    -o default_permissions enable permission checking by the kernel\n" +
+		"    -o fsname=NAME         set file system name\n" +
+		"    -o subtype=NAME        set file system type\n" +
+		"    -o max_read=N          set maximum size of read requests\n" +
+		"    -o ro, rw, [no]suid, [no]dev, [no]exec, sync, async, dirsync, [no]atime\n" +
+		"                           mount flags\n")
+}
+
+// mountVersion writes the version to stdout.
+func mountVersion() {
+	fmt.Printf("cgofuse FUSE layer (no cgo)\n")
+	fmt.Printf("using FUSE kernel interface version %d.%d\n", kernelMajor, kernelMinor)
+}
+
+// mountSession is a mounted file system.
+type mountSession struct {
+	mountpoint string
+	fd         int
+	sock       int         // auto_unmount socket of fusermount or -1
+	proc       *os.Process // fusermount with auto_unmount or nil
+	external   bool        // the mountpoint is /dev/fd/N
+}
+
+// mount mounts the file system and returns the session, or nil if it fails.
+func (mc *mountConfig) mount() *mountSession {
+	if "" == mc.mountpoint {
+		fmt.Fprintf(mountStderr(), "fuse: no mount point\n")
+		return nil
+	}
+
+	// The mountpoint may be a descriptor of /dev/fuse that was opened and mounted by
+	// a privileged parent process.
+	if strings.HasPrefix(mc.mountpoint, "/dev/fd/") {
+		fd, err := strconv.Atoi(mc.mountpoint[len("/dev/fd/"):])
+		if nil == err && 0 <= fd {
+			if _, err := fcntl(fd, syscall.F_GETFD, 0); nil != err {
+				fmt.Fprintf(mountStderr(), "fuse: invalid file descriptor %s\n", mc.mountpoint)
+				return nil
+			}
+			return &mountSession{mountpoint: mc.mountpoint, fd: fd, sock: -1, external: true}
+		}
+	}
+
+	var stbuf syscall.Stat_t
+	if err := syscall.Stat(mc.mountpoint, &stbuf); nil != err {
+		fmt.Fprintf(mountStderr(), "fuse: bad mount point `%s': %s\n", mc.mountpoint, err.Error())
+		return nil
+	}
+
+	if !mc.autoUnmount && !mc.blkdev {
+		fd, err := mc.mountSys(&stbuf)
+		if nil == err {
+			return &mountSession{mountpoint: mc.mountpoint, fd: fd, sock: -1}
+		}
+		if syscall.EPERM != err {
+			return nil
+		}
+		// not privileged; let fusermount mount the file system
+	}
+	return mc.mountFusermount()
+}
+
+// mountSys mounts the file system with mount(2). It reports errors on stderr, except
+// EPERM which tells the caller to try fusermount.
+func (mc *mountConfig) mountSys(stbuf *syscall.Stat_t) (int, error) {
+	fd, err := syscall.Open("/dev/fuse", syscall.O_RDWR|syscall.O_CLOEXEC, 0)
+	if nil != err {
+		if syscall.ENOENT == err || syscall.ENODEV == err {
+			fmt.Fprintf(mountStderr(), "fuse: device not found, try 'modprobe fuse' first\n")
+		} else {
+			fmt.Fprintf(mountStderr(), "fuse: failed to open /dev/fuse: %s\n", err.Error())
+		}
+		return -1, err
+	}
+
+	data := fmt.Sprintf("fd=%d,rootmode=%o,user_id=%d,group_id=%d",
+		fd, stbuf.Mode&syscall.S_IFMT, os.Getuid(), os.Getgid())
+	for _, opt := range mc.kernelOpts {
+		data += "," + opt
+	}
+	source := mc.fsname
+	if "" == source {
+		source = mc.subtype
+	}
+	if "" == source {
+		source = "/dev/fuse"
+	}
+	fstype := "fuse"
+	if "" != mc.subtype {
+		fstype += "." + mc.subtype
+	}
+
+	err = syscall.Mount(source, mc.mountpoint, fstype, mc.flags, data)
+	if syscall.ENODEV == err && "fuse" != fstype {
+		// the kernel does not support subtypes
+		err = syscall.Mount(source, mc.mountpoint, "fuse", mc.flags, data)
+	}
+	if nil != err {
+		syscall.Close(fd)
+		if syscall.EPERM != err {
+			fmt.Fprintf(mountStderr(), "fuse: mount failed: %s\n", err.Error())
+		}
+		return -1, err
+	}
+	return fd, nil
+}
+
+// mountFusermount mounts the file system with fusermount.
+func (mc *mountConfig) mountFusermount() *mountSession {
+	prog := mountFusermountPath()
+	if "" == prog {
+		fmt.Fprintf(mountStderr(), "fuse: failed to exec fusermount3: %s\n",
+			syscall.ENOENT.Error())
+		return nil
+	}
+
+	var opts []string
+	opts = append(opts, mc.kernelOpts...)
+	opts = append(opts, mc.helperOpts...)
+	for name, f := range mountFlags {
+		if f.set && mc.flags&f.flag == f.flag {
+			opts = append(opts, name)
+		}
+	}
+	if "" != mc.fsname {
+		opts = append(opts, "fsname="+mc.fsname)
+	}
+	if "" != mc.subtype {
+		opts = append(opts, "subtype="+mc.subtype)
+	}
+	for i := range opts {
+		opts[i] = optEscape(opts[i])
+	}
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if nil != err {
+		fmt.Fprintf(mountStderr(), "fuse: socketpair() failed: %s\n", err.Error())
+		return nil
+	}
+	theirs := os.NewFile(uintptr(fds[1]), "fusermount")
+	cmd := exec.Command(prog, "-o", strings.Join(opts, ","), "--", mc.mountpoint)
+	cmd.Env = append(os.Environ(), "_FUSE_COMMFD=3")
+	cmd.ExtraFiles = []*os.File{theirs}
+	cmd.Stdout = mountStderr()
+	cmd.Stderr = mountStderr()
+	err = cmd.Start()
+	theirs.Close()
+	if nil != err {
+		syscall.Close(fds[0])
+		fmt.Fprintf(mountStderr(), "fuse: failed to exec %s: %s\n", prog, err.Error())
+		return nil
+	}
+
+	fd := mountReceiveFd(fds[0])
+	if mc.autoUnmount && -1 != fd {
+		// fusermount unmounts the file system when it sees the socket close
+		return &mountSession{mountpoint: mc.mountpoint, fd: fd, sock: fds[0], proc: cmd.Process}
+	}
+	syscall.Close(fds[0])
+	cmd.Wait()
+	if -1 == fd {
+		// fusermount has reported the error
+		return nil
+	}
+	return &mountSession{mountpoint: mc.mountpoint, fd: fd, sock: -1}
+}
+
+// mountReceiveFd receives the descriptor of /dev/fuse that fusermount sends over sock.
+// It returns -1 if fusermount fails.
+func mountReceiveFd(sock int) int {
+	buf := make([]byte, 1)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	for {
+		n, oobn, _, _, err := syscall.Recvmsg(sock, buf, oob, syscall.MSG_CMSG_CLOEXEC)
+		if syscall.EINTR == err {
+			continue
+		}
+		if nil != err || 0 == n {
+			// fusermount exited without sending a descriptor
+			return -1
+		}
+		msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if nil != err || 0 == len(msgs) {
+			fmt.Fprintf(mountStderr(), "fuse: fusermount did not send a file descriptor\n")
+			return -1
+		}
+		fds, err := syscall.ParseUnixRights(&msgs[0])
+		if nil != err || 0 == len(fds) {
+			fmt.Fprintf(mountStderr(), "fuse: fusermount did not send a file descriptor\n")
+			return -1
+		}
+		for _, fd := range fds[1:] {
+			syscall.Close(fd)
+		}
+		return fds[0]
+	}
+}
+
+// mountFusermountPath returns the path of fusermount3 or fusermount (the FUSE2 program
+// uses the same protocol), or "" if neither is installed.
+func mountFusermountPath() string {
+	for _, name := range []string{"fusermount3", "fusermount"} {
+		for _, dir := range []string{"/bin", "/usr/bin"} {
+			path := dir + "/" + name
+			if nil == syscall.Access(path, X_OK) {
+				return path
+			}
+		}
+		if path, err := exec.LookPath(name); nil == err {
+			return path
+		}
+	}
+	return ""
+}
+
+// mountUnmount unmounts the file system mounted at mountpoint. It returns 1 if it was
+// unmounted with umount2, 2 if it was unmounted with fusermount and 0 on failure.
+func mountUnmount(mountpoint string) int {
+	// umount2 succeeds if we have the privileges to unmount
+	if nil == syscall.Unmount(mountpoint, syscall.MNT_DETACH) {
+		return 1
+	}
+	if prog := mountFusermountPath(); "" != prog &&
+		nil == exec.Command(prog, "-u", "-q", "-z", "--", mountpoint).Run() {
+		return 2
+	}
+	return 0
+}
+
+// unmount unmounts the file system unless it has already been unmounted, and closes
+// the FUSE device.
+func (ms *mountSession) unmount() {
+	if -1 == ms.fd {
+		return
+	}
+	if !ms.external {
+		// The device reports POLLERR once the file system has been unmounted or the
+		// connection has been aborted; there is nothing left to unmount then.
+		// With auto_unmount closing the socket makes fusermount unmount.
+		pfd := pollFd{fd: int32(ms.fd), events: pollIN}
+		if n, _ := pollNow(&pfd); -1 == ms.sock && (1 != n || 0 == pfd.revents&pollERR) {
+			mountUnmount(ms.mountpoint)
+		}
+	}
+	if -1 != ms.sock {
+		syscall.Close(ms.sock)
+		ms.sock = -1
+	}
+	if nil != ms.proc {
+		ms.proc.Wait()
+		ms.proc = nil
+	}
+	syscall.Close(ms.fd)
+	ms.fd = -1
+}
+
+const (
+	pollIN  = 0x1
+	pollERR = 0x8
+)
+
+type pollFd struct {
+	fd      int32
+	events  int16
+	revents int16
+}
+
+// pollNow polls a descriptor without waiting.
+func pollNow(pfd *pollFd) (int, error) {
+	var ts syscall.Timespec
+	n, _, e := syscall.Syscall6(syscall.SYS_PPOLL,
+		uintptr(unsafe.Pointer(pfd)), 1, uintptr(unsafe.Pointer(&ts)), 0, 0, 0)
+	if 0 != e {
+		return -1, e
+	}
+	return int(n), nil
+}
+
+func fcntl(fd int, cmd int, arg int) (int, error) {
+	n, _, e := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), uintptr(cmd), uintptr(arg))
+	if 0 != e {
+		return -1, e
+	}
+	return int(n), nil
+}
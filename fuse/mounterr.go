@@ -0,0 +1,182 @@
+/*
+ * mounterr.go
+ *
+ * Copyright 2017-2022 Bill Zissimopoulos
+ */
+/*
+ * This file is part of Cgofuse.
+ *
+ * It is licensed under the MIT license. The full license text can be found
+ * in the License.txt file at the root of this project.
+ */
+
+package fuse
+
+import (
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// MountErrorKind is the category of a MountError.
+type MountErrorKind int
+
+const (
+	// The reason of the failure is not known. The MountError Message may contain
+	// additional information.
+	MountErrUnknown MountErrorKind = iota
+
+	// The FUSE library (WinFsp on Windows) could not be found.
+	MountErrLibrary
+
+	// The mount options are invalid.
+	MountErrOptions
+
+	// The mountpoint is missing, does not exist, is not a directory or is not empty.
+	MountErrMountpoint
+
+	// The process does not have permission to mount the file system; for example, it
+	// cannot open /dev/fuse or it does not own the mountpoint.
+	MountErrPermission
+
+	// The FUSE device (/dev/fuse) does not exist; for example, the FUSE kernel module
+	// is not loaded.
+	MountErrDevice
+
+	// The fusermount helper program could not be found.
+	MountErrFusermount
+)
+
+func (self MountErrorKind) String() string {
+	switch self {
+	case MountErrLibrary:
+		return "cannot find FUSE library"
+	case MountErrOptions:
+		return "invalid mount options"
+	case MountErrMountpoint:
+		return "invalid mountpoint"
+	case MountErrPermission:
+		return "permission denied"
+	case MountErrDevice:
+		return "cannot find FUSE device"
+	case MountErrFusermount:
+		return "cannot find fusermount"
+	default:
+		return "mount failed"
+	}
+}
+
+// MountError describes why a file system could not be mounted. It is returned by
+// FileSystemHost.MountE.
+type MountError struct {
+	// Category of the failure.
+	Kind MountErrorKind
+
+	// Underlying error code (for example fuse.EACCES) or 0 if it is not known.
+	Errno int
+
+	// Diagnostic output of the FUSE layer.
+	Message string
+}
+
+func (self *MountError) Error() string {
+	s := "cgofuse: " + self.Kind.String()
+	if m := strings.Join(strings.Fields(self.Message), " "); "" != m {
+		s += ": " + m
+	}
+	return s
+}
+
+// Unwrap returns the underlying error code as a fuse.Error, so that errors.Is and
+// errors.As can be used with a MountError; for example,
+// errors.Is(err, fs.ErrPermission).
+func (self *MountError) Unwrap() error {
+	if 0 == self.Errno {
+		return nil
+	}
+	return Error(-self.Errno)
+}
+
+// newMountError creates a MountError from the diagnostic output of the FUSE layer.
+func newMountError(message string) *MountError {
+	err := &MountError{Message: strings.TrimSpace(message)}
+	m := strings.ToLower(err.Message)
+	err.Errno = mountErrno(m)
+
+	contains := func(subs ...string) bool {
+		for _, sub := range subs {
+			if strings.Contains(m, sub) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case contains("exec fusermount") ||
+		(contains("fusermount") && ENOENT == err.Errno):
+		err.Kind = MountErrFusermount
+	case EPERM == err.Errno || EACCES == err.Errno ||
+		contains("not owned by user", "no write access", "only allowed if"):
+		err.Kind = MountErrPermission
+	case ENODEV == err.Errno || contains("device not found"):
+		err.Kind = MountErrDevice
+	case contains("mountpoint is not empty"):
+		err.Kind = MountErrMountpoint
+		err.Errno = ENOTEMPTY
+	case contains("mountpoint", "mount point"):
+		err.Kind = MountErrMountpoint
+	case contains("unknown option", "invalid argument", "invalid parameter",
+		"missing argument", "mutually exclusive", "usage:"):
+		err.Kind = MountErrOptions
+	}
+
+	return err
+}
+
+// mountErrno finds the first error description (as returned by strerror) in m and
+// returns the corresponding error code.
+func mountErrno(m string) int {
+	if "windows" == runtime.GOOS {
+		return 0
+	}
+	errc, pos, size := 0, len(m), 0
+	for _, e := range errorStrings {
+		s := strings.ToLower(syscall.Errno(e.errc).Error())
+		if i := strings.Index(m, s); -1 != i && (pos > i || (pos == i && size < len(s))) {
+			errc, pos, size = e.errc, i, len(s)
+		}
+	}
+	return errc
+}
+
+// UnmountError describes why a file system could not be unmounted as requested. It is
+// returned by FileSystemHost.UnmountE.
+type UnmountError struct {
+	// Requested unmount mode.
+	Mode UnmountMode
+
+	// Steps that were taken; for example, "drain" followed by "umount2(MNT_DETACH)".
+	Steps []string
+
+	// Number of operations that were still in flight when a drain timed out.
+	InFlight int
+
+	// Underlying error.
+	Err error
+}
+
+func (self *UnmountError) Error() string {
+	s := "cgofuse: " + self.Mode.String() + " unmount"
+	if 0 < len(self.Steps) {
+		s += " (" + strings.Join(self.Steps, ", then ") + ")"
+	}
+	if nil != self.Err {
+		s += ": " + self.Err.Error()
+	}
+	return s
+}
+
+func (self *UnmountError) Unwrap() error {
+	return self.Err
+}
@@ -0,0 +1,88 @@
+/*
+ * mounterr_test.go
+ *
+ * Copyright 2017-2022 Bill Zissimopoulos
+ */
+/*
+ * This file is part of Cgofuse.
+ *
+ * It is licensed under the MIT license. The full license text can be found
+ * in the License.txt file at the root of this project.
+ */
+
+package fuse
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestMountError(t *testing.T) {
+	tests := []struct {
+		message string
+		kind    MountErrorKind
+		errno   int
+	}{
+		{"fuse: unknown option `bogus'\n", MountErrOptions, 0},
+		{"fuse: unknown option(s): `-o bogus'\n", MountErrOptions, 0},
+		{"fuse: bad mount point `/mnt': No such file or directory\n", MountErrMountpoint, ENOENT},
+		{"fuse: mountpoint is not empty\n", MountErrMountpoint, ENOTEMPTY},
+		{"fuse: failed to open /dev/fuse: Permission denied\n", MountErrPermission, EACCES},
+		{"fusermount: user has no write access to mountpoint /mnt\n", MountErrPermission, 0},
+		{"fuse: device not found, try 'modprobe fuse' first\n", MountErrDevice, 0},
+		{"fuse: failed to exec fusermount: No such file or directory\n", MountErrFusermount, ENOENT},
+		{"", MountErrUnknown, 0},
+	}
+	for _, test := range tests {
+		err := newMountError(test.message)
+		errno := test.errno
+		if "windows" == runtime.GOOS {
+			errno = 0
+		}
+		if test.kind != err.Kind || errno != err.Errno {
+			t.Errorf("newMountError(%q) = %v, %v; expected %v, %v",
+				test.message, err.Kind, err.Errno, test.kind, errno)
+		}
+	}
+}
+
+func TestMountE(t *testing.T) {
+	if "linux" != runtime.GOOS && "freebsd" != runtime.GOOS {
+		return
+	}
+	path, err := ioutil.TempDir("", "test")
+	if nil != err {
+		panic(err)
+	}
+	defer os.Remove(path)
+	mntp := filepath.Join(path, "nonexistent")
+	host := NewFileSystemHost(&testfs{})
+	err = host.MountE(mntp, nil)
+	var merr *MountError
+	if !errors.As(err, &merr) {
+		t.Error("MountE expected MountError", err)
+	} else if MountErrMountpoint != merr.Kind || !errors.Is(err, fs.ErrNotExist) {
+		t.Error("MountE expected MountErrMountpoint and ENOENT", err)
+	}
+}
+
+func TestUnmountError(t *testing.T) {
+	err := &UnmountError{
+		Mode:     UnmountDrain,
+		Steps:    []string{"drain", "umount2(MNT_DETACH)"},
+		InFlight: 1,
+		Err:      Error(-EBUSY),
+	}
+	s := "cgofuse: drain unmount (drain, then umount2(MNT_DETACH)): " + Error(-EBUSY).Error()
+	if s != err.Error() {
+		t.Errorf("Error %q; expected %q", err.Error(), s)
+	}
+	if !errors.Is(err, Error(-EBUSY)) {
+		t.Error("errors.Is failed")
+	}
+}
@@ -0,0 +1,945 @@
+/*
+ * node.go
+ *
+ * Copyright 2017-2022 Bill Zissimopoulos
+ */
+/*
+ * This file is part of Cgofuse.
+ *
+ * It is licensed under the MIT license. The full license text can be found
+ * in the License.txt file at the root of this project.
+ */
+
+package fuse
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+)
+
+// Node is the interface that the objects (files, directories, symbolic links, etc.) of a
+// node-based file system must implement. A node-based file system is a tree of nodes that
+// is hosted by a NodeFileSystem, which implements FileSystemInterface on top of it.
+//
+// The methods of a Node receive names and other nodes rather than paths: the
+// NodeFileSystem resolves paths to nodes by calling Lookup on each path component,
+// remembers the nodes that it has resolved and updates its bookkeeping when nodes are
+// created, linked, unlinked and renamed. A Node must therefore have a stable identity:
+// Lookup must return the same Node every time that it is called for the same object.
+// A Node that is reachable through multiple names is a hard link.
+//
+// Methods that create a node (Mknod, Mkdir, Symlink, Create) and methods that remove or
+// rename a node (Unlink, Rmdir, Rename) are called on the parent directory. Calls that
+// change the namespace are serialized by the NodeFileSystem; all other calls (including
+// Lookup) may be made concurrently.
+//
+// The names passed to the methods of a Node are never "." or "..". All methods must
+// return 0 on success or the NEGATIVE value of a FUSE error on failure.
+type Node interface {
+	// Getattr gets file attributes.
+	Getattr(stat *Stat_t) int
+
+	// Lookup looks up a child of a directory by name.
+	Lookup(name string) (int, Node)
+
+	// Readdir reads the children of a directory. The entries "." and ".." are added by
+	// the NodeFileSystem. The stat passed to fill may be nil.
+	Readdir(fill func(name string, stat *Stat_t) bool) int
+
+	// Mknod creates a file node in a directory.
+	Mknod(name string, mode uint32, dev uint64) (int, Node)
+
+	// Mkdir creates a directory in a directory.
+	Mkdir(name string, mode uint32) (int, Node)
+
+	// Symlink creates a symbolic link in a directory.
+	Symlink(name string, target string) (int, Node)
+
+	// Link creates a hard link in a directory to an existing node.
+	Link(name string, node Node) int
+
+	// Unlink removes a file from a directory.
+	Unlink(name string) int
+
+	// Rmdir removes a directory from a directory.
+	Rmdir(name string) int
+
+	// Rename renames a child of a directory. Any existing node with the new name in
+	// the new parent directory must be replaced, as with rename(2).
+	Rename(oldname string, newparent Node, newname string) int
+
+	// Readlink reads the target of a symbolic link.
+	Readlink() (int, string)
+
+	// Chmod changes the permission bits of a file.
+	Chmod(mode uint32) int
+
+	// Chown changes the owner and group of a file.
+	Chown(uid uint32, gid uint32) int
+
+	// Utimens changes the access and modification times of a file.
+	Utimens(tmsp []Timespec) int
+
+	// Truncate changes the size of a file.
+	Truncate(size int64) int
+
+	// Access checks file access permissions.
+	Access(mask uint32) int
+
+	// Open opens a file and returns a Handle for it.
+	Open(flags int) (int, Handle)
+
+	// Create creates and opens a file in a directory and returns its Node and a Handle
+	// for it. If Create returns -ENOSYS the
+	// FUSE layer uses Mknod and Open instead.
+	Create(name string, flags int, mode uint32) (int, Node, Handle)
+
+	// Statfs gets file system statistics. It is only called on the root node.
+	Statfs(stat *Statfs_t) int
+
+	// Setxattr sets extended attributes.
+	Setxattr(name string, value []byte, flags int) int
+
+	// Getxattr gets extended attributes.
+	Getxattr(name string) (int, []byte)
+
+	// Removexattr removes extended attributes.
+	Removexattr(name string) int
+
+	// Listxattr lists extended attributes.
+	Listxattr(fill func(name string) bool) int
+}
+
+// Handle is the interface that the open files of a node-based file system must
+// implement. A Handle is returned by Node.Open or Node.Create and remains valid until
+// Release is called, even if its node is unlinked or renamed in the meantime.
+type Handle interface {
+	// Read reads data from a file.
+	Read(buff []byte, ofst int64) int
+
+	// Write writes data to a file.
+	Write(buff []byte, ofst int64) int
+
+	// Flush flushes cached file data.
+	Flush() int
+
+	// Fsync synchronizes file contents.
+	Fsync(datasync bool) int
+
+	// Release closes an open file.
+	Release() int
+}
+
+// NodeBase provides default implementations of the methods in Node.
+// The default implementations return -ENOSYS to signal that the node does not
+// implement a particular operation to the FUSE layer, except for Lookup and
+// Readdir, which behave as though the node is an empty directory.
+type NodeBase struct {
+}
+
+// Getattr gets file attributes.
+// The NodeBase implementation returns -ENOSYS.
+func (*NodeBase) Getattr(stat *Stat_t) int {
+	return -ENOSYS
+}
+
+// Lookup looks up a child of a directory by name.
+// The NodeBase implementation returns -ENOENT.
+func (*NodeBase) Lookup(name string) (int, Node) {
+	return -ENOENT, nil
+}
+
+// Readdir reads the children of a directory.
+// The NodeBase implementation returns 0 without calling fill.
+func (*NodeBase) Readdir(fill func(name string, stat *Stat_t) bool) int {
+	return 0
+}
+
+// Mknod creates a file node in a directory.
+// The NodeBase implementation returns -ENOSYS.
+func (*NodeBase) Mknod(name string, mode uint32, dev uint64) (int, Node) {
+	return -ENOSYS, nil
+}
+
+// Mkdir creates a directory in a directory.
+// The NodeBase implementation returns -ENOSYS.
+func (*NodeBase) Mkdir(name string, mode uint32) (int, Node) {
+	return -ENOSYS, nil
+}
+
+// Symlink creates a symbolic link in a directory.
+// The NodeBase implementation returns -ENOSYS.
+func (*NodeBase) Symlink(name string, target string) (int, Node) {
+	return -ENOSYS, nil
+}
+
+// Link creates a hard link in a directory to an existing node.
+// The NodeBase implementation returns -ENOSYS.
+func (*NodeBase) Link(name string, node Node) int {
+	return -ENOSYS
+}
+
+// Unlink removes a file from a directory.
+// The NodeBase implementation returns -ENOSYS.
+func (*NodeBase) Unlink(name string) int {
+	return -ENOSYS
+}
+
+// Rmdir removes a directory from a directory.
+// The NodeBase implementation returns -ENOSYS.
+func (*NodeBase) Rmdir(name string) int {
+	return -ENOSYS
+}
+
+// Rename renames a child of a directory.
+// The NodeBase implementation returns -ENOSYS.
+func (*NodeBase) Rename(oldname string, newparent Node, newname string) int {
+	return -ENOSYS
+}
+
+// Readlink reads the target of a symbolic link.
+// The NodeBase implementation returns -ENOSYS.
+func (*NodeBase) Readlink() (int, string) {
+	return -ENOSYS, ""
+}
+
+// Chmod changes the permission bits of a file.
+// The NodeBase implementation returns -ENOSYS.
+func (*NodeBase) Chmod(mode uint32) int {
+	return -ENOSYS
+}
+
+// Chown changes the owner and group of a file.
+// The NodeBase implementation returns -ENOSYS.
+func (*NodeBase) Chown(uid uint32, gid uint32) int {
+	return -ENOSYS
+}
+
+// Utimens changes the access and modification times of a file.
+// The NodeBase implementation returns -ENOSYS.
+func (*NodeBase) Utimens(tmsp []Timespec) int {
+	return -ENOSYS
+}
+
+// Truncate changes the size of a file.
+// The NodeBase implementation returns -ENOSYS.
+func (*NodeBase) Truncate(size int64) int {
+	return -ENOSYS
+}
+
+// Access checks file access permissions.
+// The NodeBase implementation returns -ENOSYS.
+func (*NodeBase) Access(mask uint32) int {
+	return -ENOSYS
+}
+
+// Open opens a file and returns a Handle for it.
+// The NodeBase implementation returns -ENOSYS.
+func (*NodeBase) Open(flags int) (int, Handle) {
+	return -ENOSYS, nil
+}
+
+// Create creates and opens a file in a directory.
+// The NodeBase implementation returns -ENOSYS.
+func (*NodeBase) Create(name string, flags int, mode uint32) (int, Node, Handle) {
+	return -ENOSYS, nil, nil
+}
+
+// Statfs gets file system statistics.
+// The NodeBase implementation returns -ENOSYS.
+func (*NodeBase) Statfs(stat *Statfs_t) int {
+	return -ENOSYS
+}
+
+// Setxattr sets extended attributes.
+// The NodeBase implementation returns -ENOSYS.
+func (*NodeBase) Setxattr(name string, value []byte, flags int) int {
+	return -ENOSYS
+}
+
+// Getxattr gets extended attributes.
+// The NodeBase implementation returns -ENOSYS.
+func (*NodeBase) Getxattr(name string) (int, []byte) {
+	return -ENOSYS, nil
+}
+
+// Removexattr removes extended attributes.
+// The NodeBase implementation returns -ENOSYS.
+func (*NodeBase) Removexattr(name string) int {
+	return -ENOSYS
+}
+
+// Listxattr lists extended attributes.
+// The NodeBase implementation returns -ENOSYS.
+func (*NodeBase) Listxattr(fill func(name string) bool) int {
+	return -ENOSYS
+}
+
+var _ Node = (*NodeBase)(nil)
+
+// HandleBase provides default implementations of the methods in Handle.
+// The default implementations return -ENOSYS, except for Flush and Release,
+// which return 0.
+type HandleBase struct {
+}
+
+// Read reads data from a file.
+// The HandleBase implementation returns -ENOSYS.
+func (*HandleBase) Read(buff []byte, ofst int64) int {
+	return -ENOSYS
+}
+
+// Write writes data to a file.
+// The HandleBase implementation returns -ENOSYS.
+func (*HandleBase) Write(buff []byte, ofst int64) int {
+	return -ENOSYS
+}
+
+// Flush flushes cached file data.
+// The HandleBase implementation returns 0.
+func (*HandleBase) Flush() int {
+	return 0
+}
+
+// Fsync synchronizes file contents.
+// The HandleBase implementation returns -ENOSYS.
+func (*HandleBase) Fsync(datasync bool) int {
+	return -ENOSYS
+}
+
+// Release closes an open file.
+// The HandleBase implementation returns 0.
+func (*HandleBase) Release() int {
+	return 0
+}
+
+var _ Handle = (*HandleBase)(nil)
+
+// NodeFileSystem implements FileSystemInterface on top of a tree of nodes. It resolves
+// paths to nodes, keeps track of the nodes that it has resolved across creations, hard
+// links, unlinks and renames, and maps file handles (fh) to Handle objects. A
+// NodeFileSystem is hosted by a FileSystemHost like any other file system:
+//
+//	host := fuse.NewFileSystemHost(fuse.NewNodeFileSystem(root))
+//
+// The NodeFileSystem remembers the nodes that it resolves, so that a path is usually
+// looked up only once. The number of nodes that it remembers is bounded (see
+// SetCacheSize); when the bound is exceeded the least recently used nodes are forgotten
+// and looked up again the next time that they are accessed. Open handles are not
+// affected. A file system whose nodes change behind the back of the NodeFileSystem
+// (for example a network file system) must call Invalidate with the affected paths.
+type NodeFileSystem struct {
+	FileSystemBase
+	root   *nodeEntry
+	nsmux  sync.RWMutex // serializes namespace changes
+	tblmux sync.Mutex   // guards the entry tree and the LRU list
+	lru    list.List    // entries other than the root; most recently used first
+	size   int
+	hndtab HandleTable[*nodeHandle]
+}
+
+// DefaultNodeCacheSize is the number of nodes that a NodeFileSystem remembers by
+// default.
+const DefaultNodeCacheSize = 16384
+
+type nodeEntry struct {
+	node Node
+	prnt *nodeEntry
+	name string
+	chld map[string]*nodeEntry
+	elem *list.Element // nil for the root and for entries that have been forgotten
+}
+
+type nodeHandle struct {
+	node   Node
+	handle Handle // nil for directories
+}
+
+// NewNodeFileSystem creates a NodeFileSystem whose root directory is root.
+func NewNodeFileSystem(root Node) *NodeFileSystem {
+	return &NodeFileSystem{
+		root: &nodeEntry{node: root},
+		size: DefaultNodeCacheSize,
+	}
+}
+
+// SetCacheSize sets the number of resolved nodes that the NodeFileSystem remembers.
+// If size is 0 nodes are not remembered and every path is resolved from the root; if
+// size is negative the number of remembered nodes is unbounded. The default is
+// DefaultNodeCacheSize.
+func (self *NodeFileSystem) SetCacheSize(size int) {
+	self.tblmux.Lock()
+	defer self.tblmux.Unlock()
+	self.size = size
+	self.evict()
+}
+
+// Invalidate forgets the node for a path and the nodes of its descendants, so that they
+// are looked up again the next time that they are accessed. It does not affect open
+// handles.
+func (self *NodeFileSystem) Invalidate(path string) {
+	self.nsmux.Lock()
+	defer self.nsmux.Unlock()
+	self.forget(path)
+}
+
+// Destroy releases all handles that remain open.
+func (self *NodeFileSystem) Destroy() {
+	for _, h := range self.hndtab.Destroy() {
+		if nil != h.handle {
+			h.handle.Release()
+		}
+	}
+}
+
+// Statfs gets file system statistics from the root node.
+func (self *NodeFileSystem) Statfs(path string, stat *Statfs_t) int {
+	return self.root.node.Statfs(stat)
+}
+
+// Mknod creates a file node.
+func (self *NodeFileSystem) Mknod(path string, mode uint32, dev uint64) int {
+	return self.make(path, func(prnt Node, name string) (int, Node) {
+		return prnt.Mknod(name, mode, dev)
+	})
+}
+
+// Mkdir creates a directory.
+func (self *NodeFileSystem) Mkdir(path string, mode uint32) int {
+	return self.make(path, func(prnt Node, name string) (int, Node) {
+		return prnt.Mkdir(name, mode)
+	})
+}
+
+// Unlink removes a file.
+func (self *NodeFileSystem) Unlink(path string) int {
+	return self.remove(path, func(prnt Node, name string) int {
+		return prnt.Unlink(name)
+	})
+}
+
+// Rmdir removes a directory.
+func (self *NodeFileSystem) Rmdir(path string) int {
+	return self.remove(path, func(prnt Node, name string) int {
+		return prnt.Rmdir(name)
+	})
+}
+
+// Link creates a hard link to a file.
+func (self *NodeFileSystem) Link(oldpath string, newpath string) int {
+	self.nsmux.Lock()
+	defer self.nsmux.Unlock()
+	errc, node := self.resolve(oldpath)
+	if 0 != errc {
+		return errc
+	}
+	return self.makeLocked(newpath, func(prnt Node, name string) (int, Node) {
+		return prnt.Link(name, node), node
+	})
+}
+
+// Symlink creates a symbolic link.
+func (self *NodeFileSystem) Symlink(target string, newpath string) int {
+	return self.make(newpath, func(prnt Node, name string) (int, Node) {
+		return prnt.Symlink(name, target)
+	})
+}
+
+// Readlink reads the target of a symbolic link.
+func (self *NodeFileSystem) Readlink(path string) (int, string) {
+	errc, node := self.lookup(path)
+	if 0 != errc {
+		return errc, ""
+	}
+	return node.Readlink()
+}
+
+// Rename renames a file.
+func (self *NodeFileSystem) Rename(oldpath string, newpath string) int {
+	self.nsmux.Lock()
+	defer self.nsmux.Unlock()
+	olddir, oldname := nodeSplit(oldpath)
+	newdir, newname := nodeSplit(newpath)
+	if "" == oldname || "" == newname {
+		return -EBUSY
+	}
+	if strings.HasPrefix(nodeClean(newpath), nodeClean(oldpath)+"/") {
+		// guard against directory loop creation
+		return -EINVAL
+	}
+	errc, oldprnt := self.resolve(olddir)
+	if 0 != errc {
+		return errc
+	}
+	errc, newprnt := self.resolve(newdir)
+	if 0 != errc {
+		return errc
+	}
+	errc = oldprnt.Rename(oldname, newprnt, newname)
+	if 0 != errc {
+		return errc
+	}
+
+	self.tblmux.Lock()
+	defer self.tblmux.Unlock()
+	olde := self.entry(olddir)
+	newe := self.entry(newdir)
+	var e *nodeEntry
+	if nil != olde {
+		e = olde.chld[oldname]
+	}
+	if nil != newe {
+		if t := newe.chld[newname]; nil != t {
+			self.delEntry(t)
+		}
+	}
+	if nil != e {
+		if nil != newe {
+			// keep the entry and its descendants
+			delete(olde.chld, oldname)
+			e.prnt = newe
+			e.name = newname
+			if nil == newe.chld {
+				newe.chld = map[string]*nodeEntry{}
+			}
+			newe.chld[newname] = e
+			self.touch(e)
+		} else {
+			self.delEntry(e)
+		}
+	}
+	return 0
+}
+
+// Chmod changes the permission bits of a file.
+func (self *NodeFileSystem) Chmod(path string, mode uint32) int {
+	errc, node := self.lookup(path)
+	if 0 != errc {
+		return errc
+	}
+	return node.Chmod(mode)
+}
+
+// Chown changes the owner and group of a file.
+func (self *NodeFileSystem) Chown(path string, uid uint32, gid uint32) int {
+	errc, node := self.lookup(path)
+	if 0 != errc {
+		return errc
+	}
+	return node.Chown(uid, gid)
+}
+
+// Utimens changes the access and modification times of a file.
+func (self *NodeFileSystem) Utimens(path string, tmsp []Timespec) int {
+	errc, node := self.lookup(path)
+	if 0 != errc {
+		return errc
+	}
+	return node.Utimens(tmsp)
+}
+
+// Access checks file access permissions.
+func (self *NodeFileSystem) Access(path string, mask uint32) int {
+	errc, node := self.lookup(path)
+	if 0 != errc {
+		return errc
+	}
+	return node.Access(mask)
+}
+
+// Create creates and opens a file.
+func (self *NodeFileSystem) Create(path string, flags int, mode uint32) (int, uint64) {
+	var handle Handle
+	var node Node
+	errc := self.make(path, func(prnt Node, name string) (int, Node) {
+		var errc int
+		errc, node, handle = prnt.Create(name, flags, mode)
+		return errc, node
+	})
+	if 0 != errc {
+		return errc, InvalidHandle
+	}
+	if nil == handle {
+		return -EIO, InvalidHandle
+	}
+	return 0, self.hndtab.New(&nodeHandle{node, handle})
+}
+
+// Open opens a file.
+func (self *NodeFileSystem) Open(path string, flags int) (int, uint64) {
+	errc, node := self.lookup(path)
+	if 0 != errc {
+		return errc, InvalidHandle
+	}
+	errc, handle := node.Open(flags)
+	if 0 != errc {
+		return errc, InvalidHandle
+	}
+	if nil == handle {
+		return -EIO, InvalidHandle
+	}
+	return 0, self.hndtab.New(&nodeHandle{node, handle})
+}
+
+// Getattr gets file attributes.
+func (self *NodeFileSystem) Getattr(path string, stat *Stat_t, fh uint64) int {
+	errc, node := self.lookupFh(path, fh)
+	if 0 != errc {
+		return errc
+	}
+	return node.Getattr(stat)
+}
+
+// Truncate changes the size of a file.
+func (self *NodeFileSystem) Truncate(path string, size int64, fh uint64) int {
+	errc, node := self.lookupFh(path, fh)
+	if 0 != errc {
+		return errc
+	}
+	return node.Truncate(size)
+}
+
+// Read reads data from a file.
+func (self *NodeFileSystem) Read(path string, buff []byte, ofst int64, fh uint64) int {
+	h, _ := self.hndtab.Get(fh)
+	if nil == h || nil == h.handle {
+		return -EBADF
+	}
+	return h.handle.Read(buff, ofst)
+}
+
+// Write writes data to a file.
+func (self *NodeFileSystem) Write(path string, buff []byte, ofst int64, fh uint64) int {
+	h, _ := self.hndtab.Get(fh)
+	if nil == h || nil == h.handle {
+		return -EBADF
+	}
+	return h.handle.Write(buff, ofst)
+}
+
+// Flush flushes cached file data.
+func (self *NodeFileSystem) Flush(path string, fh uint64) int {
+	h, _ := self.hndtab.Get(fh)
+	if nil == h || nil == h.handle {
+		return -EBADF
+	}
+	return h.handle.Flush()
+}
+
+// Release closes an open file.
+func (self *NodeFileSystem) Release(path string, fh uint64) int {
+	h, _, _ := self.hndtab.Release(fh)
+	if nil == h || nil == h.handle {
+		return -EBADF
+	}
+	return h.handle.Release()
+}
+
+// Fsync synchronizes file contents.
+func (self *NodeFileSystem) Fsync(path string, datasync bool, fh uint64) int {
+	h, _ := self.hndtab.Get(fh)
+	if nil == h || nil == h.handle {
+		return -EBADF
+	}
+	return h.handle.Fsync(datasync)
+}
+
+// Opendir opens a directory.
+func (self *NodeFileSystem) Opendir(path string) (int, uint64) {
+	errc, node := self.lookup(path)
+	if 0 != errc {
+		return errc, InvalidHandle
+	}
+	stat := Stat_t{}
+	errc = node.Getattr(&stat)
+	if 0 != errc {
+		return errc, InvalidHandle
+	}
+	if S_IFDIR != stat.Mode&S_IFMT {
+		return -ENOTDIR, InvalidHandle
+	}
+	return 0, self.hndtab.New(&nodeHandle{node, nil})
+}
+
+// Readdir reads a directory.
+func (self *NodeFileSystem) Readdir(path string,
+	fill func(name string, stat *Stat_t, ofst int64) bool,
+	ofst int64,
+	fh uint64) int {
+	h, _ := self.hndtab.Get(fh)
+	if nil == h || nil != h.handle {
+		return -EBADF
+	}
+	stat := Stat_t{}
+	if 0 == h.node.Getattr(&stat) {
+		fill(".", &stat, 0)
+	} else {
+		fill(".", nil, 0)
+	}
+	fill("..", nil, 0)
+	return h.node.Readdir(func(name string, stat *Stat_t) bool {
+		return fill(name, stat, 0)
+	})
+}
+
+// Releasedir closes an open directory.
+func (self *NodeFileSystem) Releasedir(path string, fh uint64) int {
+	h, _, _ := self.hndtab.Release(fh)
+	if nil == h || nil != h.handle {
+		return -EBADF
+	}
+	return 0
+}
+
+// Fsyncdir synchronizes directory contents.
+// The NodeFileSystem implementation returns 0.
+func (self *NodeFileSystem) Fsyncdir(path string, datasync bool, fh uint64) int {
+	return 0
+}
+
+// Setxattr sets extended attributes.
+func (self *NodeFileSystem) Setxattr(path string, name string, value []byte, flags int) int {
+	errc, node := self.lookup(path)
+	if 0 != errc {
+		return errc
+	}
+	return node.Setxattr(name, value, flags)
+}
+
+// Getxattr gets extended attributes.
+func (self *NodeFileSystem) Getxattr(path string, name string) (int, []byte) {
+	errc, node := self.lookup(path)
+	if 0 != errc {
+		return errc, nil
+	}
+	return node.Getxattr(name)
+}
+
+// Removexattr removes extended attributes.
+func (self *NodeFileSystem) Removexattr(path string, name string) int {
+	errc, node := self.lookup(path)
+	if 0 != errc {
+		return errc
+	}
+	return node.Removexattr(name)
+}
+
+// Listxattr lists extended attributes.
+func (self *NodeFileSystem) Listxattr(path string, fill func(name string) bool) int {
+	errc, node := self.lookup(path)
+	if 0 != errc {
+		return errc
+	}
+	return node.Listxattr(fill)
+}
+
+// lookup resolves a path to a node, holding off namespace changes.
+func (self *NodeFileSystem) lookup(path string) (int, Node) {
+	self.nsmux.RLock()
+	defer self.nsmux.RUnlock()
+	return self.resolve(path)
+}
+
+// lookupFh returns the node of an open handle, or resolves path if fh is not valid.
+func (self *NodeFileSystem) lookupFh(path string, fh uint64) (int, Node) {
+	if InvalidHandle != fh {
+		if h, _ := self.hndtab.Get(fh); nil != h {
+			return 0, h.node
+		}
+	}
+	return self.lookup(path)
+}
+
+// resolve resolves a path to a node. It must be called with nsmux held.
+func (self *NodeFileSystem) resolve(path string) (int, Node) {
+	e := self.root
+	for _, c := range strings.Split(path, "/") {
+		if "" == c {
+			continue
+		}
+		self.tblmux.Lock()
+		next := e.chld[c]
+		self.tblmux.Unlock()
+		if nil == next {
+			errc, node := e.node.Lookup(c)
+			if 0 != errc {
+				return errc, nil
+			}
+			if nil == node {
+				return -ENOENT, nil
+			}
+			self.tblmux.Lock()
+			if next = e.chld[c]; nil == next {
+				next = self.addEntry(e, c, node)
+			}
+			self.tblmux.Unlock()
+		}
+		e = next
+	}
+	self.tblmux.Lock()
+	self.touch(e)
+	self.tblmux.Unlock()
+	return 0, e.node
+}
+
+// entry returns the entry of a path that has already been resolved or nil.
+// It must be called with tblmux held.
+func (self *NodeFileSystem) entry(path string) *nodeEntry {
+	e := self.root
+	for _, c := range strings.Split(path, "/") {
+		if "" == c {
+			continue
+		}
+		if e = e.chld[c]; nil == e {
+			return nil
+		}
+	}
+	return e
+}
+
+// forget removes the entry of a path (and its descendants). It must be called with
+// nsmux held.
+func (self *NodeFileSystem) forget(path string) {
+	dir, name := nodeSplit(path)
+	self.tblmux.Lock()
+	defer self.tblmux.Unlock()
+	if "" == name {
+		for _, c := range self.root.chld {
+			self.delEntry(c)
+		}
+	} else if e := self.entry(dir); nil != e {
+		if c := e.chld[name]; nil != c {
+			self.delEntry(c)
+		}
+	}
+}
+
+// addEntry adds an entry for a node that has been resolved or created. The entry is not
+// remembered if its parent has been forgotten in the meantime. It must be called with
+// tblmux held.
+func (self *NodeFileSystem) addEntry(prnt *nodeEntry, name string, node Node) *nodeEntry {
+	e := &nodeEntry{node: node, prnt: prnt, name: name}
+	if (self.root != prnt && nil == prnt.elem) || 0 == self.size {
+		return e
+	}
+	if nil == prnt.chld {
+		prnt.chld = map[string]*nodeEntry{}
+	}
+	prnt.chld[name] = e
+	e.elem = self.lru.PushFront(e)
+	self.touch(prnt)
+	self.evict()
+	return e
+}
+
+// delEntry forgets an entry and its descendants. It must be called with tblmux held.
+func (self *NodeFileSystem) delEntry(e *nodeEntry) {
+	if nil != e.prnt && e == e.prnt.chld[e.name] {
+		delete(e.prnt.chld, e.name)
+	}
+	var del func(e *nodeEntry)
+	del = func(e *nodeEntry) {
+		for _, c := range e.chld {
+			del(c)
+		}
+		e.chld = nil
+		if nil != e.elem {
+			self.lru.Remove(e.elem)
+			e.elem = nil
+		}
+	}
+	del(e)
+}
+
+// touch marks an entry and its ancestors as recently used, so that ancestors are always
+// evicted after their descendants. It must be called with tblmux held.
+func (self *NodeFileSystem) touch(e *nodeEntry) {
+	for ; nil != e && nil != e.elem; e = e.prnt {
+		self.lru.MoveToFront(e.elem)
+	}
+}
+
+// evict forgets the least recently used entries until the cache size is not exceeded.
+// It must be called with tblmux held.
+func (self *NodeFileSystem) evict() {
+	for 0 <= self.size && self.lru.Len() > self.size {
+		self.delEntry(self.lru.Back().Value.(*nodeEntry))
+	}
+}
+
+// make creates a node by calling fn on the parent directory of path.
+func (self *NodeFileSystem) make(path string, fn func(prnt Node, name string) (int, Node)) int {
+	self.nsmux.Lock()
+	defer self.nsmux.Unlock()
+	return self.makeLocked(path, fn)
+}
+
+// makeLocked is like make, but it must be called with nsmux held.
+func (self *NodeFileSystem) makeLocked(path string,
+	fn func(prnt Node, name string) (int, Node)) int {
+	dir, name := nodeSplit(path)
+	if "" == name {
+		return -EEXIST
+	}
+	errc, prnt := self.resolve(dir)
+	if 0 != errc {
+		return errc
+	}
+	errc, node := fn(prnt, name)
+	if 0 != errc {
+		return errc
+	}
+	self.tblmux.Lock()
+	defer self.tblmux.Unlock()
+	if e := self.entry(dir); nil != e {
+		if c := e.chld[name]; nil != c {
+			self.delEntry(c)
+		}
+		if nil != node {
+			self.addEntry(e, name, node)
+		}
+	}
+	return 0
+}
+
+// remove removes a node by calling fn on the parent directory of path.
+func (self *NodeFileSystem) remove(path string, fn func(prnt Node, name string) int) int {
+	self.nsmux.Lock()
+	defer self.nsmux.Unlock()
+	dir, name := nodeSplit(path)
+	if "" == name {
+		return -EBUSY
+	}
+	errc, prnt := self.resolve(dir)
+	if 0 != errc {
+		return errc
+	}
+	errc = fn(prnt, name)
+	if 0 != errc {
+		return errc
+	}
+	self.forget(path)
+	return 0
+}
+
+// nodeClean removes redundant slashes from a path.
+func nodeClean(path string) string {
+	comps := []string{}
+	for _, c := range strings.Split(path, "/") {
+		if "" != c {
+			comps = append(comps, c)
+		}
+	}
+	return "/" + strings.Join(comps, "/")
+}
+
+// nodeSplit splits a path into its parent directory and name. The name of the root
+// directory is "".
+func nodeSplit(path string) (dir string, name string) {
+	path = nodeClean(path)
+	i := strings.LastIndex(path, "/")
+	return path[:i], path[i+1:]
+}
+
+var _ FileSystemInterface = (*NodeFileSystem)(nil)
@@ -0,0 +1,311 @@
+/*
+ * node_test.go
+ *
+ * Copyright 2017-2022 Bill Zissimopoulos
+ */
+/*
+ * This file is part of Cgofuse.
+ *
+ * It is licensed under the MIT license. The full license text can be found
+ * in the License.txt file at the root of this project.
+ */
+
+package fuse
+
+import (
+	"sort"
+	"sync"
+	"testing"
+)
+
+type testnode struct {
+	NodeBase
+	mux      *sync.Mutex
+	lookups  *int
+	mode     uint32
+	nlink    uint32
+	nohandle bool
+	data     []byte
+	chld     map[string]*testnode
+}
+
+type testhandle struct {
+	HandleBase
+	node *testnode
+}
+
+func newTestnode(prnt *testnode, mode uint32) *testnode {
+	node := &testnode{mode: mode, nlink: 1}
+	if nil != prnt {
+		node.mux, node.lookups = prnt.mux, prnt.lookups
+	} else {
+		node.mux, node.lookups = &sync.Mutex{}, new(int)
+	}
+	if S_IFDIR == mode&S_IFMT {
+		node.chld = map[string]*testnode{}
+	}
+	return node
+}
+
+func (self *testnode) Getattr(stat *Stat_t) int {
+	self.mux.Lock()
+	defer self.mux.Unlock()
+	*stat = Stat_t{Mode: self.mode, Nlink: self.nlink, Size: int64(len(self.data))}
+	return 0
+}
+
+func (self *testnode) Lookup(name string) (int, Node) {
+	self.mux.Lock()
+	defer self.mux.Unlock()
+	*self.lookups++
+	if chld, ok := self.chld[name]; ok {
+		return 0, chld
+	}
+	return -ENOENT, nil
+}
+
+func (self *testnode) Readdir(fill func(name string, stat *Stat_t) bool) int {
+	self.mux.Lock()
+	defer self.mux.Unlock()
+	for name := range self.chld {
+		if !fill(name, nil) {
+			break
+		}
+	}
+	return 0
+}
+
+func (self *testnode) Mkdir(name string, mode uint32) (int, Node) {
+	self.mux.Lock()
+	defer self.mux.Unlock()
+	if _, ok := self.chld[name]; ok {
+		return -EEXIST, nil
+	}
+	chld := newTestnode(self, S_IFDIR|mode)
+	self.chld[name] = chld
+	return 0, chld
+}
+
+func (self *testnode) Create(name string, flags int, mode uint32) (int, Node, Handle) {
+	self.mux.Lock()
+	defer self.mux.Unlock()
+	if _, ok := self.chld[name]; ok {
+		return -EEXIST, nil, nil
+	}
+	chld := newTestnode(self, S_IFREG|mode)
+	self.chld[name] = chld
+	if self.nohandle {
+		return 0, chld, nil
+	}
+	return 0, chld, &testhandle{node: chld}
+}
+
+func (self *testnode) Link(name string, node Node) int {
+	self.mux.Lock()
+	defer self.mux.Unlock()
+	chld := node.(*testnode)
+	chld.nlink++
+	self.chld[name] = chld
+	return 0
+}
+
+func (self *testnode) Unlink(name string) int {
+	self.mux.Lock()
+	defer self.mux.Unlock()
+	chld, ok := self.chld[name]
+	if !ok {
+		return -ENOENT
+	}
+	chld.nlink--
+	delete(self.chld, name)
+	return 0
+}
+
+func (self *testnode) Rename(oldname string, newparent Node, newname string) int {
+	self.mux.Lock()
+	defer self.mux.Unlock()
+	chld, ok := self.chld[oldname]
+	if !ok {
+		return -ENOENT
+	}
+	delete(self.chld, oldname)
+	newparent.(*testnode).chld[newname] = chld
+	return 0
+}
+
+func (self *testnode) Open(flags int) (int, Handle) {
+	return 0, &testhandle{node: self}
+}
+
+func (self *testhandle) Read(buff []byte, ofst int64) int {
+	self.node.mux.Lock()
+	defer self.node.mux.Unlock()
+	if int64(len(self.node.data)) <= ofst {
+		return 0
+	}
+	return copy(buff, self.node.data[ofst:])
+}
+
+func (self *testhandle) Write(buff []byte, ofst int64) int {
+	self.node.mux.Lock()
+	defer self.node.mux.Unlock()
+	if end := ofst + int64(len(buff)); int64(len(self.node.data)) < end {
+		self.node.data = append(self.node.data, make([]byte, end-int64(len(self.node.data)))...)
+	}
+	return copy(self.node.data[ofst:], buff)
+}
+
+func TestNodeFileSystem(t *testing.T) {
+	root := newTestnode(nil, S_IFDIR|0755)
+	fsop := NewNodeFileSystem(root)
+
+	if errc := fsop.Mkdir("/d", 0755); 0 != errc {
+		t.Error("Mkdir failed", errc)
+	}
+	errc, fh := fsop.Create("/d/f", O_RDWR, 0644)
+	if 0 != errc {
+		t.Fatal("Create failed", errc)
+	}
+	if n := fsop.Write("/d/f", []byte("hello"), 0, fh); 5 != n {
+		t.Error("Write failed", n)
+	}
+
+	// lookups of created nodes are answered without calling Lookup
+	stat := Stat_t{}
+	if errc := fsop.Getattr("/d/f", &stat, InvalidHandle); 0 != errc || 5 != stat.Size {
+		t.Error("Getattr failed", errc, stat)
+	}
+	if 0 != *root.lookups {
+		t.Error("unexpected Lookup calls", *root.lookups)
+	}
+
+	// rename of a directory moves its resolved children along
+	if errc := fsop.Rename("/d", "/e"); 0 != errc {
+		t.Error("Rename failed", errc)
+	}
+	if errc := fsop.Rename("/e", "/e/x"); -EINVAL != errc {
+		t.Error("Rename into itself expected -EINVAL", errc)
+	}
+	if errc := fsop.Getattr("/d/f", &stat, InvalidHandle); -ENOENT != errc {
+		t.Error("Getattr of old path expected -ENOENT", errc)
+	}
+	if errc := fsop.Getattr("/e/f", &stat, InvalidHandle); 0 != errc || 5 != stat.Size {
+		t.Error("Getattr of new path failed", errc, stat)
+	}
+
+	// a Create that returns no handle fails rather than yield a directory handle
+	root.chld["e"].nohandle = true
+	if errc, _ := fsop.Create("/e/n", O_RDWR, 0644); -EIO != errc {
+		t.Error("Create without handle expected -EIO", errc)
+	}
+
+	// hard links resolve to the same node
+	if errc := fsop.Link("/e/f", "/g"); 0 != errc {
+		t.Error("Link failed", errc)
+	}
+	if errc := fsop.Getattr("/g", &stat, InvalidHandle); 0 != errc || 2 != stat.Nlink {
+		t.Error("Getattr of link failed", errc, stat)
+	}
+
+	// an open handle survives the unlink of its node
+	if errc := fsop.Unlink("/e/f"); 0 != errc {
+		t.Error("Unlink failed", errc)
+	}
+	if errc := fsop.Unlink("/g"); 0 != errc {
+		t.Error("Unlink failed", errc)
+	}
+	if errc := fsop.Getattr("/g", &stat, InvalidHandle); -ENOENT != errc {
+		t.Error("Getattr of unlinked path expected -ENOENT", errc)
+	}
+	if errc := fsop.Getattr("/g", &stat, fh); 0 != errc || 0 != stat.Nlink {
+		t.Error("Getattr of open handle failed", errc, stat)
+	}
+	buff := make([]byte, 16)
+	if n := fsop.Read("/g", buff, 0, fh); "hello" != string(buff[:n]) {
+		t.Error("Read failed", n, string(buff[:n]))
+	}
+	if errc := fsop.Release("/g", fh); 0 != errc {
+		t.Error("Release failed", errc)
+	}
+	if n := fsop.Read("/g", buff, 0, fh); -EBADF != n {
+		t.Error("Read after Release expected -EBADF", n)
+	}
+
+	// nodes created behind the back of the NodeFileSystem are found with Lookup
+	root.chld["h"] = newTestnode(root, S_IFREG|0644)
+	lookups := *root.lookups
+	errc, fh = fsop.Opendir("/")
+	if 0 != errc {
+		t.Fatal("Opendir failed", errc)
+	}
+	names := []string{}
+	fsop.Readdir("/", func(name string, stat *Stat_t, ofst int64) bool {
+		names = append(names, name)
+		return true
+	}, 0, fh)
+	sort.Strings(names)
+	if 4 != len(names) || "." != names[0] || ".." != names[1] || "e" != names[2] || "h" != names[3] {
+		t.Error("Readdir failed", names)
+	}
+	if errc := fsop.Releasedir("/", fh); 0 != errc {
+		t.Error("Releasedir failed", errc)
+	}
+	if errc, _ := fsop.Open("/h", O_RDONLY); 0 != errc || lookups+1 != *root.lookups {
+		t.Error("Open failed", errc, *root.lookups)
+	}
+	fsop.Invalidate("/h")
+	if errc := fsop.Getattr("/h", &stat, InvalidHandle); 0 != errc || lookups+2 != *root.lookups {
+		t.Error("Getattr after Invalidate failed", errc, *root.lookups)
+	}
+}
+
+func TestNodeFileSystemEvict(t *testing.T) {
+	root := newTestnode(nil, S_IFDIR|0755)
+	fsop := NewNodeFileSystem(root)
+	fsop.SetCacheSize(2)
+
+	if errc := fsop.Mkdir("/d", 0755); 0 != errc {
+		t.Error("Mkdir failed", errc)
+	}
+	errc, fh := fsop.Create("/d/f", O_RDWR, 0644)
+	if 0 != errc {
+		t.Fatal("Create failed", errc)
+	}
+	if errc := fsop.Mkdir("/d/g", 0755); 0 != errc {
+		t.Error("Mkdir failed", errc)
+	}
+
+	// the least recently used leaf is evicted before its parent
+	if 2 != fsop.lru.Len() || nil != fsop.root.chld["d"].chld["f"] {
+		t.Error("unexpected cache contents", fsop.lru.Len())
+	}
+	stat := Stat_t{}
+	if errc := fsop.Getattr("/d/f", &stat, InvalidHandle); 0 != errc || 1 != *root.lookups {
+		t.Error("Getattr of evicted path failed", errc, *root.lookups)
+	}
+	if errc := fsop.Getattr("/d/f", &stat, InvalidHandle); 0 != errc || 1 != *root.lookups {
+		t.Error("Getattr of resolved path failed", errc, *root.lookups)
+	}
+
+	// an open handle survives the eviction of its node
+	if errc := fsop.Mkdir("/e", 0755); 0 != errc {
+		t.Error("Mkdir failed", errc)
+	}
+	if n := fsop.Write("/d/f", []byte("hello"), 0, fh); 5 != n {
+		t.Error("Write failed", n)
+	}
+	if errc := fsop.Release("/d/f", fh); 0 != errc {
+		t.Error("Release failed", errc)
+	}
+
+	// a cache size of 0 disables caching
+	fsop.SetCacheSize(0)
+	if 0 != fsop.lru.Len() || 0 != len(fsop.root.chld) {
+		t.Error("unexpected cache contents", fsop.lru.Len())
+	}
+	lookups := *root.lookups
+	if errc := fsop.Getattr("/d/f", &stat, InvalidHandle); 0 != errc || 5 != stat.Size ||
+		lookups+2 != *root.lookups {
+		t.Error("Getattr without cache failed", errc, stat, *root.lookups)
+	}
+}
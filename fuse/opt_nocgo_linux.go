@@ -0,0 +1,297 @@
+//go:build linux && (!cgo || nocgo)
+// +build linux
+// +build !cgo nocgo
+
+/*
+ * opt_nocgo_linux.go
+ *
+ * Copyright 2017-2022 Bill Zissimopoulos
+ */
+/*
+ * This file is part of Cgofuse.
+ *
+ * It is licensed under the MIT license. The full license text can be found
+ * in the License.txt file at the root of this project.
+ */
+
+package fuse
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+/*
+ * Option parsing for OptParse
+ *
+ * OptParse (host.go) passes a list of templates produced by optNormBool, optNormInt and
+ * optNormStr. A template is one of:
+ *
+ *     x           matches x exactly; stores 1 (as int)
+ *     x=          matches any argument that starts with x=; stores 1 (as int)
+ *     x=%FMT      matches any argument that starts with x=; stores the parameter
+ *
+ * where FMT is one of d, o, x, X, i, optionally preceded by hh, h or ll (which select a
+ * 1, 2 or 8 byte integer instead of a 4 byte one), or s (which stores a string
+ * allocated with c_malloc). Every matching template is applied.
+ *
+ * Arguments are either options (starting with -), option groups (-o a,b or -oa,b) or
+ * non-options. Unmatched options are kept; unmatched options from option groups are
+ * collected into a single -o group, which is placed first. The argument "--" ends the
+ * options; all arguments after it are non-options. If nonopts is true, all unmatched
+ * options are discarded and only non-options are kept.
+ */
+
+type optTemplate struct {
+	templ  string
+	offset uintptr
+	value  int32
+}
+
+// match reports whether the template matches arg and returns the parameter of arg if
+// the template has a format.
+func (t *optTemplate) match(arg string) (param string, format string, ok bool) {
+	if i := strings.IndexByte(t.templ, '='); -1 != i &&
+		(len(t.templ) == i+1 || '%' == t.templ[i+1]) {
+		if strings.HasPrefix(arg, t.templ[:i+1]) {
+			if len(t.templ) > i+1 {
+				format = t.templ[i+2:]
+			}
+			return arg[i+1:], format, true
+		}
+	}
+	return "", "", t.templ == arg
+}
+
+type optParser struct {
+	templs  []optTemplate
+	data    unsafe.Pointer
+	nonopts bool
+	outargs []string
+	group   []string
+	endopts bool
+}
+
+// optParseArgs parses args (not including the program name) as described above. It
+// returns the resulting arguments and false if an error happens.
+func optParseArgs(args []string, data unsafe.Pointer, templs []optTemplate,
+	nonopts bool) ([]string, bool) {
+	p := optParser{templs: templs, data: data, nonopts: nonopts}
+	for i := 0; len(args) > i; i++ {
+		arg := args[i]
+		switch {
+		case p.endopts || !strings.HasPrefix(arg, "-"):
+			p.outargs = append(p.outargs, arg)
+		case "--" == arg:
+			p.endopts = true
+			p.outargs = append(p.outargs, arg)
+		case "-o" == arg:
+			if len(args) <= i+1 {
+				fmt.Fprintf(mountStderr(), "fuse: missing argument after `-o'\n")
+				return nil, false
+			}
+			i++
+			if !p.parseGroup(args[i]) {
+				return nil, false
+			}
+		case strings.HasPrefix(arg, "-o") && !p.matches(arg):
+			if !p.parseGroup(arg[2:]) {
+				return nil, false
+			}
+		default:
+			matched, ok := p.apply(arg)
+			if !ok {
+				return nil, false
+			}
+			if !matched && !p.nonopts {
+				p.outargs = append(p.outargs, arg)
+			}
+		}
+	}
+
+	if p.endopts && 0 < len(p.outargs) && "--" == p.outargs[len(p.outargs)-1] {
+		// the option separator is pointless if nothing follows it
+		p.outargs = p.outargs[:len(p.outargs)-1]
+	}
+	if 0 < len(p.group) {
+		p.outargs = append([]string{"-o", strings.Join(p.group, ",")}, p.outargs...)
+	}
+	return p.outargs, true
+}
+
+// parseGroup parses the comma separated options of an option group. A comma may be
+// escaped with a backslash.
+func (p *optParser) parseGroup(group string) bool {
+	for _, opt := range optSplit(group) {
+		matched, ok := p.apply(opt)
+		if !ok {
+			return false
+		}
+		if !matched && !p.nonopts {
+			p.group = append(p.group, optEscape(opt))
+		}
+	}
+	return true
+}
+
+// matches reports whether any template matches arg.
+func (p *optParser) matches(arg string) bool {
+	for i := range p.templs {
+		if _, _, ok := p.templs[i].match(arg); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// apply applies every template that matches arg.
+func (p *optParser) apply(arg string) (matched bool, ok bool) {
+	for i := range p.templs {
+		t := &p.templs[i]
+		param, format, ok := t.match(arg)
+		if !ok {
+			continue
+		}
+		matched = true
+		slot := unsafe.Add(p.data, t.offset)
+		if "" == format {
+			*(*int32)(slot) = t.value
+		} else if !optStore(slot, param, format) {
+			fmt.Fprintf(mountStderr(), "fuse: invalid parameter in option `%s'\n", arg)
+			return true, false
+		}
+	}
+	return matched, true
+}
+
+// optStore parses param according to format and stores the result at slot.
+func optStore(slot unsafe.Pointer, param string, format string) bool {
+	if "s" == format {
+		*(**c_char)(slot) = c_CString(param)
+		return true
+	}
+	size := 4
+	switch {
+	case strings.HasPrefix(format, "hh"):
+		size, format = 1, format[2:]
+	case strings.HasPrefix(format, "h"):
+		size, format = 2, format[1:]
+	case strings.HasPrefix(format, "ll"):
+		size, format = 8, format[2:]
+	}
+	base := 0
+	switch format {
+	case "d":
+		base = 10
+	case "o":
+		base = 8
+	case "x", "X":
+		base = 16
+	case "i":
+		base = 0
+	default:
+		return false
+	}
+	v, ok := optScanInt(param, base)
+	if !ok {
+		return false
+	}
+	switch size {
+	case 1:
+		*(*uint8)(slot) = uint8(v)
+	case 2:
+		*(*uint16)(slot) = uint16(v)
+	case 4:
+		*(*uint32)(slot) = uint32(v)
+	case 8:
+		*(*uint64)(slot) = v
+	}
+	return true
+}
+
+// optScanInt parses the integer at the start of s in the manner of scanf: an optional
+// sign followed by digits in base (base 0 selects 8, 10 or 16 from the prefix of the
+// digits). Trailing characters are ignored. The result is truncated to 64 bits.
+func optScanInt(s string, base int) (uint64, bool) {
+	s = strings.TrimLeft(s, " \t\n")
+	neg := false
+	if 0 < len(s) && ('-' == s[0] || '+' == s[0]) {
+		neg = '-' == s[0]
+		s = s[1:]
+	}
+	hex := 2 <= len(s) && '0' == s[0] && ('x' == s[1] || 'X' == s[1])
+	switch {
+	case 0 == base && hex:
+		base = 16
+		s = s[2:]
+	case 0 == base && 1 <= len(s) && '0' == s[0]:
+		base = 8
+	case 0 == base:
+		base = 10
+	case 16 == base && hex:
+		s = s[2:]
+	}
+	var v uint64
+	n := 0
+	for ; len(s) > n; n++ {
+		d := optDigit(s[n])
+		if base <= d {
+			break
+		}
+		v = v*uint64(base) + uint64(d)
+	}
+	if 0 == n {
+		return 0, false
+	}
+	if neg {
+		v = -v
+	}
+	return v, true
+}
+
+func optDigit(c byte) int {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c - '0')
+	case 'a' <= c && c <= 'z':
+		return int(c-'a') + 10
+	case 'A' <= c && c <= 'Z':
+		return int(c-'A') + 10
+	}
+	return 36
+}
+
+// optSplit splits a comma separated option group and removes backslash escapes.
+func optSplit(group string) []string {
+	var opts []string
+	var opt []byte
+	for i := 0; len(group) > i; i++ {
+		switch c := group[i]; {
+		case '\\' == c && len(group) > i+1:
+			i++
+			opt = append(opt, group[i])
+		case ',' == c:
+			opts = append(opts, string(opt))
+			opt = opt[:0]
+		default:
+			opt = append(opt, c)
+		}
+	}
+	return append(opts, string(opt))
+}
+
+// optEscape escapes the commas and backslashes of an option.
+func optEscape(opt string) string {
+	if !strings.ContainsAny(opt, ",\\") {
+		return opt
+	}
+	var b strings.Builder
+	for i := 0; len(opt) > i; i++ {
+		if ',' == opt[i] || '\\' == opt[i] {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(opt[i])
+	}
+	return b.String()
+}
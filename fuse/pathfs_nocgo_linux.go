@@ -0,0 +1,1865 @@
+//go:build linux && (!cgo || nocgo)
+// +build linux
+// +build !cgo nocgo
+
+/*
+ * pathfs_nocgo_linux.go
+ *
+ * Copyright 2017-2022 Bill Zissimopoulos
+ */
+/*
+ * This file is part of Cgofuse.
+ *
+ * It is licensed under the MIT license. The full license text can be found
+ * in the License.txt file at the root of this project.
+ */
+
+package fuse
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+/*
+ * Path based file system
+ *
+ * The kernel identifies files by node ids, but FileSystemInterface identifies them by
+ * path. A pathfs translates between the two: it remembers the parent and name of every
+ * node that the kernel knows about and calls the host* functions of host.go with the
+ * path of the node.
+ *
+ * Paths must not change while an operation uses them. Every operation therefore holds
+ * its nodes and their ancestors shared, while RENAME, UNLINK and RMDIR also hold the
+ * nodes that they move or remove exclusively. An exclusive hold waits until no
+ * operation holds the node, and a shared hold waits until no node on the path to the
+ * root is held exclusively. So an operation never sees a path that a concurrent rename
+ * of one of its ancestors has made stale. Holds are acquired all at once, so that an
+ * operation never waits while holding nodes.
+ *
+ * Files that are unlinked while open are renamed to a hidden name (.fuse_hiddenXXX)
+ * instead, so that the open file keeps a path, and are unlinked when they are closed.
+ * The hard_remove option disables this.
+ */
+
+type pathkey struct {
+	parent uint64
+	name   string
+}
+
+type pathnode struct {
+	id      uint64
+	parent  *pathnode
+	name    string
+	lookups uint64 // lookup count of the kernel
+	kids    int    // child nodes
+	opens   int    // open files
+	readers int    // shared holds
+	writer  bool   // exclusive hold
+	hidden  bool   // renamed to a hidden name by unlink
+	stale   bool   // unlinked or replaced; the node no longer has a path
+
+	// auto_cache state
+	cacheValid bool
+	mtime      fuse_timespec_t
+	size       int64
+	statTime   time.Time
+}
+
+// pathhold is a set of nodes held by an operation.
+type pathhold struct {
+	shared [2]*pathnode
+	excl   [2]*pathnode
+	paths  [2]string
+}
+
+// pathdir is an open directory.
+type pathdir struct {
+	guard   sync.Mutex
+	id      uint64
+	fi      struct_fuse_file_info
+	mode    int
+	filled  bool
+	entries []pathdirent
+}
+
+const (
+	pathdirUnknown = iota
+	pathdirCache   // Readdir ignores the offset and returns all entries
+	pathdirStream  // Readdir honours the offset
+)
+
+type pathdirent struct {
+	name string
+	stat fuse_stat_t
+	plus bool
+}
+
+type pathfs struct {
+	conn     *kernelConn
+	conf     struct_fuse_config
+	data     unsafe.Pointer
+	readBuf  bool
+	writeBuf bool
+
+	guard  sync.Mutex
+	cond   sync.Cond
+	nodes  map[uint64]*pathnode
+	names  map[pathkey]*pathnode
+	lastId uint64
+	hideId uint64
+	dirs   HandleTable[*pathdir]
+}
+
+func newPathfs(data unsafe.Pointer, readBuf bool, writeBuf bool) *pathfs {
+	fs := &pathfs{
+		data:     data,
+		readBuf:  readBuf,
+		writeBuf: writeBuf,
+		nodes:    map[uint64]*pathnode{},
+		names:    map[pathkey]*pathnode{},
+		lastId:   fuse_ROOT_ID,
+	}
+	fs.conf.entry_timeout = 1
+	fs.conf.attr_timeout = 1
+	fs.cond.L = &fs.guard
+	fs.nodes[fuse_ROOT_ID] = &pathnode{id: fuse_ROOT_ID, lookups: 1}
+	return fs
+}
+
+// option parses an option of the path based file system.
+func (fs *pathfs) option(opt string) bool {
+	conf := &fs.conf
+	name, value, hasValue := opt, "", false
+	if i := strings.IndexByte(opt, '='); -1 != i {
+		name, value, hasValue = opt[:i], opt[i+1:], true
+	}
+	flag := func(p *c_int, v c_int) bool {
+		*p = v
+		return !hasValue
+	}
+	seconds := func(p *c_double) bool {
+		v, err := strconv.ParseFloat(value, 64)
+		*p = v
+		return hasValue && nil == err
+	}
+	unsigned := func(p *c_unsigned, base int) bool {
+		v, err := strconv.ParseUint(value, base, 32)
+		*p = c_unsigned(v)
+		return hasValue && nil == err
+	}
+	integer := func(p *c_int) bool {
+		v, err := strconv.ParseInt(value, 10, 32)
+		*p = c_int(v)
+		return hasValue && nil == err
+	}
+	switch name {
+	case "hard_remove":
+		return flag(&conf.hard_remove, 1)
+	case "use_ino":
+		return flag(&conf.use_ino, 1)
+	case "readdir_ino":
+		return flag(&conf.readdir_ino, 1)
+	case "direct_io":
+		return flag(&conf.direct_io, 1)
+	case "kernel_cache":
+		return flag(&conf.kernel_cache, 1)
+	case "auto_cache":
+		return flag(&conf.auto_cache, 1)
+	case "noauto_cache":
+		return flag(&conf.auto_cache, 0)
+	case "no_rofd_flush":
+		return flag(&conf.no_rofd_flush, 1)
+	case "intr":
+		return flag(&conf.intr, 1)
+	case "noforget":
+		return flag(&conf.remember, -1)
+	case "umask":
+		conf.set_mode = 1
+		return unsigned(&conf.umask, 8)
+	case "uid":
+		conf.set_uid = 1
+		return unsigned(&conf.uid, 10)
+	case "gid":
+		conf.set_gid = 1
+		return unsigned(&conf.gid, 10)
+	case "entry_timeout":
+		return seconds(&conf.entry_timeout)
+	case "attr_timeout":
+		return seconds(&conf.attr_timeout)
+	case "negative_timeout":
+		return seconds(&conf.negative_timeout)
+	case "ac_attr_timeout":
+		conf.ac_attr_timeout_set = 1
+		return seconds(&conf.ac_attr_timeout)
+	case "intr_signal":
+		return integer(&conf.intr_signal)
+	case "remember":
+		return integer(&conf.remember)
+	}
+	return false
+}
+
+// pathfsHelp writes the help of the options of the path based file system to stdout.
+func pathfsHelp() {
+	fmt.Print("\n" +
+		"    -o hard_remove         immediate removal (don't hide files)\n" +
+		"    -o use_ino             let file system set inode numbers\n" +
+		"    -o readdir_ino         try to fill in d_ino in readdir\n" +
+		"    -o direct_io           use direct I/O\n" +
+		"    -o kernel_cache        cache files in kernel\n" +
+		"    -o [no]auto_cache      enable caching based on modification times\n" +
+		"    -o umask=M             set file permissions (octal)\n" +
+		"    -o uid=N               set file owner\n" +
+		"    -o gid=N               set file group\n" +
+		"    -o entry_timeout=T     cache timeout for names (1.0s)\n" +
+		"    -o negative_timeout=T  cache timeout for deleted names (0.0s)\n" +
+		"    -o attr_timeout=T      cache timeout for attributes (1.0s)\n" +
+		"    -o ac_attr_timeout=T   auto cache timeout for attributes (attr_timeout)\n")
+}
+
+/*
+ * Nodes and holds
+ */
+
+// child returns the node of the entry name of parent, creating it if necessary, and
+// increments its lookup count. The caller must hold fs.guard.
+func (fs *pathfs) child(parent *pathnode, name string) *pathnode {
+	k := pathkey{parent.id, name}
+	n := fs.names[k]
+	if nil == n {
+		fs.lastId++
+		n = &pathnode{id: fs.lastId, parent: parent, name: name}
+		fs.nodes[n.id] = n
+		fs.names[k] = n
+		parent.kids++
+	}
+	n.lookups++
+	return n
+}
+
+// unref removes n if it is no longer used. The caller must hold fs.guard.
+func (fs *pathfs) unref(n *pathnode) {
+	for nil != n && fuse_ROOT_ID != n.id &&
+		0 == n.lookups && 0 == n.kids && 0 == n.opens && 0 == n.readers && !n.writer {
+		delete(fs.nodes, n.id)
+		p := n.parent
+		if nil != p {
+			fs.unname(n)
+			p.kids--
+			n.parent = nil
+		}
+		n = p
+	}
+}
+
+// move moves n to the entry name of parent. The caller must hold fs.guard.
+func (fs *pathfs) move(n *pathnode, parent *pathnode, name string) {
+	old := n.parent
+	fs.unname(n)
+	if old != parent {
+		old.kids--
+		parent.kids++
+	}
+	n.parent = parent
+	n.name = name
+	fs.names[pathkey{parent.id, name}] = n
+	fs.unref(old)
+}
+
+// unname removes the entry of n from fs.names, unless the entry has been taken by
+// another node (RENAME_EXCHANGE). The caller must hold fs.guard.
+func (fs *pathfs) unname(n *pathnode) {
+	k := pathkey{n.parent.id, n.name}
+	if fs.names[k] == n {
+		delete(fs.names, k)
+	}
+}
+
+// detach removes n from its parent after it has been unlinked or replaced. The caller
+// must hold fs.guard.
+func (fs *pathfs) detach(n *pathnode) {
+	p := n.parent
+	if nil == p {
+		return
+	}
+	fs.unname(n)
+	p.kids--
+	n.parent = nil
+	n.stale = true
+	fs.unref(p)
+	fs.unref(n)
+}
+
+// forget decrements the lookup count of the node id.
+func (fs *pathfs) forget(id uint64, nlookup uint64) {
+	fs.guard.Lock()
+	defer fs.guard.Unlock()
+	n := fs.nodes[id]
+	if nil == n || fuse_ROOT_ID == id {
+		return
+	}
+	if 0 > fs.conf.remember {
+		// noforget: the file system relies on paths that do not expire
+		return
+	}
+	if n.lookups < nlookup {
+		n.lookups = 0
+	} else {
+		n.lookups -= nlookup
+	}
+	fs.unref(n)
+}
+
+// path returns the path of n; the caller must hold fs.guard.
+func (fs *pathfs) path(n *pathnode) string {
+	if fuse_ROOT_ID == n.id {
+		return "/"
+	}
+	var names []string
+	for ; nil != n && fuse_ROOT_ID != n.id; n = n.parent {
+		names = append(names, n.name)
+	}
+	var b strings.Builder
+	for i := len(names) - 1; 0 <= i; i-- {
+		b.WriteByte('/')
+		b.WriteString(names[i])
+	}
+	return b.String()
+}
+
+// acquire holds the nodes shared together with their ancestors and the entries excl
+// exclusively (if they have nodes), waiting while another operation conflicts. It
+// returns -ENOENT if a node has no path.
+func (fs *pathfs) acquire(shared []uint64, excl []pathkey) (*pathhold, int) {
+	fs.guard.Lock()
+	defer fs.guard.Unlock()
+	h := &pathhold{}
+	for {
+		errc, wait := fs.tryAcquire(h, shared, excl)
+		if !wait {
+			if 0 != errc {
+				return nil, errc
+			}
+			return h, 0
+		}
+		fs.cond.Wait()
+	}
+}
+
+func (fs *pathfs) tryAcquire(h *pathhold, shared []uint64, excl []pathkey) (int, bool) {
+	*h = pathhold{}
+	for i, k := range excl {
+		x := fs.names[k]
+		if nil == x {
+			continue
+		}
+		if 0 < x.readers || x.writer {
+			return 0, true
+		}
+		h.excl[i] = x
+	}
+	for i, id := range shared {
+		n := fs.nodes[id]
+		if nil == n {
+			return -ENOENT, false
+		}
+		for p := n; fuse_ROOT_ID != p.id; p = p.parent {
+			if p == h.excl[0] || p == h.excl[1] {
+				// a directory would be moved below itself
+				return -EINVAL, false
+			}
+			if p.writer {
+				return 0, true
+			}
+			if nil == p.parent {
+				return -ENOENT, false
+			}
+		}
+		h.shared[i] = n
+	}
+	for i, n := range h.shared {
+		if nil != n {
+			h.paths[i] = fs.path(n)
+			for p := n; nil != p; p = p.parent {
+				p.readers++
+			}
+		}
+	}
+	for _, x := range h.excl {
+		if nil != x {
+			x.writer = true
+		}
+	}
+	return 0, false
+}
+
+// release releases the nodes held by h.
+func (fs *pathfs) release(h *pathhold) {
+	if nil == h {
+		return
+	}
+	fs.guard.Lock()
+	defer fs.guard.Unlock()
+	for _, n := range h.shared {
+		for p := n; nil != p; {
+			next := p.parent
+			p.readers--
+			fs.unref(p)
+			p = next
+		}
+	}
+	for _, x := range h.excl {
+		if nil != x {
+			x.writer = false
+			fs.unref(x)
+		}
+	}
+	fs.cond.Broadcast()
+}
+
+// hold holds the node id and returns its path.
+func (fs *pathfs) hold(id uint64) (*pathhold, *c_char, int) {
+	h, errc := fs.acquire([]uint64{id}, nil)
+	if 0 != errc {
+		return nil, nil, errc
+	}
+	return h, pathCString(h.paths[0]), 0
+}
+
+// holdFile is similar to hold, but it is used by operations on open files. If nullok
+// is true these do not need a path: with the nullpath_ok option they get a nil path,
+// and without it they get a nil path if the file has been unlinked.
+func (fs *pathfs) holdFile(id uint64, nullok bool) (*pathhold, *c_char, int) {
+	if nullok && 0 != fs.conf.nullpath_ok {
+		return nil, nil, 0
+	}
+	h, path, errc := fs.hold(id)
+	if nullok && -ENOENT == errc {
+		return nil, nil, 0
+	}
+	return h, path, errc
+}
+
+// holdEntry holds the directory parent and returns the path of its entry name.
+func (fs *pathfs) holdEntry(parent uint64, name string) (*pathhold, *c_char, int) {
+	h, errc := fs.acquire([]uint64{parent}, nil)
+	if 0 != errc {
+		return nil, nil, errc
+	}
+	return h, pathCString(pathJoin(h.paths[0], name)), 0
+}
+
+// lookupPath returns the node of path or nil. The caller must hold fs.guard.
+func (fs *pathfs) lookupPath(path string) *pathnode {
+	n := fs.nodes[fuse_ROOT_ID]
+	for _, name := range strings.Split(path, "/") {
+		if "" == name {
+			continue
+		}
+		n = fs.names[pathkey{n.id, name}]
+		if nil == n {
+			return nil
+		}
+	}
+	return n
+}
+
+func pathJoin(dir string, name string) string {
+	if "/" == dir {
+		return "/" + name
+	}
+	return dir + "/" + name
+}
+
+// pathCString returns a NUL terminated copy of s.
+func pathCString(s string) *c_char {
+	b := make([]byte, len(s)+1)
+	copy(b, s)
+	return &b[0]
+}
+
+/*
+ * Attributes
+ */
+
+// fixAttr applies the options that override attributes.
+func (fs *pathfs) fixAttr(id uint64, stat *fuse_stat_t) {
+	if 0 == fs.conf.use_ino {
+		stat.st_ino = id
+	}
+	if 0 != fs.conf.set_mode {
+		stat.st_mode = stat.st_mode&S_IFMT | 0777&^fs.conf.umask
+	}
+	if 0 != fs.conf.set_uid {
+		stat.st_uid = fs.conf.uid
+	}
+	if 0 != fs.conf.set_gid {
+		stat.st_gid = fs.conf.gid
+	}
+}
+
+// updateStat records the modification time and size of a file for auto_cache; a
+// change invalidates the cache. The caller must hold fs.guard.
+func (fs *pathfs) updateStat(n *pathnode, stat *fuse_stat_t) {
+	if 0 == fs.conf.auto_cache || nil == n {
+		return
+	}
+	if n.cacheValid && (n.mtime != stat.st_mtim || n.size != stat.st_size) {
+		n.cacheValid = false
+	}
+	n.mtime = stat.st_mtim
+	n.size = stat.st_size
+	n.statTime = time.Now()
+}
+
+// autoCache decides whether the kernel may keep the cached data of a file when it is
+// opened (auto_cache).
+func (fs *pathfs) autoCache(id uint64, path *c_char, fi *struct_fuse_file_info) {
+	timeout := fs.conf.attr_timeout
+	if 0 != fs.conf.ac_attr_timeout_set {
+		timeout = fs.conf.ac_attr_timeout
+	}
+	fs.guard.Lock()
+	n := fs.nodes[id]
+	expired := nil != n && n.cacheValid &&
+		time.Since(n.statTime).Seconds() >= float64(timeout)
+	fs.guard.Unlock()
+	var stat fuse_stat_t
+	errc := 0
+	if expired {
+		errc = int(hostGetattr(path, &stat, fi))
+	}
+	fs.guard.Lock()
+	defer fs.guard.Unlock()
+	if nil == n {
+		return
+	}
+	if expired {
+		if 0 == errc {
+			fs.updateStat(n, &stat)
+		} else {
+			n.cacheValid = false
+		}
+	}
+	fi.keep_cache = fi.keep_cache || n.cacheValid
+	n.cacheValid = true
+}
+
+// entry gets the attributes of the entry name of parent and registers its node.
+func (fs *pathfs) entry(parent uint64, name string, path *c_char, fi *struct_fuse_file_info,
+	e *kernelEntry) int {
+	var stat fuse_stat_t
+	if errc := int(hostGetattr(path, &stat, fi)); 0 != errc {
+		return errc
+	}
+	fs.guard.Lock()
+	p := fs.nodes[parent]
+	if nil == p {
+		fs.guard.Unlock()
+		return -ENOENT
+	}
+	n := fs.child(p, name)
+	fs.updateStat(n, &stat)
+	fs.guard.Unlock()
+	fs.fixAttr(n.id, &stat)
+	*e = kernelEntry{
+		ino:          n.id,
+		attr:         stat,
+		attrTimeout:  float64(fs.conf.attr_timeout),
+		entryTimeout: float64(fs.conf.entry_timeout),
+	}
+	return 0
+}
+
+// replyEntry replies with an entry and forgets the entry if the kernel no longer waits
+// for it.
+func (fs *pathfs) replyEntry(req *kernelReq, errc int, e *kernelEntry) {
+	if 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	if -ENOENT == req.replyEntry(e) {
+		fs.forget(e.ino, 1)
+	}
+}
+
+/*
+ * Requests
+ */
+
+func (fs *pathfs) init(conn *struct_fuse_conn_info) {
+	hostInit(conn, &fs.conf)
+}
+
+func (fs *pathfs) destroy() {
+	// remove the hidden files of files that are still open
+	fs.guard.Lock()
+	var hidden []uint64
+	for id, n := range fs.nodes {
+		if n.hidden && !n.stale {
+			hidden = append(hidden, id)
+		}
+	}
+	fs.guard.Unlock()
+	for _, id := range hidden {
+		fs.unlinkHidden(id)
+	}
+	hostDestroy(fs.data)
+}
+
+func (fs *pathfs) serve(req *kernelReq) {
+	switch req.hdr.opcode {
+	case fuse_LOOKUP:
+		fs.lookup(req)
+	case fuse_FORGET:
+		if in, _ := kernelArg[fuse_forget_in](req.in); nil != in {
+			fs.forget(req.hdr.nodeid, in.nlookup)
+		}
+	case fuse_BATCH_FORGET:
+		in, rest := kernelArg[fuse_batch_forget_in](req.in)
+		for i := uint32(0); nil != in && in.count > i; i++ {
+			var one *fuse_forget_one
+			if one, rest = kernelArg[fuse_forget_one](rest); nil == one {
+				break
+			}
+			fs.forget(one.nodeid, one.nlookup)
+		}
+	case fuse_GETATTR:
+		fs.getattr(req)
+	case fuse_SETATTR:
+		fs.setattr(req)
+	case fuse_READLINK:
+		fs.readlink(req)
+	case fuse_MKNOD:
+		fs.mknod(req)
+	case fuse_MKDIR:
+		fs.mkdir(req)
+	case fuse_SYMLINK:
+		fs.symlink(req)
+	case fuse_UNLINK:
+		fs.remove(req, false)
+	case fuse_RMDIR:
+		fs.remove(req, true)
+	case fuse_RENAME, fuse_RENAME2:
+		fs.rename(req)
+	case fuse_LINK:
+		fs.link(req)
+	case fuse_OPEN:
+		fs.open(req)
+	case fuse_READ:
+		fs.read(req)
+	case fuse_WRITE:
+		fs.write(req)
+	case fuse_STATFS:
+		fs.statfs(req)
+	case fuse_RELEASE:
+		fs.releaseFile(req)
+	case fuse_FSYNC:
+		fs.fsync(req)
+	case fuse_SETXATTR:
+		fs.setxattr(req)
+	case fuse_GETXATTR, fuse_LISTXATTR:
+		fs.getxattr(req)
+	case fuse_REMOVEXATTR:
+		fs.removexattr(req)
+	case fuse_FLUSH:
+		fs.flush(req)
+	case fuse_OPENDIR:
+		fs.opendir(req)
+	case fuse_READDIR:
+		fs.readdir(req, false)
+	case fuse_READDIRPLUS:
+		fs.readdir(req, true)
+	case fuse_RELEASEDIR:
+		fs.releasedir(req)
+	case fuse_FSYNCDIR:
+		fs.fsyncdir(req)
+	case fuse_GETLK, fuse_SETLK, fuse_SETLKW:
+		fs.lock(req)
+	case fuse_ACCESS:
+		fs.access(req)
+	case fuse_CREATE:
+		fs.create(req)
+	case fuse_IOCTL:
+		fs.ioctl(req)
+	case fuse_POLL:
+		fs.poll(req)
+	case fuse_FALLOCATE:
+		fs.fallocate(req)
+	case fuse_LSEEK:
+		fs.lseek(req)
+	case fuse_COPY_FILE_RANGE:
+		fs.copyFileRange(req)
+	default:
+		req.replyErr(-ENOSYS)
+	}
+}
+
+func (fs *pathfs) lookup(req *kernelReq) {
+	name, _ := kernelString(req.in)
+	h, path, errc := fs.holdEntry(req.hdr.nodeid, name)
+	if 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	defer fs.release(h)
+	var e kernelEntry
+	errc = fs.entry(req.hdr.nodeid, name, path, nil, &e)
+	if -ENOENT == errc && 0 < fs.conf.negative_timeout {
+		// a negative entry tells the kernel to cache that the name does not exist
+		req.replyEntry(&kernelEntry{entryTimeout: float64(fs.conf.negative_timeout)})
+		return
+	}
+	fs.replyEntry(req, errc, &e)
+}
+
+func (fs *pathfs) getattr(req *kernelReq) {
+	var fi *struct_fuse_file_info
+	if in, _ := kernelArg[fuse_getattr_in](req.in); nil != in &&
+		0 != in.getattr_flags&fuse_GETATTR_FH {
+		fi = &struct_fuse_file_info{fh: in.fh}
+	}
+	h, path, errc := fs.holdFile(req.hdr.nodeid, nil != fi)
+	if 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	defer fs.release(h)
+	var stat fuse_stat_t
+	if errc = int(hostGetattr(path, &stat, fi)); 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	fs.guard.Lock()
+	if n := fs.nodes[req.hdr.nodeid]; nil != n {
+		if n.hidden && 0 < stat.st_nlink {
+			stat.st_nlink--
+		}
+		fs.updateStat(n, &stat)
+	}
+	fs.guard.Unlock()
+	fs.fixAttr(req.hdr.nodeid, &stat)
+	req.replyAttr(&stat, float64(fs.conf.attr_timeout))
+}
+
+func (fs *pathfs) setattr(req *kernelReq) {
+	in, _ := kernelArg[fuse_setattr_in](req.in)
+	if nil == in {
+		req.replyErr(-EINVAL)
+		return
+	}
+	attr, valid := kernelSetattr(in)
+	var fi *struct_fuse_file_info
+	if 0 != valid&fattr_FH {
+		fi = &struct_fuse_file_info{fh: in.fh}
+		if 0 != valid&fattr_LOCKOWNER {
+			fi.lock_owner = in.lock_own
+		}
+	}
+	h, path, errc := fs.holdFile(req.hdr.nodeid, nil != fi)
+	if 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	defer fs.release(h)
+	if 0 == errc && 0 != valid&fattr_MODE {
+		errc = int(hostChmod(path, attr.st_mode, fi))
+	}
+	if 0 == errc && 0 != valid&(fattr_UID|fattr_GID) {
+		uid, gid := ^c_fuse_uid_t(0), ^c_fuse_gid_t(0)
+		if 0 != valid&fattr_UID {
+			uid = attr.st_uid
+		}
+		if 0 != valid&fattr_GID {
+			gid = attr.st_gid
+		}
+		errc = int(hostChown(path, uid, gid, fi))
+	}
+	if 0 == errc && 0 != valid&fattr_SIZE {
+		errc = int(hostTruncate(path, attr.st_size, fi))
+	}
+	if 0 == errc && 0 != valid&(fattr_ATIME|fattr_MTIME) {
+		tmsp := [2]fuse_timespec_t{{tv_nsec: UTIME_OMIT}, {tv_nsec: UTIME_OMIT}}
+		switch {
+		case 0 != valid&fattr_ATIME_NOW:
+			tmsp[0].tv_nsec = UTIME_NOW
+		case 0 != valid&fattr_ATIME:
+			tmsp[0] = attr.st_atim
+		}
+		switch {
+		case 0 != valid&fattr_MTIME_NOW:
+			tmsp[1].tv_nsec = UTIME_NOW
+		case 0 != valid&fattr_MTIME:
+			tmsp[1] = attr.st_mtim
+		}
+		errc = int(hostUtimens(path, &tmsp[0], fi))
+	}
+	var stat fuse_stat_t
+	if 0 == errc {
+		errc = int(hostGetattr(path, &stat, fi))
+	}
+	if 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	fs.guard.Lock()
+	fs.updateStat(fs.nodes[req.hdr.nodeid], &stat)
+	fs.guard.Unlock()
+	fs.fixAttr(req.hdr.nodeid, &stat)
+	req.replyAttr(&stat, float64(fs.conf.attr_timeout))
+}
+
+func (fs *pathfs) readlink(req *kernelReq) {
+	h, path, errc := fs.hold(req.hdr.nodeid)
+	if 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	defer fs.release(h)
+	buf := make([]byte, 4096+1)
+	if errc = int(hostReadlink(path, &buf[0], c_size_t(len(buf)))); 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	n := 0
+	for len(buf)-1 > n && 0 != buf[n] {
+		n++
+	}
+	req.reply(0, buf[:n])
+}
+
+func (fs *pathfs) mknod(req *kernelReq) {
+	in, rest := kernelArg[fuse_mknod_in](req.in)
+	if nil == in {
+		req.replyErr(-EINVAL)
+		return
+	}
+	name, _ := kernelString(rest)
+	req.setUmask(in.umask)
+	h, path, errc := fs.holdEntry(req.hdr.nodeid, name)
+	if 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	defer fs.release(h)
+	errc = -ENOSYS
+	if S_IFREG == in.mode&S_IFMT {
+		// create regular files with Create if the file system has it
+		fi := struct_fuse_file_info{flags: O_CREAT | O_EXCL | O_WRONLY}
+		errc = int(hostCreate(path, in.mode, &fi))
+		if 0 == errc {
+			hostRelease(path, &fi)
+		}
+	}
+	if -ENOSYS == errc {
+		errc = int(hostMknod(path, in.mode, c_fuse_dev_t(in.rdev)))
+	}
+	var e kernelEntry
+	if 0 == errc {
+		errc = fs.entry(req.hdr.nodeid, name, path, nil, &e)
+	}
+	fs.replyEntry(req, errc, &e)
+}
+
+func (fs *pathfs) mkdir(req *kernelReq) {
+	in, rest := kernelArg[fuse_mkdir_in](req.in)
+	if nil == in {
+		req.replyErr(-EINVAL)
+		return
+	}
+	name, _ := kernelString(rest)
+	req.setUmask(in.umask)
+	h, path, errc := fs.holdEntry(req.hdr.nodeid, name)
+	if 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	defer fs.release(h)
+	var e kernelEntry
+	if errc = int(hostMkdir(path, in.mode)); 0 == errc {
+		errc = fs.entry(req.hdr.nodeid, name, path, nil, &e)
+	}
+	fs.replyEntry(req, errc, &e)
+}
+
+func (fs *pathfs) symlink(req *kernelReq) {
+	name, rest := kernelString(req.in)
+	target, _ := kernelString(rest)
+	h, path, errc := fs.holdEntry(req.hdr.nodeid, name)
+	if 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	defer fs.release(h)
+	var e kernelEntry
+	if errc = int(hostSymlink(pathCString(target), path)); 0 == errc {
+		errc = fs.entry(req.hdr.nodeid, name, path, nil, &e)
+	}
+	fs.replyEntry(req, errc, &e)
+}
+
+// remove handles UNLINK and RMDIR.
+func (fs *pathfs) remove(req *kernelReq, dir bool) {
+	name, _ := kernelString(req.in)
+	parent := req.hdr.nodeid
+	h, errc := fs.acquire([]uint64{parent}, []pathkey{{parent, name}})
+	if 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	defer fs.release(h)
+	path := pathJoin(h.paths[0], name)
+	n := h.excl[0]
+	if dir {
+		errc = int(hostRmdir(pathCString(path)))
+	} else if fs.isOpen(n) && 0 == fs.conf.hard_remove {
+		errc = fs.hide(n, h.paths[0], path)
+	} else {
+		errc = int(hostUnlink(pathCString(path)))
+		if 0 == errc && nil != n {
+			fs.guard.Lock()
+			fs.detach(n)
+			fs.guard.Unlock()
+		}
+	}
+	if dir && 0 == errc && nil != n {
+		fs.guard.Lock()
+		fs.detach(n)
+		fs.guard.Unlock()
+	}
+	req.replyErr(errc)
+}
+
+func (fs *pathfs) isOpen(n *pathnode) bool {
+	if nil == n {
+		return false
+	}
+	fs.guard.Lock()
+	defer fs.guard.Unlock()
+	return 0 < n.opens
+}
+
+// hide renames the node n, which is held exclusively, to a hidden name in the
+// directory dir.
+func (fs *pathfs) hide(n *pathnode, dir string, path string) int {
+	for i := 0; 10 > i; i++ {
+		fs.guard.Lock()
+		fs.hideId++
+		name := fmt.Sprintf(".fuse_hidden%08x%08x", uint32(n.id), uint32(fs.hideId))
+		taken := nil != fs.names[pathkey{n.parent.id, name}]
+		fs.guard.Unlock()
+		if taken {
+			continue
+		}
+		newpath := pathCString(pathJoin(dir, name))
+		var stat fuse_stat_t
+		if 0 == hostGetattr(newpath, &stat, nil) {
+			continue
+		}
+		errc := int(hostRename(pathCString(path), newpath, 0))
+		if 0 == errc {
+			fs.guard.Lock()
+			fs.move(n, n.parent, name)
+			n.hidden = true
+			fs.guard.Unlock()
+		}
+		return errc
+	}
+	return -EBUSY
+}
+
+// unlinkHidden unlinks the hidden file of the node id.
+func (fs *pathfs) unlinkHidden(id uint64) {
+	fs.guard.Lock()
+	n := fs.nodes[id]
+	if nil == n || !n.hidden || n.stale || nil == n.parent {
+		fs.guard.Unlock()
+		return
+	}
+	k := pathkey{n.parent.id, n.name}
+	fs.guard.Unlock()
+	h, errc := fs.acquire([]uint64{k.parent}, []pathkey{k})
+	if 0 != errc {
+		return
+	}
+	defer fs.release(h)
+	if n == h.excl[0] && 0 == hostUnlink(pathCString(pathJoin(h.paths[0], k.name))) {
+		fs.guard.Lock()
+		fs.detach(n)
+		fs.guard.Unlock()
+	}
+}
+
+func (fs *pathfs) rename(req *kernelReq) {
+	var newdir uint64
+	var flags uint32
+	var rest []byte
+	if fuse_RENAME2 == req.hdr.opcode {
+		var in *fuse_rename2_in
+		if in, rest = kernelArg[fuse_rename2_in](req.in); nil != in {
+			newdir, flags = in.newdir, in.flags
+		}
+	} else {
+		var in *fuse_rename_in
+		if in, rest = kernelArg[fuse_rename_in](req.in); nil != in {
+			newdir = in.newdir
+		}
+	}
+	if 0 == newdir {
+		req.replyErr(-EINVAL)
+		return
+	}
+	oldname, rest := kernelString(rest)
+	newname, _ := kernelString(rest)
+	olddir := req.hdr.nodeid
+	h, errc := fs.acquire([]uint64{olddir, newdir},
+		[]pathkey{{olddir, oldname}, {newdir, newname}})
+	if 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	defer fs.release(h)
+	oldpath := pathJoin(h.paths[0], oldname)
+	newpath := pathJoin(h.paths[1], newname)
+	src, dst := h.excl[0], h.excl[1]
+	exchange := 0 != flags&RENAME_EXCHANGE
+	if !exchange && nil != dst && src != dst && fs.isOpen(dst) && 0 == fs.conf.hard_remove {
+		// keep the open target file reachable
+		if errc = fs.hide(dst, h.paths[1], newpath); 0 != errc {
+			req.replyErr(errc)
+			return
+		}
+		dst = nil
+	}
+	if errc = int(hostRename(pathCString(oldpath), pathCString(newpath),
+		c_uint32_t(flags))); 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	fs.guard.Lock()
+	if src != dst {
+		if nil != dst {
+			if exchange {
+				fs.move(dst, h.shared[0], oldname)
+			} else {
+				fs.detach(dst)
+			}
+		}
+		if nil != src {
+			fs.move(src, h.shared[1], newname)
+		}
+	}
+	fs.guard.Unlock()
+	req.replyErr(0)
+}
+
+func (fs *pathfs) link(req *kernelReq) {
+	in, rest := kernelArg[fuse_link_in](req.in)
+	if nil == in {
+		req.replyErr(-EINVAL)
+		return
+	}
+	newname, _ := kernelString(rest)
+	newdir := req.hdr.nodeid
+	h, errc := fs.acquire([]uint64{in.oldnodeid, newdir}, nil)
+	if 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	defer fs.release(h)
+	newpath := pathCString(pathJoin(h.paths[1], newname))
+	var e kernelEntry
+	if errc = int(hostLink(pathCString(h.paths[0]), newpath)); 0 == errc {
+		errc = fs.entry(newdir, newname, newpath, nil, &e)
+	}
+	fs.replyEntry(req, errc, &e)
+}
+
+// opened applies the caching options to a file that has been opened and counts it.
+func (fs *pathfs) opened(id uint64, path *c_char, fi *struct_fuse_file_info) {
+	if 0 != fs.conf.direct_io {
+		fi.direct_io = true
+	}
+	if 0 != fs.conf.kernel_cache {
+		fi.keep_cache = true
+	}
+	if 0 != fs.conf.auto_cache {
+		fs.autoCache(id, path, fi)
+	}
+	fs.guard.Lock()
+	if n := fs.nodes[id]; nil != n {
+		n.opens++
+	}
+	fs.guard.Unlock()
+}
+
+func (fs *pathfs) open(req *kernelReq) {
+	in, _ := kernelArg[fuse_open_in](req.in)
+	if nil == in {
+		req.replyErr(-EINVAL)
+		return
+	}
+	id := req.hdr.nodeid
+	h, path, errc := fs.hold(id)
+	if 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	fi := struct_fuse_file_info{flags: c_int(in.flags)}
+	if errc = int(hostOpen(path, &fi)); 0 != errc {
+		fs.release(h)
+		req.replyErr(errc)
+		return
+	}
+	fs.opened(id, path, &fi)
+	res := req.replyOpen(&fi)
+	fs.release(h)
+	if -ENOENT == res {
+		// the open was interrupted; nobody will close the file
+		fs.close(id, &fi)
+	}
+}
+
+// close closes an open file (RELEASE) and unlinks it if it is hidden.
+func (fs *pathfs) close(id uint64, fi *struct_fuse_file_info) {
+	h, path, _ := fs.holdFile(id, true)
+	if fi.flush {
+		fs.flushFile(path, fi)
+	}
+	hostRelease(path, fi)
+	fs.release(h)
+	fs.guard.Lock()
+	hidden := false
+	if n := fs.nodes[id]; nil != n && 0 < n.opens {
+		n.opens--
+		hidden = 0 == n.opens && n.hidden
+	}
+	fs.guard.Unlock()
+	if hidden {
+		fs.unlinkHidden(id)
+	}
+}
+
+func (fs *pathfs) releaseFile(req *kernelReq) {
+	in, _ := kernelArg[fuse_release_in](req.in)
+	if nil == in {
+		req.replyErr(-EINVAL)
+		return
+	}
+	fi := struct_fuse_file_info{
+		flags:         c_int(in.flags),
+		fh:            in.fh,
+		lock_owner:    in.lock_owner,
+		flush:         0 != in.release_flags&fuse_RELEASE_FLUSH,
+		flock_release: 0 != in.release_flags&fuse_RELEASE_FLOCK_UNLOCK,
+	}
+	fs.close(req.hdr.nodeid, &fi)
+	req.replyErr(0)
+}
+
+// flushFile flushes an open file and releases its POSIX locks.
+func (fs *pathfs) flushFile(path *c_char, fi *struct_fuse_file_info) int {
+	errc := int(hostFlush(path, fi))
+	lock := fuse_flock_t{l_type: F_UNLCK, l_whence: SEEK_SET}
+	if -ENOSYS != int(hostLock(path, fi, F_SETLK, &lock)) && -ENOSYS == errc {
+		// a file system that has locks needs FLUSH to release them
+		errc = 0
+	}
+	return errc
+}
+
+func (fs *pathfs) flush(req *kernelReq) {
+	in, _ := kernelArg[fuse_flush_in](req.in)
+	if nil == in {
+		req.replyErr(-EINVAL)
+		return
+	}
+	fi := struct_fuse_file_info{fh: in.fh, lock_owner: in.lock_owner, flush: true}
+	h, path, _ := fs.holdFile(req.hdr.nodeid, true)
+	defer fs.release(h)
+	req.replyErr(fs.flushFile(path, &fi))
+}
+
+func (fs *pathfs) read(req *kernelReq) {
+	in, _ := kernelArg[fuse_read_in](req.in)
+	if nil == in {
+		req.replyErr(-EINVAL)
+		return
+	}
+	fi := struct_fuse_file_info{fh: in.fh, flags: c_int(in.flags), lock_owner: in.lock_owner}
+	h, path, _ := fs.holdFile(req.hdr.nodeid, true)
+	defer fs.release(h)
+	size := int(in.size)
+	bufp := kernelGetBuf(size)
+	defer kernelPutBuf(bufp)
+	buf := (*bufp)[:size]
+
+	if fs.readBuf {
+		var bufv unsafe.Pointer
+		errc := int(hostReadBuf(path, &bufv, c_size_t(size), c_fuse_off_t(in.offset), &fi))
+		defer bufvecFree(bufv)
+		if 0 == errc && nil != bufv {
+			var n int
+			n, errc = bufvecCopy(buf, bufv)
+			buf = buf[:n]
+		}
+		if 0 != errc {
+			req.replyErr(errc)
+			return
+		}
+		req.reply(0, buf)
+		return
+	}
+
+	// hostRead needs a valid buffer pointer even when the size is 0
+	n := int(hostRead(path, &(*bufp)[0], c_size_t(size), c_fuse_off_t(in.offset), &fi))
+	if 0 > n {
+		req.replyErr(n)
+		return
+	}
+	if size < n {
+		fmt.Fprintf(os.Stderr, "fuse: read too many bytes\n")
+		n = size
+	}
+	req.reply(0, buf[:n])
+}
+
+// kernelZero is a valid buffer pointer for empty writes.
+var kernelZero [1]byte
+
+func (fs *pathfs) write(req *kernelReq) {
+	in, data := kernelArg[fuse_write_in](req.in)
+	if nil == in || len(data) < int(in.size) {
+		req.replyErr(-EINVAL)
+		return
+	}
+	data = data[:in.size]
+	fi := struct_fuse_file_info{
+		fh:         in.fh,
+		flags:      c_int(in.flags),
+		lock_owner: in.lock_owner,
+		writepage:  0 != in.write_flags&1, // FUSE_WRITE_CACHE
+	}
+	h, path, _ := fs.holdFile(req.hdr.nodeid, true)
+	defer fs.release(h)
+	// data is in the request buffer, which is not Go memory (see kernelConn.worker)
+	mem := &kernelZero[0]
+	if 0 < len(data) {
+		mem = &data[0]
+	}
+	var n int
+	if fs.writeBuf {
+		bufv := c_hostBufvecNew(1)
+		if nil == bufv {
+			req.replyErr(-ENOMEM)
+			return
+		}
+		defer c_free(bufv)
+		c_hostBufvecSet(bufv, 0, 0, unsafe.Pointer(mem), c_size_t(len(data)), -1, 0)
+		n = int(hostWriteBuf(path, bufv, c_fuse_off_t(in.offset), &fi))
+	} else {
+		n = int(hostWrite(path, mem, c_size_t(len(data)), c_fuse_off_t(in.offset), &fi))
+	}
+	if 0 > n {
+		req.replyErr(n)
+		return
+	}
+	if len(data) < n {
+		fmt.Fprintf(os.Stderr, "fuse: wrote too many bytes\n")
+		n = len(data)
+	}
+	req.replyWrite(uint32(n))
+}
+
+func (fs *pathfs) statfs(req *kernelReq) {
+	h, path, errc := fs.hold(req.hdr.nodeid)
+	if 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	defer fs.release(h)
+	var stat fuse_statvfs_t
+	if errc = int(hostStatfs(path, &stat)); 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	req.replyStatfs(&stat)
+}
+
+func (fs *pathfs) fsync(req *kernelReq) {
+	in, _ := kernelArg[fuse_fsync_in](req.in)
+	if nil == in {
+		req.replyErr(-EINVAL)
+		return
+	}
+	fi := struct_fuse_file_info{fh: in.fh}
+	h, path, _ := fs.holdFile(req.hdr.nodeid, true)
+	defer fs.release(h)
+	datasync := c_int(in.fsync_flags & fuse_FSYNC_FDATASYNC)
+	req.replyErr(int(hostFsync(path, datasync, &fi)))
+}
+
+func (fs *pathfs) setxattr(req *kernelReq) {
+	in, rest := kernelArg[fuse_setxattr_in](req.in)
+	if nil == in {
+		req.replyErr(-EINVAL)
+		return
+	}
+	name, value := kernelString(rest)
+	if len(value) < int(in.size) {
+		req.replyErr(-EINVAL)
+		return
+	}
+	value = value[:in.size]
+	h, path, errc := fs.hold(req.hdr.nodeid)
+	if 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	defer fs.release(h)
+	mem := &kernelZero[0]
+	if 0 < len(value) {
+		mem = &value[0]
+	}
+	req.replyErr(int(hostSetxattr(path, pathCString(name), mem, c_size_t(len(value)),
+		c_int(in.flags))))
+}
+
+// getxattr handles GETXATTR and LISTXATTR.
+func (fs *pathfs) getxattr(req *kernelReq) {
+	in, rest := kernelArg[fuse_getxattr_in](req.in)
+	if nil == in {
+		req.replyErr(-EINVAL)
+		return
+	}
+	h, path, errc := fs.hold(req.hdr.nodeid)
+	if 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	defer fs.release(h)
+	var buf []byte
+	var mem *c_char
+	if 0 < in.size {
+		buf = make([]byte, in.size)
+		mem = &buf[0]
+	}
+	var n int
+	if fuse_GETXATTR == req.hdr.opcode {
+		name, _ := kernelString(rest)
+		n = int(hostGetxattr(path, pathCString(name), mem, c_size_t(in.size)))
+	} else {
+		n = int(hostListxattr(path, mem, c_size_t(in.size)))
+	}
+	switch {
+	case 0 > n:
+		req.replyErr(n)
+	case 0 == in.size:
+		req.replyXattrSize(uint32(n))
+	case int(in.size) < n:
+		req.replyErr(-ERANGE)
+	default:
+		req.reply(0, buf[:n])
+	}
+}
+
+func (fs *pathfs) removexattr(req *kernelReq) {
+	name, _ := kernelString(req.in)
+	h, path, errc := fs.hold(req.hdr.nodeid)
+	if 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	defer fs.release(h)
+	req.replyErr(int(hostRemovexattr(path, pathCString(name))))
+}
+
+func (fs *pathfs) opendir(req *kernelReq) {
+	in, _ := kernelArg[fuse_open_in](req.in)
+	if nil == in {
+		req.replyErr(-EINVAL)
+		return
+	}
+	h, path, errc := fs.hold(req.hdr.nodeid)
+	if 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	defer fs.release(h)
+	fi := struct_fuse_file_info{flags: c_int(in.flags)}
+	if errc = int(hostOpendir(path, &fi)); 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	d := &pathdir{id: req.hdr.nodeid, fi: fi}
+	out := struct_fuse_file_info{
+		fh:            fs.dirs.New(d),
+		keep_cache:    fi.keep_cache,
+		cache_readdir: fi.cache_readdir,
+	}
+	if -ENOENT == req.replyOpen(&out) {
+		// the opendir was interrupted; nobody will close the directory
+		fs.dirs.Release(out.fh)
+		hostReleasedir(path, &fi)
+	}
+}
+
+func (fs *pathfs) readdir(req *kernelReq, plus bool) {
+	in, _ := kernelArg[fuse_read_in](req.in)
+	if nil == in {
+		req.replyErr(-EINVAL)
+		return
+	}
+	d, ok := fs.dirs.Get(in.fh)
+	if !ok {
+		req.replyErr(-EBADF)
+		return
+	}
+	d.guard.Lock()
+	defer d.guard.Unlock()
+	bufp := kernelGetBuf(int(in.size))
+	defer kernelPutBuf(bufp)
+	buf := (*bufp)[:in.size]
+	nbyt := 0
+	errc := 0
+
+	if 0 == in.offset || pathdirCache != d.mode || !d.filled {
+		// Ask the file system. If it passes an offset of 0 to fill, it returns all
+		// entries at once and we cache them; otherwise we pass its entries to the
+		// kernel until the buffer is full.
+		h, path, _ := fs.holdFile(d.id, true)
+		d.mode = pathdirUnknown
+		d.filled = false
+		d.entries = d.entries[:0]
+		fill := func(_ unsafe.Pointer, name0 *c_char, stat *c_fuse_stat_t, ofst c_fuse_off_t,
+			flags c_int) c_int {
+			if nil != stat && 0 == flags&FUSE_FILL_DIR_PLUS {
+				stat = nil
+			}
+			name := c_GoString(name0)
+			if 0 == ofst {
+				if pathdirStream == d.mode {
+					errc = -EIO
+					return 1
+				}
+				d.mode = pathdirCache
+				e := pathdirent{name: name, plus: nil != stat}
+				if nil != stat {
+					e.stat = *stat
+				}
+				d.entries = append(d.entries, e)
+				return 0
+			}
+			if pathdirCache == d.mode {
+				errc = -EIO
+				return 1
+			}
+			d.mode = pathdirStream
+			n := fs.direntry(buf[nbyt:], d.id, name, stat, int64(ofst), plus)
+			if len(buf)-nbyt < n {
+				return 1
+			}
+			nbyt += n
+			return 0
+		}
+		var flags uint32
+		if plus {
+			flags = READDIR_PLUS
+		}
+		res := int(hostReaddir(path, nil, fill, c_fuse_off_t(in.offset), &d.fi, flags))
+		fs.release(h)
+		if -EIO == errc {
+			fmt.Fprintf(os.Stderr, "fuse: readdir filler mixes zero and non-zero offsets\n")
+		} else {
+			errc = res
+		}
+		d.filled = 0 == errc && pathdirCache == d.mode
+	}
+
+	if pathdirCache == d.mode {
+		for i := int(in.offset); len(d.entries) > i; i++ {
+			e := &d.entries[i]
+			var stat *fuse_stat_t
+			if e.plus {
+				stat = &e.stat
+			}
+			n := fs.direntry(buf[nbyt:], d.id, e.name, stat, int64(i+1), plus)
+			if len(buf)-nbyt < n {
+				break
+			}
+			nbyt += n
+		}
+	}
+
+	if 0 != errc && 0 == nbyt {
+		req.replyErr(errc)
+		return
+	}
+	req.reply(0, buf[:nbyt])
+}
+
+// direntry encodes a directory entry at the start of buf and returns its size. For
+// READDIRPLUS it looks up the entry, but only if the entry fits into buf.
+func (fs *pathfs) direntry(buf []byte, dir uint64, name string, stat *fuse_stat_t,
+	ofst int64, plus bool) int {
+	if !plus {
+		ino, mode := uint64(fuse_UNKNOWN_INO), uint32(0)
+		if nil != stat {
+			mode = stat.st_mode
+			if 0 != fs.conf.use_ino {
+				ino = stat.st_ino
+			}
+		}
+		if 0 == fs.conf.use_ino && 0 != fs.conf.readdir_ino {
+			ino = fs.knownIno(dir, name, ino)
+		}
+		return kernelDirent(buf, name, ino, mode, ofst)
+	}
+
+	var e kernelEntry
+	if nil == stat || "." == name || ".." == name {
+		// the kernel only uses the name, type and inode number of this entry
+		e.attr.st_ino = fuse_UNKNOWN_INO
+		if nil != stat {
+			e.attr.st_mode = stat.st_mode
+		}
+		if 0 == fs.conf.use_ino && 0 != fs.conf.readdir_ino {
+			e.attr.st_ino = fs.knownIno(dir, name, e.attr.st_ino)
+		}
+		return kernelDirentPlus(buf, name, &e, ofst)
+	}
+	if n := kernelDirentPlus(nil, name, &e, ofst); len(buf) < n {
+		return n
+	}
+	fs.guard.Lock()
+	p := fs.nodes[dir]
+	if nil == p {
+		fs.guard.Unlock()
+		e.attr.st_ino = fuse_UNKNOWN_INO
+		e.attr.st_mode = stat.st_mode
+		return kernelDirentPlus(buf, name, &e, ofst)
+	}
+	n := fs.child(p, name)
+	fs.updateStat(n, stat)
+	fs.guard.Unlock()
+	e = kernelEntry{
+		ino:          n.id,
+		attr:         *stat,
+		attrTimeout:  float64(fs.conf.attr_timeout),
+		entryTimeout: float64(fs.conf.entry_timeout),
+	}
+	fs.fixAttr(n.id, &e.attr)
+	return kernelDirentPlus(buf, name, &e, ofst)
+}
+
+// knownIno returns the node id of the entry name of dir if the kernel knows it, or ino.
+func (fs *pathfs) knownIno(dir uint64, name string, ino uint64) uint64 {
+	fs.guard.Lock()
+	defer fs.guard.Unlock()
+	if n := fs.names[pathkey{dir, name}]; nil != n {
+		return n.id
+	}
+	return ino
+}
+
+func (fs *pathfs) releasedir(req *kernelReq) {
+	in, _ := kernelArg[fuse_release_in](req.in)
+	if nil == in {
+		req.replyErr(-EINVAL)
+		return
+	}
+	d, _, ok := fs.dirs.Release(in.fh)
+	if !ok {
+		req.replyErr(-EBADF)
+		return
+	}
+	h, path, _ := fs.holdFile(d.id, true)
+	defer fs.release(h)
+	d.guard.Lock()
+	defer d.guard.Unlock()
+	hostReleasedir(path, &d.fi)
+	req.replyErr(0)
+}
+
+func (fs *pathfs) fsyncdir(req *kernelReq) {
+	in, _ := kernelArg[fuse_fsync_in](req.in)
+	if nil == in {
+		req.replyErr(-EINVAL)
+		return
+	}
+	d, ok := fs.dirs.Get(in.fh)
+	if !ok {
+		req.replyErr(-EBADF)
+		return
+	}
+	h, path, _ := fs.holdFile(d.id, true)
+	defer fs.release(h)
+	datasync := c_int(in.fsync_flags & fuse_FSYNC_FDATASYNC)
+	req.replyErr(int(hostFsyncdir(path, datasync, &d.fi)))
+}
+
+func (fs *pathfs) lock(req *kernelReq) {
+	in, _ := kernelArg[fuse_lk_in](req.in)
+	if nil == in {
+		req.replyErr(-EINVAL)
+		return
+	}
+	fi := struct_fuse_file_info{fh: in.fh, lock_owner: in.owner}
+	h, path, _ := fs.holdFile(req.hdr.nodeid, true)
+	defer fs.release(h)
+
+	if fuse_GETLK != req.hdr.opcode && 0 != in.lk_flags&fuse_LK_FLOCK {
+		var op c_int
+		switch in.lk.typ {
+		case F_RDLCK:
+			op = LOCK_SH
+		case F_WRLCK:
+			op = LOCK_EX
+		default:
+			op = LOCK_UN
+		}
+		if fuse_SETLK == req.hdr.opcode {
+			op |= LOCK_NB
+		}
+		req.replyErr(int(hostFlock(path, &fi, op)))
+		return
+	}
+
+	lock := fuse_flock_t{
+		l_type:   c_int16_t(in.lk.typ),
+		l_whence: SEEK_SET,
+		l_start:  c_fuse_off_t(in.lk.start),
+		l_pid:    c_fuse_pid_t(in.lk.pid),
+	}
+	if 1<<63-1 != in.lk.end {
+		lock.l_len = c_fuse_off_t(in.lk.end - in.lk.start + 1)
+	}
+	cmd := c_int(F_GETLK)
+	switch req.hdr.opcode {
+	case fuse_SETLK:
+		cmd = F_SETLK
+	case fuse_SETLKW:
+		cmd = F_SETLKW
+	}
+	errc := int(hostLock(path, &fi, cmd, &lock))
+	if 0 == errc && F_GETLK == cmd {
+		req.replyLock(&lock)
+		return
+	}
+	req.replyErr(errc)
+}
+
+func (fs *pathfs) access(req *kernelReq) {
+	in, _ := kernelArg[fuse_access_in](req.in)
+	if nil == in {
+		req.replyErr(-EINVAL)
+		return
+	}
+	h, path, errc := fs.hold(req.hdr.nodeid)
+	if 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	defer fs.release(h)
+	req.replyErr(int(hostAccess(path, c_int(in.mask))))
+}
+
+func (fs *pathfs) create(req *kernelReq) {
+	in, rest := kernelArg[fuse_create_in](req.in)
+	if nil == in {
+		req.replyErr(-EINVAL)
+		return
+	}
+	name, _ := kernelString(rest)
+	req.setUmask(in.umask)
+	parent := req.hdr.nodeid
+	h, path, errc := fs.holdEntry(parent, name)
+	if 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	fi := struct_fuse_file_info{flags: c_int(in.flags)}
+	if errc = int(hostCreate(path, in.mode, &fi)); 0 != errc {
+		fs.release(h)
+		req.replyErr(errc)
+		return
+	}
+	var e kernelEntry
+	if errc = fs.entry(parent, name, path, &fi, &e); 0 != errc {
+		hostRelease(path, &fi)
+		fs.release(h)
+		req.replyErr(errc)
+		return
+	}
+	fs.opened(e.ino, path, &fi)
+	res := req.replyCreate(&e, &fi)
+	fs.release(h)
+	if -ENOENT == res {
+		// the create was interrupted; nobody will close or forget the file
+		fs.close(e.ino, &fi)
+		fs.forget(e.ino, 1)
+	}
+}
+
+func (fs *pathfs) ioctl(req *kernelReq) {
+	in, data := kernelArg[fuse_ioctl_in](req.in)
+	if nil == in || len(data) < int(in.in_size) {
+		req.replyErr(-EINVAL)
+		return
+	}
+	if 0 != in.flags&fuse_IOCTL_UNRESTRICTED {
+		req.replyErr(-ENOSYS)
+		return
+	}
+	fi := struct_fuse_file_info{fh: in.fh}
+	if 0 != in.flags&fuse_IOCTL_DIR {
+		d, ok := fs.dirs.Get(in.fh)
+		if !ok {
+			req.replyErr(-EBADF)
+			return
+		}
+		fi.fh = d.fi.fh
+	}
+	size := in.in_size
+	if size < in.out_size {
+		size = in.out_size
+	}
+	var buf []byte
+	var mem unsafe.Pointer
+	if 0 < size {
+		buf = make([]byte, size)
+		copy(buf, data[:in.in_size])
+		mem = unsafe.Pointer(&buf[0])
+	}
+	h, path, _ := fs.holdFile(req.hdr.nodeid, true)
+	defer fs.release(h)
+	errc := int(hostIoctl(path, c_unsigned(in.cmd), c_uintptr_t(in.arg), &fi,
+		c_unsigned(in.flags), mem))
+	if 0 > errc {
+		req.replyErr(errc)
+		return
+	}
+	req.replyIoctl(int32(errc), buf[:in.out_size])
+}
+
+func (fs *pathfs) poll(req *kernelReq) {
+	in, _ := kernelArg[fuse_poll_in](req.in)
+	if nil == in {
+		req.replyErr(-EINVAL)
+		return
+	}
+	fi := struct_fuse_file_info{fh: in.fh, poll_events: in.events}
+	var ph unsafe.Pointer
+	if 0 != in.flags&fuse_POLL_SCHEDULE_NOTIFY {
+		ph = unsafe.Pointer(&kernelPoll{conn: fs.conn, kh: in.kh})
+	}
+	h, path, _ := fs.holdFile(req.hdr.nodeid, true)
+	defer fs.release(h)
+	var revents c_unsigned
+	if errc := int(hostPoll(path, &fi, ph, &revents)); 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	req.replyPoll(revents)
+}
+
+func (fs *pathfs) fallocate(req *kernelReq) {
+	in, _ := kernelArg[fuse_fallocate_in](req.in)
+	if nil == in {
+		req.replyErr(-EINVAL)
+		return
+	}
+	fi := struct_fuse_file_info{fh: in.fh}
+	h, path, _ := fs.holdFile(req.hdr.nodeid, true)
+	defer fs.release(h)
+	req.replyErr(int(hostFallocate(path, c_int(in.mode),
+		c_fuse_off_t(in.offset), c_fuse_off_t(in.length), &fi)))
+}
+
+func (fs *pathfs) lseek(req *kernelReq) {
+	in, _ := kernelArg[fuse_lseek_in](req.in)
+	if nil == in {
+		req.replyErr(-EINVAL)
+		return
+	}
+	fi := struct_fuse_file_info{fh: in.fh}
+	h, path, _ := fs.holdFile(req.hdr.nodeid, true)
+	defer fs.release(h)
+	var ofst c_fuse_off_t
+	if errc := int(hostLseek(path, c_fuse_off_t(in.offset), c_int(in.whence), &fi,
+		&ofst)); 0 != errc {
+		req.replyErr(errc)
+		return
+	}
+	req.replyLseek(ofst)
+}
+
+func (fs *pathfs) copyFileRange(req *kernelReq) {
+	in, _ := kernelArg[fuse_copy_file_range_in](req.in)
+	if nil == in {
+		req.replyErr(-EINVAL)
+		return
+	}
+	fiIn := struct_fuse_file_info{fh: in.fh_in}
+	fiOut := struct_fuse_file_info{fh: in.fh_out}
+	var h *pathhold
+	var pathIn, pathOut *c_char
+	if 0 == fs.conf.nullpath_ok {
+		var errc int
+		h, errc = fs.acquire([]uint64{req.hdr.nodeid, in.nodeid_out}, nil)
+		if 0 == errc {
+			pathIn, pathOut = pathCString(h.paths[0]), pathCString(h.paths[1])
+		}
+	}
+	defer fs.release(h)
+	n := int(hostCopyFileRange(pathIn, &fiIn, c_fuse_off_t(in.off_in),
+		pathOut, &fiOut, c_fuse_off_t(in.off_out), c_size_t(in.len), c_int(in.flags)))
+	if 0 > n {
+		req.replyErr(n)
+		return
+	}
+	req.replyWrite(uint32(n))
+}
+
+// invalidatePath invalidates the attributes and data that the kernel has cached for
+// path. It returns -ENOENT if the kernel does not know path.
+func (fs *pathfs) invalidatePath(path string) int {
+	fs.guard.Lock()
+	n := fs.lookupPath(path)
+	fs.guard.Unlock()
+	if nil == n {
+		return -ENOENT
+	}
+	return fs.conn.notifyInvalInode(n.id, 0, 0)
+}
+
+// invalidateEntry invalidates the entry name of the directory dir. It returns -ENOENT
+// if the kernel does not know the entry.
+func (fs *pathfs) invalidateEntry(dir string, name string) int {
+	fs.guard.Lock()
+	n := fs.lookupPath(dir)
+	fs.guard.Unlock()
+	if nil == n {
+		return -ENOENT
+	}
+	return fs.conn.notifyInvalEntry(n.id, name)
+}
+
+// invalidateData invalidates the attributes of path and the data that the kernel has
+// cached for the range [ofst, ofst+size) of it. It returns -ENOENT if the kernel does
+// not know path.
+func (fs *pathfs) invalidateData(path string, ofst int64, size int64) int {
+	fs.guard.Lock()
+	n := fs.lookupPath(path)
+	fs.guard.Unlock()
+	if nil == n {
+		return -ENOENT
+	}
+	return fs.conn.notifyInvalInode(n.id, ofst, size)
+}